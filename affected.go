@@ -0,0 +1,214 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A listedPackage is a package as go list -json describes it.
+type listedPackage struct {
+	ImportPath   string
+	Dir          string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	Deps         []string
+	TestImports  []string
+	XTestImports []string
+	Module       *struct{ GoMod string }
+	DepOnly      bool // the package does not match the patterns listed
+}
+
+func (p *listedPackage) hasTests() bool {
+	return len(p.TestGoFiles)+len(p.XTestGoFiles) > 0
+}
+
+// AffectedPackages returns the import paths of the packages matching
+// patterns whose tests are affected by changes to the named files: those
+// with tests whose own files changed, or the files of a package they depend
+// on, directly or through their tests, or the go.mod or go.sum files of their
+// module. A file changes its package when it is in the directory of the
+// package, or in its testdata directory. Relative names are relative to dir.
+func AffectedPackages(ctx context.Context, patterns, files []string, dir string) ([]string, error) {
+	pkgs, err := listPackages(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]*listedPackage)
+	for _, p := range pkgs {
+		byPath[p.ImportPath] = p
+	}
+	// go list -deps leaves out the packages imported only by tests, and
+	// their dependencies, which are listed next.
+	var testOnly []string
+	for _, p := range pkgs {
+		for _, imp := range append(append([]string(nil), p.TestImports...), p.XTestImports...) {
+			if byPath[imp] == nil {
+				byPath[imp] = &listedPackage{ImportPath: imp, DepOnly: true}
+				testOnly = append(testOnly, imp)
+			}
+		}
+	}
+	if len(testOnly) > 0 {
+		more, err := listPackages(ctx, testOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range more {
+			if p := byPath[q.ImportPath]; p == nil || p.Dir == "" {
+				q.DepOnly = true
+				byPath[q.ImportPath] = q
+			}
+		}
+	}
+
+	changedDirs := make(map[string]bool)
+	changedMods := make(map[string]bool)
+	for _, name := range files {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, filepath.FromSlash(name))
+		}
+		switch filepath.Base(name) {
+		case "go.mod", "go.sum":
+			changedMods[filepath.Join(filepath.Dir(name), "go.mod")] = true
+		}
+		d := filepath.Dir(name)
+		for parent := d; ; parent = filepath.Dir(parent) {
+			if filepath.Base(parent) == "testdata" {
+				d = filepath.Dir(parent)
+			}
+			if filepath.Dir(parent) == parent {
+				break
+			}
+		}
+		changedDirs[d] = true
+	}
+	changed := func(path string) bool {
+		p := byPath[path]
+		return p != nil && changedDirs[p.Dir]
+	}
+
+	var affected []string
+	for _, p := range pkgs {
+		if p.DepOnly || !p.hasTests() {
+			continue
+		}
+		hit := changedDirs[p.Dir] || p.Module != nil && changedMods[p.Module.GoMod]
+		deps := append(append(append([]string(nil), p.Deps...), p.TestImports...), p.XTestImports...)
+		for _, imp := range deps[len(p.Deps):] {
+			if q := byPath[imp]; q != nil {
+				deps = append(deps, q.Deps...)
+			}
+		}
+		for _, dep := range deps {
+			if hit {
+				break
+			}
+			hit = changed(dep)
+		}
+		if hit {
+			affected = append(affected, p.ImportPath)
+		}
+	}
+	return affected, nil
+}
+
+// listPackages returns the packages matching patterns, and their
+// dependencies, as go list -deps lists them.
+func listPackages(ctx context.Context, patterns []string) ([]*listedPackage, error) {
+	args := append([]string{"list", "-e", "-deps", "-json=ImportPath,Dir,TestGoFiles,XTestGoFiles,Deps,TestImports,XTestImports,Module,DepOnly"}, patterns...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v", err)
+	}
+	var pkgs []*listedPackage
+	for dec := json.NewDecoder(bytes.NewReader(out)); dec.More(); {
+		p := new(listedPackage)
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("go list: %v", err)
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// readChangedFiles reads the names of changed files, one per line, as
+// written by git diff --name-only, from the named file, or from standard
+// input if it is "-".
+func readChangedFiles(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var files []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, s.Err()
+}
+
+// changedFilesDir returns the directory relative to which the names of
+// changed files are taken: the top of the git checkout, as they are listed
+// by git diff --name-only, or else the working directory.
+func changedFilesDir() string {
+	if top, err := git("rev-parse", "--show-toplevel"); err == nil {
+		return strings.TrimSpace(top)
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
+
+// affectedPatterns returns the packages matching patterns whose tests are
+// affected by the changed files listed in the named file.
+func affectedPatterns(ctx context.Context, name string, patterns []string) ([]string, error) {
+	files, err := readChangedFiles(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	return AffectedPackages(ctx, patterns, files, changedFilesDir())
+}
+
+// affectedMain runs gojunit affected, which lists the packages whose tests
+// are affected by changed files.
+func affectedMain(args []string) {
+	fs := flag.NewFlagSet("affected", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit affected [flags] [packages]")
+		fs.PrintDefaults()
+	}
+	list := fs.String("changed-files", "-", "file listing the changed files, one per line, relative to the top of the git checkout, as git diff --name-only lists them; - for standard input")
+	fs.Parse(args)
+	pkgs, err := affectedPatterns(context.Background(), *list, fs.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit affected:", err)
+		os.Exit(exitInfra)
+	}
+	for _, p := range pkgs {
+		fmt.Println(p)
+	}
+}
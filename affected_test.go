@@ -0,0 +1,118 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAffectedPackages(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	// b imports a, the tests of c import d, which imports a, and d and f
+	// have no tests.
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":           "module example.com/m\n\ngo 1.21\n",
+		"README.md":        "m\n",
+		"a/a.go":           "package a\n",
+		"a/a_test.go":      "package a\n",
+		"b/b.go":           "package b\n\nimport _ \"example.com/m/a\"\n",
+		"b/b_test.go":      "package b\n",
+		"c/c.go":           "package c\n",
+		"c/c_test.go":      "package c_test\n\nimport _ \"example.com/m/d\"\n",
+		"d/d.go":           "package d\n\nimport _ \"example.com/m/a\"\n",
+		"e/e.go":           "package e\n",
+		"e/e_test.go":      "package e\n",
+		"e/testdata/in/x":  "x\n",
+		"f/f.go":           "package f\n\nimport _ \"example.com/m/e\"\n",
+		"tools/gen/gen.go": "package main\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o777)
+		if err := os.WriteFile(path, []byte(data), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	t.Setenv("GO111MODULE", "on")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOPROXY", "off")
+	t.Setenv("GOWORK", "off")
+
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"package", []string{"a/a.go"}, "a b c"},
+		{"test file", []string{"a/a_test.go"}, "a b c"},
+		{"test import", []string{"d/d.go"}, "c"},
+		{"testdata", []string{"e/testdata/in/x"}, "e"},
+		{"importer without tests", []string{"f/f.go"}, ""},
+		{"go.mod", []string{"go.mod"}, "a b c e"},
+		{"go.sum", []string{"go.sum"}, "a b c e"},
+		{"outside packages", []string{"README.md", "tools/gen/gen.go", "gone/gone.go"}, ""},
+		{"absolute", []string{filepath.Join(dir, "e", "e.go")}, "e"},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AffectedPackages(context.Background(), []string{"./..."}, tt.files, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range got {
+				got[i] = strings.TrimPrefix(got[i], "example.com/m/")
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("AffectedPackages(%q) = %q, want %q", tt.files, strings.Join(got, " "), tt.want)
+			}
+		})
+	}
+	// The patterns limit the packages listed, but not the dependencies
+	// whose changes affect them.
+	for _, tt := range []struct{ pattern, want string }{
+		{"./b/...", "b"},
+		{"./c/...", "c"},
+		{"./a/...", "a"},
+		{"./d/...", ""},
+	} {
+		got, err := AffectedPackages(context.Background(), []string{tt.pattern}, []string{"a/a.go"}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range got {
+			got[i] = strings.TrimPrefix(got[i], "example.com/m/")
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("AffectedPackages(%q) in %s = %q, want %q", "a/a.go", tt.pattern, strings.Join(got, " "), tt.want)
+		}
+	}
+}
+
+func TestReadChangedFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "changed.txt")
+	if err := os.WriteFile(name, []byte("a/a.go\n\n  b/b.go  \r\ngo.mod"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	files, err := readChangedFiles(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(files, ","), "a/a.go,b/b.go,go.mod"; got != want {
+		t.Errorf("readChangedFiles = %q, want %q", got, want)
+	}
+	if _, err := readChangedFiles(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("readChangedFiles of a missing file succeeded")
+	}
+}
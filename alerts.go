@@ -0,0 +1,187 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// alertSeverities maps the severities of alert rules, those of PagerDuty
+// events, to Opsgenie priorities.
+var alertSeverities = map[string]string{
+	"critical": "P1",
+	"error":    "P2",
+	"warning":  "P3",
+	"info":     "P5",
+}
+
+// An AlertRule raises alerts of a severity when the suites matching a
+// pattern fail.
+type AlertRule struct {
+	Pattern  *regexp.Regexp // matched against the suite name, unanchored
+	Severity string         // critical, error, warning or info
+}
+
+// ReadAlertRules reads an alert rules file. Each line holds a regular
+// expression matched against suite names and a severity separated by white
+// space, as in
+//
+//	^example.com/app/integration  critical
+//	/e2e/                         error
+//
+// Blank lines and lines starting with # are ignored.
+func ReadAlertRules(path string) ([]AlertRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []AlertRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a pattern and a severity", path, n)
+		}
+		re, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if alertSeverities[fields[1]] == "" {
+			return nil, fmt.Errorf("%s:%d: unknown severity %q; want critical, error, warning or info", path, n, fields[1])
+		}
+		rules = append(rules, AlertRule{re, fields[1]})
+	}
+	return rules, s.Err()
+}
+
+// An Alert reports the failure of a suite matched by an alert rule.
+type Alert struct {
+	Suite    string
+	Severity string
+	Counts   Counts
+	Failed   []string // names of the tests that failed or had an error
+}
+
+// Summary returns a one line description of a.
+func (a *Alert) Summary() string {
+	return fmt.Sprintf("%s: %d of %d tests failed", a.Suite, a.Counts.Failures+a.Counts.Errors, a.Counts.Tests)
+}
+
+// dedupKey returns the key under which the alerts of the same suite are
+// grouped into one incident.
+func (a *Alert) dedupKey() string {
+	return "gojunit/" + a.Suite
+}
+
+// Alerts returns an alert for every failed suite matched by a rule, with the
+// severity of the first rule matching it.
+func Alerts(suites []TestSuite, rules []AlertRule) []Alert {
+	var alerts []Alert
+	for i := range suites {
+		s := &suites[i]
+		var c Counts
+		c.Add(s)
+		if c.Failures+c.Errors == 0 {
+			continue
+		}
+		for _, r := range rules {
+			if !r.Pattern.MatchString(s.Name) {
+				continue
+			}
+			a := Alert{Suite: suiteKey(s), Severity: r.Severity, Counts: c}
+			for _, t := range s.TestCases {
+				if t.Status == Failure || t.Status == Error {
+					a.Failed = append(a.Failed, t.Name)
+				}
+			}
+			alerts = append(alerts, a)
+			break
+		}
+	}
+	return alerts
+}
+
+// An alerter sends alerts to an incident management service.
+type alerter func(a *Alert) error
+
+// alertDetails returns the custom details attached to incidents.
+func alertDetails(a *Alert) map[string]interface{} {
+	d := map[string]interface{}{
+		"suite":        a.Suite,
+		"counts":       a.Counts,
+		"failed_tests": a.Failed,
+		"job":          ciJobID(),
+	}
+	if *label != "" {
+		d["label"] = *label
+	}
+	return d
+}
+
+// pagerDutyAlerter triggers events with the PagerDuty Events API v2 on the
+// service of routingKey.
+func pagerDutyAlerter(routingKey string) alerter {
+	url := envOr("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue")
+	return func(a *Alert) error {
+		source, _ := os.Hostname()
+		event := map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "trigger",
+			"dedup_key":    a.dedupKey(),
+			"client":       "gojunit",
+			"payload": map[string]interface{}{
+				"summary":        a.Summary(),
+				"source":         firstNonEmpty(source, "gojunit"),
+				"severity":       a.Severity,
+				"component":      a.Suite,
+				"class":          "test failure",
+				"custom_details": alertDetails(a),
+			},
+		}
+		return doJSON("POST", url, nil, event, nil)
+	}
+}
+
+// opsgenieAlerter creates alerts with the Opsgenie Alert API, with the
+// priority of their severity.
+func opsgenieAlerter(apiKey string) alerter {
+	url := strings.TrimSuffix(envOr("OPSGENIE_API_URL", "https://api.opsgenie.com"), "/") + "/v2/alerts"
+	return func(a *Alert) error {
+		details := map[string]string{"suite": a.Suite, "job": ciJobID(), "failed_tests": strings.Join(a.Failed, ", ")}
+		alert := map[string]interface{}{
+			"message":     truncate(a.Summary(), 130),
+			"alias":       a.dedupKey(),
+			"description": "Failed tests:\n" + strings.Join(a.Failed, "\n"),
+			"priority":    alertSeverities[a.Severity],
+			"source":      "gojunit",
+			"entity":      a.Suite,
+			"details":     details,
+		}
+		return doJSON("POST", url, http.Header{"Authorization": {"GenieKey " + apiKey}}, alert, nil)
+	}
+}
+
+// ambientAlerters returns the alerters configured in the environment, with
+// PAGERDUTY_ROUTING_KEY and OPSGENIE_API_KEY.
+func ambientAlerters() []alerter {
+	var alerters []alerter
+	if key := os.Getenv("PAGERDUTY_ROUTING_KEY"); key != "" {
+		alerters = append(alerters, pagerDutyAlerter(key))
+	}
+	if key := os.Getenv("OPSGENIE_API_KEY"); key != "" {
+		alerters = append(alerters, opsgenieAlerter(key))
+	}
+	return alerters
+}
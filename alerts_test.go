@@ -0,0 +1,155 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// alertSuites are the suites of the tests of alerts: x/app/integration
+// failed, x/app/e2e/login had an error, and x/app/unit passed.
+func alertSuites() []TestSuite {
+	return []TestSuite{
+		{Name: "x/app/integration", TestCases: []TestCase{{Name: "TestDB", Status: Failure}, {Name: "TestCache"}, {Name: "TestQueue", Status: Failure}}},
+		{Name: "x/app/e2e/login", Properties: []Property{{Name: "label", Value: "linux"}}, TestCases: []TestCase{{Name: "TestLogin", Status: Error}}},
+		{Name: "x/app/unit", TestCases: []TestCase{{Name: "TestA"}}},
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.txt")
+	rules := "# alerts\n^x/app/integration  critical\n\n/e2e/  error\nx/app  info\n"
+	if err := os.WriteFile(path, []byte(rules), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadAlertRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range Alerts(alertSuites(), r) {
+		got = append(got, a.Severity+" "+a.Summary()+" "+strings.Join(a.Failed, ","))
+	}
+	// A suite takes the severity of the first rule matching it, and passed
+	// suites raise no alert.
+	want := []string{
+		"critical x/app/integration: 2 of 3 tests failed TestDB,TestQueue",
+		"error x/app/e2e/login [linux]: 1 of 1 tests failed TestLogin",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestReadAlertRulesErrors(t *testing.T) {
+	tests := []struct{ rules, want string }{
+		{"^x/app\n", "alerts.txt:1: want a pattern and a severity"},
+		{"# c\n^x/app critical extra\n", "alerts.txt:2: want a pattern and a severity"},
+		{"x(  critical\n", "alerts.txt:1: error parsing regexp"},
+		{"x  fatal\n", `alerts.txt:1: unknown severity "fatal"`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "alerts.txt")
+		if err := os.WriteFile(path, []byte(tt.rules), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadAlertRules(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ReadAlertRules(%q) error %v, want %q", tt.rules, err, tt.want)
+		}
+	}
+}
+
+func TestPagerDutyAlerter(t *testing.T) {
+	defer func(v string) { *label = v }(*label)
+	*label = "linux"
+	t.Setenv("GITHUB_RUN_ID", "42")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "2")
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		return 202, `{"status":"success","dedup_key":"gojunit/x/app/integration"}`
+	})
+	t.Setenv("PAGERDUTY_EVENTS_URL", api.URL+"/v2/enqueue")
+	a := Alert{Suite: "x/app/integration", Severity: "critical", Counts: Counts{Tests: 3, Failures: 2}, Failed: []string{"TestDB", "TestQueue"}}
+	if err := pagerDutyAlerter("routing-key")(&a); err != nil {
+		t.Fatal(err)
+	}
+	reqs := api.received()
+	if len(reqs) != 1 || reqs[0].Method != "POST" || reqs[0].Path != "/v2/enqueue" {
+		t.Fatalf("requests %+v, want a POST to /v2/enqueue", reqs)
+	}
+	if ct := reqs[0].Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q, want application/json", ct)
+	}
+	var event struct {
+		RoutingKey  string `json:"routing_key"`
+		EventAction string `json:"event_action"`
+		DedupKey    string `json:"dedup_key"`
+		Payload     struct {
+			Summary, Severity, Component string
+			Details                      struct {
+				Suite       string
+				FailedTests []string `json:"failed_tests"`
+				Job, Label  string
+				Counts      Counts
+			} `json:"custom_details"`
+		}
+	}
+	reqs[0].decode(t, &event)
+	if event.RoutingKey != "routing-key" || event.EventAction != "trigger" || event.DedupKey != "gojunit/x/app/integration" {
+		t.Errorf("event %+v, want a trigger of gojunit/x/app/integration with routing-key", event)
+	}
+	p := event.Payload
+	if p.Summary != "x/app/integration: 2 of 3 tests failed" || p.Severity != "critical" || p.Component != "x/app/integration" {
+		t.Errorf("payload %+v", p)
+	}
+	d := p.Details
+	if d.Suite != "x/app/integration" || strings.Join(d.FailedTests, ",") != "TestDB,TestQueue" || d.Job != "42-2" || d.Label != "linux" || d.Counts != a.Counts {
+		t.Errorf("custom details %+v", d)
+	}
+}
+
+func TestOpsgenieAlerter(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		if r.Header.Get("Authorization") != "GenieKey api-key" {
+			return 401, `{"message":"Key format is not valid!"}`
+		}
+		return 202, `{"result":"Request will be processed"}`
+	})
+	t.Setenv("OPSGENIE_API_URL", api.URL+"/")
+	long := strings.Repeat("x", 200)
+	a := Alert{Suite: long, Severity: "error", Counts: Counts{Tests: 1, Errors: 1}, Failed: []string{"TestLogin"}}
+	if err := opsgenieAlerter("api-key")(&a); err != nil {
+		t.Fatal(err)
+	}
+	reqs := api.received()
+	if len(reqs) != 1 || reqs[0].Method != "POST" || reqs[0].Path != "/v2/alerts" {
+		t.Fatalf("requests %+v, want a POST to /v2/alerts", reqs)
+	}
+	var alert struct {
+		Message, Alias, Description, Priority, Entity string
+		Details                                       map[string]string
+	}
+	reqs[0].decode(t, &alert)
+	// Opsgenie rejects messages longer than 130 characters.
+	if n := len([]rune(alert.Message)); n > 130 {
+		t.Errorf("message of %d characters, want at most 130", n)
+	}
+	if alert.Alias != "gojunit/"+long || alert.Priority != "P2" || alert.Entity != long || alert.Description != "Failed tests:\nTestLogin" {
+		t.Errorf("alert %+v", alert)
+	}
+	if alert.Details["failed_tests"] != "TestLogin" {
+		t.Errorf("details %v", alert.Details)
+	}
+
+	// Errors of the API are reported with its message.
+	err := opsgenieAlerter("wrong")(&a)
+	if err == nil || !isStatus(err, 401) || !strings.Contains(err.Error(), "Key format is not valid!") {
+		t.Errorf("error %v, want 401 with the message of the API", err)
+	}
+}
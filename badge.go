@@ -0,0 +1,108 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// badgeColors are the colors of the values of badges, as those of
+// shields.io.
+const (
+	badgeGreen  = "#4c1"
+	badgeYellow = "#dfb317"
+	badgeRed    = "#e05d44"
+	badgeGrey   = "#9f9f9f"
+)
+
+// WriteBadge writes an SVG badge, in the style of shields.io, of the results
+// of suites: the number of tests that passed and failed, and, if any suite
+// has the coverage property, set from the output of go test -cover, the
+// mean coverage of those suites.
+func WriteBadge(suites []TestSuite, w io.Writer) error {
+	var c Counts
+	var coverage float64
+	var covered int
+	for i := range suites {
+		c.Add(&suites[i])
+		if pct, err := strconv.ParseFloat(suites[i].Property("coverage"), 64); err == nil {
+			coverage += pct
+			covered++
+		}
+	}
+	failed := c.Failures + c.Errors
+	value := fmt.Sprintf("%d passed", c.Tests-failed-c.Skipped)
+	color := badgeGreen
+	switch {
+	case failed > 0:
+		value += fmt.Sprintf(", %d failed", failed)
+		color = badgeRed
+	case c.Tests == 0:
+		value, color = "no tests", badgeGrey
+	}
+	if c.Skipped > 0 {
+		value += fmt.Sprintf(", %d skipped", c.Skipped)
+	}
+	parts := [][3]string{{"tests", value, color}}
+	if covered > 0 {
+		pct := coverage / float64(covered)
+		color := badgeRed
+		switch {
+		case pct >= 80:
+			color = badgeGreen
+		case pct >= 60:
+			color = badgeYellow
+		}
+		parts = append(parts, [3]string{"coverage", fmt.Sprintf("%.1f%%", pct), color})
+	}
+
+	// Text is 11px Verdana, whose characters are about 7px wide on average.
+	width := func(s string) int { return 7*len(s) + 10 }
+	total := 0
+	for _, p := range parts {
+		total += width(p[0]) + width(p[1])
+	}
+	var title strings.Builder
+	for i, p := range parts {
+		if i > 0 {
+			title.WriteString(", ")
+		}
+		title.WriteString(p[0] + ": " + p[1])
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s">`+"\n", total, html.EscapeString(title.String()))
+	fmt.Fprintf(bw, "<title>%s</title>\n", html.EscapeString(title.String()))
+	bw.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` + "\n")
+	fmt.Fprintf(bw, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+"\n", total)
+	bw.WriteString(`<g clip-path="url(#r)">` + "\n")
+	x := 0
+	for _, p := range parts {
+		lw, vw := width(p[0]), width(p[1])
+		fmt.Fprintf(bw, `<rect x="%d" width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/>`+"\n", x, lw, x+lw, vw, p[2])
+		x += lw + vw
+	}
+	fmt.Fprintf(bw, `<rect width="%d" height="20" fill="url(#s)"/>`+"\n", total)
+	bw.WriteString("</g>\n")
+	bw.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` + "\n")
+	// Each text is drawn over its shadow.
+	text := func(x int, s string) {
+		s = html.EscapeString(s)
+		fmt.Fprintf(bw, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+"\n", x, s, x, s)
+	}
+	x = 0
+	for _, p := range parts {
+		lw, vw := width(p[0]), width(p[1])
+		text(x+lw/2, p[0])
+		text(x+lw+vw/2, p[1])
+		x += lw + vw
+	}
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
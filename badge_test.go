@@ -0,0 +1,130 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const failedBadge = `<svg xmlns="http://www.w3.org/2000/svg" width="181" height="20" role="img" aria-label="tests: 1 passed, 1 failed">
+<title>tests: 1 passed, 1 failed</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="181" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect x="0" width="45" height="20" fill="#555"/><rect x="45" width="136" height="20" fill="#e05d44"/>
+<rect width="181" height="20" fill="url(#s)"/>
+</g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="22" y="15" fill="#010101" fill-opacity=".3">tests</text><text x="22" y="14">tests</text>
+<text x="113" y="15" fill="#010101" fill-opacity=".3">1 passed, 1 failed</text><text x="113" y="14">1 passed, 1 failed</text>
+</g>
+</svg>
+`
+
+// badgeOf returns the title of the badge of suites and the colors of its
+// values, rather than of its labels, clip or gradient, checking that it is well-formed XML.
+func badgeOf(t *testing.T, suites []TestSuite) (title string, colors []string) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := WriteBadge(suites, &b); err != nil {
+		t.Fatal(err)
+	}
+	for d := xml.NewDecoder(&b); ; {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("badge is not well-formed: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "title" {
+				d.DecodeElement(&title, &tok)
+			}
+			for _, a := range tok.Attr {
+				if tok.Name.Local == "rect" && a.Name.Local == "fill" && !strings.Contains("#555 #fff url(#s)", a.Value) {
+					colors = append(colors, a.Value)
+				}
+			}
+		}
+	}
+	return title, colors
+}
+
+func TestWriteBadge(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteBadge([]TestSuite{{Name: "x", TestCases: []TestCase{{Name: "A"}, {Name: "B", Status: Failure}}}}, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != failedBadge {
+		t.Errorf("badge\n%s\nwant\n%s", b.String(), failedBadge)
+	}
+
+	coverage := func(pct string, tests ...TestCase) TestSuite {
+		s := TestSuite{Name: "x/" + pct, TestCases: tests}
+		if pct != "" {
+			s.Properties = []Property{{Name: "coverage", Value: pct}}
+		}
+		return s
+	}
+	tests := []struct {
+		name   string
+		suites []TestSuite
+		title  string
+		colors string
+	}{
+		{"passed", []TestSuite{coverage("", TestCase{Name: "A"}, TestCase{Name: "B"})}, "tests: 2 passed", badgeGreen},
+		{"failed", []TestSuite{coverage("", TestCase{Name: "A", Status: Error}, TestCase{Name: "B", Status: Failure})}, "tests: 0 passed, 2 failed", badgeRed},
+		{"skipped", []TestSuite{coverage("", TestCase{Name: "A"}, TestCase{Name: "B", Status: Skipped})}, "tests: 1 passed, 1 skipped", badgeGreen},
+		{"no tests", nil, "tests: no tests", badgeGrey},
+		{"all skipped", []TestSuite{coverage("", TestCase{Name: "A", Status: Skipped})}, "tests: 0 passed, 1 skipped", badgeGreen},
+		// The coverage is the mean of that of the suites reporting it.
+		{
+			"coverage",
+			[]TestSuite{coverage("90.0", TestCase{Name: "A"}), coverage("70.0", TestCase{Name: "B"}), coverage("", TestCase{Name: "C"})},
+			"tests: 3 passed, coverage: 80.0%",
+			badgeGreen + " " + badgeGreen,
+		},
+		{"medium coverage", []TestSuite{coverage("60.0", TestCase{Name: "A"})}, "tests: 1 passed, coverage: 60.0%", badgeGreen + " " + badgeYellow},
+		{"low coverage", []TestSuite{coverage("59.9", TestCase{Name: "A"})}, "tests: 1 passed, coverage: 59.9%", badgeGreen + " " + badgeRed},
+		{"bad coverage", []TestSuite{coverage("n/a", TestCase{Name: "A"})}, "tests: 1 passed", badgeGreen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, colors := badgeOf(t, tt.suites)
+			if title != tt.title || strings.Join(colors, " ") != tt.colors {
+				t.Errorf("badge %q in %s, want %q in %s", title, strings.Join(colors, " "), tt.title, tt.colors)
+			}
+		})
+	}
+}
+
+func TestBadgeFlag(t *testing.T) {
+	log := "=== RUN   TestA\n--- PASS: TestA (0.00s)\nPASS\ncoverage: 75.0% of statements\nok  \tx/m\t0.01s\tcoverage: 75.0% of statements\n"
+	name := filepath.Join(t.TempDir(), "badge.svg")
+	if _, code := gojunitMain(t, log, "-badge", name); code != exitOK {
+		t.Fatalf("exit code %d, want %d", code, exitOK)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<title>tests: 1 passed, coverage: 75.0%</title>"; !bytes.Contains(b, []byte(want)) {
+		t.Errorf("badge\n%s\nwant %s", b, want)
+	}
+	// A dry run writes no badge.
+	name = filepath.Join(t.TempDir(), "badge.svg")
+	gojunitMain(t, log, "-badge", name, "-dry-run")
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote %s: %v", name, err)
+	}
+}
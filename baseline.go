@@ -0,0 +1,86 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// notInRun is the message of tests reported missing by -baseline.
+const notInRun = "present in the baseline but missing from this run"
+
+// MissingTests returns the tests in baseline that do not appear in suites,
+// grouped in suites named after the baseline suites holding them. Tests are
+// matched by suite name, label and test name. The test cases gojunit adds for packages
+// that failed to build are not required.
+func MissingTests(suites, baseline []TestSuite) []TestSuite {
+	seen := make(map[[2]string]bool)
+	for i, s := range suites {
+		for _, t := range s.TestCases {
+			seen[[2]string{suiteKey(&suites[i]), t.Name}] = true
+		}
+	}
+	var missing []TestSuite
+	for i, s := range baseline {
+		m := TestSuite{Name: s.Name}
+		if l := s.Property("label"); l != "" {
+			m.SetProperty("label", l)
+		}
+		key := suiteKey(&baseline[i])
+		for _, t := range s.TestCases {
+			if junit.IsSuiteError(t.Name) || seen[[2]string{key, t.Name}] {
+				continue
+			}
+			m.TestCases = append(m.TestCases, TestCase{Name: t.Name, Classname: t.Classname})
+		}
+		if len(m.TestCases) > 0 {
+			missing = append(missing, m)
+		}
+	}
+	return missing
+}
+
+// addMissing adds the tests in missing to suites as errors.
+func addMissing(suites, missing []TestSuite) []TestSuite {
+	index := make(map[string]int)
+	for i := range suites {
+		index[suiteKey(&suites[i])] = i
+	}
+	for _, m := range missing {
+		key := suiteKey(&m)
+		i, ok := index[key]
+		if !ok {
+			i = len(suites)
+			index[key] = i
+			suites = append(suites, TestSuite{Name: m.Name, Properties: m.Properties})
+		}
+		for _, t := range m.TestCases {
+			t.Status = Error
+			t.Message = notInRun
+			suites[i].TestCases = append(suites[i].TestCases, t)
+		}
+	}
+	return suites
+}
+
+// readReport reads the results in the named file, detecting its format.
+func readReport(path string) ([]TestSuite, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(junit.NewTextReader(f))
+	parse, _ := junit.LookupFormat(sniffFormat(r))
+	suites, _, err := junit.Collect(parse, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return suites, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// Bazel runs test binaries directly, so their logs have no package result
+// line. Each log is reported as one suite named after its target.
+
+// bazelOutputRE matches the line introducing the log of a target in the
+// output of bazel test --test_output=all or =errors.
+var bazelOutputRE = regexp.MustCompile(`^=+ Test output for (//\S*?):?$`)
+
+// bazelShardRE matches the directories bazel-testlogs uses for shards and
+// runs of a target.
+var bazelShardRE = regexp.MustCompile(`^(shard|run)_\d+_of_\d+$`)
+
+// streamBazel parses the log of a Bazel go_test target, as found in its
+// test.log file, or the output of bazel test holding the logs of several
+// targets.
+func streamBazel(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	return bazelLog("", r, emit)
+}
+
+// bazelLog parses a Bazel test log whose suites are named label unless the
+// log names the target itself.
+func bazelLog(label string, r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	p := junit.NewParser(emit)
+	inHeader, inSection := false, false
+	end := func() {
+		if s := p.Suite(); len(s.TestCases) > 0 {
+			p.EndSuite(label, junit.TestsDuration(s))
+		}
+		p.Reset()
+	}
+	err := junit.ReadLines(r, func(line string) {
+		switch {
+		case strings.HasPrefix(line, "exec ${PAGER"):
+		case strings.HasPrefix(line, "Executing tests from //"):
+			end()
+			label = strings.TrimPrefix(line, "Executing tests from ")
+			inHeader = true
+		case inHeader && len(line) > 10 && strings.Trim(line, "-") == "":
+			inHeader = false
+		case bazelOutputRE.MatchString(line):
+			end()
+			label = bazelOutputRE.FindStringSubmatch(line)[1]
+			inSection = true
+		case inSection && len(line) > 20 && strings.Trim(line, "=") == "":
+			end()
+			inSection = false
+		default:
+			p.Line(line)
+		}
+	})
+	end()
+	return p.Finish(), err
+}
+
+// bazelLabel returns the label of the target whose logs are in dir, relative
+// to the bazel-testlogs directory.
+func bazelLabel(rel string) string {
+	dir, target := filepath.Split(filepath.ToSlash(rel))
+	for bazelShardRE.MatchString(target) && dir != "" {
+		dir, target = filepath.Split(strings.TrimSuffix(dir, "/"))
+	}
+	return "//" + strings.TrimSuffix(dir, "/") + ":" + target
+}
+
+// addBazelTestlogs starts parsing with c the logs of all targets in a Bazel
+// bazel-testlogs directory. The test.xml file of a target is used if it has
+// one, and its test.log otherwise. The suites of sharded targets record
+// their shard in the "shard" property.
+func addBazelTestlogs(c *Collector, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == "test_attempts" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		label := bazelLabel(rel)
+		var shard string
+		if bazelShardRE.MatchString(info.Name()) {
+			shard = info.Name()
+		}
+		tag := func(emit func(TestSuite)) func(TestSuite) {
+			return func(s TestSuite) {
+				s.Name = label
+				if shard != "" {
+					s.SetProperty("shard", shard)
+				}
+				emit(s)
+			}
+		}
+		open := func(name string) func() (io.ReadCloser, error) {
+			return func() (io.ReadCloser, error) { return os.Open(filepath.Join(path, name)) }
+		}
+		if _, err := os.Stat(filepath.Join(path, "test.xml")); err == nil {
+			return c.AddStream(path, func(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+				return streamXML(r, tag(emit))
+			}, open("test.xml"))
+		}
+		if _, err := os.Stat(filepath.Join(path, "test.log")); err == nil {
+			return c.AddStream(path, func(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+				return bazelLog(label, r, tag(emit))
+			}, open("test.log"))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// bazelTestLog is the test.log of a go_test target in bazel-testlogs.
+const bazelTestLog = `exec ${PAGER:-/usr/bin/less} "$0" || exit 1
+Executing tests from //books:books_test
+-----------------------------------------------------------------------------
+=== RUN   TestTitle
+--- PASS: TestTitle (0.00s)
+=== RUN   TestPages
+    pages_test.go:9: got 12, want 10
+--- FAIL: TestPages (0.01s)
+FAIL
+`
+
+func TestParseBazel(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"test.log", bazelTestLog, "//books:books_test: TestTitle:success TestPages:failure"},
+		{
+			"bazel test output",
+			"INFO: Analyzed 2 targets (0 packages loaded, 0 targets configured).\n" +
+				"INFO: Found 2 test targets...\n" +
+				"==================== Test output for //books:books_test:\n" +
+				"=== RUN   TestTitle\n--- PASS: TestTitle (0.00s)\nPASS\n" +
+				"================================================================================\n" +
+				"==================== Test output for //pages:pages_test:\n" +
+				"=== RUN   TestCount\n    count_test.go:9: got 2\n--- FAIL: TestCount (0.00s)\nFAIL\n" +
+				"================================================================================\n" +
+				"//books:books_test                                              PASSED in 0.1s\n" +
+				"//pages:pages_test                                              FAILED in 0.1s\n",
+			"//books:books_test: TestTitle:success\n//pages:pages_test: TestCount:failure",
+		},
+		{
+			// The output of a target killed by its timeout ends in the
+			// middle of a test.
+			"truncated",
+			"==================== Test output for //books:books_test:\n=== RUN   TestTitle\n--- PASS: TestTitle (0.00s)\n=== RUN   TestSlow\n",
+			"//books:books_test: TestTitle:success TestSlow:error",
+		},
+		{
+			// A section whose closing line is missing ends at the next one.
+			"unclosed section",
+			"==================== Test output for //a:a_test:\n=== RUN   TestA\n--- PASS: TestA (0.00s)\n" +
+				"==================== Test output for //b:b_test:\n=== RUN   TestB\n--- PASS: TestB (0.00s)\nPASS\n" +
+				"================================================================================\n",
+			"//a:a_test: TestA:success\n//b:b_test: TestB:success",
+		},
+		{"no tests", "INFO: Build completed successfully, 1 total action\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := junit.Collect(streamBazel, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := casesOf(suites); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBazelLabel(t *testing.T) {
+	tests := []struct{ rel, want string }{
+		{"books/books_test", "//books:books_test"},
+		{"a/b/c_test", "//a/b:c_test"},
+		{"books/books_test/shard_1_of_4", "//books:books_test"},
+		{"books/books_test/run_2_of_3/shard_1_of_2", "//books:books_test"},
+		{"books_test", "//:books_test"},
+	}
+	for _, tt := range tests {
+		if got := bazelLabel(tt.rel); got != tt.want {
+			t.Errorf("bazelLabel(%q) = %q, want %q", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestBazelTestlogs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"books/books_test/test.log":                         bazelTestLog,
+		"pages/pages_test/shard_1_of_2/test.log":            "=== RUN   TestA\n--- PASS: TestA (0.00s)\nPASS\n",
+		"pages/pages_test/shard_2_of_2/test.log":            "=== RUN   TestB\n--- SKIP: TestB (0.00s)\nPASS\n",
+		"pages/pages_test/shard_2_of_2/test_attempts/1.log": "=== RUN   TestB\n--- FAIL: TestB (0.00s)\nFAIL\n",
+		"xml/xml_test/test.xml":                             `<testsuites><testsuite name="xml_test" tests="1"><testcase name="TestX" classname="xml_test"></testcase></testsuite></testsuites>`,
+		"xml/xml_test/test.log":                             "=== RUN   TestIgnored\n--- PASS: TestIgnored (0.00s)\nPASS\n",
+		"empty/empty_test/test.outputs/outputs.zip":         "",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var c Collector
+	if err := addBazelTestlogs(&c, dir); err != nil {
+		t.Fatal(err)
+	}
+	suites, _, err := c.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := range suites {
+		s := &suites[i]
+		line := casesOf(suites[i : i+1])
+		if shard := s.Property("shard"); shard != "" {
+			line += " (" + shard + ")"
+		}
+		got = append(got, line)
+	}
+	want := "//books:books_test: TestTitle:success TestPages:failure\n" +
+		"//pages:pages_test: TestA:success (shard_1_of_2)\n" +
+		"//pages:pages_test: TestB:skipped (shard_2_of_2)\n" +
+		"//xml:xml_test: TestX:success"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+}
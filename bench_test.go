@@ -0,0 +1,247 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// The benchmarks of the parsers and of the JUnit writer run over synthetic
+// logs, whose size is set by flags given to the test binary, as in
+//
+//	go test -run '^$' -bench Parse -benchmem -args -lines 5000000
+var (
+	benchLines = flag.Int("lines", 1000000, "number of lines of each synthetic log of the benchmarks")
+	benchDepth = flag.Int("depth", 8, "nesting depth of the subtests of the subtests log of the benchmarks")
+)
+
+// logs holds the synthetic inputs of the benchmarks.
+type logs struct {
+	flat, subtests, json []byte
+	// output and outputJSON are of tests that each print many lines, whose
+	// output the parsers append to the Log of the test as it is read.
+	output, outputJSON []byte
+}
+
+var (
+	benchLogsOnce sync.Once
+	benchLogs     *logs
+)
+
+// syntheticLogs returns the inputs of the benchmarks, which are made once.
+func syntheticLogs() *logs {
+	benchLogsOnce.Do(func() {
+		benchLogs = &logs{
+			flat:     flatLog(*benchLines),
+			subtests: subtestLog(*benchLines, *benchDepth),
+		}
+		benchLogs.json = jsonLog(benchLogs.flat)
+		benchLogs.output = outputLog(*benchLines)
+		benchLogs.outputJSON = jsonLog(benchLogs.output)
+	})
+	return benchLogs
+}
+
+func BenchmarkParseOutput(b *testing.B) {
+	benchParse(b, junit.ParseOutput, syntheticLogs().flat)
+}
+
+func BenchmarkParseBytes(b *testing.B) {
+	log := syntheticLogs().flat
+	b.ReportAllocs()
+	b.SetBytes(int64(len(log)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		junit.ParseBytes(log)
+	}
+}
+
+func BenchmarkParseOutputSubtests(b *testing.B) {
+	benchParse(b, junit.ParseOutput, syntheticLogs().subtests)
+}
+
+func BenchmarkParseJSON(b *testing.B) {
+	benchParse(b, junit.ParseJSON, syntheticLogs().json)
+}
+
+func BenchmarkParseOutputLargeOutput(b *testing.B) {
+	benchParse(b, junit.ParseOutput, syntheticLogs().output)
+}
+
+func BenchmarkParseJSONLargeOutput(b *testing.B) {
+	benchParse(b, junit.ParseJSON, syntheticLogs().outputJSON)
+}
+
+func BenchmarkWriteXML(b *testing.B) {
+	log := syntheticLogs().flat
+	suites, _, err := junit.ParseOutput(bytes.NewReader(log))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(log)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteXML(suites, io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchParse(b *testing.B, parse func(io.Reader) ([]TestSuite, []ParseWarning, error), log []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(log)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := parse(bytes.NewReader(log)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// flatLog returns about n lines of go test -v output of packages of top-level
+// tests, passing and failing, that log a few lines each.
+func flatLog(n int) []byte {
+	var buf bytes.Buffer
+	lines := 0
+	for pkg := 0; lines < n; pkg++ {
+		failed := false
+		for i := 0; i < 1000 && lines < n; i++ {
+			fmt.Fprintf(&buf, "=== RUN   TestCase%d\n", i)
+			for j := 0; j < 5; j++ {
+				fmt.Fprintf(&buf, "    case_test.go:%d: step %d of test %d in package %d\n", 10+j, j, i, pkg)
+			}
+			if i%50 == 0 {
+				failed = true
+				fmt.Fprintf(&buf, "    case_test.go:20: expected 1, got 2\n--- FAIL: TestCase%d (0.01s)\n", i)
+				lines++
+			} else {
+				fmt.Fprintf(&buf, "--- PASS: TestCase%d (0.00s)\n", i)
+			}
+			lines += 7
+		}
+		endPackage(&buf, pkg, failed)
+		lines += 2
+	}
+	return buf.Bytes()
+}
+
+// outputLog returns about n lines of go test -v output of packages of a few
+// tests that each print thousands of lines, half of them failing.
+func outputLog(n int) []byte {
+	var buf bytes.Buffer
+	lines := 0
+	for pkg := 0; lines < n; pkg++ {
+		for i := 0; i < 10 && lines < n; i++ {
+			fmt.Fprintf(&buf, "=== RUN   TestVerbose%d\n", i)
+			for j := 0; j < 5000; j++ {
+				fmt.Fprintf(&buf, "    verbose_test.go:%d: request %d of test %d in package %d: status 200, 1532 bytes\n", 10+j%100, j, i, pkg)
+			}
+			if i%2 == 0 {
+				fmt.Fprintf(&buf, "--- FAIL: TestVerbose%d (1.00s)\n", i)
+			} else {
+				fmt.Fprintf(&buf, "--- PASS: TestVerbose%d (1.00s)\n", i)
+			}
+			lines += 5002
+		}
+		endPackage(&buf, pkg, true)
+		lines += 2
+	}
+	return buf.Bytes()
+}
+
+// subtestLog returns about n lines of go test -v output of tests that run
+// subtests nested depth levels deep, with the indented result lines go test
+// prints for them.
+func subtestLog(n, depth int) []byte {
+	var buf bytes.Buffer
+	lines := 0
+	for pkg := 0; lines < n; pkg++ {
+		for i := 0; i < 100 && lines < n; i++ {
+			name := fmt.Sprintf("TestDeep%d", i)
+			names := []string{name}
+			for d := 1; d <= depth; d++ {
+				name += fmt.Sprintf("/level_%d", d)
+				names = append(names, name)
+			}
+			for _, name := range names {
+				fmt.Fprintf(&buf, "=== RUN   %s\n", name)
+			}
+			fmt.Fprintf(&buf, "    deep_test.go:42: reached depth %d\n", depth)
+			for d := depth; d >= 0; d-- {
+				fmt.Fprintf(&buf, "%s--- PASS: %s (0.00s)\n", strings.Repeat("    ", d), names[d])
+			}
+			lines += 2*len(names) + 1
+		}
+		endPackage(&buf, pkg, false)
+		lines += 2
+	}
+	return buf.Bytes()
+}
+
+func endPackage(w io.Writer, pkg int, failed bool) {
+	if failed {
+		fmt.Fprintf(w, "FAIL\nFAIL\texample.com/pkg%d\t1.234s\n", pkg)
+	} else {
+		fmt.Fprintf(w, "PASS\nok  \texample.com/pkg%d\t1.234s\n", pkg)
+	}
+}
+
+// jsonLog converts a log returned by flatLog to the events go test -json
+// prints for it.
+func jsonLog(text []byte) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	event := func(action, pkg, test, output string) {
+		enc.Encode(struct {
+			Action  string
+			Package string
+			Test    string `json:",omitempty"`
+			Output  string `json:",omitempty"`
+		}{action, pkg, test, output})
+	}
+	// The package of each line is only known at its end.
+	var pending []string
+	for _, line := range strings.SplitAfter(string(text), "\n") {
+		if line == "" {
+			continue
+		}
+		pending = append(pending, line)
+		fields := strings.Fields(line)
+		if len(fields) < 3 || (fields[0] != "ok" && fields[0] != "FAIL") {
+			continue
+		}
+		pkg, test := fields[1], ""
+		for _, l := range pending {
+			f := strings.Fields(l)
+			switch {
+			case strings.HasPrefix(l, "=== RUN"):
+				test = f[2]
+				event("run", pkg, test, "")
+				event("output", pkg, test, l)
+			case strings.HasPrefix(l, "--- "):
+				event("output", pkg, test, l)
+				event(strings.ToLower(strings.TrimSuffix(f[1], ":")), pkg, test, "")
+				test = ""
+			case l == line:
+				event("output", pkg, "", l)
+				event(map[string]string{"ok": "pass", "FAIL": "fail"}[f[0]], pkg, "", "")
+			default:
+				event("output", pkg, test, l)
+			}
+		}
+		pending = pending[:0]
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,403 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// A benchMetric is a unit of the results of benchmarks compared by gojunit
+// benchdiff.
+type benchMetric struct {
+	unit         string
+	higherBetter bool
+	value        func(r *BenchmarkResult) (float64, bool)
+}
+
+var benchMetrics = []benchMetric{
+	{"ns/op", false, func(r *BenchmarkResult) (float64, bool) { return r.NsPerOp, true }},
+	{"MB/s", true, func(r *BenchmarkResult) (float64, bool) {
+		if r.MBPerS == nil {
+			return 0, false
+		}
+		return *r.MBPerS, true
+	}},
+	{"B/op", false, func(r *BenchmarkResult) (float64, bool) {
+		if r.BytesPerOp == nil {
+			return 0, false
+		}
+		return float64(*r.BytesPerOp), true
+	}},
+	{"allocs/op", false, func(r *BenchmarkResult) (float64, bool) {
+		if r.AllocsPerOp == nil {
+			return 0, false
+		}
+		return float64(*r.AllocsPerOp), true
+	}},
+}
+
+// benchKey identifies a benchmark across files of results.
+type benchKey struct {
+	pkg, name string
+}
+
+// benchSamples holds the results of the runs of the benchmarks of a file, as
+// with go test -count, in the order they were first seen.
+type benchSamples struct {
+	order   []benchKey
+	results map[benchKey][]BenchmarkResult
+}
+
+// readBenchSamples reads the benchmark results in the output of go test
+// -bench, or of go test -bench -json.
+func readBenchSamples(r io.Reader) (*benchSamples, error) {
+	bs := &benchSamples{results: make(map[benchKey][]BenchmarkResult)}
+	var pkg string
+	// The output in events of go test -json can hold part of a line, as
+	// the name of a benchmark printed before its result.
+	var partial string
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "{") {
+			var e TestEvent
+			if json.Unmarshal([]byte(line), &e) != nil || e.Action != "output" {
+				continue
+			}
+			pkg = e.Package
+			if partial += e.Output; !strings.HasSuffix(partial, "\n") {
+				continue
+			}
+			line, partial = strings.TrimRight(partial, "\n"), ""
+		}
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = strings.TrimSpace(strings.TrimPrefix(line, "pkg: "))
+			continue
+		}
+		bs.add(pkg, line)
+	}
+	return bs, s.Err()
+}
+
+// add adds the result of a benchmark of pkg if line is one.
+func (bs *benchSamples) add(pkg, line string) {
+	name, res, ok := junit.ParseBenchmark(line)
+	if !ok {
+		return
+	}
+	k := benchKey{pkg, strings.TrimPrefix(name, "Benchmark")}
+	if bs.results[k] == nil {
+		bs.order = append(bs.order, k)
+	}
+	bs.results[k] = append(bs.results[k], res)
+}
+
+func readBenchFile(path string) (*benchSamples, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBenchSamples(f)
+}
+
+// A benchDelta compares a metric of a benchmark between two files of
+// results.
+type benchDelta struct {
+	key      benchKey
+	metric   *benchMetric
+	old, new []float64
+	p        float64 // of the Mann-Whitney U test
+	change   float64 // of the median, as a fraction of the old one
+}
+
+// significant reports whether the change of d is significant at alpha. An
+// alpha of 1 takes every change as significant.
+func (d *benchDelta) significant(alpha float64) bool {
+	return alpha >= 1 || d.p < alpha
+}
+
+// regression returns how much worse the new results of d are, as a fraction
+// of the old ones, or 0 if they are not worse.
+func (d *benchDelta) regression() float64 {
+	if d.metric.higherBetter {
+		return math.Max(0, -d.change)
+	}
+	return math.Max(0, d.change)
+}
+
+// compareBenchmarks returns the deltas of the metrics of the benchmarks in
+// both old and new, by package and metric, in the order of new.
+func compareBenchmarks(old, new *benchSamples) []benchDelta {
+	var pkgs []string
+	seen := make(map[string]bool)
+	for _, k := range new.order {
+		if !seen[k.pkg] {
+			seen[k.pkg] = true
+			pkgs = append(pkgs, k.pkg)
+		}
+	}
+	var deltas []benchDelta
+	for _, pkg := range pkgs {
+		for i := range benchMetrics {
+			m := &benchMetrics[i]
+			deltas = append(deltas, compareMetric(old, new, pkg, m)...)
+		}
+	}
+	return deltas
+}
+
+// compareMetric returns the deltas of a metric of the benchmarks of pkg.
+func compareMetric(old, new *benchSamples, pkg string, m *benchMetric) []benchDelta {
+	var deltas []benchDelta
+	for _, k := range new.order {
+		if k.pkg != pkg || old.results[k] == nil {
+			continue
+		}
+		d := benchDelta{key: k, metric: m, old: metricValues(m, old.results[k]), new: metricValues(m, new.results[k])}
+		if len(d.old) == 0 || len(d.new) == 0 {
+			continue
+		}
+		d.p = mannWhitneyU(d.old, d.new)
+		if o := median(d.old); o != 0 {
+			d.change = (median(d.new) - o) / o
+		} else if median(d.new) != 0 {
+			d.change = math.Inf(1)
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+func metricValues(m *benchMetric, results []BenchmarkResult) []float64 {
+	var v []float64
+	for i := range results {
+		if x, ok := m.value(&results[i]); ok {
+			v = append(v, x)
+		}
+	}
+	return v
+}
+
+func median(x []float64) float64 {
+	s := append([]float64(nil), x...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// spread returns the largest deviation of x from its median, as a fraction
+// of the median.
+func spread(x []float64) float64 {
+	m := median(x)
+	if m == 0 {
+		return 0
+	}
+	var d float64
+	for _, v := range x {
+		d = math.Max(d, math.Abs(v-m))
+	}
+	return d / m
+}
+
+// mannWhitneyU returns the two-sided p-value of the Mann-Whitney U test of
+// whether x and y come from the same distribution: exact for small samples
+// without ties, and by the normal approximation, corrected for ties,
+// otherwise.
+func mannWhitneyU(x, y []float64) float64 {
+	type obs struct {
+		v float64
+		x bool
+	}
+	all := make([]obs, 0, len(x)+len(y))
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+	// The ranks of tied values are the mean of the ranks they span.
+	var rx, ties float64
+	tied := false
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].x {
+				rx += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			tied = true
+			ties += t*t*t - t
+		}
+		i = j
+	}
+	n1, n2 := float64(len(x)), float64(len(y))
+	u := rx - n1*(n1+1)/2
+	if !tied && len(x)+len(y) <= 40 {
+		return exactU(len(x), len(y), int(u))
+	}
+	n := n1 + n2
+	sigma := math.Sqrt(n1 * n2 / 12 * (n + 1 - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	z := (math.Abs(u-n1*n2/2) - 0.5) / sigma
+	return math.Min(1, math.Erfc(math.Max(0, z)/math.Sqrt2))
+}
+
+// exactU returns the two-sided p-value of the statistic u of samples of n1
+// and n2 values without ties, from the number of orderings of the samples
+// giving each value of the statistic.
+func exactU(n1, n2, u int) float64 {
+	// counts[i][j][v] is the number of orderings of i and j values whose
+	// statistic is v.
+	max := n1 * n2
+	counts := make([][][]float64, n1+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n2+1)
+		for j := range counts[i] {
+			counts[i][j] = make([]float64, max+1)
+			if i == 0 || j == 0 {
+				counts[i][j][0] = 1
+				continue
+			}
+			for v := 0; v <= i*j; v++ {
+				c := counts[i][j-1][v]
+				if v >= j {
+					c += counts[i-1][j][v-j]
+				}
+				counts[i][j][v] = c
+			}
+		}
+	}
+	var below, above, total float64
+	for v, c := range counts[n1][n2] {
+		total += c
+		if v <= u {
+			below += c
+		}
+		if v >= u {
+			above += c
+		}
+	}
+	return math.Min(1, 2*math.Min(below, above)/total)
+}
+
+// parsePercent parses a percentage such as "5%" or "5" into a fraction.
+func parsePercent(s string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid percentage %q", s)
+	}
+	return v / 100, nil
+}
+
+// benchdiffMain runs gojunit benchdiff, which compares two files of
+// benchmark results like benchstat and fails if a benchmark got
+// significantly worse by more than -max-regression.
+func benchdiffMain(args []string) {
+	fs := flag.NewFlagSet("benchdiff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit benchdiff [flags] old.txt new.txt")
+		fs.PrintDefaults()
+	}
+	alpha := fs.Float64("alpha", 0.05, "p-value below which a change is significant; 1 takes every change as significant")
+	maxRegression := fs.String("max-regression", "", "fail if a benchmark got significantly worse by more than this percentage, as in 5%")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	var limit float64
+	if *maxRegression != "" {
+		var err error
+		if limit, err = parsePercent(*maxRegression); err != nil {
+			fmt.Fprintln(os.Stderr, "gojunit benchdiff:", err)
+			os.Exit(exitParse)
+		}
+	}
+	old, err := readBenchFile(fs.Arg(0))
+	if err == nil {
+		var new *benchSamples
+		if new, err = readBenchFile(fs.Arg(1)); err == nil {
+			regressed := writeBenchDiff(os.Stdout, compareBenchmarks(old, new), *alpha, limit, *maxRegression != "")
+			if regressed {
+				os.Exit(exitFailures)
+			}
+			return
+		}
+	}
+	fmt.Fprintln(os.Stderr, "gojunit benchdiff:", err)
+	os.Exit(exitParse)
+}
+
+// writeBenchDiff writes a table of deltas, one per benchmark and metric,
+// and reports whether any regressed by more than limit, if gating.
+func writeBenchDiff(w io.Writer, deltas []benchDelta, alpha, limit float64, gate bool) bool {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	regressed := false
+	pkg := "\x00"
+	var unit string
+	for i := range deltas {
+		d := &deltas[i]
+		if d.key.pkg != pkg {
+			if pkg = d.key.pkg; pkg != "" {
+				fmt.Fprintf(tw, "pkg: %s\n", pkg)
+			}
+			unit = ""
+		}
+		if d.metric.unit != unit {
+			if unit != "" {
+				fmt.Fprintln(tw)
+			}
+			unit = d.metric.unit
+			fmt.Fprintf(tw, "name\told %s\tnew %s\tdelta\n", unit, unit)
+		}
+		delta := "~"
+		if d.significant(alpha) {
+			delta = fmt.Sprintf("%+.2f%%", 100*d.change)
+		}
+		mark := ""
+		if gate && d.significant(alpha) && d.regression() > limit {
+			mark = "  regression"
+			regressed = true
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s (p=%.3f n=%d+%d)%s\n", d.key.name,
+			benchValue(d.old), benchValue(d.new), delta, d.p, len(d.old), len(d.new), mark)
+	}
+	tw.Flush()
+	return regressed
+}
+
+// benchValue returns the median of x and its spread.
+func benchValue(x []float64) string {
+	s := strconv.FormatFloat(median(x), 'g', 4, 64)
+	if len(x) > 1 {
+		s += fmt.Sprintf(" ± %.0f%%", 100*spread(x))
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	seq := func(from, to float64) []float64 {
+		var x []float64
+		for v := from; v <= to; v++ {
+			x = append(x, v)
+		}
+		return x
+	}
+	// The p-values are those of R's wilcox.test(x, y), which is exact for
+	// samples without ties and otherwise uses the normal approximation with
+	// the continuity correction.
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+	}{
+		{"separated 3+3", []float64{1, 2, 3}, []float64{4, 5, 6}, 0.1},
+		{"separated reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 0.1},
+		{"interleaved 3+3", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{"separated 5+5", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{"2+2", []float64{1, 2}, []float64{3, 4}, 1.0 / 3},
+		{"1+2", []float64{1}, []float64{2, 3}, 2.0 / 3},
+		{"1+1", []float64{1}, []float64{2}, 1},
+		{"ties", []float64{1, 2, 3, 4}, []float64{3, 5, 6, 7}, 0.0814291},
+		{"all tied", []float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		{"large", seq(1, 21), seq(22, 42), 3.1254e-8},
+	}
+	for _, tt := range tests {
+		got := mannWhitneyU(tt.x, tt.y)
+		if math.Abs(got-tt.want) > 1e-6*math.Max(1e-6, tt.want) {
+			t.Errorf("%s: mannWhitneyU(%v, %v) = %g, want %g", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestExactU(t *testing.T) {
+	// The number of orderings of 3 and 3 values with each statistic, from
+	// 0 to 9, is 1 1 2 3 3 3 3 2 1 1, of 20.
+	tests := []struct {
+		n1, n2, u int
+		want      float64
+	}{
+		{3, 3, 0, 0.1},
+		{3, 3, 9, 0.1},
+		{3, 3, 1, 0.2},
+		{3, 3, 2, 0.4},
+		{3, 3, 4, 1},
+		{4, 4, 0, 2.0 / 70},
+		{2, 3, 0, 0.2},
+		{1, 1, 0, 1},
+		{1, 3, 0, 0.5},
+	}
+	for _, tt := range tests {
+		if got := exactU(tt.n1, tt.n2, tt.u); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("exactU(%d, %d, %d) = %g, want %g", tt.n1, tt.n2, tt.u, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+)
+
+// benchmarkOf returns the result of the benchmark t, or nil if t is not a
+// benchmark with a result.
+func benchmarkOf(t *TestCase) *BenchmarkResult {
+	ns := t.Property("ns_per_op")
+	if ns == "" {
+		return nil
+	}
+	r := new(BenchmarkResult)
+	r.NsPerOp, _ = strconv.ParseFloat(ns, 64)
+	r.Iterations, _ = strconv.ParseInt(t.Property("iterations"), 10, 64)
+	if v, err := strconv.ParseFloat(t.Property("mb_per_s"), 64); err == nil {
+		r.MBPerS = &v
+	}
+	if v, err := strconv.ParseInt(t.Property("bytes_per_op"), 10, 64); err == nil {
+		r.BytesPerOp = &v
+	}
+	if v, err := strconv.ParseInt(t.Property("allocs_per_op"), 10, 64); err == nil {
+		r.AllocsPerOp = &v
+	}
+	return r
+}
+
+// benchmarkColumns are the properties of the results of benchmarks, in the
+// order of the columns of reports.
+var benchmarkColumns = []string{"iterations", "ns_per_op", "mb_per_s", "bytes_per_op", "allocs_per_op"}
+
+// hasBenchmarks reports whether any of the tests of suites is a benchmark
+// with a result.
+func hasBenchmarks(suites []TestSuite) bool {
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			if suites[i].TestCases[j].Property("ns_per_op") != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
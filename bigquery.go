@@ -0,0 +1,179 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// bigQueryName matches the names of BigQuery datasets and tables gojunit
+// accepts, which need no quoting beyond backquotes.
+var bigQueryName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// A bigQueryStore keeps runs in a BigQuery table, with the JSON document of
+// each run in a row of its own.
+type bigQueryStore struct {
+	base     string // of the API, up to and including the project
+	table    string // quoted dataset.table
+	emulator bool   // needs no credentials
+	once     sync.Once
+	err      error // of creating the table
+}
+
+// NewBigQueryStore returns a Store that keeps runs in the BigQuery table
+// named by a URL of the form bigquery://PROJECT/DATASET.TABLE, creating the
+// table if necessary; the dataset must exist. The BIGQUERY_EMULATOR_HOST
+// variable selects an emulator instead.
+func NewBigQueryStore(dsn string) (Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	dataset, table, ok := strings.Cut(strings.TrimPrefix(u.Path, "/"), ".")
+	if u.Host == "" || !ok || !bigQueryName.MatchString(dataset) || !bigQueryName.MatchString(table) {
+		return nil, fmt.Errorf("%s: want bigquery://PROJECT/DATASET.TABLE", dsn)
+	}
+	s := &bigQueryStore{base: "https://bigquery.googleapis.com", table: "`" + dataset + "." + table + "`"}
+	if host := os.Getenv("BIGQUERY_EMULATOR_HOST"); host != "" {
+		s.base = strings.TrimSuffix(host, "/")
+		if !strings.Contains(s.base, "://") {
+			s.base = "http://" + s.base
+		}
+		s.emulator = true
+	}
+	s.base += "/bigquery/v2/projects/" + url.PathEscape(u.Host)
+	return s, nil
+}
+
+// A bigQueryResponse is the response of the jobs.query and
+// jobs.getQueryResults methods.
+type bigQueryResponse struct {
+	JobComplete  bool `json:"jobComplete"`
+	JobReference struct {
+		JobID    string `json:"jobId"`
+		Location string `json:"location"`
+	} `json:"jobReference"`
+	PageToken string `json:"pageToken"`
+	Rows      []struct {
+		F []struct {
+			V string `json:"v"`
+		} `json:"f"`
+	} `json:"rows"`
+}
+
+// query runs the standard SQL query q with the named string parameters
+// params, given as pairs of names and values, and returns the values of the
+// first column of its rows.
+func (s *bigQueryStore) query(q string, params ...string) ([]string, error) {
+	s.once.Do(func() {
+		_, s.err = s.run("CREATE TABLE IF NOT EXISTS " + s.table + " (id STRING NOT NULL, created TIMESTAMP NOT NULL, data STRING NOT NULL)")
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.run(q, params...)
+}
+
+func (s *bigQueryStore) run(q string, params ...string) ([]string, error) {
+	header := http.Header{}
+	if !s.emulator {
+		token, err := googleAccessToken()
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	type value struct {
+		Value string `json:"value"`
+	}
+	type param struct {
+		Name           string            `json:"name"`
+		ParameterType  map[string]string `json:"parameterType"`
+		ParameterValue value             `json:"parameterValue"`
+	}
+	req := struct {
+		Query           string  `json:"query"`
+		UseLegacySQL    bool    `json:"useLegacySql"`
+		ParameterMode   string  `json:"parameterMode"`
+		QueryParameters []param `json:"queryParameters"`
+	}{Query: q, ParameterMode: "NAMED", QueryParameters: []param{}}
+	for i := 0; i+1 < len(params); i += 2 {
+		req.QueryParameters = append(req.QueryParameters, param{params[i], map[string]string{"type": "STRING"}, value{params[i+1]}})
+	}
+	var resp bigQueryResponse
+	if err := doJSON("POST", s.base+"/queries", header, req, &resp); err != nil {
+		return nil, fmt.Errorf("bigquery: %v", err)
+	}
+	var rows []string
+	job, location := resp.JobReference.JobID, resp.JobReference.Location
+	for {
+		for _, row := range resp.Rows {
+			if len(row.F) > 0 {
+				rows = append(rows, row.F[0].V)
+			}
+		}
+		if resp.JobComplete && resp.PageToken == "" {
+			return rows, nil
+		}
+		if job == "" {
+			return nil, fmt.Errorf("bigquery: query returned no job")
+		}
+		// Waits up to timeoutMs for the job to complete.
+		v := url.Values{"timeoutMs": {"10000"}}
+		if location != "" {
+			v.Set("location", location)
+		}
+		if resp.PageToken != "" {
+			v.Set("pageToken", resp.PageToken)
+		}
+		u := s.base + "/queries/" + url.PathEscape(job) + "?" + v.Encode()
+		resp = bigQueryResponse{}
+		if err := doJSON("GET", u, header, nil, &resp); err != nil {
+			return nil, fmt.Errorf("bigquery: %v", err)
+		}
+	}
+}
+
+func (s *bigQueryStore) Save(r *Run) error {
+	b, err := marshalRun(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.query("MERGE "+s.table+" t USING (SELECT @id AS id, TIMESTAMP(@created) AS created, @data AS data) s ON t.id = s.id "+
+		"WHEN MATCHED THEN UPDATE SET created = s.created, data = s.data "+
+		"WHEN NOT MATCHED THEN INSERT (id, created, data) VALUES (s.id, s.created, s.data)",
+		"id", r.ID, "created", r.Created.UTC().Format("2006-01-02 15:04:05.999999 UTC"), "data", string(b))
+	return err
+}
+
+func (s *bigQueryStore) Load(id string) (*Run, error) {
+	rows, err := s.query("SELECT data FROM "+s.table+" WHERE id = @id", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return unmarshalRun([]byte(rows[0]))
+}
+
+func (s *bigQueryStore) List() ([]*Run, error) {
+	rows, err := s.query("SELECT data FROM " + s.table)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalRuns(rows)
+}
+
+func (s *bigQueryStore) Delete(id string) error {
+	_, err := s.query("DELETE FROM "+s.table+" WHERE id = @id", "id", id)
+	return err
+}
@@ -0,0 +1,154 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Limits of the Code Insights API of Bitbucket Cloud. Longer texts are
+// truncated and annotations past the limit of a report dropped.
+const (
+	bitbucketDetailsLimit     = 2000 // details of reports and annotations
+	bitbucketSummaryLimit     = 450  // summaries of annotations
+	bitbucketAnnotationLimit  = 1000 // annotations of a report
+	bitbucketAnnotationsBatch = 100  // annotations of a request
+)
+
+// A bitbucketReport publishes results as a Code Insights report on a commit
+// of a Bitbucket Cloud repository, which Bitbucket shows on its pull
+// requests.
+type bitbucketReport struct {
+	API    string // URL of the REST API
+	Repo   string // workspace/repo_slug
+	Commit string
+	Auth   string // value of the Authorization header
+}
+
+// A bitbucketAnnotation is an annotation of a Code Insights report.
+type bitbucketAnnotation struct {
+	ExternalID string `json:"external_id"`
+	Type       string `json:"annotation_type"`
+	Result     string `json:"result"`
+	Severity   string `json:"severity"`
+	Summary    string `json:"summary"`
+	Details    string `json:"details,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Line       int    `json:"line,omitempty"`
+}
+
+var bitbucketIDRE = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// Publish creates or replaces the report with the given title on the
+// commit, adding an annotation for every failed test, on the line of its
+// failure when it is known.
+func (b *bitbucketReport) Publish(title string, suites []TestSuite) error {
+	var total Counts
+	for i := range suites {
+		total.Add(&suites[i])
+	}
+	result := "PASSED"
+	if failed(suites) {
+		result = "FAILED"
+	}
+	id := "gojunit"
+	if *label != "" {
+		id += "-" + strings.Trim(bitbucketIDRE.ReplaceAllString(*label, "-"), "-")
+	}
+	report := map[string]interface{}{
+		"title":       title,
+		"details":     truncate(total.String(), bitbucketDetailsLimit),
+		"report_type": "TEST",
+		"reporter":    "gojunit",
+		"result":      result,
+		"data": []map[string]interface{}{
+			{"title": "Tests", "type": "NUMBER", "value": total.Tests},
+			{"title": "Failed", "type": "NUMBER", "value": total.Failures + total.Errors},
+			{"title": "Skipped", "type": "NUMBER", "value": total.Skipped},
+		},
+	}
+	path := "/repositories/" + b.Repo + "/commit/" + b.Commit + "/reports/" + id
+	if err := b.do("PUT", path, report); err != nil {
+		return err
+	}
+	annotations := bitbucketAnnotations(suites)
+	if len(annotations) > bitbucketAnnotationLimit {
+		logger.Warn("too many failures; annotating the first ones", "limit", bitbucketAnnotationLimit)
+		annotations = annotations[:bitbucketAnnotationLimit]
+	}
+	for len(annotations) > 0 {
+		n := len(annotations)
+		if n > bitbucketAnnotationsBatch {
+			n = bitbucketAnnotationsBatch
+		}
+		if err := b.do("POST", path+"/annotations", annotations[:n]); err != nil {
+			return err
+		}
+		annotations = annotations[n:]
+	}
+	return nil
+}
+
+// bitbucketAnnotations returns an annotation for every failed test in
+// suites.
+func bitbucketAnnotations(suites []TestSuite) []bitbucketAnnotation {
+	var annotations []bitbucketAnnotation
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			a := bitbucketAnnotation{
+				ExternalID: caseID(s, t),
+				Type:       "BUG",
+				Result:     "FAILED",
+				Severity:   "HIGH",
+				Summary:    truncate(suiteKey(s)+"."+t.Name+": "+firstNonEmpty(messageOf(t), t.Status.String()), bitbucketSummaryLimit),
+			}
+			if lines := lastLines(t.Output.String(), digestSnippetLines); lines != nil {
+				a.Details = truncate(strings.Join(lines, "\n"), bitbucketDetailsLimit)
+			}
+			if file, line, _ := FailureLocation(t.Output.String()); file != "" {
+				a.Path, a.Line = githubFile(s, file), line
+			}
+			annotations = append(annotations, a)
+		}
+	}
+	return annotations
+}
+
+func (b *bitbucketReport) do(method, path string, body interface{}) error {
+	return doJSON(method, strings.TrimSuffix(b.API, "/")+path, http.Header{"Authorization": {b.Auth}}, body, nil)
+}
+
+// ambientBitbucketReport returns the bitbucketReport of the commit of a
+// Bitbucket Pipelines build, given by $BITBUCKET_WORKSPACE,
+// $BITBUCKET_REPO_SLUG and $BITBUCKET_COMMIT. It authenticates with the
+// access token in $BITBUCKET_ACCESS_TOKEN, or as $BITBUCKET_USER with the
+// app password in $BITBUCKET_APP_PASSWORD.
+func ambientBitbucketReport() (*bitbucketReport, error) {
+	b := &bitbucketReport{
+		API:    envOr("BITBUCKET_API_URL", "https://api.bitbucket.org/2.0"),
+		Repo:   os.Getenv("BITBUCKET_WORKSPACE") + "/" + os.Getenv("BITBUCKET_REPO_SLUG"),
+		Commit: os.Getenv("BITBUCKET_COMMIT"),
+	}
+	if strings.HasPrefix(b.Repo, "/") || strings.HasSuffix(b.Repo, "/") || b.Commit == "" {
+		return nil, fmt.Errorf("-bitbucket-report requires $BITBUCKET_WORKSPACE, $BITBUCKET_REPO_SLUG and $BITBUCKET_COMMIT")
+	}
+	if token := os.Getenv("BITBUCKET_ACCESS_TOKEN"); token != "" {
+		b.Auth = "Bearer " + token
+	} else if user := os.Getenv("BITBUCKET_USER"); user != "" {
+		b.Auth = basicAuth(user, os.Getenv("BITBUCKET_APP_PASSWORD"))
+	} else {
+		return nil, fmt.Errorf("-bitbucket-report requires $BITBUCKET_ACCESS_TOKEN, or $BITBUCKET_USER and $BITBUCKET_APP_PASSWORD")
+	}
+	return b, nil
+}
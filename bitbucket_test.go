@@ -0,0 +1,131 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBitbucketReportPublish(t *testing.T) {
+	defer func(v string) { *label = v }(*label)
+	*label = "linux/amd64"
+	api := newFakeAPI(t, nil)
+	t.Setenv("BITBUCKET_API_URL", api.URL+"/2.0")
+	t.Setenv("BITBUCKET_WORKSPACE", "ws")
+	t.Setenv("BITBUCKET_REPO_SLUG", "repo")
+	t.Setenv("BITBUCKET_COMMIT", "abc123")
+	t.Setenv("BITBUCKET_ACCESS_TOKEN", "")
+	t.Setenv("BITBUCKET_USER", "ci")
+	t.Setenv("BITBUCKET_APP_PASSWORD", "secret")
+	b, err := ambientBitbucketReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 150 failures need two requests of annotations.
+	var tests []TestCase
+	for i := 0; i < 150; i++ {
+		tc := TestCase{Name: fmt.Sprintf("Test%d", i), Status: Failure}
+		fmt.Fprintf(&tc.Output, "    a_test.go:%d: got %d\n", i+1, i)
+		tests = append(tests, tc)
+	}
+	tests = append(tests, TestCase{Name: "TestNoLocation", Status: Error}, TestCase{Name: "TestSkip", Status: Skipped})
+	suites := []TestSuite{{
+		Name:       "example.com/m/pkg",
+		Properties: []Property{{Name: "module", Value: "example.com/m"}},
+		TestCases:  tests,
+	}}
+	if err := b.Publish("Tests", suites); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := api.received()
+	// The label keeps the reports of matrix entries apart.
+	const path = "/2.0/repositories/ws/repo/commit/abc123/reports/gojunit-linux-amd64"
+	var got []string
+	for _, r := range reqs {
+		got = append(got, r.Method+" "+r.Path)
+		if auth := r.Header.Get("Authorization"); auth != basicAuth("ci", "secret") {
+			t.Errorf("%s %s: Authorization %q", r.Method, r.Path, auth)
+		}
+	}
+	if want := "PUT " + path + "\nPOST " + path + "/annotations\nPOST " + path + "/annotations"; strings.Join(got, "\n") != want {
+		t.Fatalf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+	var report struct {
+		Title, Details, Result string
+		ReportType             string `json:"report_type"`
+		Data                   []struct {
+			Title, Type string
+			Value       int
+		}
+	}
+	reqs[0].decode(t, &report)
+	if report.Title != "Tests" || report.ReportType != "TEST" || report.Result != "FAILED" || report.Details != "152 tests, 150 failed, 1 errors, 1 skipped" {
+		t.Errorf("report %+v", report)
+	}
+	if got := fmt.Sprint(report.Data); got != "[{Tests NUMBER 152} {Failed NUMBER 151} {Skipped NUMBER 1}]" {
+		t.Errorf("report data %s", got)
+	}
+
+	var first, second []bitbucketAnnotation
+	reqs[1].decode(t, &first)
+	reqs[2].decode(t, &second)
+	if len(first) != bitbucketAnnotationsBatch || len(second) != 51 {
+		t.Fatalf("annotations in batches of %d and %d, want %d and 51", len(first), len(second), bitbucketAnnotationsBatch)
+	}
+	want := bitbucketAnnotation{
+		ExternalID: TestID("example.com/m/pkg", "Test0"),
+		Type:       "BUG",
+		Result:     "FAILED",
+		Severity:   "HIGH",
+		Summary:    "example.com/m/pkg.Test0: got 0",
+		Details:    "    a_test.go:1: got 0",
+		Path:       "pkg/a_test.go",
+		Line:       1,
+	}
+	if first[0] != want {
+		t.Errorf("annotation\n%+v\nwant\n%+v", first[0], want)
+	}
+	// A failure without a location annotates the report rather than a line.
+	last := second[len(second)-1]
+	if last.Summary != "example.com/m/pkg.TestNoLocation: error" || last.Path != "" || last.Line != 0 {
+		t.Errorf("annotation %+v, want one of TestNoLocation without a path", last)
+	}
+}
+
+func TestBitbucketReportPassed(t *testing.T) {
+	defer func(v string) { *label = v }(*label)
+	*label = ""
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) { return 200, "{}" })
+	b := &bitbucketReport{API: api.URL, Repo: "ws/repo", Commit: "abc123", Auth: "Bearer token"}
+	if err := b.Publish("Tests", []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := api.received()
+	if len(reqs) != 1 || reqs[0].Method != "PUT" || reqs[0].Path != "/repositories/ws/repo/commit/abc123/reports/gojunit" {
+		t.Fatalf("requests %+v, want a PUT of the report gojunit alone", reqs)
+	}
+	var report struct{ Result string }
+	reqs[0].decode(t, &report)
+	if report.Result != "PASSED" {
+		t.Errorf("result %s, want PASSED", report.Result)
+	}
+}
+
+func TestBitbucketReportError(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		return 403, `{"type":"error","error":{"message":"Access denied"}}`
+	})
+	b := &bitbucketReport{API: api.URL, Repo: "ws/repo", Commit: "abc123", Auth: "Bearer token"}
+	err := b.Publish("Tests", []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA", Status: Failure}}}})
+	if err == nil || !isStatus(err, 403) || !strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("error %v, want 403 with the message of Bitbucket", err)
+	}
+	if n := len(api.received()); n != 1 {
+		t.Errorf("%d requests, want no annotations after the report failed", n)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// An archive is a tar or zip file being written.
+type archive interface {
+	add(name string, data []byte) error
+	Close() error
+}
+
+type zipArchive struct{ *zip.Writer }
+
+func (a zipArchive) add(name string, data []byte) error {
+	w, err := a.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+type tarArchive struct {
+	*tar.Writer
+	gz *gzip.Writer // nil if not compressed
+}
+
+func (a tarArchive) add(name string, data []byte) error {
+	if err := a.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := a.Write(data)
+	return err
+}
+
+func (a tarArchive) Close() error {
+	err := a.Writer.Close()
+	if a.gz != nil {
+		err = errors.Join(err, a.gz.Close())
+	}
+	return err
+}
+
+// newArchive returns an archive written to w in the format given by the
+// extension of name: .zip, .tar, or .tar.gz or .tgz for a compressed tar
+// file.
+func newArchive(name string, w io.Writer) (archive, error) {
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return zipArchive{zip.NewWriter(w)}, nil
+	case strings.HasSuffix(name, ".tar"):
+		return tarArchive{Writer: tar.NewWriter(w)}, nil
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gz := gzip.NewWriter(w)
+		return tarArchive{tar.NewWriter(gz), gz}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown archive format; want .zip, .tar, .tar.gz or .tgz", name)
+}
+
+// WriteBundle writes a self-contained bundle of the results of inputs, the
+// named files holding them in any input format, to the archive a: an HTML
+// report, as index.html, a JSON report, as results.json, the inputs under
+// logs/, and, if runs is not nil, a snapshot of the history of the results
+// under history/: the runs, as listed by the API of gojunit serve, and the
+// flaky tests, in the format of -quarantine.
+func WriteBundle(a archive, inputs []string, runs []*Run) error {
+	var suites []TestSuite
+	for i, name := range inputs {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		s, err := readReport(name)
+		if err != nil {
+			return err
+		}
+		suites = append(suites, s...)
+		// Inputs of the same name in different directories are numbered.
+		base := filepath.Base(name)
+		for _, other := range inputs[:i] {
+			if filepath.Base(other) == base {
+				base = fmt.Sprintf("%d-%s", i+1, base)
+				break
+			}
+		}
+		if err := a.add("logs/"+base, data); err != nil {
+			return err
+		}
+	}
+	var b bytes.Buffer
+	if err := WriteHTML(suites, &b); err != nil {
+		return err
+	}
+	if err := a.add("index.html", b.Bytes()); err != nil {
+		return err
+	}
+	b.Reset()
+	if err := WriteJSON(suites, &b); err != nil {
+		return err
+	}
+	if err := a.add("results.json", b.Bytes()); err != nil {
+		return err
+	}
+	if runs == nil {
+		return nil
+	}
+	infos := []runInfo{}
+	for _, run := range runs {
+		infos = append(infos, newRunInfo(run))
+	}
+	data, err := json.MarshalIndent(infos, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := a.add("history/runs.json", append(data, '\n')); err != nil {
+		return err
+	}
+	b.Reset()
+	if err := WriteQuarantine(SuggestQuarantine(CollectFlakeStats(runs), 0), &b); err != nil {
+		return err
+	}
+	return a.add("history/flaky.txt", b.Bytes())
+}
+
+// bundleMain runs gojunit bundle, which writes the results of reports, along
+// with their history, to a single archive for readers without access to CI.
+func bundleMain(args []string) {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit bundle [flags] -o results.zip input...")
+		fs.PrintDefaults()
+	}
+	output := fs.String("o", "", "archive to write: a .zip, .tar, .tar.gz or .tgz file")
+	dir := fs.String("store", "", "store in which gojunit serve keeps runs, as for its -store flag, whose history is added to the bundle")
+	last := fs.Int("runs", 20, "add only this many of the latest runs of -store; 0 for all")
+	fs.Parse(args)
+	if *output == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	err := writeBundleFile(*output, fs.Args(), *dir, *last)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit bundle:", err)
+		os.Exit(exitInfra)
+	}
+}
+
+func writeBundleFile(name string, inputs []string, dir string, last int) error {
+	var runs []*Run
+	if dir != "" {
+		store, err := OpenStore(dir)
+		if err != nil {
+			return err
+		}
+		if runs, err = store.List(); err != nil {
+			return err
+		}
+		if last > 0 && len(runs) > last {
+			runs = runs[:last]
+		}
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	a, err := newArchive(name, f)
+	if err == nil {
+		err = WriteBundle(a, inputs, runs)
+		err = errors.Join(err, a.Close())
+	}
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readArchive returns the contents of the files of the named archive by
+// name.
+func readArchive(t *testing.T, name string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	if strings.HasSuffix(name, ".zip") {
+		z, err := zip.OpenReader(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(data)
+		}
+		return files
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if !strings.HasSuffix(name, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(data)
+	}
+	return files
+}
+
+func TestWriteBundleFile(t *testing.T) {
+	dir := t.TempDir()
+	inputs := map[string]string{
+		"a/test.log": "=== RUN   TestA\n--- PASS: TestA (0.00s)\nPASS\nok  \tx/a\t0.01s\n",
+		"b/test.log": "=== RUN   TestB\n--- FAIL: TestB (0.00s)\nFAIL\nFAIL\tx/b\t0.01s\n",
+		"c.xml":      `<testsuites><testsuite name="x/c" tests="1"><testcase name="TestC" classname="x/c"></testcase></testsuite></testsuites>`,
+	}
+	var names []string
+	for name, data := range inputs {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o777)
+		if err := os.WriteFile(path, []byte(data), 0o666); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, path)
+	}
+	sort.Strings(names)
+
+	storeDir := filepath.Join(dir, "store")
+	store, err := NewDirStore(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, status := range []Status{Failure, Success, Failure, Success} {
+		store.Save(&Run{ID: string(rune('a' + i)), Created: created.Add(time.Duration(i) * time.Hour), Suites: []TestSuite{
+			{Name: "x/b", TestCases: []TestCase{{Name: "TestB", Status: status}}},
+		}})
+	}
+
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		t.Run(ext, func(t *testing.T) {
+			name := filepath.Join(dir, "bundle"+ext)
+			if err := writeBundleFile(name, names, storeDir, 3); err != nil {
+				t.Fatal(err)
+			}
+			files := readArchive(t, name)
+			var got []string
+			for f := range files {
+				got = append(got, f)
+			}
+			sort.Strings(got)
+			// The second input named test.log is numbered.
+			want := "history/flaky.txt history/runs.json index.html logs/2-test.log logs/c.xml logs/test.log results.json"
+			if strings.Join(got, " ") != want {
+				t.Fatalf("files %s, want %s", strings.Join(got, " "), want)
+			}
+			if files["logs/test.log"] != inputs["a/test.log"] || files["logs/2-test.log"] != inputs["b/test.log"] || files["logs/c.xml"] != inputs["c.xml"] {
+				t.Errorf("logs differ from the inputs: %q", files)
+			}
+
+			var report jsonReport
+			if err := json.Unmarshal([]byte(files["results.json"]), &report); err != nil {
+				t.Fatalf("results.json: %v", err)
+			}
+			var cases []string
+			for _, s := range report.Suites {
+				for _, tc := range s.TestCases {
+					cases = append(cases, s.Name+" "+tc.Name+":"+tc.Status.String())
+				}
+			}
+			if got, want := strings.Join(cases, ", "), "x/a TestA:success, x/b TestB:failure, x/c TestC:success"; got != want {
+				t.Errorf("results.json holds %s, want %s", got, want)
+			}
+			for _, test := range []string{"TestA", "TestB", "TestC"} {
+				if !strings.Contains(files["index.html"], test) {
+					t.Errorf("index.html does not mention %s", test)
+				}
+			}
+
+			// Only the latest 3 runs are added.
+			var runs []runInfo
+			if err := json.Unmarshal([]byte(files["history/runs.json"]), &runs); err != nil {
+				t.Fatalf("history/runs.json: %v", err)
+			}
+			var ids []string
+			for _, r := range runs {
+				ids = append(ids, r.ID)
+			}
+			if got := strings.Join(ids, " "); got != "d c b" {
+				t.Errorf("runs %s, want d c b", got)
+			}
+			if want := "^x/b/TestB$ flaky: failed 1 of 3 runs (33.3%), last on 2024-03-01 in run c\n"; files["history/flaky.txt"] != want {
+				t.Errorf("flaky.txt = %q, want %q", files["history/flaky.txt"], want)
+			}
+		})
+	}
+}
+
+func TestWriteBundleFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.log")
+	if err := os.WriteFile(input, []byte("=== RUN   TestA\n--- PASS: TestA (0.00s)\nPASS\nok  \tx/a\t0.01s\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		output string
+		inputs []string
+		want   string // in the error
+	}{
+		{"unknown format", "bundle.rar", []string{input}, "unknown archive format"},
+		{"missing input", "bundle.zip", []string{input, filepath.Join(dir, "missing.log")}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(dir, tt.output)
+			err := writeBundleFile(output, tt.inputs, "", 0)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error %v, want %q", err, tt.want)
+			}
+			// No partial archive is left behind.
+			if _, err := os.Stat(output); !os.IsNotExist(err) {
+				t.Errorf("%s left behind: %v", tt.output, err)
+			}
+		})
+	}
+}
+
+func TestWriteBundleWithoutHistory(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.log")
+	if err := os.WriteFile(input, []byte("=== RUN   TestA\n--- PASS: TestA (0.00s)\nPASS\nok  \tx/a\t0.01s\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "bundle.zip")
+	if err := writeBundleFile(name, []string{input}, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	for f := range readArchive(t, name) {
+		if strings.HasPrefix(f, "history/") {
+			t.Errorf("bundle without -store holds %s", f)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// checkAnnotationsPerRequest is the most annotations the Checks API
+	// accepts in one request; more are added by updating the check run.
+	checkAnnotationsPerRequest = 50
+
+	// checkSummaryLimit is the longest summary of a check run.
+	checkSummaryLimit = 65535
+)
+
+// A checkAnnotation is an annotation of a check run on a line of a file.
+type checkAnnotation struct {
+	Path       string `json:"path"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Level      string `json:"annotation_level"`
+	Title      string `json:"title,omitempty"`
+	Message    string `json:"message"`
+	RawDetails string `json:"raw_details,omitempty"`
+}
+
+// failureAnnotations returns an annotation for every failed test in suites
+// whose failure has a known location.
+func failureAnnotations(suites []TestSuite) []checkAnnotation {
+	var annotations []checkAnnotation
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			file, line, _ := FailureLocation(t.Output.String())
+			if file == "" {
+				continue
+			}
+			a := checkAnnotation{
+				Path:      githubFile(s, file),
+				StartLine: line,
+				EndLine:   line,
+				Level:     "failure",
+				Title:     suiteKey(s) + "." + t.Name,
+				Message:   firstNonEmpty(messageOf(t), t.Status.String()),
+			}
+			if lines := lastLines(t.Output.String(), digestSnippetLines); lines != nil {
+				a.RawDetails = strings.Join(lines, "\n")
+			}
+			annotations = append(annotations, a)
+		}
+	}
+	return annotations
+}
+
+// A githubCheck creates check runs on a commit of a GitHub repository.
+type githubCheck struct {
+	API   string // URL of the REST API
+	Repo  string // owner/name
+	SHA   string // commit the check runs are created on
+	Token string
+}
+
+// Publish creates a completed check run with the given name for suites,
+// with the Markdown report as its summary, an annotation for every failure
+// with a location, and a conclusion of failure if any test failed or had an
+// error.
+func (c *githubCheck) Publish(name string, suites []TestSuite) error {
+	var summary bytes.Buffer
+	if err := WriteMarkdown(suites, &summary); err != nil {
+		return err
+	}
+	conclusion := "success"
+	if failed(suites) {
+		conclusion = "failure"
+	}
+	var total Counts
+	for i := range suites {
+		total.Add(&suites[i])
+	}
+	output := map[string]interface{}{
+		"title":   total.String(),
+		"summary": truncate(summary.String(), checkSummaryLimit),
+	}
+	annotations := failureAnnotations(suites)
+	n := len(annotations)
+	if n > checkAnnotationsPerRequest {
+		n = checkAnnotationsPerRequest
+	}
+	output["annotations"] = annotations[:n]
+	run := map[string]interface{}{
+		"name":         name,
+		"head_sha":     c.SHA,
+		"status":       "completed",
+		"conclusion":   conclusion,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"output":       output,
+	}
+	var created struct{ ID int64 }
+	if err := c.do("POST", "/repos/"+c.Repo+"/check-runs", run, &created); err != nil {
+		return err
+	}
+	for annotations = annotations[n:]; len(annotations) > 0; annotations = annotations[n:] {
+		if n = len(annotations); n > checkAnnotationsPerRequest {
+			n = checkAnnotationsPerRequest
+		}
+		output["annotations"] = annotations[:n]
+		update := map[string]interface{}{"output": output}
+		if err := c.do("PATCH", fmt.Sprintf("/repos/%s/check-runs/%d", c.Repo, created.ID), update, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *githubCheck) do(method, path string, body, out interface{}) error {
+	header := http.Header{
+		"Accept":               {"application/vnd.github+json"},
+		"Authorization":        {"Bearer " + c.Token},
+		"X-Github-Api-Version": {"2022-11-28"},
+	}
+	return doJSON(method, strings.TrimSuffix(c.API, "/")+path, header, body, out)
+}
+
+// ambientGitHubCheck returns the githubCheck of the commit of a GitHub
+// Actions workflow run, or of $GITHUB_REPOSITORY and $GITHUB_SHA elsewhere.
+// It authenticates with $GITHUB_TOKEN or, without it, as an installation of
+// the GitHub App of $GITHUB_APP_ID with the private key in
+// $GITHUB_APP_PRIVATE_KEY, which holds the key or the name of its file.
+func ambientGitHubCheck() (*githubCheck, error) {
+	c := &githubCheck{
+		API:  envOr("GITHUB_API_URL", "https://api.github.com"),
+		Repo: os.Getenv("GITHUB_REPOSITORY"),
+		SHA:  os.Getenv("GITHUB_SHA"),
+	}
+	if c.Repo == "" || c.SHA == "" {
+		return nil, fmt.Errorf("-github-check requires $GITHUB_REPOSITORY and $GITHUB_SHA")
+	}
+	if c.Token = os.Getenv("GITHUB_TOKEN"); c.Token != "" {
+		return c, nil
+	}
+	appID, key := os.Getenv("GITHUB_APP_ID"), os.Getenv("GITHUB_APP_PRIVATE_KEY")
+	if appID == "" || key == "" {
+		return nil, fmt.Errorf("-github-check requires $GITHUB_TOKEN, or $GITHUB_APP_ID and $GITHUB_APP_PRIVATE_KEY")
+	}
+	token, err := githubAppToken(c.API, c.Repo, appID, key)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub App %s: %v", appID, err)
+	}
+	c.Token = token
+	return c, nil
+}
+
+// githubAppToken returns an installation access token of the GitHub App
+// with the given ID on repo, signing in with its private key, given as PEM
+// or as the name of a PEM file.
+func githubAppToken(api, repo, appID, key string) (string, error) {
+	pem := []byte(key)
+	if !strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		var err error
+		if pem, err = os.ReadFile(key); err != nil {
+			return "", err
+		}
+	}
+	rsaKey, err := parseRSAKey(pem)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	jwt, err := signJWT(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(), // allow for clock drift
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	}, rsaKey)
+	if err != nil {
+		return "", err
+	}
+	app := &githubCheck{API: api, Token: jwt}
+	var installation struct{ ID int64 }
+	if err := app.do("GET", "/repos/"+repo+"/installation", nil, &installation); err != nil {
+		return "", err
+	}
+	var token struct{ Token string }
+	if err := app.do("POST", fmt.Sprintf("/app/installations/%d/access_tokens", installation.ID), nil, &token); err != nil {
+		return "", err
+	}
+	return token.Token, nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// checkRun is the part of a check run checked by the tests.
+type checkRun struct {
+	Name, Status, Conclusion string
+	HeadSHA                  string `json:"head_sha"`
+	Output                   struct {
+		Title, Summary string
+		Annotations    []checkAnnotation
+	}
+}
+
+func TestGitHubCheckPublish(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		if r.Method == "POST" {
+			return 201, `{"id":7}`
+		}
+		return 200, `{}`
+	})
+	// 120 failures with a location need three requests of annotations.
+	var tests []TestCase
+	for i := 0; i < 120; i++ {
+		tc := TestCase{Name: fmt.Sprintf("Test%d", i), Status: Failure}
+		fmt.Fprintf(&tc.Output, "    a_test.go:%d: got %d\n", i+1, i)
+		tests = append(tests, tc)
+	}
+	tests = append(tests, TestCase{Name: "TestNoLocation", Status: Error}, TestCase{Name: "TestPass"})
+	suites := []TestSuite{{
+		Name:       "example.com/m/pkg",
+		Properties: []Property{{Name: "module", Value: "example.com/m"}},
+		TestCases:  tests,
+	}}
+	c := &githubCheck{API: api.URL + "/", Repo: "o/r", SHA: "abc123", Token: "ghs_token"}
+	if err := c.Publish("tests", suites); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := api.received()
+	var got []string
+	for _, r := range reqs {
+		got = append(got, r.Method+" "+r.Path)
+		if r.Header.Get("Authorization") != "Bearer ghs_token" || r.Header.Get("Accept") != "application/vnd.github+json" || r.Header.Get("X-Github-Api-Version") == "" {
+			t.Errorf("%s %s: headers %v", r.Method, r.Path, r.Header)
+		}
+	}
+	want := "POST /repos/o/r/check-runs\nPATCH /repos/o/r/check-runs/7\nPATCH /repos/o/r/check-runs/7"
+	if strings.Join(got, "\n") != want {
+		t.Fatalf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+	var run checkRun
+	reqs[0].decode(t, &run)
+	if run.Name != "tests" || run.HeadSHA != "abc123" || run.Status != "completed" || run.Conclusion != "failure" {
+		t.Errorf("check run %s %s %s %s, want tests abc123 completed failure", run.Name, run.HeadSHA, run.Status, run.Conclusion)
+	}
+	if want := "122 tests, 120 failed, 1 errors, 0 skipped"; run.Output.Title != want {
+		t.Errorf("output title %q, want %q", run.Output.Title, want)
+	}
+	if !strings.HasPrefix(run.Output.Summary, "## Test results\n") || !strings.Contains(run.Output.Summary, "TestNoLocation") {
+		t.Errorf("output summary is not the Markdown report of the tests")
+	}
+	var annotations []checkAnnotation
+	for i, r := range reqs {
+		var update checkRun
+		r.decode(t, &update)
+		if n := len(update.Output.Annotations); n > checkAnnotationsPerRequest {
+			t.Errorf("request %d has %d annotations, more than %d", i, n, checkAnnotationsPerRequest)
+		}
+		annotations = append(annotations, update.Output.Annotations...)
+	}
+	if len(annotations) != 120 {
+		t.Fatalf("%d annotations, want 120", len(annotations))
+	}
+	// The file of an annotation is relative to the root of the module.
+	wantFirst := checkAnnotation{
+		Path: "pkg/a_test.go", StartLine: 1, EndLine: 1, Level: "failure",
+		Title: "example.com/m/pkg.Test0", Message: "got 0", RawDetails: "    a_test.go:1: got 0",
+	}
+	if annotations[0] != wantFirst {
+		t.Errorf("annotation %+v, want %+v", annotations[0], wantFirst)
+	}
+	if a := annotations[119]; a.Title != "example.com/m/pkg.Test119" || a.StartLine != 120 {
+		t.Errorf("last annotation %+v, want that of Test119 at line 120", a)
+	}
+}
+
+func TestGitHubCheckPublishSuccess(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) { return 201, `{"id":1}` })
+	c := &githubCheck{API: api.URL, Repo: "o/r", SHA: "abc123", Token: "t"}
+	if err := c.Publish("tests", []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := api.received()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requests, want 1", len(reqs))
+	}
+	var run checkRun
+	reqs[0].decode(t, &run)
+	if run.Conclusion != "success" || len(run.Output.Annotations) != 0 {
+		t.Errorf("conclusion %s with %d annotations, want success with none", run.Conclusion, len(run.Output.Annotations))
+	}
+}
+
+func TestGitHubAppToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		switch r.Method + " " + r.Path {
+		case "GET /repos/o/r/installation":
+			return 200, `{"id":9}`
+		case "POST /app/installations/9/access_tokens":
+			return 201, `{"token":"ghs_installation"}`
+		}
+		return 404, `{"message":"Not Found"}`
+	})
+	t.Setenv("GITHUB_API_URL", api.URL)
+	t.Setenv("GITHUB_REPOSITORY", "o/r")
+	t.Setenv("GITHUB_SHA", "abc123")
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GITHUB_APP_ID", "1234")
+	t.Setenv("GITHUB_APP_PRIVATE_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})))
+	c, err := ambientGitHubCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Token != "ghs_installation" || c.Repo != "o/r" || c.SHA != "abc123" {
+		t.Errorf("check %+v, want the installation token on o/r at abc123", c)
+	}
+
+	// The app signs in with a JWT signed with its key.
+	reqs := api.received()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests, want 2", len(reqs))
+	}
+	for _, r := range reqs {
+		jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if !ok || len(parts) != 3 {
+			t.Fatalf("%s %s: Authorization %q, want a bearer JWT", r.Method, r.Path, r.Header.Get("Authorization"))
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("JWT signature: %v", err)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims struct {
+			Iss      string
+			Iat, Exp int64
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil || claims.Iss != "1234" || claims.Exp-claims.Iat != 600 {
+			t.Errorf("JWT claims %s, want iss 1234 valid for 10 minutes", payload)
+		}
+	}
+
+	// Without a token or app, there is no check.
+	t.Setenv("GITHUB_APP_ID", "")
+	if _, err := ambientGitHubCheck(); err == nil || !strings.Contains(err.Error(), "requires $GITHUB_TOKEN") {
+		t.Errorf("error %v, want one requiring $GITHUB_TOKEN", err)
+	}
+}
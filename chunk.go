@@ -0,0 +1,104 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chunkSuites splits suites into chunks whose reports, written by write,
+// are at most max bytes, keeping suites whole. A suite whose report alone
+// exceeds max gets a chunk of its own. The reports of the chunks are
+// returned.
+func chunkSuites(suites []TestSuite, write func([]TestSuite, io.Writer) error, max int64) ([][]byte, error) {
+	// Sizes are estimated from the reports of single suites, less the size
+	// of an empty report, and chunks that end up too large split in two.
+	var empty bytes.Buffer
+	if err := write(nil, &empty); err != nil {
+		return nil, err
+	}
+	overhead := int64(empty.Len())
+	var chunks [][]TestSuite
+	var size int64
+	start := 0
+	for i := range suites {
+		var buf bytes.Buffer
+		if err := write(suites[i:i+1], &buf); err != nil {
+			return nil, err
+		}
+		n := int64(buf.Len()) - overhead
+		if i > start && overhead+size+n > max {
+			chunks = append(chunks, suites[start:i])
+			start, size = i, 0
+		}
+		size += n
+	}
+	if start < len(suites) || len(chunks) == 0 {
+		chunks = append(chunks, suites[start:])
+	}
+	var reports [][]byte
+	for len(chunks) > 0 {
+		c := chunks[0]
+		chunks = chunks[1:]
+		var buf bytes.Buffer
+		if err := write(c, &buf); err != nil {
+			return nil, err
+		}
+		if int64(buf.Len()) > max && len(c) > 1 {
+			chunks = append([][]TestSuite{c[:len(c)/2], c[len(c)/2:]}, chunks...)
+			continue
+		}
+		if int64(buf.Len()) > max {
+			logger.Warn("suite report larger than -max-report-bytes", "suite", suiteKey(&c[0]), "bytes", buf.Len())
+		}
+		reports = append(reports, buf.Bytes())
+	}
+	return reports, nil
+}
+
+// chunkName returns the name of the nth chunk, counting from 1, of the
+// report named name, as in report-2.xml for report.xml.
+func chunkName(name string, n int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// writeChunkedReport writes the report of suites to the named file, or, if
+// it would be larger than max bytes, to numbered files holding chunks of the
+// suites, each a complete report, together with a manifest listing them in
+// order. It returns the names of the files holding the report.
+func writeChunkedReport(name, format string, suites []TestSuite, write func([]TestSuite, io.Writer) error, max int64) ([]string, error) {
+	reports, err := chunkSuites(suites, write, max)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 1 {
+		return []string{name}, os.WriteFile(name, reports[0], 0666)
+	}
+	var names []string
+	for i, r := range reports {
+		names = append(names, chunkName(name, i+1))
+		if err := os.WriteFile(names[i], r, 0666); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info("split report", "path", name, "files", len(names))
+	m := NewManifest(nil, "", suites, nil)
+	for _, n := range names {
+		m.AddOutput(n, format)
+	}
+	return names, m.Write(chunkManifestName(name))
+}
+
+// chunkManifestName returns the name of the manifest of the chunks of the
+// report named name, as in report-manifest.json for report.xml.
+func chunkManifestName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "-manifest.json"
+}
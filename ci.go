@@ -0,0 +1,145 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// ciPrefix starts the names of the properties describing the CI build a
+// report comes from.
+const ciPrefix = "ci."
+
+// runProperties are the properties describing the run, of the CI build and
+// the git checkout, recorded in each suite. JUnit XML holds them once, on the
+// <testsuites> element, rather than on each suite.
+var runProperties []Property
+
+// readRunProperties returns the properties of the CI build, unless
+// -no-ci-env is set, and of the git checkout, if -git is.
+func readRunProperties() []Property {
+	var props []Property
+	if !*noCIEnv {
+		if c := DetectCI(); c != nil {
+			props = append(props, c.Properties()...)
+		}
+	}
+	if *gitInfo {
+		g, err := ReadGit()
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+		props = append(props, g.Properties()...)
+	}
+	return props
+}
+
+// isRunProperty reports whether a property describes the run rather than a
+// suite.
+func isRunProperty(name string) bool {
+	return strings.HasPrefix(name, ciPrefix) || strings.HasPrefix(name, gitPrefix)
+}
+
+// CIEnv describes the CI build gojunit runs in.
+type CIEnv struct {
+	Provider string
+	BuildID  string
+	Branch   string
+	Commit   string
+	JobURL   string
+}
+
+// DetectCI returns the build described by the variables of GitHub Actions,
+// GitLab CI, Jenkins or Buildkite, or nil outside of them.
+func DetectCI() *CIEnv {
+	env := os.Getenv
+	switch {
+	case env("GITHUB_ACTIONS") == "true":
+		c := &CIEnv{
+			Provider: "github",
+			BuildID:  env("GITHUB_RUN_ID"),
+			Branch:   envOr("GITHUB_HEAD_REF", env("GITHUB_REF_NAME")),
+			Commit:   env("GITHUB_SHA"),
+		}
+		if repo := env("GITHUB_REPOSITORY"); repo != "" && c.BuildID != "" {
+			c.JobURL = envOr("GITHUB_SERVER_URL", "https://github.com") + "/" + repo + "/actions/runs/" + c.BuildID
+		}
+		return c
+	case env("GITLAB_CI") == "true":
+		return &CIEnv{
+			Provider: "gitlab",
+			BuildID:  env("CI_PIPELINE_ID"),
+			Branch:   envOr("CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", env("CI_COMMIT_REF_NAME")),
+			Commit:   env("CI_COMMIT_SHA"),
+			JobURL:   env("CI_JOB_URL"),
+		}
+	case env("BUILDKITE") == "true":
+		c := &CIEnv{
+			Provider: "buildkite",
+			BuildID:  env("BUILDKITE_BUILD_NUMBER"),
+			Branch:   env("BUILDKITE_BRANCH"),
+			Commit:   env("BUILDKITE_COMMIT"),
+			JobURL:   env("BUILDKITE_BUILD_URL"),
+		}
+		if job := env("BUILDKITE_JOB_ID"); job != "" && c.JobURL != "" {
+			c.JobURL += "#" + job
+		}
+		return c
+	case env("JENKINS_URL") != "":
+		return &CIEnv{
+			Provider: "jenkins",
+			BuildID:  envOr("BUILD_NUMBER", env("BUILD_ID")),
+			Branch:   strings.TrimPrefix(envOr("BRANCH_NAME", env("GIT_BRANCH")), "origin/"),
+			Commit:   env("GIT_COMMIT"),
+			JobURL:   env("BUILD_URL"),
+		}
+	}
+	return nil
+}
+
+// Properties returns the non-empty fields of c as properties.
+func (c *CIEnv) Properties() []Property {
+	var props []Property
+	for _, p := range []Property{
+		{Name: ciPrefix + "provider", Value: c.Provider},
+		{Name: ciPrefix + "build_id", Value: c.BuildID},
+		{Name: ciPrefix + "branch", Value: c.Branch},
+		{Name: ciPrefix + "commit", Value: c.Commit},
+		{Name: ciPrefix + "job_url", Value: c.JobURL},
+	} {
+		if p.Value != "" {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// AddRunProperties records props in each suite.
+func AddRunProperties(suites []TestSuite, props []Property) {
+	for i := range suites {
+		for _, p := range props {
+			suites[i].SetProperty(p.Name, p.Value)
+		}
+	}
+}
+
+// sharedRunProperties returns the run properties all suites share, which
+// suitesToXML writes on the <testsuites> element.
+func sharedRunProperties(suites []TestSuite) []Property {
+	if len(suites) == 0 {
+		return nil
+	}
+	var props []Property
+	for _, p := range suites[0].Properties {
+		if isRunProperty(p.Name) {
+			props = append(props, p)
+		}
+	}
+	for i := range suites[1:] {
+		props = sharedProperties(props, &suites[i+1])
+	}
+	return props
+}
@@ -0,0 +1,89 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A Diff is a go-cmp diff logged by a test, such as
+//
+//	foo_test.go:20: Parse() mismatch (-want +got):
+//	      []string{
+//	    - 	"a",
+//	    + 	"b",
+//	      }
+type Diff struct {
+	Header string `json:"header"` // the message introducing the diff
+	Text   string `json:"text"`   // the diff, as printed by cmp.Diff
+}
+
+// diffRE matches the legend introducing a cmp.Diff, such as (-want +got).
+var diffRE = regexp.MustCompile(`\([-+](want|got|expected|actual) [-+](want|got|expected|actual)\)`)
+
+// ParseDiffs returns the go-cmp diffs logged in output. The lines of a
+// diff are the continuation lines of the message with the legend, with the
+// indentation added by the testing package removed.
+func ParseDiffs(output string) []Diff {
+	var diffs []Diff
+	lines := strings.Split(output, "\n")
+	for i := 0; i < len(lines); i++ {
+		m := locationRE.FindStringSubmatch(lines[i])
+		if m == nil || !diffRE.MatchString(m[3]) {
+			continue
+		}
+		indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+		var text []string
+		for i+1 < len(lines) && isContinuation(lines[i+1], indent) {
+			i++
+			text = append(text, strings.TrimPrefix(strings.TrimPrefix(lines[i], indent), "    "))
+		}
+		if len(text) > 0 {
+			diffs = append(diffs, Diff{strings.TrimSpace(m[3]), strings.Join(text, "\n")})
+		}
+	}
+	return diffs
+}
+
+// isContinuation reports whether line continues a message logged with the
+// given indentation: it is indented further and not a new message.
+func isContinuation(line, indent string) bool {
+	if !strings.HasPrefix(line, indent+"    ") && !strings.HasPrefix(line, indent+"\t") {
+		return false
+	}
+	return !locationRE.MatchString(line)
+}
+
+// failureBody returns the contents of the failure element of t: its output
+// followed by a section holding each of the diffs it logged verbatim.
+func failureBody(t *TestCase) string {
+	return withDiffs(t.Output.String())
+}
+
+// withDiffs returns out followed by the text of the go-cmp diffs in it.
+func withDiffs(out string) string {
+	body := out
+	for _, d := range ParseDiffs(body) {
+		body += "\n--- " + d.Header + "\n" + d.Text + "\n"
+	}
+	return body
+}
+
+// unwrapFailureBody returns the output of the test whose failureBody is
+// body.
+func unwrapFailureBody(body string) string {
+	for i := strings.Index(body, "\n--- "); i >= 0; {
+		if out := body[:i]; withDiffs(out) == body {
+			return out
+		}
+		j := strings.Index(body[i+1:], "\n--- ")
+		if j < 0 {
+			break
+		}
+		i += 1 + j
+	}
+	return body
+}
@@ -0,0 +1,97 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+func TestParseDiffs(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string // of go test -v
+		want   []Diff // in the output of the last test
+	}{
+		{
+			"diff",
+			"=== RUN   TestParse\n" +
+				"    parse_test.go:20: Parse() mismatch (-want +got):\n" +
+				"          []string{\n" +
+				"        - \t\"a\",\n" +
+				"        + \t\"b\",\n" +
+				"          }\n" +
+				"--- FAIL: TestParse (0.00s)\n",
+			[]Diff{{"Parse() mismatch (-want +got):", "  []string{\n- \t\"a\",\n+ \t\"b\",\n  }"}},
+		},
+		{
+			"subtest",
+			"=== RUN   TestParse\n" +
+				"=== RUN   TestParse/empty\n" +
+				"    parse_test.go:31: (+got -want)\n" +
+				"          int(\n" +
+				"        - \t1,\n" +
+				"        + \t2,\n" +
+				"          )\n" +
+				"    --- FAIL: TestParse/empty (0.00s)\n" +
+				"--- FAIL: TestParse (0.00s)\n",
+			[]Diff{{"(+got -want)", "  int(\n- \t1,\n+ \t2,\n  )"}},
+		},
+		{
+			// A message logged after a diff ends it.
+			"two diffs",
+			"=== RUN   TestParse\n" +
+				"    parse_test.go:20: first (-expected +actual):\n" +
+				"        - 1\n" +
+				"        + 2\n" +
+				"    parse_test.go:21: got 2\n" +
+				"    parse_test.go:22: second (-want +got):\n" +
+				"        - x\n" +
+				"--- FAIL: TestParse (0.00s)\n",
+			[]Diff{{"first (-expected +actual):", "- 1\n+ 2"}, {"second (-want +got):", "- x"}},
+		},
+		{
+			// The output of a test cut short ends in the middle of a diff.
+			"truncated",
+			"=== RUN   TestParse\n" +
+				"    parse_test.go:20: Parse() mismatch (-want +got):\n" +
+				"          []string{\n" +
+				"        - \t\"a\",\n",
+			[]Diff{{"Parse() mismatch (-want +got):", "  []string{\n- \t\"a\","}},
+		},
+		{
+			"no diff lines",
+			"=== RUN   TestParse\n    parse_test.go:20: Parse() mismatch (-want +got):\n--- FAIL: TestParse (0.00s)\n",
+			nil,
+		},
+		{
+			"no legend",
+			"=== RUN   TestParse\n    parse_test.go:20: mismatch (want got):\n        - 1\n--- FAIL: TestParse (0.00s)\n",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := junit.ParseOutput(strings.NewReader(tt.output + "FAIL\nFAIL\tx/m\t0.01s\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suites) != 1 || len(suites[0].TestCases) == 0 {
+				t.Fatalf("got %v, want one suite with tests", suites)
+			}
+			out := suites[0].TestCases[len(suites[0].TestCases)-1].Output.String()
+			got := ParseDiffs(out)
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("ParseDiffs(%q)\n = %q\nwant %q", out, got, tt.want)
+			}
+			if body := withDiffs(out); unwrapFailureBody(body) != out {
+				t.Errorf("unwrapFailureBody(%q) = %q, want %q", body, unwrapFailureBody(body), out)
+			}
+		})
+	}
+}
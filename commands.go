@@ -0,0 +1,150 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// A command is a subcommand of gojunit.
+type command struct {
+	Name  string
+	Args  string // the arguments following the flags in its usage line
+	Short string // what it does, in a line
+
+	// Main runs the commands with flags of their own. The others take the
+	// flags of the command line, which select how results are processed
+	// and reported, and are run by main.
+	Main func(args []string)
+}
+
+// commands returns the subcommands of gojunit. gojunit without one runs
+// convert.
+func commands() []*command {
+	return []*command{
+		{Name: "convert", Args: "[< go test output]", Short: "convert the output of go test, read from standard input or -i files, into reports"},
+		{Name: "run", Args: "[packages] [-- go test flags]", Short: "run go test and report its results"},
+		{Name: "list", Args: "[packages] [-- go test flags]", Short: "report the tests of packages, found with go test -list, without running them"},
+		{Name: "serve", Short: "serve a web UI and an API storing the results of runs"},
+		{Name: "notify", Args: "[< go test output]", Short: "email a digest of the failures of the results read like convert"},
+		{Name: "tui", Args: "report...", Short: "browse the suites and tests of reports in the terminal, and run tests again", Main: tuiMain},
+		{Name: "suggest-quarantine", Short: "list the flaky tests of the runs kept by gojunit serve, for -quarantine", Main: suggestQuarantineMain},
+		{Name: "stale", Short: "report the tests of the runs kept by gojunit serve that have been skipped or not run for a while", Main: staleMain},
+		{Name: "stylesheet", Short: "write an XSLT stylesheet with which browsers render JUnit XML reports, for -stylesheet", Main: stylesheetMain},
+		{Name: "bundle", Args: "-o results.zip input...", Short: "write an HTML and a JSON report of inputs, the inputs and the history of their results to a single archive", Main: bundleMain},
+		{Name: "affected", Args: "[packages]", Short: "list the packages whose tests are affected by changed files, found with go list -deps", Main: affectedMain},
+		{Name: "flake-scores", Short: "estimate how often each flaky test of the runs kept by gojunit serve fails, with confidence intervals", Main: flakeScoresMain},
+		{Name: "history", Args: "prune|compact [flags]", Short: "delete old runs kept by gojunit serve, or collapse them into one run a day", Main: historyMain},
+		{Name: "benchdiff", Args: "old new", Short: "compare two sets of benchmark results", Main: benchdiffMain},
+		{Name: "completion", Args: "bash|zsh|fish", Short: "write a shell completion script", Main: completionMain},
+		{Name: "help", Args: "[command]", Short: "describe a command and its flags", Main: helpMain},
+	}
+}
+
+// lookupCommand returns the subcommand with the given name, or nil.
+func lookupCommand(name string) *command {
+	for _, c := range commands() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// commandFlags lists the commands taking the flags that not all commands
+// reporting results take.
+var commandFlags = map[string][]string{
+	"i":                 {"convert", "notify"},
+	"from":              {"convert", "notify"},
+	"j":                 {"convert", "notify"},
+	"tee":               {"convert", "notify"},
+	"record-env":        {"run"},
+	"parallel-packages": {"run"},
+	"order-by-duration": {"run"},
+	"fail-fast":         {"run"},
+	"changed-files":     {"run"},
+	"listen":            {"serve"},
+	"max-body":          {"serve"},
+	"store":             {"serve"},
+	"email":             {"notify"},
+	"email-from":        {"notify"},
+	"smtp":              {"notify"},
+	"smtp-user":         {"notify"},
+	"notify-passing":    {"notify"},
+}
+
+// takes reports whether c takes the named flag of the command line.
+func (c *command) takes(name string) bool {
+	cmds, ok := commandFlags[name]
+	if !ok {
+		return c.Main == nil
+	}
+	for _, cmd := range cmds {
+		if cmd == c.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// flagSet returns a flag set holding the flags of the command line that c
+// takes. Its usage also lists the commands of gojunit when c is run
+// without being named.
+func (c *command) flagSet(named bool) *flag.FlagSet {
+	fs := flag.NewFlagSet("gojunit "+c.Name, flag.ExitOnError)
+	flag.VisitAll(func(f *flag.Flag) {
+		if c.takes(f.Name) {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fs.Usage = func() {
+		w := fs.Output()
+		if !named {
+			writeCommands(w)
+			fmt.Fprintf(w, "\nFlags of convert:\n")
+		} else {
+			fmt.Fprintf(w, "usage: gojunit %s [flags] %s\n\n%s.\n\nFlags:\n", c.Name, c.Args, strings.ToUpper(c.Short[:1])+c.Short[1:])
+		}
+		fs.PrintDefaults()
+		fmt.Fprint(w, exitCodesHelp)
+	}
+	return fs
+}
+
+// writeCommands writes the usage of gojunit and the list of its commands.
+func writeCommands(w io.Writer) {
+	fmt.Fprintf(w, "usage: gojunit [command] [flags] [arguments]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Short)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nWithout a command, gojunit runs convert. Run gojunit help command for the\nflags of a command.\n")
+}
+
+// helpMain runs gojunit help, which describes a command or lists them all.
+func helpMain(args []string) {
+	if len(args) == 0 {
+		writeCommands(os.Stdout)
+		return
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "gojunit help: unknown command %q\n", args[0])
+		os.Exit(exitParse)
+	}
+	if c.Main != nil {
+		c.Main([]string{"-h"})
+		return
+	}
+	fs := c.flagSet(true)
+	fs.SetOutput(os.Stdout)
+	fs.Usage()
+}
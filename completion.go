@@ -0,0 +1,128 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// A completedFlag is a flag as described to shell completions.
+type completedFlag struct {
+	Name   string
+	Usage  string
+	Bool   bool     // takes no value
+	Values []string // the values it takes, if they are a fixed set
+}
+
+// completedFlags returns the flags of gojunit, sorted by name.
+func completedFlags() []completedFlag {
+	formats := []string{"sqlite", "template"}
+	for name := range writers {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	froms := junit.Formats()
+	values := map[string][]string{
+		"format":          formats,
+		"to":              formats,
+		"from":            froms,
+		"classname-style": {"go", "java"},
+		"merge-suites":    {"matrix", "union"},
+	}
+	var flags []completedFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completedFlag{f.Name, f.Usage, ok && b.IsBoolFlag(), values[f.Name]})
+	})
+	return flags
+}
+
+// completionCommands returns the names of the subcommands of gojunit.
+func completionCommands() []string {
+	var names []string
+	for _, c := range commands() {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// completionMain runs gojunit completion, which writes the completion
+// script of a shell.
+func completionMain(args []string) {
+	writers := map[string]func(io.Writer, []string, []completedFlag){
+		"bash": writeBashCompletion,
+		"zsh":  writeZshCompletion,
+		"fish": writeFishCompletion,
+	}
+	if len(args) != 1 || writers[args[0]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: gojunit completion bash|zsh|fish")
+		os.Exit(exitParse)
+	}
+	w := bufio.NewWriter(os.Stdout)
+	writers[args[0]](w, completionCommands(), completedFlags())
+	if err := w.Flush(); err != nil {
+		fatal(exitInfra, err)
+	}
+}
+
+func writeBashCompletion(w io.Writer, cmds []string, flags []completedFlag) {
+	var names []string
+	fmt.Fprintf(w, "_gojunit() {\n")
+	fmt.Fprintf(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	fmt.Fprintf(w, "\tcase $prev in\n")
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+		if f.Values != nil {
+			fmt.Fprintf(w, "\t-%s)\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\treturn ;;\n", f.Name, strings.Join(f.Values, " "))
+		}
+	}
+	fmt.Fprintf(w, "\tesac\n")
+	fmt.Fprintf(w, "\tif [[ $cur == -* ]]; then\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "\telif [[ $COMP_CWORD -eq 1 ]]; then\n\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(cmds, " "))
+	fmt.Fprintf(w, "\telse\n\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n\tfi\n}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _gojunit gojunit\n")
+}
+
+func writeZshCompletion(w io.Writer, cmds []string, flags []completedFlag) {
+	esc := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	fmt.Fprintf(w, "#compdef gojunit\n\n_arguments \\\n")
+	fmt.Fprintf(w, "\t'1:command:(%s)' \\\n", strings.Join(cmds, " "))
+	for _, f := range flags {
+		fmt.Fprintf(w, "\t'-%s[%s]", f.Name, esc.Replace(f.Usage))
+		switch {
+		case f.Bool:
+		case f.Values != nil:
+			fmt.Fprintf(w, ":%s:(%s)", f.Name, strings.Join(f.Values, " "))
+		default:
+			fmt.Fprintf(w, ":%s:_files", f.Name)
+		}
+		fmt.Fprintf(w, "' \\\n")
+	}
+	fmt.Fprintf(w, "\t'*:file:_files'\n")
+}
+
+func writeFishCompletion(w io.Writer, cmds []string, flags []completedFlag) {
+	esc := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	fmt.Fprintf(w, "complete -c gojunit -n __fish_use_subcommand -f -a '%s'\n", strings.Join(cmds, " "))
+	for _, f := range flags {
+		fmt.Fprintf(w, "complete -c gojunit -o %s -d '%s'", f.Name, esc.Replace(f.Usage))
+		switch {
+		case f.Bool:
+		case f.Values != nil:
+			fmt.Fprintf(w, " -x -a '%s'", strings.Join(f.Values, " "))
+		default:
+			fmt.Fprintf(w, " -r -F")
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// locationRE matches the file:line prefix that the testing package adds to
+// messages logged by t.Error, t.Log and friends, as well as the
+// file:line:column prefix of compiler errors.
+var locationRE = regexp.MustCompile(`^\s*([\w./\\-]+\.go):(\d+)(?::\d+)?: ?(.*)$`)
+
+// FailureLocation returns the source location and message of the first line in
+// output that was logged by the testing package. It returns an empty file
+// name if no such line exists.
+func FailureLocation(output string) (file string, line int, message string) {
+	for _, l := range strings.Split(output, "\n") {
+		if m := locationRE.FindStringSubmatch(l); m != nil {
+			line, _ = strconv.Atoi(m[2])
+			return m[1], line, m[3]
+		}
+	}
+	return "", 0, ""
+}
+
+// skipReason returns the message of the last line in output that was logged
+// by the testing package: t.Skip logs its reason before the test stops.
+func skipReason(output string) string {
+	var reason string
+	for _, l := range strings.Split(output, "\n") {
+		if m := locationRE.FindStringSubmatch(l); m != nil {
+			reason = m[3]
+		}
+	}
+	return reason
+}
+
+// WriteCSV writes a slice of TestSuites to a writer as CSV, one row per test
+// case. The duration column is in seconds. When there are benchmarks, the
+// columns of their results follow, empty for tests and for the throughput
+// and allocations that a benchmark does not report.
+func WriteCSV(suites []TestSuite, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"package", "test", "status", "duration", "file", "line", "message"}
+	benchmarks := hasBenchmarks(suites)
+	if benchmarks {
+		header = append(header, benchmarkColumns...)
+	}
+	cw.Write(header)
+	for _, suite := range suites {
+		for _, t := range suite.TestCases {
+			var file, line, message string
+			if t.Status != Success {
+				f, l, _ := FailureLocation(t.Output.String())
+				if f != "" {
+					file, line = f, strconv.Itoa(l)
+				}
+				message = messageOf(&t)
+			}
+			row := []string{
+				suite.Name,
+				t.Name,
+				t.Status.String(),
+				strconv.FormatFloat(t.Duration.Seconds(), 'f', -1, 64),
+				file,
+				line,
+				message,
+			}
+			if benchmarks {
+				for _, c := range benchmarkColumns {
+					row = append(row, t.Property(c))
+				}
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// The exit codes of gojunit, which wrapper scripts can branch on. When
+// several apply, the highest is used.
+const (
+	exitOK       = 0
+	exitFailures = 1 // tests run by gojunit run failed, or tests of -baseline did not run
+	exitParse    = 2 // the flags, a file they name, or the input could not be parsed
+	exitGate     = 3 // the -gate or skip budget was exceeded
+	exitInfra    = 4 // tests could not be run, or reports written, sent or uploaded
+)
+
+// exitCodesHelp documents the exit codes in -help.
+const exitCodesHelp = `
+Exit codes:
+  0  success
+  1  tests run by gojunit run failed, or tests of -baseline did not run
+  2  the flags, a file they name, or the input could not be parsed
+  3  the -gate, -max-skipped or -max-skip-ratio budget was exceeded
+  4  infrastructure error: the tests could not be run, a report could not be
+     written, published or uploaded, or the run was interrupted
+
+Converting results that hold failed tests is a success; -gate 'failures==0'
+makes it exit with status 3.
+`
+
+// exitCode returns the exit code of a run in which tests failed, the gate
+// was exceeded, or which was interrupted.
+func exitCode(failed, gated, interrupted bool) int {
+	switch {
+	case interrupted:
+		return exitInfra
+	case gated:
+		return exitGate
+	case failed:
+		return exitFailures
+	}
+	return exitOK
+}
+
+// fatal logs v, like log.Fatal, and exits with code.
+func fatal(code int, v ...interface{}) {
+	log.Print(v...)
+	os.Exit(code)
+}
+
+// fatalf is like fatal but formats its arguments like log.Fatalf.
+func fatalf(code int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(code)
+}
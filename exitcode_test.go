@@ -0,0 +1,26 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		failed, gated, interrupted bool
+		want                       int
+	}{
+		{false, false, false, exitOK},
+		{true, false, false, exitFailures},
+		{false, true, false, exitGate},
+		{true, true, false, exitGate},
+		{false, false, true, exitInfra},
+		{true, true, true, exitInfra},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.failed, tt.gated, tt.interrupted); got != tt.want {
+			t.Errorf("exitCode(%v, %v, %v) = %d, want %d", tt.failed, tt.gated, tt.interrupted, got, tt.want)
+		}
+	}
+}
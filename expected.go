@@ -0,0 +1,109 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// An ExpectedFailure lists tests that are known to fail.
+type ExpectedFailure struct {
+	Pattern *regexp.Regexp // matched against the whole of "suite/test"
+	Reason  string
+}
+
+// Messages of tests on the expected failures list.
+const (
+	expectedFailure    = "expected failure"
+	unexpectedlyPassed = "passed unexpectedly; remove it from the expected failures"
+)
+
+// ReadExpectedFailures reads a list of expected failures. Each line holds a
+// regular expression, which must match the whole "suite/test" name of a
+// test, or of the test whose subtests it is, optionally followed by the
+// reason the tests fail. Blank lines and lines starting with # are ignored.
+func ReadExpectedFailures(path string) ([]ExpectedFailure, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var list []ExpectedFailure
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, reason := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			pattern, reason = line[:i], strings.TrimSpace(line[i:])
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		list = append(list, ExpectedFailure{re, reason})
+	}
+	return list, s.Err()
+}
+
+// MarkExpectedFailures applies a list of expected failures to suites. Tests
+// on the list that failed or had an error are marked as skipped, so that
+// they do not fail the run, and get the "expected_failure" property. Tests on
+// the list that passed are marked as failed, so that the list is kept
+// current.
+func MarkExpectedFailures(suites []TestSuite, list []ExpectedFailure) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			for _, e := range list {
+				if !e.lists(s.Name, t.Name) {
+					continue
+				}
+				switch t.Status {
+				case Failure, Error:
+					msg := expectedFailure
+					if e.Reason != "" {
+						msg += ": " + e.Reason
+					}
+					if m := messageOf(t); m != "" {
+						msg += " (" + m + ")"
+					}
+					t.Status, t.Message = Skipped, msg
+					t.SetProperty("expected_failure", "true")
+				case Success:
+					// Listing a test covers its subtests, not all of which
+					// need to fail.
+					if i := strings.LastIndex(t.Name, "/"); i >= 0 && e.lists(s.Name, t.Name[:i]) {
+						break
+					}
+					t.Status, t.Message = Failure, unexpectedlyPassed
+				}
+				break
+			}
+		}
+	}
+}
+
+// lists reports whether e names the given test of suite, or a test whose
+// subtest it is.
+func (e ExpectedFailure) lists(suite, test string) bool {
+	for {
+		if e.Pattern.MatchString(suite + "/" + test) {
+			return true
+		}
+		i := strings.LastIndex(test, "/")
+		if i < 0 {
+			return false
+		}
+		test = test[:i]
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkExpectedFailures(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "expected.txt")
+	if err := os.WriteFile(list, []byte("# known\nx/m/TestFlaky tracked elsewhere\nx/m/TestParent\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ReadExpectedFailures(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		suite, test string
+		status      Status
+		want        Status
+		wantMessage string
+	}{
+		{"x/m", "TestFlaky", Failure, Skipped, "expected failure: tracked elsewhere"},
+		{"x/m", "TestFlaky", Success, Failure, unexpectedlyPassed},
+		// The patterns match whole names only.
+		{"x/m", "TestFlakyToo", Failure, Failure, ""},
+		{"x/m", "TestFlakyToo", Success, Success, ""},
+		{"other/x/m", "TestFlaky", Failure, Failure, ""},
+		{"x/m/sub", "TestFlaky", Failure, Failure, ""},
+		// A listed test covers its subtests, which need not all fail.
+		{"x/m", "TestParent/one", Error, Skipped, "expected failure"},
+		{"x/m", "TestParent/two", Success, Success, ""},
+		{"x/m", "TestParentless/one", Failure, Failure, ""},
+	}
+	for _, tt := range tests {
+		suites := []TestSuite{{Name: tt.suite, TestCases: []TestCase{{Name: tt.test, Status: tt.status}}}}
+		MarkExpectedFailures(suites, expected)
+		got := suites[0].TestCases[0]
+		if got.Status != tt.want || got.Message != tt.wantMessage {
+			t.Errorf("%s/%s %v: got %v %q, want %v %q", tt.suite, tt.test, tt.status, got.Status, got.Message, tt.want, tt.wantMessage)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A FailureReport reports the first test that fails, as soon as it fails,
+// without waiting for the other tests: it prints its output to W and writes a
+// JUnit XML report of the test alone to the file named by Path. It is safe for
+// concurrent use.
+type FailureReport struct {
+	Path string
+	W    io.Writer
+
+	once sync.Once
+}
+
+// Failed reports tc, which failed in the named package, if no test failed
+// before it.
+func (r *FailureReport) Failed(pkg string, tc TestCase) {
+	r.once.Do(func() {
+		name := tc.Name
+		if pkg != "" {
+			name = pkg + "." + tc.Name
+		}
+		fmt.Fprintf(r.W, "first failure: %s\n", name)
+		if out := strings.TrimRight(tc.Output.String(), "\n"); out != "" {
+			fmt.Fprintln(r.W, out)
+		} else if tc.Message != "" {
+			fmt.Fprintln(r.W, tc.Message)
+		}
+		if r.Path == "" {
+			return
+		}
+		suite := TestSuite{Name: pkg, Duration: tc.Duration, TestCases: []TestCase{tc}}
+		if err := writeFailureReport(r.Path, suite); err != nil {
+			logger.Warn("cannot write the first failure", "error", err)
+		}
+	})
+}
+
+func writeFailureReport(path string, suite TestSuite) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteXML([]TestSuite{suite}, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,184 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A FlakeScore is the estimated probability that a run of a flaky test
+// fails, with its 95% confidence interval, which narrows as the test runs
+// more often.
+type FlakeScore struct {
+	Suite       string    `json:"suite"`
+	Test        string    `json:"test"`
+	Runs        int       `json:"runs"`
+	Failures    int       `json:"failures"`
+	Probability float64   `json:"probability"`
+	Low         float64   `json:"confidence_low"`
+	High        float64   `json:"confidence_high"`
+	LastFailure time.Time `json:"last_failure"`
+	LastRun     string    `json:"last_run"`
+}
+
+// ScoreFlakes returns the scores of the flaky tests of stats, ordered by the
+// low end of their confidence intervals, so that the tests most surely
+// failing often come first, and a test failing 1 of 2 runs comes after one
+// failing 20 of 100.
+func ScoreFlakes(stats []FlakeStats) []FlakeScore {
+	var scores []FlakeScore
+	for _, f := range stats {
+		if !f.Flaky() {
+			continue
+		}
+		low, high := wilsonInterval(f.Failures, f.Runs)
+		scores = append(scores, FlakeScore{
+			Suite: f.Suite, Test: f.Test, Runs: f.Runs, Failures: f.Failures,
+			Probability: f.Rate(), Low: low, High: high,
+			LastFailure: f.LastFailure, LastRun: f.LastRun,
+		})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Low > scores[j].Low })
+	return scores
+}
+
+// wilsonInterval returns the 95% Wilson score interval of the probability of
+// failure of a test that failed k of n runs, which unlike the normal
+// approximation holds for the few runs and rare failures of flaky tests.
+func wilsonInterval(k, n int) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	const z = 1.96
+	p, fn := float64(k)/float64(n), float64(n)
+	d := 1 + z*z/fn
+	center := (p + z*z/(2*fn)) / d
+	half := z * math.Sqrt(p*(1-p)/fn+z*z/(4*fn*fn)) / d
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
+
+// WriteFlakeScoresJSON writes scores as a JSON array.
+func WriteFlakeScoresJSON(scores []FlakeScore, w io.Writer) error {
+	if scores == nil {
+		scores = []FlakeScore{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(scores)
+}
+
+// WriteFlakeScoresCSV writes scores as CSV, one row per test.
+func WriteFlakeScoresCSV(scores []FlakeScore, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"package", "test", "runs", "failures", "probability", "confidence_low", "confidence_high", "last_failure", "last_run"})
+	for _, s := range scores {
+		cw.Write([]string{
+			s.Suite, s.Test, strconv.Itoa(s.Runs), strconv.Itoa(s.Failures),
+			formatProbability(s.Probability), formatProbability(s.Low), formatProbability(s.High),
+			s.LastFailure.UTC().Format(time.RFC3339), s.LastRun,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatProbability(p float64) string {
+	return strconv.FormatFloat(p, 'f', 4, 64)
+}
+
+// ReadFlakeScores reads scores written by WriteFlakeScoresJSON.
+func ReadFlakeScores(path string) ([]FlakeScore, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scores []FlakeScore
+	if err := json.Unmarshal(b, &scores); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return scores, nil
+}
+
+// AddFlakeScores sets the flake_probability, flake_confidence_low,
+// flake_confidence_high and flake_runs properties of the tests of suites
+// that have scores.
+func AddFlakeScores(suites []TestSuite, scores []FlakeScore) {
+	index := make(map[string]*FlakeScore, len(scores))
+	for i := range scores {
+		index[flakeKey(scores[i].Suite, scores[i].Test)] = &scores[i]
+	}
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			f := index[flakeKey(s.Name, t.Name)]
+			if f == nil {
+				continue
+			}
+			t.SetProperty("flake_probability", formatProbability(f.Probability))
+			t.SetProperty("flake_confidence_low", formatProbability(f.Low))
+			t.SetProperty("flake_confidence_high", formatProbability(f.High))
+			t.SetProperty("flake_runs", strconv.Itoa(f.Runs))
+		}
+	}
+}
+
+// flakeScoresMain runs gojunit flake-scores, which scores the flaky tests of
+// the runs kept by gojunit serve.
+func flakeScoresMain(args []string) {
+	fs := flag.NewFlagSet("flake-scores", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit flake-scores [flags]")
+		fs.PrintDefaults()
+	}
+	dir := fs.String("store", "", "store in which gojunit serve keeps runs, as for its -store flag")
+	last := fs.Int("runs", 50, "score the tests over only this many of the latest runs; 0 for all")
+	format := fs.String("format", "json", "report format: json, which -flake-scores reads, or csv")
+	output := fs.String("o", "", "write the report to this file instead of standard output")
+	fs.Parse(args)
+	if *dir == "" || fs.NArg() > 0 || *format != "json" && *format != "csv" {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	store, err := OpenStore(*dir)
+	if err == nil {
+		var runs []*Run
+		if runs, err = store.List(); err == nil {
+			if *last > 0 && len(runs) > *last {
+				runs = runs[:*last]
+			}
+			err = writeFlakeScores(*output, *format, ScoreFlakes(CollectFlakeStats(runs)))
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit flake-scores:", err)
+		os.Exit(exitInfra)
+	}
+}
+
+func writeFlakeScores(name, format string, scores []FlakeScore) error {
+	write := WriteFlakeScoresJSON
+	if format == "csv" {
+		write = WriteFlakeScoresCSV
+	}
+	if name == "" {
+		return write(scores, os.Stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	return errors.Join(write(scores, f), f.Close())
+}
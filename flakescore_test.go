@@ -0,0 +1,83 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddFlakeScores(t *testing.T) {
+	// Joined with a slash, the suite and test names of these scores would
+	// be the same.
+	scores := []FlakeScore{
+		{Suite: "x/m", Test: "TestA/sub", Probability: 0.25, Runs: 8},
+		{Suite: "x/m/TestA", Test: "sub", Probability: 0.5, Runs: 4},
+	}
+	suites := []TestSuite{
+		{Name: "x/m", TestCases: []TestCase{{Name: "TestA/sub"}, {Name: "TestB"}}},
+		{Name: "x/m/TestA", TestCases: []TestCase{{Name: "sub"}}},
+	}
+	AddFlakeScores(suites, scores)
+	tests := []struct {
+		tc       *TestCase
+		wantProb string
+		wantRuns string
+	}{
+		{&suites[0].TestCases[0], "0.2500", "8"},
+		{&suites[0].TestCases[1], "", ""},
+		{&suites[1].TestCases[0], "0.5000", "4"},
+	}
+	for _, tt := range tests {
+		if got := tt.tc.Property("flake_probability"); got != tt.wantProb {
+			t.Errorf("%s: flake_probability %q, want %q", tt.tc.Name, got, tt.wantProb)
+		}
+		if got := tt.tc.Property("flake_runs"); got != tt.wantRuns {
+			t.Errorf("%s: flake_runs %q, want %q", tt.tc.Name, got, tt.wantRuns)
+		}
+	}
+}
+
+func TestCollectFlakeStats(t *testing.T) {
+	// x/m TestA/sub fails every other run and x/m/TestA sub never fails.
+	// Joined with a slash, their results would be counted together.
+	var runs []*Run
+	for i := 0; i < 4; i++ {
+		status := Success
+		if i%2 == 0 {
+			status = Failure
+		}
+		runs = append(runs, &Run{ID: fmt.Sprintf("r%d", i), Suites: []TestSuite{
+			{Name: "x/m", TestCases: []TestCase{{Name: "TestA/sub", Status: status}}},
+			{Name: "x/m/TestA", TestCases: []TestCase{{Name: "sub"}}},
+		}})
+	}
+	stats := CollectFlakeStats(runs)
+	want := []FlakeStats{
+		{Suite: "x/m", Test: "TestA/sub", Runs: 4, Failures: 2, LastRun: "r0"},
+		{Suite: "x/m/TestA", Test: "sub", Runs: 4},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("stats %+v, want %+v", stats, want)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("stats[%d] = %+v, want %+v", i, stats[i], want[i])
+		}
+	}
+
+	scores := ScoreFlakes(stats)
+	if len(scores) != 1 || scores[0].Suite != "x/m" || scores[0].Test != "TestA/sub" {
+		t.Fatalf("scores %+v, want one of x/m TestA/sub", scores)
+	}
+	suites := runs[0].Suites
+	AddFlakeScores(suites, scores)
+	if got := suites[0].TestCases[0].Property("flake_probability"); got != "0.5000" {
+		t.Errorf("x/m TestA/sub: flake_probability %q, want 0.5000", got)
+	}
+	if got := suites[1].TestCases[0].Property("flake_probability"); got != "" {
+		t.Errorf("x/m/TestA sub: flake_probability %q, want none", got)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A Gate is a condition on the aggregate results of a run, such as
+//
+//	failures==0 && skipped<5 && time<10m
+//
+// Gates compare the variables below with numbers or durations using ==, !=,
+// <, <=, > and >=, and combine comparisons with &&, || and !, grouped by
+// parentheses.
+//
+//	tests     the number of test cases
+//	passed    the number of test cases that passed
+//	failures  the number of test cases that failed
+//	errors    the number of test cases with errors
+//	skipped   the number of skipped test cases
+//	suites    the number of suites
+//	passrate  the percentage of test cases, not counting skipped ones, that passed
+//	time      the total duration of the suites
+type Gate struct {
+	text string
+	expr gateExpr
+}
+
+// gateVars are the variables of gates, computed from the results.
+type gateVars map[string]float64
+
+var gateVarNames = []string{"tests", "passed", "failures", "errors", "skipped", "suites", "passrate", "time"}
+
+func newGateVars(suites []TestSuite) gateVars {
+	var c Counts
+	var d time.Duration
+	for i := range suites {
+		c.Add(&suites[i])
+		d += suites[i].Duration
+	}
+	passed := c.Tests - c.Failures - c.Errors - c.Skipped
+	rate := 100.0
+	if run := c.Tests - c.Skipped; run > 0 {
+		rate = 100 * float64(passed) / float64(run)
+	}
+	return gateVars{
+		"tests":    float64(c.Tests),
+		"passed":   float64(passed),
+		"failures": float64(c.Failures),
+		"errors":   float64(c.Errors),
+		"skipped":  float64(c.Skipped),
+		"suites":   float64(len(suites)),
+		"passrate": rate,
+		"time":     d.Seconds(),
+	}
+}
+
+// ParseGate parses a gate expression.
+func ParseGate(text string) (*Gate, error) {
+	toks, err := gateTokens(text)
+	if err != nil {
+		return nil, fmt.Errorf("gate %q: %v", text, err)
+	}
+	p := &gateParser{toks: toks}
+	expr, err := p.or()
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gate %q: %v", text, err)
+	}
+	return &Gate{text, expr}, nil
+}
+
+func (g *Gate) String() string { return g.text }
+
+// Check evaluates the gate against suites. If the gate is not met, it
+// returns an error explaining which comparisons failed.
+func (g *Gate) Check(suites []TestSuite) error {
+	vars := newGateVars(suites)
+	if g.expr.eval(vars) {
+		return nil
+	}
+	var failed []string
+	g.expr.explain(vars, &failed)
+	return fmt.Errorf("gate %s not met: %s", g.text, strings.Join(failed, ", "))
+}
+
+// CheckSkips checks that no more than max tests of suites, if max is not
+// negative, and no more than the fraction ratio of their tests were skipped.
+// If more were, it returns an error listing the skipped tests and their
+// reasons.
+func CheckSkips(suites []TestSuite, max int, ratio float64) error {
+	var c Counts
+	for i := range suites {
+		c.Add(&suites[i])
+	}
+	var over string
+	switch {
+	case max >= 0 && c.Skipped > max:
+		over = fmt.Sprintf("more than %d", max)
+	case c.Tests > 0 && float64(c.Skipped) > ratio*float64(c.Tests):
+		over = fmt.Sprintf("more than %g of %d tests", ratio, c.Tests)
+	default:
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "skip budget exceeded: %d tests skipped, %s", c.Skipped, over)
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			if t := &suites[i].TestCases[j]; t.Status == Skipped {
+				reason := messageOf(t)
+				if reason == "" {
+					reason = noSkipReason
+				}
+				fmt.Fprintf(&b, "\n\t%s.%s: %s", suiteKey(&suites[i]), t.Name, reason)
+			}
+		}
+	}
+	return errors.New(b.String())
+}
+
+type gateExpr interface {
+	eval(vars gateVars) bool
+	// explain appends the comparisons that evaluate to false to failed.
+	explain(vars gateVars, failed *[]string)
+}
+
+type gateAnd struct{ x, y gateExpr }
+type gateOr struct{ x, y gateExpr }
+type gateNot struct {
+	x    gateExpr
+	text string
+}
+
+type gateCmp struct {
+	op   string
+	x, y gateOperand
+}
+
+// A gateOperand is a variable or a constant.
+type gateOperand struct {
+	name  string // variable name, or "" for a constant
+	value float64
+	text  string
+}
+
+func (o gateOperand) get(vars gateVars) float64 {
+	if o.name != "" {
+		return vars[o.name]
+	}
+	return o.value
+}
+
+func (e gateAnd) eval(vars gateVars) bool { return e.x.eval(vars) && e.y.eval(vars) }
+func (e gateOr) eval(vars gateVars) bool  { return e.x.eval(vars) || e.y.eval(vars) }
+func (e gateNot) eval(vars gateVars) bool { return !e.x.eval(vars) }
+
+func (e gateCmp) eval(vars gateVars) bool {
+	x, y := e.x.get(vars), e.y.get(vars)
+	switch e.op {
+	case "==":
+		return x == y
+	case "!=":
+		return x != y
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	default:
+		return x >= y
+	}
+}
+
+func (e gateAnd) explain(vars gateVars, failed *[]string) {
+	e.x.explain(vars, failed)
+	e.y.explain(vars, failed)
+}
+
+func (e gateOr) explain(vars gateVars, failed *[]string) {
+	e.x.explain(vars, failed)
+	e.y.explain(vars, failed)
+}
+
+func (e gateNot) explain(vars gateVars, failed *[]string) {
+	if e.eval(vars) {
+		return
+	}
+	*failed = append(*failed, e.text+" is false")
+}
+
+func (e gateCmp) explain(vars gateVars, failed *[]string) {
+	if e.eval(vars) {
+		return
+	}
+	msg := e.x.text + e.op + e.y.text
+	for _, o := range []gateOperand{e.x, e.y} {
+		if o.name != "" {
+			msg += fmt.Sprintf(" (%s is %s)", o.name, formatGateVar(o.name, o.get(vars)))
+		}
+	}
+	*failed = append(*failed, msg)
+}
+
+func formatGateVar(name string, v float64) string {
+	if name == "time" {
+		return time.Duration(v * float64(time.Second)).Round(time.Millisecond).String()
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// gateTokens splits a gate expression into tokens.
+func gateTokens(text string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.ContainsRune("()", rune(c)):
+			toks = append(toks, text[i:i+1])
+			i++
+		case strings.HasPrefix(text[i:], "&&") || strings.HasPrefix(text[i:], "||") ||
+			strings.HasPrefix(text[i:], "==") || strings.HasPrefix(text[i:], "!=") ||
+			strings.HasPrefix(text[i:], "<=") || strings.HasPrefix(text[i:], ">="):
+			toks = append(toks, text[i:i+2])
+			i += 2
+		case strings.ContainsRune("<>!", rune(c)):
+			toks = append(toks, text[i:i+1])
+			i++
+		case unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || c == '.' || c == '_':
+			j := i
+			for j < len(text) && (unicode.IsLetter(rune(text[j])) || unicode.IsDigit(rune(text[j])) || text[j] == '.' || text[j] == '_') {
+				j++
+			}
+			toks = append(toks, text[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type gateParser struct {
+	toks []string
+	pos  int
+}
+
+func (p *gateParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *gateParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *gateParser) or() (gateExpr, error) {
+	x, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.next()
+		var y gateExpr
+		if y, err = p.and(); err == nil {
+			x = gateOr{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *gateParser) and() (gateExpr, error) {
+	x, err := p.unary()
+	for err == nil && p.peek() == "&&" {
+		p.next()
+		var y gateExpr
+		if y, err = p.unary(); err == nil {
+			x = gateAnd{x, y}
+		}
+	}
+	return x, err
+}
+
+func (p *gateParser) unary() (gateExpr, error) {
+	switch p.peek() {
+	case "!":
+		start := p.pos
+		p.next()
+		x, err := p.unary()
+		return gateNot{x, strings.Join(p.toks[start:p.pos], "")}, err
+	case "(":
+		p.next()
+		x, err := p.or()
+		if err == nil && p.next() != ")" {
+			err = fmt.Errorf("missing )")
+		}
+		return x, err
+	}
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	case "":
+		return nil, fmt.Errorf("missing comparison after %s", x.text)
+	default:
+		return nil, fmt.Errorf("unexpected %q after %s", op, x.text)
+	}
+	y, err := p.operand()
+	return gateCmp{op, x, y}, err
+}
+
+func (p *gateParser) operand() (gateOperand, error) {
+	t := p.next()
+	if t == "" {
+		return gateOperand{}, fmt.Errorf("unexpected end")
+	}
+	for _, name := range gateVarNames {
+		if t == name {
+			return gateOperand{name: t, text: t}, nil
+		}
+	}
+	if v, err := strconv.ParseFloat(t, 64); err == nil {
+		return gateOperand{value: v, text: t}, nil
+	}
+	if d, err := time.ParseDuration(t); err == nil {
+		return gateOperand{value: d.Seconds(), text: t}, nil
+	}
+	return gateOperand{}, fmt.Errorf("unknown variable or value %q", t)
+}
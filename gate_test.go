@@ -0,0 +1,69 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	suites := []TestSuite{{
+		Name:     "example.com/p",
+		Duration: 90 * time.Second,
+		TestCases: []TestCase{
+			{Name: "TestA", Status: Success},
+			{Name: "TestB", Status: Success},
+			{Name: "TestC", Status: Failure},
+			{Name: "TestD", Status: Skipped},
+		},
+	}}
+	tests := []struct {
+		gate    string
+		wantErr string
+	}{
+		{gate: "tests==4 && passed==2 && failures==1 && errors==0 && skipped==1 && suites==1"},
+		{gate: "failures==0", wantErr: "gate failures==0 not met: failures==0 (failures is 1)"},
+		{gate: "failures==0 || passrate>60"},
+		{gate: "passrate>=70", wantErr: "gate passrate>=70 not met: passrate>=70 (passrate is 66.66666666666667)"},
+		{gate: "time<2m"},
+		{gate: "time<1m", wantErr: "gate time<1m not met: time<1m (time is 1m30s)"},
+		{gate: "!(failures>0)", wantErr: "gate !(failures>0) not met: !(failures>0) is false"},
+		{gate: "(tests>3 && skipped<2) || errors>0"},
+	}
+	for _, tt := range tests {
+		g, err := ParseGate(tt.gate)
+		if err != nil {
+			t.Errorf("ParseGate(%q): %v", tt.gate, err)
+			continue
+		}
+		err = g.Check(suites)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("gate %s: %v", tt.gate, err)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("gate %s: error %v, want %q", tt.gate, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseGateErrors(t *testing.T) {
+	tests := []struct {
+		gate    string
+		wantErr string
+	}{
+		{"failures", `gate "failures": missing comparison after failures`},
+		{"failures=0", `gate "failures=0": unexpected '='`},
+		{"flakes==0", `gate "flakes==0": unknown variable or value "flakes"`},
+		{"(failures==0", `gate "(failures==0": missing )`},
+		{"failures==0 errors==0", `gate "failures==0 errors==0": unexpected "errors"`},
+		{"failures==", `gate "failures==": unexpected end`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseGate(tt.gate); err == nil || err.Error() != tt.wantErr {
+			t.Errorf("ParseGate(%q) error = %v, want %q", tt.gate, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// googleScope holds the OAuth scopes of the tokens gojunit asks for,
+// separated by spaces: those of Cloud Storage and BigQuery.
+const googleScope = "https://www.googleapis.com/auth/devstorage.read_write https://www.googleapis.com/auth/bigquery"
+
+// googleAccessToken returns an OAuth access token of the environment gojunit
+// runs in, found like the Google Cloud client libraries do: in
+// GOOGLE_OAUTH_ACCESS_TOKEN, in the application default credentials file
+// named by GOOGLE_APPLICATION_CREDENTIALS or written by gcloud, and from the
+// metadata server of Compute Engine, GKE and Cloud Run.
+func googleAccessToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			if p := filepath.Join(dir, "gcloud", "application_default_credentials.json"); fileExists(p) {
+				path = p
+			}
+		}
+	}
+	if path != "" {
+		return googleFileToken(path)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	const metadata = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	if err := doJSON("GET", metadata, http.Header{"Metadata-Flavor": {"Google"}}, nil, &token); err != nil {
+		return "", errors.New("no Google Cloud credentials found in the environment")
+	}
+	return token.AccessToken, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// googleFileToken exchanges the credentials of a service account key or of
+// a gcloud user, in the named file, for an access token.
+func googleFileToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var creds struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		TokenURI     string `json:"token_uri"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	var form url.Values
+	tokenURI := "https://oauth2.googleapis.com/token"
+	switch creds.Type {
+	case "service_account":
+		key, err := parseRSAKey([]byte(creds.PrivateKey))
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", path, err)
+		}
+		if creds.TokenURI != "" {
+			tokenURI = creds.TokenURI
+		}
+		now := time.Now()
+		assertion, err := signJWT(map[string]interface{}{
+			"iss":   creds.ClientEmail,
+			"scope": googleScope,
+			"aud":   tokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}, key)
+		if err != nil {
+			return "", err
+		}
+		form = url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		}
+	default:
+		return "", fmt.Errorf("%s: unsupported credentials of type %q", path, creds.Type)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	if err := doJSON("POST", tokenURI, header, strings.NewReader(form.Encode()), &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// uploadGCS stores body as the object key of a Cloud Storage bucket. The
+// STORAGE_EMULATOR_HOST variable of the client libraries selects an
+// emulator instead.
+func uploadGCS(bucket, key, contentType string, body []byte) error {
+	base := "https://storage.googleapis.com"
+	header := http.Header{"Content-Type": {contentType}}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		base = strings.TrimSuffix(host, "/")
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	} else {
+		token, err := googleAccessToken()
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+	u := base + "/upload/storage/v1/b/" + url.PathEscape(bucket) + "/o?" + url.Values{"uploadType": {"media"}, "name": {key}}.Encode()
+	return doJSON("POST", u, header, bytes.NewReader(body), nil)
+}
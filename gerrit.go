@@ -0,0 +1,98 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// A gerritReview posts the results of the tests of a patch set of a Gerrit
+// change as a review.
+type gerritReview struct {
+	URL      string // base URL of the Gerrit site
+	Change   string // number or ID of the change
+	Revision string // revision of the patch set, or "current"
+	User     string
+	Password string // HTTP password of User
+}
+
+// A gerritComment is an inline comment of a review.
+type gerritComment struct {
+	Line       int    `json:"line"`
+	Message    string `json:"message"`
+	Unresolved bool   `json:"unresolved"`
+}
+
+// Post posts a review of the patch set with the summary of suites as its
+// message and an unresolved comment on the line of every failure with a known
+// location. Gerrit rejects comments on files the patch set does not touch, so
+// the failures in other files are listed in the message instead.
+func (g *gerritReview) Post(suites []TestSuite) error {
+	var files map[string]struct{}
+	if err := g.do("GET", "/files", nil, &files); err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	if err := WriteSummary(suites, &msg); err != nil {
+		return err
+	}
+	comments := make(map[string][]gerritComment)
+	var elsewhere []string
+	for _, a := range failureAnnotations(suites) {
+		if _, ok := files[a.Path]; !ok {
+			elsewhere = append(elsewhere, fmt.Sprintf("%s:%d: %s: %s", a.Path, a.StartLine, a.Title, a.Message))
+			continue
+		}
+		comments[a.Path] = append(comments[a.Path], gerritComment{a.StartLine, a.Title + ": " + a.Message, true})
+	}
+	if len(elsewhere) > 0 {
+		sort.Strings(elsewhere)
+		fmt.Fprintf(&msg, "\nFailures outside the files of this change:\n%s\n", strings.Join(elsewhere, "\n"))
+	}
+	review := map[string]interface{}{
+		"message": msg.String(),
+		"tag":     "autogenerated:gojunit",
+	}
+	if len(comments) > 0 {
+		review["comments"] = comments
+	}
+	return g.do("POST", "/review", review, nil)
+}
+
+func (g *gerritReview) do(method, path string, body, out interface{}) error {
+	u := strings.TrimSuffix(g.URL, "/")
+	header := make(http.Header)
+	if g.User != "" {
+		// Authenticated requests go to the /a/ prefix of the REST API.
+		u += "/a"
+		header.Set("Authorization", basicAuth(g.User, g.Password))
+	}
+	u += "/changes/" + url.PathEscape(g.Change) + "/revisions/" + url.PathEscape(g.Revision) + path
+	return doJSON(method, u, header, body, out)
+}
+
+// ambientGerritReview returns the gerritReview of the patch set given by
+// $GERRIT_CHANGE_NUMBER and $GERRIT_PATCHSET_REVISION, as set by the
+// Gerrit Trigger plugin of Jenkins, authenticating with $GERRIT_USER and
+// $GERRIT_HTTP_PASSWORD.
+func ambientGerritReview(site string) (*gerritReview, error) {
+	g := &gerritReview{
+		URL:      site,
+		Change:   firstNonEmpty(os.Getenv("GERRIT_CHANGE_NUMBER"), os.Getenv("GERRIT_CHANGE_ID")),
+		Revision: envOr("GERRIT_PATCHSET_REVISION", "current"),
+		User:     os.Getenv("GERRIT_USER"),
+		Password: os.Getenv("GERRIT_HTTP_PASSWORD"),
+	}
+	if g.Change == "" {
+		return nil, fmt.Errorf("-gerrit-url requires $GERRIT_CHANGE_NUMBER")
+	}
+	return g, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGerritReviewPost(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		if r.Method == "GET" {
+			// Gerrit guards its JSON responses with a prefix.
+			return 200, ")]}'\n{\"/COMMIT_MSG\":{},\"pkg/a_test.go\":{\"lines_inserted\":3}}"
+		}
+		return 200, ")]}'\n{\"labels\":{}}"
+	})
+	inChange := TestCase{Name: "TestA", Status: Failure}
+	inChange.Output.WriteString("    a_test.go:12: got 2, want 1\n")
+	elsewhere := TestCase{Name: "TestB", Status: Failure}
+	elsewhere.Output.WriteString("    b_test.go:7: boom\n")
+	suites := []TestSuite{{
+		Name:       "example.com/m/pkg",
+		Properties: []Property{{Name: "module", Value: "example.com/m"}},
+		TestCases:  []TestCase{inChange, elsewhere, {Name: "TestC"}},
+	}}
+	g := &gerritReview{URL: api.URL + "/", Change: "proj/sub~main~I8473b95934b5732ac55d26311a706c9c2bde9940", Revision: "current", User: "ci", Password: "secret"}
+	if err := g.Post(suites); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := api.received()
+	const base = "/a/changes/proj%2Fsub~main~I8473b95934b5732ac55d26311a706c9c2bde9940/revisions/current"
+	var got []string
+	for _, r := range reqs {
+		got = append(got, r.Method+" "+r.Path)
+		if auth := r.Header.Get("Authorization"); auth != basicAuth("ci", "secret") {
+			t.Errorf("%s %s: Authorization %q", r.Method, r.Path, auth)
+		}
+	}
+	if want := "GET " + base + "/files\nPOST " + base + "/review"; strings.Join(got, "\n") != want {
+		t.Fatalf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+	var review struct {
+		Message, Tag string
+		Comments     map[string][]gerritComment
+	}
+	reqs[1].decode(t, &review)
+	if review.Tag != "autogenerated:gojunit" {
+		t.Errorf("tag %q, want autogenerated:gojunit", review.Tag)
+	}
+	// The failure in a file of the change is commented on, and the other
+	// listed in the message.
+	wantComments := map[string][]gerritComment{
+		"pkg/a_test.go": {{Line: 12, Message: "example.com/m/pkg.TestA: got 2, want 1", Unresolved: true}},
+	}
+	if !reflect.DeepEqual(review.Comments, wantComments) {
+		t.Errorf("comments %+v, want %+v", review.Comments, wantComments)
+	}
+	if want := "\nFailures outside the files of this change:\npkg/b_test.go:7: example.com/m/pkg.TestB: boom\n"; !strings.HasSuffix(review.Message, want) {
+		t.Errorf("message %q, want it to end with %q", review.Message, want)
+	}
+	if !strings.Contains(review.Message, "3 tests") {
+		t.Errorf("message %q, want the summary of the tests", review.Message)
+	}
+}
+
+func TestGerritReviewAnonymous(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) { return 200, "{}" })
+	t.Setenv("GERRIT_CHANGE_NUMBER", "1234")
+	t.Setenv("GERRIT_PATCHSET_REVISION", "")
+	t.Setenv("GERRIT_USER", "")
+	g, err := ambientGerritReview(api.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Post([]TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := api.received()
+	if len(reqs) != 2 || reqs[1].Path != "/changes/1234/revisions/current/review" || reqs[1].Header.Get("Authorization") != "" {
+		t.Fatalf("requests %+v, want an anonymous review of 1234", reqs)
+	}
+	var review map[string]interface{}
+	reqs[1].decode(t, &review)
+	if _, ok := review["comments"]; ok {
+		t.Errorf("review of passed tests has comments: %v", review)
+	}
+
+	t.Setenv("GERRIT_CHANGE_NUMBER", "")
+	t.Setenv("GERRIT_CHANGE_ID", "")
+	if _, err := ambientGerritReview(api.URL); err == nil {
+		t.Error("ambientGerritReview without a change succeeded")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// The ginkgo types are the parts of the report written by ginkgo
+// --json-report that gojunit uses.
+
+type ginkgoReport struct {
+	SuitePath        string
+	SuiteDescription string
+	StartTime        time.Time
+	RunTime          time.Duration
+	SpecReports      []ginkgoSpec
+}
+
+type ginkgoSpec struct {
+	ContainerHierarchyTexts    []string
+	LeafNodeType               string
+	LeafNodeText               string
+	State                      string
+	RunTime                    time.Duration
+	Failure                    *ginkgoFailure
+	CapturedGinkgoWriterOutput string
+	CapturedStdOutErr          string
+}
+
+type ginkgoFailure struct {
+	Message        string
+	ForwardedPanic string
+	Location       struct {
+		FileName       string
+		LineNumber     int
+		FullStackTrace string
+	}
+}
+
+// ParseGinkgo parses the JSON report written by ginkgo --json-report. Each
+// Ginkgo suite becomes a TestSuite named after the import path of its
+// package, and each spec a test case named after its containers and its own
+// text, separated by slashes like subtests. Setup nodes such as BeforeSuite
+// are only reported when they fail.
+func ParseGinkgo(r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	return junit.Collect(streamGinkgo, r)
+}
+
+func streamGinkgo(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	var reports []ginkgoReport
+	if err := json.NewDecoder(r).Decode(&reports); err != nil {
+		return nil, err
+	}
+	var warnings []ParseWarning
+	for _, report := range reports {
+		suite := TestSuite{
+			Name:      report.SuiteDescription,
+			Duration:  report.RunTime,
+			Timestamp: report.StartTime,
+		}
+		if pkg := ImportPath(report.SuitePath); pkg != "" {
+			suite.Name = pkg
+		}
+		suite.SetProperty("description", report.SuiteDescription)
+		for _, spec := range report.SpecReports {
+			t, ok := ginkgoTestCase(spec)
+			if !ok {
+				continue
+			}
+			if _, known := ginkgoStates[spec.State]; !known {
+				warnings = append(warnings, ParseWarning{
+					Reason: fmt.Sprintf("unknown spec state %q", spec.State),
+					Text:   t.Name,
+				})
+			}
+			suite.TestCases = append(suite.TestCases, t)
+		}
+		emit(suite)
+	}
+	return warnings, nil
+}
+
+// ginkgoStates maps the states of Ginkgo specs to statuses.
+var ginkgoStates = map[string]Status{
+	"passed":      Success,
+	"skipped":     Skipped,
+	"pending":     Skipped,
+	"failed":      Failure,
+	"panicked":    Error,
+	"interrupted": Error,
+	"aborted":     Error,
+	"timedout":    Error,
+}
+
+func ginkgoTestCase(spec ginkgoSpec) (TestCase, bool) {
+	status, ok := ginkgoStates[spec.State]
+	if !ok {
+		status = Error
+	}
+	var name string
+	if spec.LeafNodeType == "It" {
+		name = strings.Join(append(spec.ContainerHierarchyTexts, spec.LeafNodeText), "/")
+	} else {
+		if status == Success || status == Skipped {
+			return TestCase{}, false
+		}
+		name = "[" + spec.LeafNodeType + "]"
+	}
+	t := TestCase{Name: name, Duration: spec.RunTime, Status: status}
+	if spec.State == "pending" {
+		t.Message = "pending"
+	}
+	t.Output.WriteString(spec.CapturedGinkgoWriterOutput)
+	t.Output.WriteString(spec.CapturedStdOutErr)
+	if f := spec.Failure; f != nil && status != Success {
+		msg := f.Message
+		if f.ForwardedPanic != "" {
+			msg += ": " + f.ForwardedPanic
+		}
+		if t.Output.Len() > 0 && !strings.HasSuffix(t.Output.String(), "\n") {
+			t.Output.WriteByte('\n')
+		}
+		// Written like a message of the testing package, so that
+		// FailureLocation finds it.
+		fmt.Fprintf(&t.Output, "%s:%d: %s\n", f.Location.FileName, f.Location.LineNumber, msg)
+		// Gomega messages span several lines.
+		t.Message = strings.Join(strings.Fields(msg), " ")
+		t.Output.WriteString(f.Location.FullStackTrace)
+	}
+	return t, true
+}
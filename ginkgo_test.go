@@ -0,0 +1,155 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ginkgoSample is the report of ginkgo --json-report of a suite of package
+// books, whose directory is replaced by that of the test.
+const ginkgoSample = `[
+  {
+    "SuitePath": "DIR/books",
+    "SuiteDescription": "Books Suite",
+    "SuiteSucceeded": false,
+    "StartTime": "2024-05-01T12:00:00.5Z",
+    "RunTime": 12000000,
+    "SpecReports": [
+      {"LeafNodeType": "BeforeSuite", "LeafNodeText": "", "State": "passed", "RunTime": 1000},
+      {
+        "ContainerHierarchyTexts": ["Book", "Categorizing"],
+        "LeafNodeType": "It", "LeafNodeText": "is a novel", "State": "passed", "RunTime": 2000000,
+        "CapturedGinkgoWriterOutput": "categorizing\n"
+      },
+      {
+        "ContainerHierarchyTexts": ["Book", "Categorizing"],
+        "LeafNodeType": "It", "LeafNodeText": "is a short story", "State": "failed", "RunTime": 3000000,
+        "Failure": {
+          "Message": "Expected\n    <string>: NOVEL\nto equal\n    <string>: SHORT STORY",
+          "Location": {"FileName": "/src/books/book_test.go", "LineNumber": 27, "FullStackTrace": "books_test.glob..func1.2()\n\t/src/books/book_test.go:27 +0x1a\n"}
+        }
+      },
+      {"ContainerHierarchyTexts": ["Book"], "LeafNodeType": "It", "LeafNodeText": "has pages", "State": "pending"},
+      {"ContainerHierarchyTexts": ["Book"], "LeafNodeType": "It", "LeafNodeText": "is skipped", "State": "skipped"},
+      {
+        "ContainerHierarchyTexts": ["Book"], "LeafNodeType": "It", "LeafNodeText": "loads", "State": "panicked",
+        "CapturedStdOutErr": "loading",
+        "Failure": {"Message": "Test Panicked", "ForwardedPanic": "nil map", "Location": {"FileName": "/src/books/load.go", "LineNumber": 9}}
+      },
+      {
+        "LeafNodeType": "AfterSuite", "State": "failed",
+        "Failure": {"Message": "cleanup failed", "Location": {"FileName": "/src/books/suite_test.go", "LineNumber": 40}}
+      }
+    ]
+  }
+]`
+
+func TestParseGinkgo(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "books"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/library\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		input        string
+		want         string
+		wantMessages string // of the test cases, separated by "|"
+		wantWarnings string
+		wantErr      string
+	}{
+		{
+			name:  "report",
+			input: strings.ReplaceAll(ginkgoSample, "DIR", filepath.ToSlash(dir)),
+			want: "example.com/library/books: Book/Categorizing/is a novel:success Book/Categorizing/is a short story:failure " +
+				"Book/has pages:skipped Book/is skipped:skipped Book/loads:error [AfterSuite]:failure",
+			wantMessages: "|Expected <string>: NOVEL to equal <string>: SHORT STORY|pending||Test Panicked: nil map|cleanup failed",
+		},
+		{
+			// A suite outside of a module is named after its description.
+			name:         "no module",
+			input:        `[{"SuitePath": "/nonexistent/books", "SuiteDescription": "Books Suite", "SpecReports": [{"LeafNodeType": "It", "LeafNodeText": "works", "State": "passed"}]}]`,
+			want:         "Books Suite: works:success",
+			wantMessages: "",
+		},
+		{
+			name:         "unknown state",
+			input:        `[{"SuiteDescription": "S", "SpecReports": [{"ContainerHierarchyTexts": ["A"], "LeafNodeType": "It", "LeafNodeText": "b", "State": "exploded"}]}]`,
+			want:         "S: A/b:error",
+			wantMessages: "",
+			wantWarnings: `unknown spec state "exploded": A/b`,
+		},
+		{name: "empty", input: `[]`},
+		{name: "truncated", input: ginkgoSample[:len(ginkgoSample)/2], wantErr: "unexpected EOF"},
+		{name: "not a report", input: `{"SuitePath": "x"}`, wantErr: "cannot unmarshal object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, warnings, err := ParseGinkgo(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := casesOf(suites); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			var messages, warns []string
+			for _, s := range suites {
+				for _, tc := range s.TestCases {
+					messages = append(messages, tc.Message)
+				}
+			}
+			for _, w := range warnings {
+				warns = append(warns, w.Reason+": "+w.Text)
+			}
+			if got := strings.Join(messages, "|"); got != tt.wantMessages {
+				t.Errorf("messages %q, want %q", got, tt.wantMessages)
+			}
+			if got := strings.Join(warns, "\n"); got != tt.wantWarnings {
+				t.Errorf("warnings %q, want %q", got, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestParseGinkgoFailure(t *testing.T) {
+	suites, _, err := ParseGinkgo(strings.NewReader(ginkgoSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &suites[0]
+	if s.Duration.Milliseconds() != 12 || s.Timestamp.Format("15:04:05.000") != "12:00:00.500" || s.Property("description") != "Books Suite" {
+		t.Errorf("suite duration %v, timestamp %v, description %q", s.Duration, s.Timestamp, s.Property("description"))
+	}
+	wantOutputs := []string{
+		"categorizing\n",
+		"/src/books/book_test.go:27: Expected\n    <string>: NOVEL\nto equal\n    <string>: SHORT STORY\nbooks_test.glob..func1.2()\n\t/src/books/book_test.go:27 +0x1a\n",
+		"",
+		"",
+		"loading\n/src/books/load.go:9: Test Panicked: nil map\n",
+		"/src/books/suite_test.go:40: cleanup failed\n",
+	}
+	for i, want := range wantOutputs {
+		tc := &s.TestCases[i]
+		if got := tc.Output.String(); got != want {
+			t.Errorf("%s: output %q, want %q", tc.Name, got, want)
+		}
+	}
+	file, line, _ := FailureLocation(s.TestCases[1].Output.String())
+	if file != "/src/books/book_test.go" || line != 27 {
+		t.Errorf("failure location %s:%d, want /src/books/book_test.go:27", file, line)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// gitPrefix starts the names of the properties describing the git checkout
+// the tests ran in.
+const gitPrefix = "git."
+
+// GitInfo describes a git checkout.
+type GitInfo struct {
+	Commit  string
+	Branch  string   // empty with a detached HEAD
+	Dirty   bool     // whether tracked or untracked files differ from Commit
+	Changed []string // the files that differ
+}
+
+// ReadGit describes the checkout of the working directory.
+func ReadGit() (*GitInfo, error) {
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	g := &GitInfo{Commit: strings.TrimSpace(commit)}
+	if branch, err := git("symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		g.Branch = strings.TrimSpace(branch)
+	}
+	status, err := git("status", "--porcelain", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(status, "\n") {
+		if len(line) > 3 {
+			g.Changed = append(g.Changed, line[3:])
+		}
+	}
+	g.Dirty = len(g.Changed) > 0
+	return g, nil
+}
+
+// git runs git with args and returns its output.
+func git(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// Properties returns g as properties. The changed files are separated by
+// spaces.
+func (g *GitInfo) Properties() []Property {
+	props := []Property{{Name: gitPrefix + "commit", Value: g.Commit}}
+	if g.Branch != "" {
+		props = append(props, Property{Name: gitPrefix + "branch", Value: g.Branch})
+	}
+	props = append(props, Property{Name: gitPrefix + "dirty", Value: strconv.FormatBool(g.Dirty)})
+	if g.Dirty {
+		props = append(props, Property{Name: gitPrefix + "changed", Value: strings.Join(g.Changed, " ")})
+	}
+	return props
+}
+
+// shortCommit abbreviates the SHA of a commit, as returned by runCommit.
+func shortCommit(commit string) string {
+	sha, dirty := commit, ""
+	if i := strings.IndexByte(commit, '+'); i >= 0 {
+		sha, dirty = commit[:i], commit[i:]
+	}
+	if len(sha) > 12 {
+		sha = sha[:12]
+	}
+	return sha + dirty
+}
+
+// runCommit returns the commit and branch the suites of a run were tested
+// at, recorded by -git or taken from the CI environment.
+func runCommit(suites []TestSuite) (commit, branch string) {
+	for i := range suites {
+		s := &suites[i]
+		if commit = s.Property(gitPrefix + "commit"); commit != "" {
+			branch = s.Property(gitPrefix + "branch")
+			if s.Property(gitPrefix+"dirty") == "true" {
+				commit += "+dirty"
+			}
+			return commit, branch
+		}
+		if commit = s.Property(ciPrefix + "commit"); commit != "" {
+			return commit, s.Property(ciPrefix + "branch")
+		}
+	}
+	return "", ""
+}
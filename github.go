@@ -0,0 +1,131 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	// githubDataEscaper escapes the message of a GitHub Actions workflow
+	// command.
+	githubDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+	// githubPropertyEscaper escapes the parameters of a workflow command.
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// WriteGitHubAnnotations writes an error annotation for every failed test in
+// suites to w as GitHub Actions workflow commands, which GitHub shows on the
+// run and, when the location of the failure is known, on the lines of the
+// pull request that failed. File names are made relative to the module of
+// the package when the suite records it, as it does with -modules.
+func WriteGitHubAnnotations(suites []TestSuite, w io.Writer) error {
+	for i := range suites {
+		if err := writeGitHubSuite(&suites[i], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGitHubSuite writes the annotations of a single suite and flushes
+// them.
+func writeGitHubSuite(s *TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i := range s.TestCases {
+		writeGitHubTest(bw, s, &s.TestCases[i])
+	}
+	return bw.Flush()
+}
+
+// writeGitHubTest writes the annotation of the test t of s, if it failed.
+func writeGitHubTest(w io.Writer, s *TestSuite, t *TestCase) {
+	if t.Status != Failure && t.Status != Error {
+		return
+	}
+	var params []string
+	if file, line, _ := FailureLocation(t.Output.String()); file != "" {
+		params = append(params, "file="+githubPropertyEscaper.Replace(githubFile(s, file)), fmt.Sprintf("line=%d", line))
+	}
+	params = append(params, "title="+githubPropertyEscaper.Replace(suiteKey(s)+"."+t.Name))
+	text := messageOf(t)
+	if text == "" {
+		text = t.Status.String()
+	}
+	fmt.Fprintf(w, "::error %s::%s\n", strings.Join(params, ","), githubDataEscaper.Replace(text))
+}
+
+// githubStream streams annotations as the input is read, writing that of
+// each failed test as soon as it finishes. With groups set, as with -tee, it
+// also puts the lines copied to the log while each top-level test runs in a
+// group named after the test, which GitHub folds. Groups do not nest, so a
+// test starting while another runs, as parallel tests do, ends its group.
+type githubStream struct {
+	w        io.Writer
+	groups   bool
+	group    string // the test whose group is open, or ""
+	finished streamedTests
+}
+
+func newGitHubStream(w io.Writer, groups bool) streamWriter {
+	return &githubStream{w: w, groups: groups, finished: make(streamedTests)}
+}
+
+func (gs *githubStream) endGroup(w io.Writer) {
+	if gs.group != "" {
+		fmt.Fprintln(w, "::endgroup::")
+		gs.group = ""
+	}
+}
+
+func (gs *githubStream) TestStarted(s *TestSuite, t *TestCase) error {
+	if !gs.groups || strings.Contains(t.Name, "/") {
+		return nil
+	}
+	bw := bufio.NewWriter(gs.w)
+	gs.endGroup(bw)
+	gs.group = suiteKey(s) + "." + t.Name
+	fmt.Fprintf(bw, "::group::%s\n", githubDataEscaper.Replace(gs.group))
+	return bw.Flush()
+}
+
+func (gs *githubStream) TestFinished(s *TestSuite, t *TestCase) error {
+	bw := bufio.NewWriter(gs.w)
+	if gs.group == suiteKey(s)+"."+t.Name {
+		gs.endGroup(bw)
+	}
+	writeGitHubTest(bw, s, t)
+	gs.finished.add(s, t)
+	return bw.Flush()
+}
+
+func (gs *githubStream) SuiteEnded(s *TestSuite) error {
+	bw := bufio.NewWriter(gs.w)
+	if strings.HasPrefix(gs.group, suiteKey(s)+".") {
+		gs.endGroup(bw)
+	}
+	for i := range s.TestCases {
+		if t := &s.TestCases[i]; !gs.finished.take(s, t) {
+			writeGitHubTest(bw, s, t)
+		}
+	}
+	return bw.Flush()
+}
+
+// githubFile returns the path of file, reported by a test of s, relative to
+// the module of s, or file itself if the module is not known.
+func githubFile(s *TestSuite, file string) string {
+	mod := s.Property("module")
+	if mod == "" || path.IsAbs(file) || strings.Contains(file, "/") {
+		return file
+	}
+	dir := strings.TrimPrefix(strings.TrimPrefix(s.Name, mod), "/")
+	return path.Join(dir, file)
+}
@@ -0,0 +1,269 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gojunitpb holds the Go types of the messages of gojunit.proto, the
+// schema of the reports written by gojunit -format=proto, and their encoding
+// in the protocol buffer wire format.
+//
+// The types are written by hand rather than generated by protoc, so that
+// neither gojunit nor the programs reading its reports need the protobuf
+// runtime. They have the names protoc-gen-go gives the messages and their
+// fields, and decode the messages of any protobuf implementation.
+package gojunitpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type Report struct {
+	Generator string
+	Suites    []*TestSuite
+}
+
+type TestSuite struct {
+	Name            string
+	DurationSeconds float64
+	// Start of the suite in nanoseconds since the Unix epoch, or 0 if
+	// unknown.
+	TimestampUnixNano int64
+	Properties        []*Property
+	TestCases         []*TestCase
+}
+
+type Property struct {
+	Name  string
+	Value string
+}
+
+type Status int32
+
+const (
+	Status_STATUS_SUCCESS Status = 0
+	Status_STATUS_FAILURE Status = 1
+	Status_STATUS_ERROR   Status = 2
+	Status_STATUS_SKIPPED Status = 3
+)
+
+type TestCase struct {
+	Name            string
+	Classname       string
+	Status          Status
+	DurationSeconds float64
+	Output          string
+}
+
+// Marshal returns the wire encoding of r. Fields with zero values are
+// omitted, as in proto3.
+func (r *Report) Marshal() []byte {
+	var b buffer
+	b.string(1, r.Generator)
+	for _, s := range r.Suites {
+		b.message(2, s.marshal)
+	}
+	return b
+}
+
+func (s *TestSuite) marshal(b *buffer) {
+	b.string(1, s.Name)
+	b.double(2, s.DurationSeconds)
+	b.varint(3, uint64(s.TimestampUnixNano))
+	for _, p := range s.Properties {
+		b.message(4, p.marshal)
+	}
+	for _, t := range s.TestCases {
+		b.message(5, t.marshal)
+	}
+}
+
+func (p *Property) marshal(b *buffer) {
+	b.string(1, p.Name)
+	b.string(2, p.Value)
+}
+
+func (t *TestCase) marshal(b *buffer) {
+	b.string(1, t.Name)
+	b.string(2, t.Classname)
+	b.varint(3, uint64(t.Status))
+	b.double(4, t.DurationSeconds)
+	b.string(5, t.Output)
+}
+
+// Unmarshal decodes the wire encoding of a Report from b into r, replacing
+// its contents. Unknown fields are skipped.
+func (r *Report) Unmarshal(b []byte) error {
+	*r = Report{}
+	return decode(b, func(field int, f value) error {
+		switch field {
+		case 1:
+			r.Generator = string(f.bytes)
+		case 2:
+			s := new(TestSuite)
+			if err := s.unmarshal(f.bytes); err != nil {
+				return err
+			}
+			r.Suites = append(r.Suites, s)
+		}
+		return nil
+	})
+}
+
+func (s *TestSuite) unmarshal(b []byte) error {
+	return decode(b, func(field int, f value) error {
+		switch field {
+		case 1:
+			s.Name = string(f.bytes)
+		case 2:
+			s.DurationSeconds = math.Float64frombits(f.n)
+		case 3:
+			s.TimestampUnixNano = int64(f.n)
+		case 4:
+			p := new(Property)
+			if err := p.unmarshal(f.bytes); err != nil {
+				return err
+			}
+			s.Properties = append(s.Properties, p)
+		case 5:
+			t := new(TestCase)
+			if err := t.unmarshal(f.bytes); err != nil {
+				return err
+			}
+			s.TestCases = append(s.TestCases, t)
+		}
+		return nil
+	})
+}
+
+func (p *Property) unmarshal(b []byte) error {
+	return decode(b, func(field int, f value) error {
+		switch field {
+		case 1:
+			p.Name = string(f.bytes)
+		case 2:
+			p.Value = string(f.bytes)
+		}
+		return nil
+	})
+}
+
+func (t *TestCase) unmarshal(b []byte) error {
+	return decode(b, func(field int, f value) error {
+		switch field {
+		case 1:
+			t.Name = string(f.bytes)
+		case 2:
+			t.Classname = string(f.bytes)
+		case 3:
+			t.Status = Status(f.n)
+		case 4:
+			t.DurationSeconds = math.Float64frombits(f.n)
+		case 5:
+			t.Output = string(f.bytes)
+		}
+		return nil
+	})
+}
+
+// The wire types of the fields of gojunit.proto, and of the fixed32 fields
+// of other schemas, which are skipped.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// buffer accumulates fields in the protocol buffer wire format. Fields with
+// zero values are omitted, as in proto3.
+type buffer []byte
+
+func (b *buffer) tag(field, wireType int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wireType))
+}
+
+func (b *buffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *buffer) double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, wireFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+}
+
+func (b *buffer) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	b.tag(field, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(s)))
+	*b = append(*b, s...)
+}
+
+// message appends an embedded message whose fields are written by f.
+func (b *buffer) message(field int, f func(*buffer)) {
+	var m buffer
+	f(&m)
+	b.tag(field, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+// A value is the value of a field: its number, for varint and fixed
+// fields, or its bytes, for length-delimited ones.
+type value struct {
+	n     uint64
+	bytes []byte
+}
+
+var errTruncated = errors.New("gojunitpb: truncated message")
+
+// decode calls f with the number and value of each field of the message b.
+func decode(b []byte, f func(field int, v value) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		var v value
+		switch wireType := tag & 7; wireType {
+		case wireVarint:
+			if v.n, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			v.n, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			v.n, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			v.bytes, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("gojunitpb: unsupported wire type %d", wireType)
+		}
+		if err := f(int(tag>>3), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
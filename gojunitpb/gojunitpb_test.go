@@ -0,0 +1,58 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gojunitpb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	r := &Report{
+		Generator: "gojunit v0.2",
+		Suites: []*TestSuite{{
+			Name:              "example.com/p",
+			DurationSeconds:   1.5,
+			TimestampUnixNano: 1700000000123456789,
+			Properties:        []*Property{{Name: "goos", Value: "linux"}},
+			TestCases: []*TestCase{
+				{Name: "TestOK", Classname: "example.com/p", DurationSeconds: 0.25},
+				{Name: "TestBad", Classname: "example.com/p", Status: Status_STATUS_FAILURE, Output: "bad\n"},
+			},
+		}},
+	}
+	var got Report
+	if err := got.Unmarshal(r.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, r) {
+		t.Errorf("round trip = %+v, want %+v", got, r)
+	}
+}
+
+func TestMarshalWire(t *testing.T) {
+	r := &Report{Generator: "g", Suites: []*TestSuite{{Name: "p", TestCases: []*TestCase{{Name: "T", Status: Status_STATUS_SKIPPED}}}}}
+	// Report.generator = "g"; Report.suites = {name = "p"; test_cases = {name = "T"; status = 3}}.
+	want := []byte{0x0a, 1, 'g', 0x12, 10, 0x0a, 1, 'p', 0x2a, 5, 0x0a, 1, 'T', 0x18, 3}
+	if got := r.Marshal(); !bytes.Equal(got, want) {
+		t.Errorf("Marshal = % x, want % x", got, want)
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	// Field 9 as a varint, a fixed64, a fixed32 and bytes, then generator.
+	b := []byte{0x48, 1, 0x49, 0, 0, 0, 0, 0, 0, 0, 0, 0x4d, 0, 0, 0, 0, 0x4a, 1, 'x', 0x0a, 1, 'g'}
+	var r Report
+	if err := r.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if r.Generator != "g" || r.Suites != nil {
+		t.Errorf("Unmarshal = %+v, want generator g only", r)
+	}
+	if err := r.Unmarshal([]byte{0x0a, 5, 'g'}); err == nil {
+		t.Error("Unmarshal of a truncated message succeeded")
+	}
+}
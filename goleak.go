@@ -0,0 +1,89 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A LeakedGoroutine is a goroutine reported by the uber-go/goleak package,
+// parsed from the error it logs:
+//
+//	leak_test.go:12: found unexpected goroutines:
+//	    [Goroutine 7 in state chan receive, with example.com/x.serve.func1 on top of the stack:
+//	    goroutine 7 [chan receive]:
+//	    example.com/x.serve.func1()
+//	    	/src/x/x.go:10 +0x2c
+//	    created by example.com/x.serve in goroutine 6
+//	    	/src/x/x.go:9 +0x65
+//	    ]
+type LeakedGoroutine struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	Top   string `json:"top"`   // function on top of its stack
+	Entry string `json:"entry"` // function it was started with
+}
+
+const goleakHeader = "found unexpected goroutines:"
+
+var leakedGoroutineRE = regexp.MustCompile(`Goroutine (\d+) in state ([^,]+), with (\S+) on top of the stack:`)
+
+// ParseGoroutineLeaks returns the goroutines goleak reported as leaked in
+// output, or nil if it reported none.
+func ParseGoroutineLeaks(output string) []LeakedGoroutine {
+	i := strings.Index(output, goleakHeader)
+	if i < 0 {
+		return nil
+	}
+	var leaks []LeakedGoroutine
+	for _, l := range strings.Split(output[i+len(goleakHeader):], "\n") {
+		l = strings.TrimSpace(l)
+		if m := leakedGoroutineRE.FindStringSubmatch(l); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			leaks = append(leaks, LeakedGoroutine{ID: id, State: m[2], Top: m[3], Entry: m[3]})
+			continue
+		}
+		if l == "" {
+			continue
+		}
+		if len(leaks) == 0 {
+			break
+		}
+		// The entry point is the last frame of the stack, above the
+		// "created by" line of its creator.
+		if strings.HasSuffix(l, ")") && !strings.HasPrefix(l, "created by ") {
+			if j := strings.LastIndexByte(l, '('); j > 0 {
+				leaks[len(leaks)-1].Entry = l[:j]
+			}
+		}
+	}
+	return leaks
+}
+
+// leakMessage returns a one line summary of leaks, naming the entry points
+// of the goroutines.
+func leakMessage(leaks []LeakedGoroutine) string {
+	var parts []string
+	seen := make(map[string]int)
+	for _, g := range leaks {
+		key := g.Entry + " (" + g.State + ")"
+		if seen[key]++; seen[key] == 1 {
+			parts = append(parts, key)
+		}
+	}
+	for i, p := range parts {
+		if n := seen[p]; n > 1 {
+			parts[i] = fmt.Sprintf("%s x%d", p, n)
+		}
+	}
+	noun := "goroutine"
+	if len(leaks) > 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d leaked %s: %s", len(leaks), noun, strings.Join(parts, ", "))
+}
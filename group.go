@@ -0,0 +1,175 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unowned is the group of the suites of packages no owners rule matches.
+const unowned = "unowned"
+
+// A Grouping returns the name of the group of a suite.
+type Grouping func(s *TestSuite) string
+
+// ParseGrouping parses the value of -group-by: "package", which keeps a
+// suite per package and returns nil, "dir:N", which groups packages by the
+// first N elements of their directory in their module, or "owners:FILE",
+// which groups them by the component given by a CODEOWNERS style file.
+func ParseGrouping(v string) (Grouping, error) {
+	kind, arg, _ := strings.Cut(v, ":")
+	switch kind {
+	case "package":
+		return nil, nil
+	case "dir":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("-group-by %s: want dir:N with N a positive depth", v)
+		}
+		return func(s *TestSuite) string { return dirGroup(s, n) }, nil
+	case "owners":
+		if arg == "" {
+			return nil, fmt.Errorf("-group-by %s: want owners:FILE", v)
+		}
+		rules, err := ReadOwners(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *TestSuite) string { return ownersGroup(s, rules) }, nil
+	}
+	return nil, fmt.Errorf("unknown grouping %q; want package, dir:N or owners:FILE", v)
+}
+
+// packageDir returns the directory of the package of s in its module, or
+// its import path if the module is not known.
+func packageDir(s *TestSuite) string {
+	pkg := suitePackage(s)
+	if mod := s.Property("module"); mod != "" {
+		if pkg == mod {
+			return "."
+		}
+		return strings.TrimPrefix(pkg, mod+"/")
+	}
+	return pkg
+}
+
+// dirGroup returns the first n elements of the directory of the package of
+// s.
+func dirGroup(s *TestSuite, n int) string {
+	elems := strings.Split(packageDir(s), "/")
+	if len(elems) > n {
+		elems = elems[:n]
+	}
+	return strings.Join(elems, "/")
+}
+
+// An OwnersRule gives the component owning the packages under a directory.
+type OwnersRule struct {
+	Dir       string // relative to the module, or "" for all of it
+	Component string
+}
+
+// ReadOwners reads a file of owners rules. Each line holds a directory and
+// the component owning it, or owners of which the first is taken, as in a
+// CODEOWNERS file:
+//
+//	/services/payments/  @example/payments
+//	auth                 auth
+//
+// The last rule whose directory contains a package gives its component.
+// Leading @ characters and the organizations of teams are removed from
+// components, glob suffixes such as /** from directories, and blank lines
+// and lines starting with # are ignored.
+func ReadOwners(path string) ([]OwnersRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []OwnersRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want a directory and a component", path, n)
+		}
+		dir := strings.TrimRight(strings.TrimSuffix(strings.TrimSuffix(fields[0], "**"), "*"), "/")
+		dir = strings.TrimPrefix(dir, "/")
+		component := strings.TrimPrefix(fields[1], "@")
+		if i := strings.LastIndexByte(component, '/'); i >= 0 {
+			component = component[i+1:]
+		}
+		rules = append(rules, OwnersRule{dir, component})
+	}
+	return rules, s.Err()
+}
+
+// ownersGroup returns the component of the last rule containing the package
+// of s, or unowned.
+func ownersGroup(s *TestSuite, rules []OwnersRule) string {
+	dir := packageDir(s)
+	group := unowned
+	for _, r := range rules {
+		if r.Dir == "" || dir == r.Dir || strings.HasPrefix(dir, r.Dir+"/") {
+			group = r.Component
+		}
+	}
+	return group
+}
+
+// GroupSuites merges the suites of each group, and label, into a suite named
+// after the group, sorted by name. The test cases keep the package of their
+// suite as their classname, and the merged suite the summed duration and
+// earliest timestamp of its suites and the properties they share, such as
+// their label.
+func GroupSuites(suites []TestSuite, group Grouping) []TestSuite {
+	index := make(map[[2]string]int)
+	var grouped []TestSuite
+	for i := range suites {
+		s := &suites[i]
+		key := [2]string{group(s), s.Property("label")}
+		j, ok := index[key]
+		if !ok {
+			j = len(grouped)
+			index[key] = j
+			props := append([]Property(nil), s.Properties...)
+			grouped = append(grouped, TestSuite{Name: key[0], Timestamp: s.Timestamp, Properties: props})
+		}
+		g := &grouped[j]
+		g.Properties = sharedProperties(g.Properties, s)
+		g.Duration += s.Duration
+		g.Output.Write(s.Output.Bytes())
+		if !s.Timestamp.IsZero() && (g.Timestamp.IsZero() || s.Timestamp.Before(g.Timestamp)) {
+			g.Timestamp = s.Timestamp
+		}
+		for _, t := range s.TestCases {
+			t.Classname = classnameOf(s, &t)
+			g.TestCases = append(g.TestCases, t)
+		}
+	}
+	sort.SliceStable(grouped, func(i, j int) bool { return grouped[i].Name < grouped[j].Name })
+	return grouped
+}
+
+// sharedProperties returns the properties in props that s has too, with
+// the same value.
+func sharedProperties(props []Property, s *TestSuite) []Property {
+	shared := props[:0]
+	for _, p := range props {
+		if s.Property(p.Name) == p.Value {
+			shared = append(shared, p)
+		}
+	}
+	return shared
+}
@@ -0,0 +1,258 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dailyPrefix starts the IDs of the runs into which CompactRuns collapses the
+// runs of a day; the date follows.
+const dailyPrefix = "daily-"
+
+// compactedCounts returns the number of runs in which a test of a daily run,
+// written by CompactRuns, ran and the number in which it failed, or ok false
+// for tests of other runs.
+func compactedCounts(t *TestCase) (runs, failures int, ok bool) {
+	r, err := strconv.Atoi(t.Property("compacted_runs"))
+	if err != nil {
+		return 0, 0, false
+	}
+	f, _ := strconv.Atoi(t.Property("compacted_failures"))
+	return r, f, true
+}
+
+// CompactRuns collapses the runs created before cutoff, listed most recently
+// created first, as a Store lists them, into one run for each day, in UTC.
+// It returns the daily runs, and the runs they replace, which do not include
+// the daily runs themselves when a day is compacted again.
+//
+// A daily run holds each test of the runs of its day once, as the latest
+// result of the test that failed, if any, or else that it ran, rather than
+// being skipped, with its duration the mean of those runs and without its
+// output. The compacted_runs and compacted_failures properties of a test
+// count the runs in which it ran and failed, which CollectFlakeStats reads.
+func CompactRuns(runs []*Run, cutoff time.Time) (daily, replaced []*Run) {
+	type test struct {
+		t         TestCase
+		runs      int
+		failures  int
+		durations time.Duration
+	}
+	type suite struct {
+		s     TestSuite
+		tests []*test
+		index map[string]*test
+	}
+	type day struct {
+		run    *Run
+		suites []*suite
+		index  map[string]*suite
+		fresh  bool // the day has runs other than its daily run
+	}
+	var days []*day
+	byID := make(map[string]*day)
+	for _, run := range runs {
+		if !run.Created.Before(cutoff) {
+			continue
+		}
+		id := dailyPrefix + run.Created.UTC().Format(time.DateOnly)
+		d := byID[id]
+		if d == nil {
+			d = &day{run: &Run{ID: id, Created: run.Created}, index: make(map[string]*suite)}
+			byID[id] = d
+			days = append(days, d)
+		}
+		if run.ID != id {
+			d.fresh = true
+			replaced = append(replaced, run)
+		}
+		for i := range run.Suites {
+			rs := &run.Suites[i]
+			key := suiteKey(rs)
+			s := d.index[key]
+			if s == nil {
+				s = &suite{s: *rs, index: make(map[string]*test)}
+				s.s.TestCases, s.s.Output = nil, Log{}
+				d.index[key] = s
+				d.suites = append(d.suites, s)
+			}
+			for j := range rs.TestCases {
+				rt := &rs.TestCases[j]
+				key := rt.Classname + "\x00" + rt.Name
+				t := s.index[key]
+				first := t == nil
+				if first {
+					t = new(test)
+					s.index[key] = t
+					s.tests = append(s.tests, t)
+				}
+				n, f, ok := compactedCounts(rt)
+				if !ok && rt.Status != Skipped {
+					n = 1
+					if rt.Status == Failure || rt.Status == Error {
+						f = 1
+					}
+				}
+				// The runs are listed latest first, so a test takes the
+				// result of an earlier run only if that run is worse.
+				if first || t.runs == 0 && n > 0 || t.failures == 0 && f > 0 {
+					t.t = *rt
+					t.t.Message = messageOf(rt)
+					t.t.Output, t.t.Stderr = Log{}, Log{}
+					t.t.Properties = append([]Property(nil), rt.Properties...)
+				}
+				t.runs += n
+				t.failures += f
+				t.durations += time.Duration(n) * rt.Duration
+			}
+		}
+	}
+	for _, d := range days {
+		if !d.fresh {
+			continue
+		}
+		for _, s := range d.suites {
+			for _, t := range s.tests {
+				if t.runs > 0 {
+					t.t.Duration = t.durations / time.Duration(t.runs)
+				}
+				t.t.SetProperty("compacted_runs", strconv.Itoa(t.runs))
+				t.t.SetProperty("compacted_failures", strconv.Itoa(t.failures))
+				s.s.TestCases = append(s.s.TestCases, t.t)
+			}
+			d.run.Suites = append(d.run.Suites, s.s)
+		}
+		daily = append(daily, d.run)
+	}
+	return daily, replaced
+}
+
+// parseAge parses an age given as a number of days, as in 90d, or as a
+// time.Duration.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q: want a number of days, as in 90d, or a duration, as in 36h", s)
+	}
+	return d, nil
+}
+
+// pruneStore deletes the runs of store created before cutoff, returning how
+// many it deleted and how many it kept.
+func pruneStore(store Store, cutoff time.Time) (deleted, kept int, err error) {
+	runs, err := store.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, run := range runs {
+		if !run.Created.Before(cutoff) {
+			kept++
+			continue
+		}
+		if err := store.Delete(run.ID); err != nil {
+			return deleted, kept, err
+		}
+		deleted++
+	}
+	return deleted, kept, nil
+}
+
+// compactStore replaces the runs of store created before cutoff with daily
+// runs, as CompactRuns does, returning how many runs it replaced with how
+// many daily runs. The daily runs are saved before the runs they replace are
+// deleted, so that an interrupted compaction loses none of the history.
+func compactStore(store Store, cutoff time.Time) (replaced, daily int, err error) {
+	runs, err := store.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	days, old := CompactRuns(runs, cutoff)
+	for _, run := range days {
+		if err := store.Save(run); err != nil {
+			return 0, 0, err
+		}
+	}
+	for i, run := range old {
+		if err := store.Delete(run.ID); err != nil {
+			return i, len(days), err
+		}
+	}
+	return len(old), len(days), nil
+}
+
+// historyMain runs gojunit history, which prunes and compacts the runs kept
+// by gojunit serve.
+func historyMain(args []string) {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		for _, verb := range []string{"prune", "compact"} {
+			fs, _, _ := historyFlags(verb)
+			fs.SetOutput(os.Stdout)
+			fs.Usage()
+		}
+		return
+	}
+	if len(args) == 0 || args[0] != "prune" && args[0] != "compact" {
+		fmt.Fprintln(os.Stderr, "usage: gojunit history prune|compact [flags]")
+		os.Exit(exitParse)
+	}
+	verb := args[0]
+	fs, dir, age := historyFlags(verb)
+	fs.Parse(args[1:])
+	if *dir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	d, err := parseAge(*age)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gojunit history %s: %v\n", verb, err)
+		os.Exit(exitParse)
+	}
+	store, err := OpenStore(*dir)
+	if err == nil {
+		cutoff := time.Now().Add(-d)
+		var n, m int
+		if verb == "prune" {
+			if n, m, err = pruneStore(store, cutoff); err == nil {
+				fmt.Printf("deleted %d runs, kept %d\n", n, m)
+			}
+		} else if n, m, err = compactStore(store, cutoff); err == nil {
+			fmt.Printf("compacted %d runs into %d daily runs\n", n, m)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gojunit history %s: %v\n", verb, err)
+		os.Exit(exitInfra)
+	}
+}
+
+// historyFlags returns the flags of gojunit history prune or compact, and
+// their -store flag and the flag giving the age of the runs to prune or
+// compact.
+func historyFlags(verb string) (fs *flag.FlagSet, store, age *string) {
+	fs = flag.NewFlagSet("history "+verb, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gojunit history %s [flags]\n", verb)
+		fs.PrintDefaults()
+	}
+	store = fs.String("store", "", "store in which gojunit serve keeps runs, as for its -store flag")
+	if verb == "prune" {
+		age = fs.String("keep", "90d", "delete the runs older than this, in days, as in 90d, or as a duration")
+	} else {
+		age = fs.String("older-than", "7d", "collapse the runs older than this, in days, as in 7d, or as a duration, into one run a day")
+	}
+	return fs, store, age
+}
@@ -0,0 +1,221 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// historyRuns returns runs of x/m over three days, most recently created
+// first, as a Store lists them: two runs on the first day, one on the
+// second, and one on the third.
+func historyRuns() []*Run {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	run := func(id string, created time.Time, tests ...TestCase) *Run {
+		return &Run{ID: id, Created: created, Suites: []TestSuite{{Name: "x/m", TestCases: tests}}}
+	}
+	return []*Run{
+		run("r4", day.Add(50*time.Hour), TestCase{Name: "TestA", Status: Failure}),
+		run("r3", day.Add(30*time.Hour), TestCase{Name: "TestA", Duration: time.Second}, TestCase{Name: "TestB", Status: Skipped}),
+		run("r2", day.Add(12*time.Hour), TestCase{Name: "TestA", Duration: 3 * time.Second}, TestCase{Name: "TestB", Status: Skipped}),
+		run("r1", day.Add(10*time.Hour), TestCase{Name: "TestA", Status: Failure, Message: "boom", Duration: time.Second}, TestCase{Name: "TestB", Duration: time.Second}),
+	}
+}
+
+// describeRuns returns a line for each run, listing the status and counts
+// of its tests.
+func describeRuns(runs []*Run) string {
+	var lines []string
+	for _, run := range runs {
+		line := run.ID + ":"
+		for _, s := range run.Suites {
+			for _, t := range s.TestCases {
+				line += fmt.Sprintf(" %s:%v", t.Name, t.Status)
+				if n := t.Property("compacted_runs"); n != "" {
+					line += fmt.Sprintf("(%s/%s %v %q)", t.Property("compacted_failures"), n, t.Duration, t.Message)
+				}
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCompactRuns(t *testing.T) {
+	runs := historyRuns()
+	runs[3].Suites[0].TestCases[0].Output.WriteString("output of r1\n")
+	cutoff := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	daily, replaced := CompactRuns(runs, cutoff)
+	// The test takes the latest failure of its day, or else its latest
+	// run, with the mean duration of the runs in which it ran.
+	want := "daily-2024-03-02: TestA:success(0/1 1s \"\") TestB:skipped(0/0 0s \"\")\n" +
+		"daily-2024-03-01: TestA:failure(1/2 2s \"boom\") TestB:success(0/1 1s \"\")"
+	if got := describeRuns(daily); got != want {
+		t.Errorf("daily runs\n%s\nwant\n%s", got, want)
+	}
+	if got := describeRuns(replaced); got != describeRuns(runs[1:]) {
+		t.Errorf("replaced\n%s\nwant\n%s", got, describeRuns(runs[1:]))
+	}
+	if out := daily[1].Suites[0].TestCases[0].Output.String(); out != "" {
+		t.Errorf("daily run keeps output %q", out)
+	}
+	if out := runs[3].Suites[0].TestCases[0].Output.String(); out != "output of r1\n" {
+		t.Errorf("compacted run modified: output %q", out)
+	}
+
+	// Compacting again collapses a later run of a day into its daily run,
+	// which is saved again rather than replaced.
+	late := &Run{ID: "r5", Created: time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC), Suites: []TestSuite{
+		{Name: "x/m", TestCases: []TestCase{{Name: "TestA", Status: Error, Duration: 5 * time.Second}}},
+	}}
+	again, replaced := CompactRuns([]*Run{runs[0], late, daily[0], daily[1]}, cutoff)
+	want = "daily-2024-03-01: TestA:error(2/3 3s \"\") TestB:success(0/1 1s \"\")"
+	if got := describeRuns(again); got != want {
+		t.Errorf("daily runs compacted again\n%s\nwant\n%s", got, want)
+	}
+	if len(replaced) != 1 || replaced[0] != late {
+		t.Errorf("replaced %v, want r5", describeRuns(replaced))
+	}
+
+	// Days without runs other than their daily run are left alone.
+	if again, replaced := CompactRuns([]*Run{runs[0], daily[0], daily[1]}, cutoff); len(again) != 0 || len(replaced) != 0 {
+		t.Errorf("compacted daily runs again into\n%s\nreplacing\n%s", describeRuns(again), describeRuns(replaced))
+	}
+}
+
+// failingStore is a Store whose Delete fails after n calls.
+type failingStore struct {
+	Store
+	n int
+}
+
+func (s *failingStore) Delete(id string) error {
+	if s.n == 0 {
+		return errors.New("delete failed")
+	}
+	s.n--
+	return s.Store.Delete(id)
+}
+
+func TestCompactStore(t *testing.T) {
+	store, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range historyRuns() {
+		if err := store.Save(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := CollectFlakeStats(runs)
+
+	cutoff := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	replaced, daily, err := compactStore(store, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replaced != 3 || daily != 2 {
+		t.Errorf("compacted %d runs into %d, want 3 into 2", replaced, daily)
+	}
+	runs, err = store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	if got, want := strings.Join(ids, " "), "r4 daily-2024-03-02 daily-2024-03-01"; got != want {
+		t.Errorf("runs %s, want %s", got, want)
+	}
+	// The runs and failures of the tests survive compaction.
+	after := CollectFlakeStats(runs)
+	if len(after) != len(before) {
+		t.Fatalf("stats %+v, want %+v", after, before)
+	}
+	for i := range before {
+		b, a := before[i], after[i]
+		if a.Suite != b.Suite || a.Test != b.Test || a.Runs != b.Runs || a.Failures != b.Failures {
+			t.Errorf("stats after compaction %+v, want %+v", a, b)
+		}
+	}
+}
+
+func TestCompactStoreInterrupted(t *testing.T) {
+	mem := NewMemStore()
+	for _, run := range historyRuns() {
+		mem.Save(run)
+	}
+	store := &failingStore{Store: mem, n: 1}
+	cutoff := time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+	replaced, _, err := compactStore(store, cutoff)
+	if err == nil {
+		t.Fatal("compactStore succeeded with Delete failing")
+	}
+	if replaced != 1 {
+		t.Errorf("replaced %d runs, want 1", replaced)
+	}
+	// The daily runs were saved before any run was deleted, so the runs
+	// left still count every result, some of them twice.
+	runs, _ := mem.List()
+	stats := CollectFlakeStats(runs)
+	if len(stats) == 0 || stats[0].Test != "TestA" || stats[0].Runs < 4 || stats[0].Failures < 2 {
+		t.Errorf("stats after interrupted compaction %+v, want TestA with 4 runs and 2 failures or more", stats)
+	}
+	for _, id := range []string{"daily-2024-03-01", "daily-2024-03-02"} {
+		if _, err := mem.Load(id); err != nil {
+			t.Errorf("load %s: %v", id, err)
+		}
+	}
+}
+
+func TestPruneStore(t *testing.T) {
+	store := NewMemStore()
+	for _, run := range historyRuns() {
+		store.Save(run)
+	}
+	deleted, kept, err := pruneStore(store, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || kept != 2 {
+		t.Errorf("deleted %d, kept %d, want 2 and 2", deleted, kept)
+	}
+	runs, _ := store.List()
+	if got, want := describeRuns(runs), describeRuns(historyRuns()[:2]); got != want {
+		t.Errorf("runs\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+		ok   bool
+	}{
+		{"90d", 90 * 24 * time.Hour, true},
+		{"0d", 0, true},
+		{"36h", 36 * time.Hour, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"-1d", 0, false},
+		{"-1h", 0, false},
+		{"d", 0, false},
+		{"1w", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.s)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseAge(%q) = %v, %v, want %v, ok %v", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+}
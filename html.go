@@ -0,0 +1,265 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// htmlSuite and htmlTest are the values WriteHTML passes to its template.
+type htmlSuite struct {
+	*TestSuite
+	Counts
+	Tests    []htmlTest
+	Timing   Timing
+	Bars     []htmlBar
+	Timeline []htmlSpan
+
+	Benchmarks []htmlBenchmark
+}
+
+type htmlBenchmark struct {
+	Name string
+	*BenchmarkResult
+}
+
+type htmlTest struct {
+	*TestCase
+	Message         string
+	Diffs           []htmlDiff
+	Output          string // with its stack traces symbolicated
+	Source          *Snippet
+	Issue, IssueURL string
+}
+
+// htmlDiff is a go-cmp diff split into lines classed by their marker.
+type htmlDiff struct {
+	Header string
+	Lines  []htmlDiffLine
+}
+
+type htmlDiffLine struct {
+	Class, Text string
+}
+
+func newHTMLDiff(d Diff) htmlDiff {
+	hd := htmlDiff{Header: d.Header}
+	for _, l := range strings.Split(d.Text, "\n") {
+		var class string
+		switch {
+		case strings.HasPrefix(l, "+"):
+			class = "add"
+		case strings.HasPrefix(l, "-"):
+			class = "del"
+		}
+		hd.Lines = append(hd.Lines, htmlDiffLine{class, l})
+	}
+	return hd
+}
+
+// htmlBar is a bar of the histogram of the durations of a suite, whose
+// width is a percentage of that of the longest.
+type htmlBar struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+func newHTMLBars(t Timing) []htmlBar {
+	max := 0
+	for _, n := range t.Histogram {
+		if n > max {
+			max = n
+		}
+	}
+	var bars []htmlBar
+	for i, l := range t.BucketLabels() {
+		b := htmlBar{Label: l, Count: t.Histogram[i]}
+		if max > 0 {
+			b.Percent = 100 * b.Count / max
+		}
+		bars = append(bars, b)
+	}
+	return bars
+}
+
+// htmlSpan is a bar of the timeline of a suite, for the run of a test,
+// placed by percentages of the time from the first start to the last end of
+// its tests.
+type htmlSpan struct {
+	*TestCase
+	Start, End  time.Duration // since the start of the first test
+	Left, Width float64
+}
+
+// newHTMLTimeline returns the timeline of the tests of s whose start and
+// end are known, in the order they started.
+func newHTMLTimeline(s *TestSuite) []htmlSpan {
+	var spans []htmlSpan
+	var starts, ends []time.Time
+	var first, last time.Time
+	for i := range s.TestCases {
+		t := &s.TestCases[i]
+		start, end := testTimes(t)
+		if start.IsZero() || end.Before(start) {
+			continue
+		}
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if end.After(last) {
+			last = end
+		}
+		spans = append(spans, htmlSpan{TestCase: t})
+		starts, ends = append(starts, start), append(ends, end)
+	}
+	total := float64(last.Sub(first))
+	for i := range spans {
+		sp := &spans[i]
+		sp.Start, sp.End = starts[i].Sub(first), ends[i].Sub(first)
+		if total > 0 {
+			sp.Left = 100 * float64(sp.Start) / total
+			sp.Width = 100 * float64(sp.End-sp.Start) / total
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans
+}
+
+// htmlData holds the values of the report template.
+type htmlData struct {
+	Title   string
+	Counts  Counts
+	Timing  Timing
+	Suites  []htmlSuite
+	History bool // link tests to their history in gojunit serve
+	Rerun   []RerunCommand
+}
+
+func (s htmlSuite) Failed() bool { return s.Failures+s.Errors > 0 }
+
+func (s htmlSuite) Key() string { return suiteKey(s.TestSuite) }
+
+// htmlStyle and the report template are shared with the pages of gojunit
+// serve.
+const htmlStyle = `
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1em; }
+th, td { text-align: left; padding: 0.2em 0.6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.num, th.num { text-align: right; }
+.success { color: #1a7f37; } .failure, .error { color: #cf222e; } .skipped { color: #9a6700; }
+summary { cursor: pointer; font-weight: bold; margin: 0.5em 0; }
+.snippet .failure { background: #ffebe9; font-weight: bold; color: inherit; }
+.add { background: #dafbe1; } .del { background: #ffebe9; }
+table.histogram { width: auto; } table.histogram td { border: none; padding: 0 0.6em; }
+.bar { display: inline-block; height: 0.8em; background: #8c959f; }
+table.timeline td { border: none; padding: 0 0.6em; white-space: nowrap; }
+.span { display: inline-block; height: 0.8em; min-width: 1px; background: #2da44e; }
+.span.failure, .span.error { background: #cf222e; } .span.skipped { background: #bf8700; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; margin: 0.3em 0; }
+`
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+}).Parse(`{{define "suites"}}
+{{range .Suites}}{{$suite := .Key}}
+<details{{if .Failed}} open{{end}}>
+<summary class="{{if .Failed}}failure{{else}}success{{end}}">{{.Key}} &mdash; {{.Counts}} ({{seconds .Duration}})</summary>
+{{if .Timing.Tests}}<details><summary>Time: {{.Timing}}</summary>
+<table class="histogram">
+{{range .Bars}}<tr><td>{{.Label}}</td><td class="num">{{.Count}}</td><td style="width: 20em"><span class="bar" style="width: {{.Percent}}%"></span></td></tr>
+{{end}}</table>
+</details>{{end}}
+{{with .Timeline}}<details><summary>Timeline</summary>
+<table class="timeline">
+{{range .}}<tr><td>{{.Name}}</td><td style="width: 60%"><span class="span {{.Status}}" style="margin-left: {{printf "%.2f" .Left}}%; width: {{printf "%.2f" .Width}}%" title="{{.Name}}: {{seconds .Start}} to {{seconds .End}}"></span></td><td class="num">{{seconds .Duration}}</td></tr>
+{{end}}</table>
+</details>{{end}}
+{{with .Benchmarks}}<table>
+<tr><th>Benchmark</th><th class="num">Iterations</th><th class="num">ns/op</th><th class="num">MB/s</th><th class="num">B/op</th><th class="num">allocs/op</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td class="num">{{.Iterations}}</td><td class="num">{{.NsPerOp}}</td><td class="num">{{with .MBPerS}}{{.}}{{end}}</td><td class="num">{{with .BytesPerOp}}{{.}}{{end}}</td><td class="num">{{with .AllocsPerOp}}{{.}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Output.String}}<details><summary>Output outside of tests</summary><pre>{{.}}</pre></details>{{end}}
+<table>
+<tr><th>Test</th><th>Status</th><th class="num">Time</th></tr>
+{{range .Tests}}
+<tr>
+<td>{{if $.History}}<a href="/history?suite={{$suite}}&amp;test={{.Name}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}{{if .Issue}} {{if .IssueURL}}<a href="{{.IssueURL}}">[{{.Issue}}]</a>{{else}}[{{.Issue}}]{{end}}{{end}}{{if .Message}}<br><small>{{.Message}}</small>{{end}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td class="num">{{seconds .Duration}}</td>
+</tr>
+{{if or (eq .Status.String "failure") (eq .Status.String "error")}}
+<tr><td colspan="3">{{with .Source}}<div>{{.File}}</div><pre class="snippet">{{range .Lines}}<span{{if .Failure}} class="failure"{{end}}>{{printf "%4d" .N}}  {{.Text}}</span>
+{{end}}</pre>{{end}}{{range .Diffs}}<div>{{.Header}}</div><pre>{{range .Lines}}<span{{with .Class}} class="{{.}}"{{end}}>{{.Text}}</span>
+{{end}}</pre>{{end}}<pre>{{.Output}}</pre>{{with .Stderr.String}}<pre>{{.}}</pre>{{end}}</td></tr>
+{{end}}
+{{end}}
+</table>
+</details>
+{{end}}
+{{end}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>` + htmlStyle + `</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Counts}}</p>
+{{if .Timing.Tests}}<p>Time: {{.Timing}}</p>{{end}}
+{{template "suites" .}}
+{{with .Rerun}}<h2>Reproduce</h2>
+<pre>{{range .}}{{.}}
+{{end}}</pre>{{end}}
+</body>
+</html>
+`))
+
+func newHTMLData(title string, suites []TestSuite) htmlData {
+	data := htmlData{Title: title}
+	all := make([]*TestSuite, len(suites))
+	for i := range suites {
+		suite := &suites[i]
+		all[i] = suite
+		hs := htmlSuite{TestSuite: suite, Timing: TimingOf(suite)}
+		hs.Bars = newHTMLBars(hs.Timing)
+		hs.Timeline = newHTMLTimeline(suite)
+		hs.Counts.Add(suite)
+		data.Counts.Add(suite)
+		for j := range suite.TestCases {
+			t := &suite.TestCases[j]
+			ht := htmlTest{TestCase: t, Issue: t.Property("issue"), IssueURL: t.Property("issue_url")}
+			if t.Status != Success {
+				ht.Message = messageOf(t)
+				ht.Output = SymbolicateStacks(suite, t.Output.String())
+				if sources != nil {
+					ht.Source = sources.Snippet(suite, t)
+				}
+				for _, d := range ParseDiffs(t.Output.String()) {
+					ht.Diffs = append(ht.Diffs, newHTMLDiff(d))
+				}
+			}
+			hs.Tests = append(hs.Tests, ht)
+			if r := benchmarkOf(t); r != nil {
+				hs.Benchmarks = append(hs.Benchmarks, htmlBenchmark{t.Name, r})
+			}
+		}
+		data.Suites = append(data.Suites, hs)
+	}
+	data.Timing = TimingOf(all...)
+	data.Rerun = RerunCommands(suites)
+	return data
+}
+
+// WriteHTML writes a slice of TestSuites to a writer as a standalone HTML
+// page.
+func WriteHTML(suites []TestSuite, w io.Writer) error {
+	return htmlTemplate.Execute(w, newHTMLData("Test report", suites))
+}
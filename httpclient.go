@@ -0,0 +1,109 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpClient is the client of the services gojunit publishes results to.
+var httpClient = &http.Client{Timeout: time.Minute}
+
+// doJSON sends a request with body, encoded as JSON unless it is an
+// io.Reader, and decodes the JSON response into out unless out is nil. The
+// request gets the given headers, and a JSON content type unless they set
+// one. Responses other than 2xx are returned as errors quoting the start of
+// their body.
+func doJSON(method, url string, header http.Header, body, out interface{}) error {
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case io.Reader:
+		r = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	req.Header.Set("User-Agent", "gojunit/"+Version)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{method, redactURL(url), resp.StatusCode, resp.Status, strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	// Gerrit prefixes JSON responses with a line guarding against their
+	// inclusion in pages as scripts.
+	br := bufio.NewReader(resp.Body)
+	if prefix, _ := br.Peek(len(xssiPrefix)); string(prefix) == xssiPrefix {
+		br.ReadString('\n')
+	}
+	return json.NewDecoder(br).Decode(out)
+}
+
+const xssiPrefix = ")]}'"
+
+// A statusError is the error returned by doJSON for responses other than 2xx.
+type statusError struct {
+	Method, URL string
+	StatusCode  int
+	Status      string
+	Message     string // start of the body of the response
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URL, e.Status, e.Message)
+}
+
+// isStatus reports whether err is a statusError with the given status code.
+func isStatus(err error, code int) bool {
+	e, ok := err.(*statusError)
+	return ok && e.StatusCode == code
+}
+
+// basicAuth returns the value of an Authorization header for HTTP basic
+// authentication.
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// redactURL returns url without the query, which may hold credentials, for
+// use in error messages.
+func redactURL(url string) string {
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
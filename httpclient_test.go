@@ -0,0 +1,67 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// An apiRequest is a request received by a fakeAPI.
+type apiRequest struct {
+	Method, Path, Query string // the path as escaped in the request
+	Header              http.Header
+	Body                []byte
+}
+
+// decode decodes the JSON body of r into v.
+func (r *apiRequest) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("%s %s: body %q: %v", r.Method, r.Path, r.Body, err)
+	}
+}
+
+// A fakeAPI stands in for the HTTP API of a service, recording the requests
+// it receives and answering them with reply.
+type fakeAPI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []apiRequest
+}
+
+// newFakeAPI starts a fakeAPI answering each request with the status and
+// body returned by reply, or with 200 and {} if reply is nil.
+func newFakeAPI(t *testing.T, reply func(r *apiRequest) (int, string)) *fakeAPI {
+	t.Helper()
+	api := new(fakeAPI)
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := apiRequest{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Clone(), body}
+		api.mu.Lock()
+		api.requests = append(api.requests, req)
+		api.mu.Unlock()
+		status, resp := http.StatusOK, "{}"
+		if reply != nil {
+			status, resp = reply(&req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, resp)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// received returns the requests received so far.
+func (api *fakeAPI) received() []apiRequest {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]apiRequest(nil), api.requests...)
+}
@@ -0,0 +1,71 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// testIDNamespace is the namespace of the name-based UUIDs returned by
+// TestID, itself derived from the URL namespace of RFC 9562 and the URL of
+// gojunit.
+var testIDNamespace = nameUUID([16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}, "https://github.com/kisielk/gojunit")
+
+// TestID returns a stable identifier of the test with the given name in the
+// package with the given import path, which contains the path of its
+// module. It is a version 5 UUID, so the same test gets the same ID in
+// every run and report, wherever it appears in them.
+func TestID(pkg, test string) string {
+	u := nameUUID(testIDNamespace, pkg+"\x00"+test)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// nameUUID returns the version 5 UUID of name in namespace.
+func nameUUID(namespace [16]byte, name string) [16]byte {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// AddTestIDs records the TestID of every test case in suites in its "id"
+// property, unless it has one already, as when it was read from a report
+// written with IDs. Labels of matrix entries are not part of the ID: the
+// same test run in two entries has the same ID.
+func AddTestIDs(suites []TestSuite) {
+	for i := range suites {
+		s := &suites[i]
+		pkg := suitePackage(s)
+		for j := range s.TestCases {
+			if t := &s.TestCases[j]; t.Property("id") == "" {
+				t.SetProperty("id", TestID(pkg, t.Name))
+			}
+		}
+	}
+}
+
+// caseID returns the ID of test case t of suite s: its "id" property, or its
+// TestID if it has none.
+func caseID(s *TestSuite, t *TestCase) string {
+	if id := t.Property("id"); id != "" {
+		return id
+	}
+	return TestID(suitePackage(s), t.Name)
+}
+
+// suitePackage returns the name of suite s without the label of its matrix
+// entry.
+func suitePackage(s *TestSuite) string {
+	if l := s.Property("label"); l != "" {
+		return strings.TrimSuffix(s.Name, " ["+l+"]")
+	}
+	return s.Name
+}
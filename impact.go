@@ -0,0 +1,87 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The values of the impact property of the failing tests marked by an
+// Impact.
+const (
+	impactChanged     = "changed"
+	impactPreexisting = "pre-existing"
+)
+
+// An Impact tells the failures of tests in the files touched by a change
+// from those that predate it.
+type Impact struct {
+	sources *sourceResolver
+	changed map[string]bool // absolute paths of the changed files
+}
+
+// NewImpact returns the Impact of the changes to the git checkout of the
+// working directory since the base commit, including those not committed
+// yet, on the tests of the modules mods.
+func NewImpact(base string, mods []moduleDir) (*Impact, error) {
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	top = strings.TrimSpace(top)
+	diff, err := git("-C", top, "diff", "--name-only", base)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("-C", top, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	im := &Impact{sources: newSourceResolver(mods), changed: make(map[string]bool)}
+	for _, name := range strings.Fields(diff + "\n" + untracked) {
+		im.changed[filepath.Join(top, filepath.FromSlash(name))] = true
+	}
+	return im, nil
+}
+
+// testFrameRE matches the frames of test files in goroutine stacks.
+var testFrameRE = regexp.MustCompile(`^\s+(\S+_test\.go):\d+`)
+
+// File returns the path of the source file of the failure of t, a test of s:
+// that of its location or, when it panicked, of the first test file in its
+// stack. It returns "" if it is not in the source tree.
+func (im *Impact) File(s *TestSuite, t *TestCase) string {
+	out := t.Output.String()
+	if file, _, _ := FailureLocation(out); file != "" {
+		return im.sources.path(suitePackage(s), file)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if m := testFrameRE.FindStringSubmatch(line); m != nil {
+			return im.sources.path(suitePackage(s), m[1])
+		}
+	}
+	return ""
+}
+
+// Mark sets the impact property of each failing test of suites to "changed"
+// if its failure is in a changed file and to "pre-existing" otherwise.
+func (im *Impact) Mark(suites []TestSuite) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			if file := im.File(s, t); file != "" && im.changed[file] {
+				t.SetProperty("impact", impactChanged)
+			} else {
+				t.SetProperty("impact", impactPreexisting)
+			}
+		}
+	}
+}
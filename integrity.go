@@ -0,0 +1,144 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checksums maps the names accepted by -checksum to the hashes they name.
+var checksums = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// writeChecksum writes the digest of the named file to a file named after
+// it with the name of the hash as its extension, as in report.xml.sha256, in
+// the format that sha256sum -c checks.
+func writeChecksum(name, algorithm string) error {
+	h := checksums[algorithm]()
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(name))
+	return os.WriteFile(name+"."+algorithm, []byte(line), 0o666)
+}
+
+// A signer signs the named file, writing its signature beside it.
+type signer func(name string) error
+
+// newSigner returns the signer selected by -sign: minisign:KEY signs with the
+// unencrypted minisign secret key in the file KEY, and cosign:KEY runs cosign
+// sign-blob with the key KEY, which may be any key reference cosign accepts.
+func newSigner(spec string) (signer, error) {
+	tool, key, ok := strings.Cut(spec, ":")
+	if !ok || key == "" {
+		return nil, fmt.Errorf("-sign %q: want minisign:KEY or cosign:KEY", spec)
+	}
+	switch tool {
+	case "minisign":
+		sk, err := readMinisignKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return sk.sign, nil
+	case "cosign":
+		return func(name string) error {
+			cmd := exec.Command("cosign", "sign-blob", "--yes", "--key", key, "--output-signature", name+".sig", name)
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("cosign sign-blob %s: %v", name, err)
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("-sign %q: unknown signing tool %q", spec, tool)
+}
+
+// A minisignKey is a minisign secret key.
+type minisignKey struct {
+	id  [8]byte
+	key ed25519.PrivateKey
+}
+
+// readMinisignKey reads a minisign secret key file. Keys encrypted with a
+// password, as minisign -G creates them without -W, are not supported.
+func readMinisignKey(name string) (*minisignKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("%s: not a minisign secret key", name)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	// The algorithms, the salt and limits of the key derivation function,
+	// the key ID, the key and its checksum.
+	if err != nil || len(b) != 158 || string(b[:2]) != "Ed" {
+		return nil, fmt.Errorf("%s: not a minisign secret key", name)
+	}
+	if b[2] != 0 || b[3] != 0 {
+		return nil, fmt.Errorf("%s: encrypted minisign keys are not supported; create the key with minisign -G -W", name)
+	}
+	k := &minisignKey{key: ed25519.PrivateKey(bytes.Clone(b[62:126]))}
+	copy(k.id[:], b[54:62])
+	return k, nil
+}
+
+// sign writes the minisign signature of the named file to a file named after
+// it with the .minisig extension, which minisign -V verifies.
+func (k *minisignKey) sign(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	sig := append([]byte("Ed"), k.id[:]...)
+	sig = append(sig, ed25519.Sign(k.key, data)...)
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s", time.Now().Unix(), filepath.Base(name))
+	global := ed25519.Sign(k.key, append(bytes.Clone(sig[10:]), trusted...))
+	out := fmt.Sprintf("untrusted comment: signature from gojunit\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig), trusted, base64.StdEncoding.EncodeToString(global))
+	return os.WriteFile(name+".minisig", []byte(out), 0o666)
+}
+
+// sealFiles writes the checksums of the named files with the given
+// algorithm, if any, and signs them with sign, if not nil.
+func sealFiles(names []string, algorithm string, sign signer) error {
+	var errs []error
+	for _, name := range names {
+		if algorithm != "" {
+			if err := writeChecksum(name, algorithm); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if sign != nil {
+			if err := sign(name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
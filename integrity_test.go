@@ -0,0 +1,176 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeMinisignKey writes an unencrypted minisign secret key with the given
+// ID and seed, as minisign -G -W does, and returns its public key.
+func writeMinisignKey(t *testing.T, name string, id [8]byte, seed byte, kdf string) ed25519.PublicKey {
+	t.Helper()
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	b := append([]byte("Ed"), kdf...)
+	b = append(b, "B2"...)
+	b = append(b, make([]byte, 32+8+8)...) // the salt and limits of the key derivation function
+	b = append(b, id[:]...)
+	b = append(b, key...)
+	b = append(b, make([]byte, 32)...) // the checksum, which is not checked
+	data := "untrusted comment: minisign encrypted secret key\n" + base64.StdEncoding.EncodeToString(b) + "\n"
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return key.Public().(ed25519.PublicKey)
+}
+
+// verifyMinisign verifies the minisign signature of the named file, as
+// minisign -V does.
+func verifyMinisign(name string, id [8]byte, pub ed25519.PublicKey) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	minisig, err := os.ReadFile(name + ".minisig")
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(minisig), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("malformed signature %q", minisig)
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 74 || string(sig[:2]) != "Ed" {
+		return fmt.Errorf("malformed signature %q", lines[1])
+	}
+	if !bytes.Equal(sig[2:10], id[:]) {
+		return fmt.Errorf("signed with key %x, want %x", sig[2:10], id)
+	}
+	if !ed25519.Verify(pub, data, sig[10:]) {
+		return fmt.Errorf("%s: signature verification failed", name)
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return err
+	}
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(pub, append(bytes.Clone(sig[10:]), trusted...), global) {
+		return fmt.Errorf("%s: trusted comment verification failed", name)
+	}
+	if !strings.HasSuffix(trusted, "\tfile:"+filepath.Base(name)) {
+		return fmt.Errorf("trusted comment %q does not name %s", trusted, filepath.Base(name))
+	}
+	return nil
+}
+
+// verifyChecksum checks the named file against its .sha256 file, as
+// sha256sum -c does.
+func verifyChecksum(name string) error {
+	line, err := os.ReadFile(name + ".sha256")
+	if err != nil {
+		return err
+	}
+	sum, file, ok := strings.Cut(strings.TrimSuffix(string(line), "\n"), "  ")
+	if !ok || file != filepath.Base(name) {
+		return fmt.Errorf("malformed checksum line %q", line)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if got := sha256.Sum256(data); hex.EncodeToString(got[:]) != sum {
+		return fmt.Errorf("%s: checksum %x, want %s", name, got, sum)
+	}
+	return nil
+}
+
+func TestSealFiles(t *testing.T) {
+	dir := t.TempDir()
+	id := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+	keyFile := filepath.Join(dir, "gojunit.key")
+	pub := writeMinisignKey(t, keyFile, id, 42, "\x00\x00")
+	report := filepath.Join(dir, "report.xml")
+	manifest := filepath.Join(dir, "manifest.json")
+	for _, name := range []string{report, manifest} {
+		if err := os.WriteFile(name, []byte("<testsuites>"+name+"</testsuites>\n"), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sign, err := newSigner("minisign:" + keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sealFiles([]string{report, manifest}, "sha256", sign); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{report, manifest} {
+		if err := verifyChecksum(name); err != nil {
+			t.Error(err)
+		}
+		if err := verifyMinisign(name, id, pub); err != nil {
+			t.Error(err)
+		}
+	}
+	// The signature of a key is not that of another.
+	other := writeMinisignKey(t, filepath.Join(dir, "other.key"), id, 7, "\x00\x00")
+	if err := verifyMinisign(report, id, other); err == nil {
+		t.Error("signature verified with another key")
+	}
+
+	// A report changed after it was sealed is rejected.
+	if err := os.WriteFile(report, []byte("<testsuites></testsuites>\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksum(report); err == nil {
+		t.Error("checksum of a tampered report verified")
+	}
+	if err := verifyMinisign(report, id, pub); err == nil {
+		t.Error("signature of a tampered report verified")
+	}
+	// A signature moved to another file is rejected too.
+	if err := os.Rename(manifest+".minisig", report+".minisig"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMinisign(report, id, pub); err == nil {
+		t.Error("signature of another file verified")
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	dir := t.TempDir()
+	encrypted := filepath.Join(dir, "encrypted.key")
+	writeMinisignKey(t, encrypted, [8]byte{}, 1, "Sc")
+	garbage := filepath.Join(dir, "garbage.key")
+	if err := os.WriteFile(garbage, []byte("untrusted comment: x\nbm90IGEga2V5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec string
+		want string // in the error
+	}{
+		{"minisign", "want minisign:KEY or cosign:KEY"},
+		{"minisign:", "want minisign:KEY or cosign:KEY"},
+		{"gpg:key", `unknown signing tool "gpg"`},
+		{"minisign:" + encrypted, "encrypted minisign keys are not supported"},
+		{"minisign:" + garbage, "not a minisign secret key"},
+		{"minisign:" + filepath.Join(dir, "missing.key"), "no such file"},
+	}
+	for _, tt := range tests {
+		_, err := newSigner(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("newSigner(%q) error %v, want %q", tt.spec, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// An IssueRule links the tests matching a pattern to an issue.
+type IssueRule struct {
+	Pattern *regexp.Regexp // matched against "suite/test", unanchored
+	Issue   string         // an issue ID or URL
+}
+
+// ReadIssueRules reads a rules file. Each line holds a regular expression
+// and an issue ID or URL separated by white space, as in
+//
+//	TestFlaky                    https://github.com/org/repo/issues/12
+//	^example.com/db/TestConnect  DB-341
+//
+// The expression is matched against the name of each test prefixed by the
+// name of its suite and a slash, like the -run flag of go test matches test
+// names. Blank lines and lines starting with # are ignored.
+func ReadIssueRules(path string) ([]IssueRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []IssueRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a pattern and an issue", path, n)
+		}
+		re, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		rules = append(rules, IssueRule{re, fields[1]})
+	}
+	return rules, s.Err()
+}
+
+// LinkIssues records the issue of the first rule matching each test in its
+// "issue" property. For issues that are IDs rather than URLs, urlFormat, if
+// not empty, is a fmt format turning the ID into a URL, which is recorded in
+// the "issue_url" property.
+func LinkIssues(suites []TestSuite, rules []IssueRule, urlFormat string) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			for _, r := range rules {
+				if !r.Pattern.MatchString(s.Name + "/" + t.Name) {
+					continue
+				}
+				t.SetProperty("issue", r.Issue)
+				if url := issueURL(r.Issue, urlFormat); url != "" {
+					t.SetProperty("issue_url", url)
+				}
+				break
+			}
+		}
+	}
+}
+
+func issueURL(issue, urlFormat string) string {
+	if strings.Contains(issue, "://") {
+		return issue
+	}
+	if urlFormat == "" {
+		return ""
+	}
+	return fmt.Sprintf(urlFormat, issue)
+}
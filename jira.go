@@ -0,0 +1,190 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// jiraMaxFiled is the most failures filed or updated by one conversion, so
+// that a broken build does not file an issue for every test.
+const jiraMaxFiled = 25
+
+// A jiraClient files the failures of tests as Jira issues, one per test.
+// Issues are found again by a label holding the ID of their test, so that a
+// test failing again updates its open issue rather than filing another.
+type jiraClient struct {
+	URL       string // base URL of the Jira site
+	Project   string // key of the project of new issues
+	IssueType string
+	Auth      string // value of the Authorization header
+
+	legacySearch bool // the site has no /search/jql
+}
+
+// jiraLabel returns the label of the issues of the test with the given ID.
+func jiraLabel(id string) string {
+	return "gojunit-" + id
+}
+
+// FileFailures files an issue for every test failing in suites that has no
+// open issue, and comments on the open issues of the others, attaching the
+// output of the tests to both.
+func (c *jiraClient) FileFailures(suites []TestSuite) error {
+	n := 0
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			if n++; n > jiraMaxFiled {
+				logger.Warn("too many failures; not filing the others", "limit", jiraMaxFiled)
+				return nil
+			}
+			if err := c.fileFailure(s, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *jiraClient) fileFailure(s *TestSuite, t *TestCase) error {
+	label := jiraLabel(caseID(s, t))
+	key, err := c.openIssue(label)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		fields := map[string]interface{}{
+			"project":     map[string]string{"key": c.Project},
+			"issuetype":   map[string]string{"name": c.IssueType},
+			"summary":     truncate(fmt.Sprintf("%s fails in %s", t.Name, s.Name), 255),
+			"description": jiraDescription(s, t),
+			"labels":      []string{"gojunit", label},
+		}
+		var issue struct{ Key string }
+		if err := c.do("POST", "/issue", map[string]interface{}{"fields": fields}, &issue); err != nil {
+			return err
+		}
+		key = issue.Key
+		logger.Info("filed issue", "issue", key, "test", t.Name, "suite", s.Name)
+	} else {
+		comment := map[string]string{"body": "Failed again.\n\n" + jiraDescription(s, t)}
+		if err := c.do("POST", "/issue/"+key+"/comment", comment, nil); err != nil {
+			return err
+		}
+		logger.Info("updated issue", "issue", key, "test", t.Name, "suite", s.Name)
+	}
+	if t.Output.Len() == 0 && t.Stderr.Len() == 0 {
+		return nil
+	}
+	return c.attach(key, jiraFileName(t.Name)+".log", append(t.Output.Bytes(), t.Stderr.Bytes()...))
+}
+
+// openIssue returns the key of the unresolved issue with label in the
+// project, or "" if there is none.
+func (c *jiraClient) openIssue(label string) (string, error) {
+	query := map[string]interface{}{
+		"jql":        fmt.Sprintf("project = %q AND labels = %q AND statusCategory != Done ORDER BY created DESC", c.Project, label),
+		"fields":     []string{"key"},
+		"maxResults": 1,
+	}
+	var result struct {
+		Issues []struct{ Key string }
+	}
+	// Jira Cloud replaced /search, which Jira Data Center still has, by
+	// /search/jql.
+	var err error
+	if !c.legacySearch {
+		err = c.do("POST", "/search/jql", query, &result)
+		c.legacySearch = isStatus(err, http.StatusNotFound)
+	}
+	if c.legacySearch {
+		err = c.do("POST", "/search", query, &result)
+	}
+	if err != nil || len(result.Issues) == 0 {
+		return "", err
+	}
+	return result.Issues[0].Key, nil
+}
+
+// attach attaches a file with the given name and contents to an issue.
+func (c *jiraClient) attach(key, name string, data []byte) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	f, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	f.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+	header := http.Header{
+		"Content-Type":      {w.FormDataContentType()},
+		"X-Atlassian-Token": {"no-check"},
+	}
+	return c.doHeader("POST", "/issue/"+key+"/attachments", header, &body, nil)
+}
+
+func (c *jiraClient) do(method, path string, body, out interface{}) error {
+	return c.doHeader(method, path, nil, body, out)
+}
+
+func (c *jiraClient) doHeader(method, path string, header http.Header, body, out interface{}) error {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Authorization", c.Auth)
+	return doJSON(method, strings.TrimSuffix(c.URL, "/")+"/rest/api/2"+path, header, body, out)
+}
+
+// jiraDescription returns the description of the issue of test t of suite s
+// in Jira wiki markup.
+func jiraDescription(s *TestSuite, t *TestCase) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Suite:* %s\n*Test:* %s\n*Job:* %s\n", s.Name, t.Name, ciJobID())
+	if t.Message != "" {
+		fmt.Fprintf(&b, "\n{noformat}\n%s\n{noformat}\n", t.Message)
+	}
+	if lines := lastLines(t.Output.String(), digestSnippetLines); lines != nil {
+		fmt.Fprintf(&b, "\nLast lines of output:\n{noformat}\n%s\n{noformat}\n", strings.Join(lines, "\n"))
+	}
+	return b.String()
+}
+
+var jiraFileNameRE = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// jiraFileName returns a file name made of the test name.
+func jiraFileName(test string) string {
+	return truncate(jiraFileNameRE.ReplaceAllString(test, "_"), 200)
+}
+
+// truncate returns s cut to at most n bytes, ending in "...", if it is
+// longer.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+// jiraAuth returns the Authorization header of requests to Jira: basic
+// authentication with an API token for Jira Cloud, with user, and a bearer
+// personal access token for Jira Data Center, without.
+func jiraAuth(user, token string) string {
+	if user != "" {
+		return basicAuth(user, token)
+	}
+	return "Bearer " + token
+}
@@ -0,0 +1,188 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+func TestJiraFileFailures(t *testing.T) {
+	t.Setenv("GITHUB_RUN_ID", "42")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "")
+	known := TestCase{Name: "TestKnown", Status: Failure, Message: "got 2"}
+	known.Output.WriteString("known_test.go:9: got 2\n")
+	fresh := TestCase{Name: "TestNew/sub case", Status: Error}
+	fresh.Output.WriteString("panic: boom\n")
+	fresh.Stderr.WriteString("goroutine 1 [running]:\n")
+	suites := []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestPass"}, known, fresh, {Name: "TestQuiet", Status: Failure}}}}
+	knownLabel := jiraLabel(TestID("x/m", "TestKnown"))
+
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		switch r.Path {
+		case "/rest/api/2/search/jql":
+			if strings.Contains(string(r.Body), knownLabel) {
+				return 200, `{"issues":[{"key":"GO-7"}]}`
+			}
+			return 200, `{"issues":[]}`
+		case "/rest/api/2/issue":
+			return 201, `{"key":"GO-8"}`
+		}
+		return 200, `{}`
+	})
+	c := &jiraClient{URL: api.URL + "/", Project: "GO", IssueType: "Bug", Auth: jiraAuth("ci@example.com", "token")}
+	if err := c.FileFailures(suites); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := api.received()
+	var got []string
+	for _, r := range reqs {
+		got = append(got, r.Method+" "+r.Path)
+		if auth := r.Header.Get("Authorization"); auth != basicAuth("ci@example.com", "token") {
+			t.Errorf("%s %s: Authorization %q", r.Method, r.Path, auth)
+		}
+	}
+	// The failing test with an open issue gets a comment, the others an
+	// issue, and the tests with output an attachment.
+	want := "POST /rest/api/2/search/jql\n" +
+		"POST /rest/api/2/issue/GO-7/comment\n" +
+		"POST /rest/api/2/issue/GO-7/attachments\n" +
+		"POST /rest/api/2/search/jql\n" +
+		"POST /rest/api/2/issue\n" +
+		"POST /rest/api/2/issue/GO-8/attachments\n" +
+		"POST /rest/api/2/search/jql\n" +
+		"POST /rest/api/2/issue"
+	if strings.Join(got, "\n") != want {
+		t.Fatalf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+
+	var query struct{ JQL string }
+	reqs[0].decode(t, &query)
+	if want := `project = "GO" AND labels = "` + knownLabel + `" AND statusCategory != Done ORDER BY created DESC`; query.JQL != want {
+		t.Errorf("jql %q, want %q", query.JQL, want)
+	}
+	var comment struct{ Body string }
+	reqs[1].decode(t, &comment)
+	wantDescription := "*Suite:* x/m\n*Test:* TestKnown\n*Job:* 42\n\n{noformat}\ngot 2\n{noformat}\n\nLast lines of output:\n{noformat}\nknown_test.go:9: got 2\n{noformat}\n"
+	if comment.Body != "Failed again.\n\n"+wantDescription {
+		t.Errorf("comment %q, want %q", comment.Body, "Failed again.\n\n"+wantDescription)
+	}
+
+	var issue struct {
+		Fields struct {
+			Project     struct{ Key string }
+			IssueType   struct{ Name string }
+			Summary     string
+			Description string
+			Labels      []string
+		}
+	}
+	reqs[4].decode(t, &issue)
+	f := issue.Fields
+	if f.Project.Key != "GO" || f.IssueType.Name != "Bug" || f.Summary != "TestNew/sub case fails in x/m" {
+		t.Errorf("issue fields %+v", f)
+	}
+	if want := "gojunit " + jiraLabel(TestID("x/m", "TestNew/sub case")); strings.Join(f.Labels, " ") != want {
+		t.Errorf("labels %q, want %q", f.Labels, want)
+	}
+
+	att := reqs[5]
+	if att.Header.Get("X-Atlassian-Token") != "no-check" {
+		t.Errorf("attachment without X-Atlassian-Token: no-check")
+	}
+	_, params, err := mime.ParseMediaType(att.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := multipart.NewReader(bytes.NewReader(att.Body), params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(part)
+	if part.FormName() != "file" || part.FileName() != "TestNew_sub_case.log" || string(data) != "panic: boom\ngoroutine 1 [running]:\n" {
+		t.Errorf("attached %s %s %q", part.FormName(), part.FileName(), data)
+	}
+}
+
+func TestJiraLegacySearch(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		switch r.Path {
+		case "/rest/api/2/search/jql":
+			return 404, `{"errorMessages":["null for uri"]}`
+		case "/rest/api/2/search":
+			return 200, `{"issues":[{"key":"GO-1"}]}`
+		}
+		return 200, `{}`
+	})
+	c := &jiraClient{URL: api.URL, Project: "GO", IssueType: "Bug", Auth: jiraAuth("", "pat")}
+	suites := []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA", Status: Failure}, {Name: "TestB", Status: Failure}}}}
+	if err := c.FileFailures(suites); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range api.received() {
+		got = append(got, r.Method+" "+r.Path)
+		if auth := r.Header.Get("Authorization"); auth != "Bearer pat" {
+			t.Errorf("%s %s: Authorization %q, want Bearer pat", r.Method, r.Path, auth)
+		}
+	}
+	// A site without /search/jql is asked once.
+	want := "POST /rest/api/2/search/jql\n" +
+		"POST /rest/api/2/search\n" +
+		"POST /rest/api/2/issue/GO-1/comment\n" +
+		"POST /rest/api/2/search\n" +
+		"POST /rest/api/2/issue/GO-1/comment"
+	if strings.Join(got, "\n") != want {
+		t.Errorf("requests\n%s\nwant\n%s", strings.Join(got, "\n"), want)
+	}
+}
+
+func TestJiraMaxFiled(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		if r.Path == "/rest/api/2/issue" {
+			return 201, `{"key":"GO-1"}`
+		}
+		return 200, `{"issues":[]}`
+	})
+	var tests []TestCase
+	for i := 0; i < jiraMaxFiled+5; i++ {
+		tests = append(tests, TestCase{Name: "TestA" + strings.Repeat("a", i), Status: Failure})
+	}
+	c := &jiraClient{URL: api.URL, Project: "GO", IssueType: "Bug", Auth: "Bearer pat"}
+	if err := c.FileFailures([]TestSuite{{Name: "x/m", TestCases: tests}}); err != nil {
+		t.Fatal(err)
+	}
+	filed := 0
+	for _, r := range api.received() {
+		if r.Path == "/rest/api/2/issue" {
+			filed++
+		}
+	}
+	if filed != jiraMaxFiled {
+		t.Errorf("filed %d issues, want %d", filed, jiraMaxFiled)
+	}
+}
+
+func TestJiraError(t *testing.T) {
+	api := newFakeAPI(t, func(r *apiRequest) (int, string) {
+		if r.Path == "/rest/api/2/issue" {
+			return 400, `{"errorMessages":[],"errors":{"issuetype":"valid issue type is required"}}`
+		}
+		return 200, `{"issues":[]}`
+	})
+	c := &jiraClient{URL: api.URL, Project: "GO", IssueType: "Nope", Auth: "Bearer pat"}
+	err := c.FileFailures([]TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA", Status: Failure}, {Name: "TestB", Status: Failure}}}})
+	if err == nil || !strings.Contains(err.Error(), "valid issue type is required") {
+		t.Errorf("error %v, want the message of Jira", err)
+	}
+	if n := len(api.received()); n != 2 {
+		t.Errorf("%d requests, want 2: filing stops at the first error", n)
+	}
+}
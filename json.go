@@ -0,0 +1,154 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// The jsonReport types define the document written by WriteJSON. Durations
+// are in seconds.
+
+type jsonReport struct {
+	Generator string      `json:"generator"`
+	Suites    []jsonSuite `json:"suites"`
+}
+
+type jsonSuite struct {
+	Name       string     `json:"name"`
+	Duration   float64    `json:"duration"`
+	Timestamp  *time.Time `json:"timestamp,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+	Counts     jsonCounts `json:"counts"`
+	TestCases  []jsonTest `json:"testcases"`
+	Output     string     `json:"output,omitempty"`
+}
+
+type jsonCounts struct {
+	Tests    int `json:"tests"`
+	Failures int `json:"failures"`
+	Errors   int `json:"errors"`
+	Skipped  int `json:"skipped"`
+}
+
+type jsonTest struct {
+	Name       string            `json:"name"`
+	Classname  string            `json:"classname"`
+	Status     Status            `json:"status"`
+	Duration   float64           `json:"duration"`
+	Message    string            `json:"message,omitempty"`
+	Assertion  *Assertion        `json:"assertion,omitempty"`
+	Leaks      []LeakedGoroutine `json:"leaks,omitempty"`
+	Benchmark  *BenchmarkResult  `json:"benchmark,omitempty"`
+	Diffs      []Diff            `json:"diffs,omitempty"`
+	Properties []Property        `json:"properties,omitempty"`
+	Output     string            `json:"output,omitempty"`
+	Stderr     string            `json:"stderr,omitempty"`
+}
+
+// WriteJSON writes a slice of TestSuites to a writer as a JSON document.
+func WriteJSON(suites []TestSuite, w io.Writer) error {
+	report := jsonReport{Generator: "gojunit v" + Version, Suites: toJSONSuites(suites)}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// ReadJSONReport reads a JSON document written by WriteJSON.
+func ReadJSONReport(r io.Reader) ([]TestSuite, error) {
+	var report jsonReport
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	return fromJSONSuites(report.Suites), nil
+}
+
+func toJSONSuites(suites []TestSuite) []jsonSuite {
+	jsuites := []jsonSuite{}
+	for i := range suites {
+		suite := &suites[i]
+		var c Counts
+		c.Add(suite)
+		js := jsonSuite{
+			Name:       suite.Name,
+			Duration:   suite.Duration.Seconds(),
+			Properties: suite.Properties,
+			Counts:     jsonCounts(c),
+			TestCases:  []jsonTest{},
+			Output:     suite.Output.String(),
+		}
+		if !suite.Timestamp.IsZero() {
+			ts := suite.Timestamp
+			js.Timestamp = &ts
+		}
+		for j := range suite.TestCases {
+			t := &suite.TestCases[j]
+			jt := jsonTest{
+				Name:       t.Name,
+				Classname:  classnameOf(suite, t),
+				Status:     t.Status,
+				Duration:   t.Duration.Seconds(),
+				Output:     t.Output.String(),
+				Stderr:     t.Stderr.String(),
+				Properties: t.Properties,
+				Benchmark:  benchmarkOf(t),
+			}
+			if t.Status != Success {
+				jt.Message = messageOf(t)
+			}
+			if t.Status == Failure {
+				jt.Assertion = ParseAssertion(jt.Output)
+				jt.Leaks = ParseGoroutineLeaks(jt.Output)
+			}
+			if t.Status != Success {
+				jt.Diffs = ParseDiffs(jt.Output)
+			}
+			js.TestCases = append(js.TestCases, jt)
+		}
+		jsuites = append(jsuites, js)
+	}
+	return jsuites
+}
+
+func fromJSONSuites(jsuites []jsonSuite) []TestSuite {
+	var suites []TestSuite
+	for _, js := range jsuites {
+		suite := TestSuite{
+			Name:       js.Name,
+			Duration:   jsonElapsed(js.Duration),
+			Properties: js.Properties,
+		}
+		if js.Timestamp != nil {
+			suite.Timestamp = *js.Timestamp
+		}
+		suite.Output.WriteString(js.Output)
+		for _, jt := range js.TestCases {
+			t := TestCase{
+				Name:       jt.Name,
+				Duration:   jsonElapsed(jt.Duration),
+				Status:     jt.Status,
+				Message:    jt.Message,
+				Properties: jt.Properties,
+			}
+			if jt.Classname != js.Name {
+				t.Classname = jt.Classname
+			}
+			t.Output.WriteString(jt.Output)
+			t.Stderr.WriteString(jt.Stderr)
+			suite.TestCases = append(suite.TestCases, t)
+		}
+		suites = append(suites, suite)
+	}
+	return suites
+}
+
+// jsonElapsed converts seconds to a Duration, rounding to the nanosecond
+// so that durations written in seconds read back the same.
+func jsonElapsed(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
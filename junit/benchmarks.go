@@ -0,0 +1,122 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A BenchmarkResult is the result of a benchmark, parsed from the line go
+// test prints for it:
+//
+//	BenchmarkParse/small-8   1000   1234 ns/op   56.78 MB/s   48 B/op   2 allocs/op
+//
+// The throughput and the allocations, printed with -benchmem, are nil when
+// they are not reported.
+type BenchmarkResult struct {
+	Iterations  int64    `json:"iterations"`
+	NsPerOp     float64  `json:"ns_per_op"`
+	MBPerS      *float64 `json:"mb_per_s,omitempty"`
+	BytesPerOp  *int64   `json:"bytes_per_op,omitempty"`
+	AllocsPerOp *int64   `json:"allocs_per_op,omitempty"`
+}
+
+// benchmarkRE matches the result line of a benchmark, whose name may carry
+// the -GOMAXPROCS suffix of go test.
+var benchmarkRE = regexp.MustCompile(`^(Benchmark\S*?)(?:-\d+)?\s+(\d+)\s+(\d+(?:\.\d+)?) ns/op(\s.*)?$`)
+
+// ParseBenchmark parses the result line of a benchmark.
+func ParseBenchmark(line string) (name string, r BenchmarkResult, ok bool) {
+	m := benchmarkRE.FindStringSubmatch(strings.TrimRight(line, "\n"))
+	if m == nil {
+		return "", r, false
+	}
+	r.Iterations, _ = strconv.ParseInt(m[2], 10, 64)
+	r.NsPerOp, _ = strconv.ParseFloat(m[3], 64)
+	fields := strings.Fields(m[4])
+	for i := 1; i < len(fields); i++ {
+		switch fields[i] {
+		case "MB/s":
+			if v, err := strconv.ParseFloat(fields[i-1], 64); err == nil {
+				r.MBPerS = &v
+			}
+		case "B/op":
+			if v, err := strconv.ParseInt(fields[i-1], 10, 64); err == nil {
+				r.BytesPerOp = &v
+			}
+		case "allocs/op":
+			if v, err := strconv.ParseInt(fields[i-1], 10, 64); err == nil {
+				r.AllocsPerOp = &v
+			}
+		}
+	}
+	return m[1], r, true
+}
+
+// isBenchmarkName reports whether line is the bare name go test -v prints
+// before running a benchmark.
+func isBenchmarkName(line string) bool {
+	return strings.HasPrefix(line, "Benchmark") && !strings.ContainsAny(line, " \t")
+}
+
+// setBenchmark records the result of a benchmark in the properties of t,
+// which passed, and in its duration, the time of all its iterations.
+func setBenchmark(t *TestCase, r BenchmarkResult) {
+	t.Status = Success
+	t.Duration = time.Duration(float64(r.Iterations) * r.NsPerOp).Round(time.Microsecond)
+	t.SetProperty("iterations", strconv.FormatInt(r.Iterations, 10))
+	t.SetProperty("ns_per_op", strconv.FormatFloat(r.NsPerOp, 'f', -1, 64))
+	if r.MBPerS != nil {
+		t.SetProperty("mb_per_s", strconv.FormatFloat(*r.MBPerS, 'f', -1, 64))
+	}
+	if r.BytesPerOp != nil {
+		t.SetProperty("bytes_per_op", strconv.FormatInt(*r.BytesPerOp, 10))
+	}
+	if r.AllocsPerOp != nil {
+		t.SetProperty("allocs_per_op", strconv.FormatInt(*r.AllocsPerOp, 10))
+	}
+}
+
+// benchmarkParents returns the names of the benchmarks that ran the
+// sub-benchmark name, which report no result of their own.
+func benchmarkParents(name string) []string {
+	var parents []string
+	for i := strings.IndexByte(name, '/'); i >= 0; {
+		parents = append(parents, name[:i])
+		j := strings.IndexByte(name[i+1:], '/')
+		if j < 0 {
+			break
+		}
+		i += 1 + j
+	}
+	return parents
+}
+
+// benchmarkHeaders are the lines go test prints before the results of the
+// benchmarks of a package. All but pkg, the name of the package, are kept as
+// properties of its suite.
+var benchmarkHeaders = []string{"goos", "goarch", "pkg", "cpu"}
+
+func isBenchmarkHeader(line string) bool {
+	_, _, ok := benchmarkHeader(line)
+	return ok
+}
+
+// benchmarkHeader returns the property of a header line of benchmarks, with
+// an empty name for the pkg line.
+func benchmarkHeader(line string) (name, value string, ok bool) {
+	for _, h := range benchmarkHeaders {
+		if strings.HasPrefix(line, h+": ") {
+			if h == "pkg" {
+				return "", "", true
+			}
+			return h, strings.TrimSpace(strings.TrimPrefix(line, h+": ")), true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,274 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A StreamFunc parses test results from r, calling emit with each suite as
+// soon as it is complete.
+type StreamFunc func(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error)
+
+// formats maps the input formats accepted by Collector.Add to the functions
+// parsing them: the output of go test, as text or JSON, and the formats
+// added by RegisterFormat.
+var formats = map[string]StreamFunc{
+	"text": streamText,
+	"json": streamJSON,
+}
+
+// RegisterFormat adds an input format accepted by Collector.Add, as gojunit
+// does for the reports of other tools, such as JUnit XML. It is meant to be
+// called from init functions, and panics if the format is already
+// registered.
+func RegisterFormat(name string, parse StreamFunc) {
+	if _, ok := formats[name]; ok {
+		panic("junit: input format " + name + " registered twice")
+	}
+	formats[name] = parse
+}
+
+// LookupFormat returns the function parsing the named input format, and
+// whether there is one.
+func LookupFormat(name string) (StreamFunc, bool) {
+	parse, ok := formats[name]
+	return parse, ok
+}
+
+// Formats returns the names of the input formats accepted by Collector.Add,
+// sorted.
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Collect parses r with parse and returns all of its suites.
+func Collect(parse StreamFunc, r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	var suites []TestSuite
+	warnings, err := parse(NewTextReader(r), func(s TestSuite) { suites = append(suites, s) })
+	if err != nil {
+		return nil, nil, err
+	}
+	return suites, warnings, nil
+}
+
+// ReadLines calls f with every line read from r, without its line ending.
+// Lines may be of any length.
+func ReadLines(r io.Reader, f func(string)) error {
+	return readLineBytes(r, func(line []byte) { f(string(line)) })
+}
+
+// readLineBytes calls f with every line read from r, without its line
+// ending. The line is only valid until f returns: it is a slice of the
+// buffer of the reader, unless the line was longer than the buffer.
+func readLineBytes(r io.Reader, f func([]byte)) error {
+	br := bufio.NewReaderSize(r, 64<<10)
+	var long []byte // a line longer than the buffer of br
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = append(long, line...)
+			continue
+		}
+		if long != nil {
+			line = append(long, line...)
+			long = long[:0:0]
+		}
+		if len(line) > 0 {
+			f(bytes.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// A Collector merges the test results of several streams, such as the logs
+// of test shards, that are parsed concurrently. Each stream has its own
+// parser state; suites are added to the collection as soon as they are
+// complete. The collection lists the suites of each stream in the order the
+// streams were added, however they were scheduled.
+type Collector struct {
+	// OnSuite, if not nil, is called with each suite as it is collected.
+	// Calls are serialized.
+	OnSuite func(TestSuite)
+
+	// Context, if not nil, stops the parsing of all streams when it is done.
+	// The suites of each stream parsed until then are still collected.
+	Context context.Context
+
+	// Tee, if not nil, receives a copy of every line read from the streams,
+	// written just before the line is parsed.
+	Tee io.Writer
+
+	// Jobs, if positive, is the number of streams parsed at the same time.
+	// The other streams are not opened until one of them ends, which can
+	// block the writers of named pipes.
+	Jobs int
+
+	// LabelInputs, if set, labels the suites of named streams that have no
+	// label with the name of their input, without its extension, to tell
+	// apart the suites of a package read from several inputs.
+	LabelInputs bool
+
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	sem      chan struct{}
+	suites   [][]TestSuite    // by stream
+	warnings [][]ParseWarning // by stream
+	err      error
+}
+
+// Add starts parsing r, which holds results in the given input format:
+// "text" or "json" for the output of go test, or one added by
+// RegisterFormat. The name of the stream is recorded in its warnings.
+func (c *Collector) Add(name string, r io.Reader, format string) error {
+	return c.add(name, format, func() (io.ReadCloser, error) { return io.NopCloser(r), nil })
+}
+
+// AddFile opens the named file and starts parsing it like Add. The file is
+// opened in the background, so that named pipes can be added before their
+// writers start.
+func (c *Collector) AddFile(name, format string) error {
+	return c.add(name, format, func() (io.ReadCloser, error) { return os.Open(name) })
+}
+
+func (c *Collector) add(name, format string, open func() (io.ReadCloser, error)) error {
+	parse, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown input format %q", format)
+	}
+	return c.AddStream(name, parse, open)
+}
+
+// AddStream starts parsing the stream returned by open with parse, like
+// Add. The stream is opened in the background, as by AddFile, and closed
+// when it ends.
+func (c *Collector) AddStream(name string, parse StreamFunc, open func() (io.ReadCloser, error)) error {
+	stream, sem := c.newStream()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if sem != nil {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+		}
+		r, err := open()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		defer r.Close()
+		c.parseStream(stream, name, parse, r)
+	}()
+	return nil
+}
+
+// newStream adds a stream to the collection, returning its index and the
+// semaphore limiting the streams parsed at the same time, if any.
+func (c *Collector) newStream() (int, chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Jobs > 0 && c.sem == nil {
+		c.sem = make(chan struct{}, c.Jobs)
+	}
+	c.suites = append(c.suites, nil)
+	c.warnings = append(c.warnings, nil)
+	return len(c.suites) - 1, c.sem
+}
+
+// parseStream parses r with parse, collecting its suites and warnings as
+// those of the given stream.
+func (c *Collector) parseStream(stream int, name string, parse StreamFunc, r io.Reader) {
+	Logger.Debug("parsing input", "input", name)
+	in := NewTextReader(NewContextReader(c.Context, r))
+	if c.Tee != nil {
+		in = newTeeReader(in, c.Tee)
+	}
+	warnings, err := parse(in, func(s TestSuite) {
+		if c.LabelInputs && name != "" && s.Property("label") == "" {
+			s.SetProperty("label", inputLabel(name))
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.suites[stream] = append(c.suites[stream], s)
+		if c.OnSuite != nil {
+			c.OnSuite(s)
+		}
+	})
+	Logger.Debug("input ended", "input", name, "warnings", len(warnings), "error", err)
+	c.mu.Lock()
+	for _, w := range warnings {
+		w.Input = name
+		c.warnings[stream] = append(c.warnings[stream], w)
+	}
+	c.mu.Unlock()
+	if err != nil && name != "" {
+		err = fmt.Errorf("%s: %v", name, err)
+	}
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+// fail records err unless an earlier error has been recorded.
+func (c *Collector) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Suites returns the suites collected so far.
+func (c *Collector) Suites() []TestSuite {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var suites []TestSuite
+	for _, s := range c.suites {
+		suites = append(suites, s...)
+	}
+	return suites
+}
+
+// Wait waits for all streams to end and returns the suites collected from
+// them, the warnings of all streams and the first error encountered.
+func (c *Collector) Wait() ([]TestSuite, []ParseWarning, error) {
+	c.wg.Wait()
+	var warnings []ParseWarning
+	c.mu.Lock()
+	for _, w := range c.warnings {
+		warnings = append(warnings, w...)
+	}
+	err := c.err
+	c.mu.Unlock()
+	return c.Suites(), warnings, err
+}
+
+// inputLabel returns the label of the suites of the named input without
+// one: its name without the extension. The directory is kept, as the inputs
+// of a matrix are often files of the same name in a directory per entry.
+func inputLabel(name string) string {
+	name = filepath.ToSlash(filepath.Clean(name))
+	return strings.TrimSuffix(name, path.Ext(name))
+}
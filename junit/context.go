@@ -0,0 +1,74 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"context"
+	"io"
+)
+
+// ParseOutputContext is like ParseOutput, but stops reading r when ctx is
+// done. The suites parsed until then are returned together with the error
+// of ctx; tests that were still running are reported in a final suite and
+// marked as errors, as when the input ends abruptly.
+//
+// A Read of r that is in progress when ctx is done is abandoned rather than
+// interrupted. Closing r, if possible, releases it.
+func ParseOutputContext(ctx context.Context, r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	return collectContext(ctx, streamText, r)
+}
+
+// ParseJSONContext is like ParseJSON, but stops reading r when ctx is done,
+// as ParseOutputContext does.
+func ParseJSONContext(ctx context.Context, r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	return collectContext(ctx, streamJSON, r)
+}
+
+// collectContext parses r with parse until ctx is done, returning the suites
+// parsed so far even if it fails.
+func collectContext(ctx context.Context, parse StreamFunc, r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	var suites []TestSuite
+	warnings, err := parse(NewTextReader(NewContextReader(ctx, r)), func(s TestSuite) { suites = append(suites, s) })
+	return suites, warnings, err
+}
+
+// contextReader is a reader whose reads fail with the error of its context
+// once the context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// NewContextReader returns a reader of r whose reads fail with the error of
+// ctx once it is done. It returns r itself if ctx is nil or never done.
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	if ctx == nil || ctx.Done() == nil {
+		return r
+	}
+	return &contextReader{ctx, r}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, len(p))
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := c.r.Read(buf)
+		done <- readResult{n, err}
+	}()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-c.ctx.Done():
+		return 0, c.ctx.Err()
+	}
+}
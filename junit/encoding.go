@@ -0,0 +1,91 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// NewTextReader returns a reader of the UTF-8 text of r, which may also
+// start with a byte order mark or be UTF-16, as the logs captured by some
+// Windows CI agents are. UTF-16 without a byte order mark is recognized by
+// the zero bytes of its first two ASCII characters.
+func NewTextReader(r io.Reader) io.Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	b, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		br.Discard(3)
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.LittleEndian}
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.BigEndian}
+	case len(b) == 4 && b[0] != 0 && b[1] == 0 && b[2] != 0 && b[3] == 0:
+		return &utf16Reader{r: br, order: binary.LittleEndian}
+	case len(b) == 4 && b[0] == 0 && b[1] != 0 && b[2] == 0 && b[3] != 0:
+		return &utf16Reader{r: br, order: binary.BigEndian}
+	}
+	return br
+}
+
+// A utf16Reader transcodes UTF-16 to UTF-8. It returns what it has decoded
+// without waiting for more input, so that streamed inputs are parsed as they
+// are written.
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	out   []byte // decoded, but not read yet
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 || len(u.out) < len(p) && u.r.Buffered() >= 2 {
+		r, err := u.rune()
+		if err != nil {
+			if len(u.out) > 0 {
+				break
+			}
+			return 0, err
+		}
+		u.out = utf8.AppendRune(u.out, r)
+	}
+	n := copy(p, u.out)
+	u.out = append(u.out[:0], u.out[n:]...)
+	return n, nil
+}
+
+// rune decodes the next character, replacing unpaired surrogates with
+// U+FFFD.
+func (u *utf16Reader) rune() (rune, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(u.r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	c := rune(u.order.Uint16(b[:]))
+	if !utf16.IsSurrogate(c) {
+		return c, nil
+	}
+	next, err := u.r.Peek(2)
+	if err != nil {
+		return utf8.RuneError, nil
+	}
+	r := utf16.DecodeRune(c, rune(u.order.Uint16(next)))
+	if r != utf8.RuneError {
+		u.r.Discard(2)
+	}
+	return r, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// encodeUTF16 returns s in UTF-16 in the given byte order, preceded by a
+// byte order mark if bom is set.
+func encodeUTF16(s string, order binary.AppendByteOrder, bom bool) []byte {
+	var b []byte
+	if bom {
+		b = order.AppendUint16(b, 0xfeff)
+	}
+	for _, c := range utf16.Encode([]rune(s)) {
+		b = order.AppendUint16(b, c)
+	}
+	return b
+}
+
+func TestNewTextReader(t *testing.T) {
+	const text = "=== RUN   TestÄ😀\n--- PASS: TestÄ😀 (0.00s)\n"
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"utf-8", []byte(text), text},
+		{"utf-8 bom", append([]byte{0xef, 0xbb, 0xbf}, text...), text},
+		{"utf-16le bom", encodeUTF16(text, binary.LittleEndian, true), text},
+		{"utf-16be bom", encodeUTF16(text, binary.BigEndian, true), text},
+		{"utf-16le", encodeUTF16(text, binary.LittleEndian, false), text},
+		{"utf-16be", encodeUTF16(text, binary.BigEndian, false), text},
+		{"short", []byte("ok"), "ok"},
+		{"empty", nil, ""},
+		{"bom only", []byte{0xff, 0xfe}, ""},
+		// A truncated input ends with half a character, which is dropped.
+		{"truncated", encodeUTF16("ok\n", binary.LittleEndian, true)[:7], "ok"},
+		// Unpaired surrogates, as in a log cut in the middle of a
+		// character, are replaced.
+		{"unpaired high surrogate", append(encodeUTF16("ab", binary.LittleEndian, true), 0x3d, 0xd8), "ab�"},
+		{"unpaired low surrogate", append(encodeUTF16("ab", binary.LittleEndian, true), 0x00, 0xde, 'c', 0), "ab�c"},
+		{"high surrogate before a character", append(encodeUTF16("a", binary.BigEndian, true), 0xd8, 0x3d, 0, 'b'), "a�b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, one := range []bool{false, true} {
+				var r io.Reader = bytes.NewReader(tt.input)
+				if one {
+					r = iotest.OneByteReader(r)
+				}
+				got, err := io.ReadAll(NewTextReader(r))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Errorf("read %q one byte at a time %v, want %q", got, one, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCollectUTF16(t *testing.T) {
+	const text = "=== RUN   TestA\n--- PASS: TestA (0.00s)\n=== RUN   TestB\n--- FAIL: TestB (0.00s)\nFAIL\nFAIL\tx/m\t0.01s\n"
+	var c Collector
+	if err := c.Add("windows.log", bytes.NewReader(encodeUTF16(strings.ReplaceAll(text, "\n", "\r\n"), binary.LittleEndian, true)), "text"); err != nil {
+		t.Fatal(err)
+	}
+	suites, warnings, err := c.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) > 0 {
+		t.Errorf("warnings %v", warnings)
+	}
+	if got, want := casesOf(suites), "x/m: TestA:success TestB:failure"; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gocheckRE matches the result lines printed by gopkg.in/check.v1, such as
+//
+//	PASS: foo_test.go:12: MySuite.TestBar	0.001s
+//	FAIL: foo_test.go:20: MySuite.TestBaz
+//	SKIP: foo_test.go:30: MySuite.TestQux (not on windows)
+var gocheckRE = regexp.MustCompile(`^(PASS|FAIL|SKIP|MISS|PANIC|FIXTURE-PANIC|FAIL EXPECTED|START): ([\w./\\-]+\.go:\d+): ([\w.]+)(?:\s+(.*))?$`)
+
+// gocheckStatuses maps the labels of gocheck result lines to statuses.
+var gocheckStatuses = map[string]Status{
+	"PASS":          Success,
+	"FAIL EXPECTED": Success,
+	"FAIL":          Failure,
+	"PANIC":         Error,
+	"FIXTURE-PANIC": Error,
+	"SKIP":          Skipped,
+	"MISS":          Skipped,
+}
+
+// gocheckLine records a gocheck result line. gocheck runs all the tests of
+// its suites inside one Go test; each of them gets a test case named like a
+// subtest of that test. The lines that follow a result, up to the next one,
+// hold the details of the failure.
+func (p *textParser) gocheckLine(line string) {
+	m := gocheckRE.FindStringSubmatch(line)
+	label, name, extra := m[1], m[3], strings.TrimSpace(m[4])
+	p.endGocheckTest()
+	if p.gocheck == "" {
+		if t := p.current(); t != nil {
+			p.gocheck = t.Name
+		} else {
+			p.gocheck = "gocheck"
+		}
+	}
+	p.cur = p.test(p.gocheck + "/" + name)
+	if label == "START" {
+		return
+	}
+	t := p.current()
+	t.Status = gocheckStatuses[label]
+	p.done[p.cur] = true
+	switch {
+	case label == "MISS":
+		t.Message = "missed"
+	case strings.HasPrefix(extra, "(") && strings.HasSuffix(extra, ")"):
+		t.Message = extra[1 : len(extra)-1]
+	default:
+		if d, err := time.ParseDuration(extra); err == nil {
+			t.Duration = d
+		}
+	}
+}
+
+// endGocheck ends the output of gocheck at its closing OOPS or OK line, and
+// returns to the Go test that ran it.
+func (p *textParser) endGocheck() {
+	p.endGocheckTest()
+	p.cur = -1
+	if i, ok := p.tests[p.gocheck]; ok {
+		p.cur = i
+	}
+	p.gocheck = ""
+}
+
+// endGocheckTest sets the message of the gocheck test receiving output, if
+// it failed, from the "... obtained" lines of its details.
+func (p *textParser) endGocheckTest() {
+	t := p.current()
+	if p.gocheck == "" || t == nil || t.Message != "" || (t.Status != Failure && t.Status != Error) {
+		return
+	}
+	var details []string
+	for _, l := range strings.Split(t.Output.String(), "\n") {
+		if strings.HasPrefix(l, "... ") {
+			details = append(details, strings.TrimPrefix(l, "... "))
+		}
+	}
+	t.Message = strings.Join(details, "; ")
+}
+
+// isGocheckSeparator reports whether line is the row of dashes gocheck
+// prints between failures.
+func isGocheckSeparator(line string) bool {
+	return len(line) > 10 && strings.Trim(line, "-") == ""
+}
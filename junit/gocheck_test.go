@@ -0,0 +1,105 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+// gocheckVerbose is the output of go test -v -check.v of a gocheck suite.
+const gocheckVerbose = `=== RUN   Test
+PASS: book_test.go:20: BookSuite.TestTitle	0.001s
+
+----------------------------------------------------------------------
+FAIL: book_test.go:25: BookSuite.TestPages
+
+book_test.go:27:
+    c.Assert(b.Pages, Equals, 10)
+... obtained int = 12
+... expected int = 10
+
+SKIP: book_test.go:40: BookSuite.TestWindows (not on windows)
+MISS: book_test.go:45: BookSuite.TestMissed
+OOPS: 1 passed, 1 FAILED, 1 SKIPPED, 1 MISSED
+--- FAIL: Test (0.00s)
+FAIL
+FAIL	example.com/books	0.012s
+`
+
+func TestGocheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		want         string
+		wantMessages string // of the test cases, separated by "|"
+	}{
+		{
+			"verbose", gocheckVerbose,
+			"example.com/books: Test:failure Test/BookSuite.TestTitle:success Test/BookSuite.TestPages:failure Test/BookSuite.TestWindows:skipped Test/BookSuite.TestMissed:skipped",
+			"||obtained int = 12; expected int = 10|not on windows|missed",
+		},
+		{
+			// Without -check.v only the failures are printed.
+			"quiet",
+			"=== RUN   Test\n\n----------------------------------------------------------------------\n" +
+				"PANIC: book_test.go:30: BookSuite.TestLoad\n\n... Panic: nil map (PC=0x4A1B2C)\n\n" +
+				"OOPS: 2 passed, 1 PANICKED\n--- FAIL: Test (0.00s)\nFAIL\nFAIL\texample.com/books\t0.01s\n",
+			"example.com/books: Test:failure Test/BookSuite.TestLoad:error",
+			"|Panic: nil map (PC=0x4A1B2C)",
+		},
+		{
+			// With -check.vv the start of each test is printed too.
+			"very verbose",
+			"=== RUN   Test\nSTART: book_test.go:20: BookSuite.TestTitle\nlog line\nPASS: book_test.go:20: BookSuite.TestTitle\t0.002s\n\n" +
+				"OK: 1 passed\n--- PASS: Test (0.00s)\nPASS\nok  \texample.com/books\t0.01s\n",
+			"example.com/books: Test:success Test/BookSuite.TestTitle:success",
+			"|",
+		},
+		{
+			"expected failure",
+			"=== RUN   Test\nFAIL EXPECTED: book_test.go:50: BookSuite.TestKnown (issue 12)\nOK: 1 passed, 1 expected failures\n--- PASS: Test (0.00s)\nPASS\nok  \texample.com/books\t0.01s\n",
+			"example.com/books: Test:success Test/BookSuite.TestKnown:success",
+			"|issue 12",
+		},
+		{
+			// A test binary exiting in the middle of gocheck prints neither
+			// its summary nor the result of the Go test.
+			"truncated",
+			"=== RUN   Test\nPASS: book_test.go:20: BookSuite.TestTitle\t0.001s\n\n" +
+				"----------------------------------------------------------------------\nFAIL: book_test.go:25: BookSuite.TestPages\n\n... obtained int = 12\n" +
+				"FAIL\texample.com/books\t0.01s\n",
+			"example.com/books: Test:error Test/BookSuite.TestTitle:success Test/BookSuite.TestPages:failure",
+			"no result recorded||obtained int = 12",
+		},
+		{
+			// Result lines without the location of the test are output.
+			"malformed",
+			"=== RUN   Test\nPASS: BookSuite.TestTitle\t0.001s\nSKIP: book_test.go:40 BookSuite.TestWindows\nPANIC: book_test.go:30:\n--- PASS: Test (0.00s)\nPASS\nok  \texample.com/books\t0.01s\n",
+			"example.com/books: Test:success",
+			"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := parseText(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := casesOf(suites); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			var messages []string
+			for _, s := range suites {
+				for _, tc := range s.TestCases {
+					messages = append(messages, tc.Message)
+				}
+			}
+			if got := strings.Join(messages, "|"); got != tt.wantMessages {
+				t.Errorf("messages %q, want %q", got, tt.wantMessages)
+			}
+		})
+	}
+}
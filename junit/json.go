@@ -0,0 +1,335 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// TestEvent is an event printed by go test -json, as documented by
+// go doc test2json.
+type TestEvent struct {
+	Time        time.Time
+	Action      string
+	Package     string
+	ImportPath  string
+	Test        string
+	Elapsed     float64 // seconds
+	Output      string
+	FailedBuild string
+}
+
+// ParseJSON parses the output of go test -json and returns a slice of
+// TestSuites, one per package, in the order in which packages finished.
+// Lines that are not JSON events, such as build errors, are reported as
+// warnings. Tests that never report a result are marked as errors.
+func ParseJSON(r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	return Collect(streamJSON, r)
+}
+
+func streamJSON(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	p := newJSONParser()
+	p.emit = emit
+	err := readLineBytes(r, p.lineBytes)
+	p.finish()
+	return p.warnings, err
+}
+
+// jsonParser holds the state of ParseJSON between lines of input.
+type jsonParser struct {
+	emit     func(TestSuite)
+	warnings []ParseWarning
+	lineno   int
+	pending  map[string]*jsonPackage
+	order    []string // pending packages in the order they were seen
+
+	building    string // package of the last "# pkg" header outside JSON
+	buildOutput map[string]*bytes.Buffer
+}
+
+// jsonPackage is a package whose tests are still running.
+type jsonPackage struct {
+	suite  TestSuite
+	tests  map[string]int // index of each test in suite.TestCases by name
+	done   map[int]bool   // tests in suite.TestCases that reported a result
+	reason string         // bracketed reason of the package result line
+	dump   *bytes.Buffer  // goroutine dump of a killed test binary
+	killed string         // the kill line
+	failed bool           // the package result was "fail"
+
+	// The name of a running benchmark is printed before its result,
+	// which test2json reports in a separate event, attributed to no test
+	// after the first run of the benchmark.
+	benchName string
+}
+
+func newJSONParser() *jsonParser {
+	p := &jsonParser{
+		pending:     make(map[string]*jsonPackage),
+		buildOutput: make(map[string]*bytes.Buffer),
+	}
+	p.emit = func(s TestSuite) {}
+	return p
+}
+
+func (p *jsonParser) warn(line, reason string) {
+	p.warnings = append(p.warnings, ParseWarning{Line: p.lineno, Reason: reason, Text: line})
+}
+
+func (p *jsonParser) appendBuildOutput(importPath, output string) {
+	pkg := firstField(importPath)
+	if p.buildOutput[pkg] == nil {
+		p.buildOutput[pkg] = getBuffer()
+	}
+	p.buildOutput[pkg].WriteString(output)
+}
+
+// lineBytes parses the next line of input, without its trailing newline.
+// Events are decoded from the line in place; other lines are made into
+// strings.
+func (p *jsonParser) lineBytes(b []byte) {
+	p.lineno++
+	if len(bytes.TrimSpace(b)) == 0 {
+		return
+	}
+	var e TestEvent
+	if err := json.Unmarshal(b, &e); err != nil || e.Action == "" {
+		line := string(b)
+		// Before Go 1.24, build errors were printed as plain text.
+		switch {
+		case strings.HasPrefix(line, "# "):
+			p.building = firstField(line[2:])
+		case p.building != "":
+			p.appendBuildOutput(p.building, line+"\n")
+		default:
+			p.warn(line, "not a test2json event; ignored")
+		}
+		return
+	}
+	p.event(&e)
+}
+
+func (p *jsonParser) event(e *TestEvent) {
+	switch e.Action {
+	case "build-output":
+		p.appendBuildOutput(e.ImportPath, e.Output)
+		return
+	case "build-fail":
+		return
+	}
+	if e.Package == "" {
+		return
+	}
+	pkg := p.pending[e.Package]
+	if pkg == nil {
+		pkg = &jsonPackage{
+			suite: TestSuite{Name: e.Package},
+			tests: make(map[string]int),
+			done:  make(map[int]bool),
+		}
+		p.pending[e.Package] = pkg
+		p.order = append(p.order, e.Package)
+	}
+	suite := &pkg.suite
+	if e.Action == "output" {
+		if pkg.benchName != "" {
+			e.Output, pkg.benchName = pkg.benchName+e.Output, ""
+		}
+		out := strings.TrimRight(e.Output, "\n")
+		if out == e.Output && isBenchmarkName(strings.TrimSpace(out)) {
+			pkg.benchName = e.Output
+			return
+		}
+		if name, r, ok := ParseBenchmark(out); ok {
+			if e.Test != "" {
+				name = e.Test
+			}
+			p.benchmark(pkg, name, r, e.Time)
+			return
+		}
+	}
+	if e.Test == "" {
+		switch e.Action {
+		case "output":
+			out := strings.TrimRight(e.Output, "\n")
+			switch {
+			case strings.HasPrefix(out, "-test.shuffle "):
+				suite.SetProperty("shuffle", strings.TrimSpace(strings.TrimPrefix(out, "-test.shuffle ")))
+			case out == noTestsWarning:
+				suite.SetProperty("reason", NoTestsToRun)
+			case isBenchmarkHeader(out):
+				if name, value, _ := benchmarkHeader(out); name != "" {
+					suite.SetProperty(name, value)
+				}
+			case isKillLine(out):
+				pkg.killed = out
+			case pkg.dump != nil || isDumpStart(out):
+				if pkg.dump == nil {
+					pkg.dump = getBuffer()
+				}
+				pkg.dump.WriteString(e.Output)
+			case strings.HasPrefix(out, "FAIL") || strings.HasPrefix(out, "ok") || strings.HasPrefix(out, "?"):
+				if _, reason := BracketReason(out); reason != "" {
+					pkg.reason = reason
+				}
+				if pct := coverageOf(out); pct != "" {
+					suite.SetProperty("coverage", pct)
+				}
+			case out != "PASS":
+				suite.Output.WriteString(e.Output)
+			}
+		case "start":
+			suite.Timestamp = e.Time
+		case "pass", "fail", "skip":
+			suite.Duration = jsonElapsed(e.Elapsed)
+			pkg.failed = e.Action == "fail"
+			p.end(e.Package)
+		}
+		return
+	}
+	i, ok := pkg.tests[e.Test]
+	if !ok {
+		i = len(suite.TestCases)
+		suite.TestCases = append(suite.TestCases, TestCase{Name: e.Test})
+		pkg.tests[e.Test] = i
+	}
+	tc := &suite.TestCases[i]
+	switch e.Action {
+	case "output":
+		switch {
+		case pkg.dump != nil || isDumpStart(strings.TrimRight(e.Output, "\n")):
+			// test2json attributes the dump to the test running at the
+			// time.
+			if pkg.dump == nil {
+				pkg.dump = getBuffer()
+			}
+			pkg.dump.WriteString(e.Output)
+		case strings.TrimRight(e.Output, "\n") == e.Test && isBenchmarkName(e.Test):
+		case !isFramingLine(e.Output):
+			tc.Output.WriteString(e.Output)
+		}
+	case "pass":
+		tc.Status, tc.Duration = Success, jsonElapsed(e.Elapsed)
+		pkg.done[i] = true
+	case "fail":
+		tc.Status, tc.Duration = Failure, jsonElapsed(e.Elapsed)
+		pkg.done[i] = true
+		if OnFailure != nil {
+			OnFailure(e.Package, *tc)
+		}
+	case "skip":
+		tc.Status, tc.Duration = Skipped, jsonElapsed(e.Elapsed)
+		pkg.done[i] = true
+	case "run", "cont":
+		// A parallel test starts running when it is continued.
+		setTestStart(tc, e.Time)
+		if e.Action == "run" && OnTestStart != nil {
+			OnTestStart(e.Package, *tc)
+		}
+	}
+	if pkg.done[i] && e.Action != "output" {
+		setTestEnd(tc, e.Time)
+	}
+	if (e.Action == "pass" || e.Action == "fail" || e.Action == "skip") && OnTestEnd != nil {
+		OnTestEnd(e.Package, *tc)
+	}
+	if pkg.done[i] && e.Action != "output" && debugging() {
+		Logger.Debug("test result", "line", p.lineno, "suite", e.Package, "test", tc.Name, "status", tc.Status)
+	}
+}
+
+// benchmark records the result of a benchmark of pkg, which reports it in
+// its output rather than with a pass event, and that its parents, which
+// report none, ran.
+func (p *jsonParser) benchmark(pkg *jsonPackage, name string, r BenchmarkResult, ts time.Time) {
+	i, ok := pkg.tests[name]
+	if !ok {
+		i = len(pkg.suite.TestCases)
+		pkg.suite.TestCases = append(pkg.suite.TestCases, TestCase{Name: name})
+		pkg.tests[name] = i
+	}
+	tc := &pkg.suite.TestCases[i]
+	setBenchmark(tc, r)
+	pkg.done[i] = true
+	setTestEnd(tc, ts)
+	for _, parent := range benchmarkParents(name) {
+		if j, ok := pkg.tests[parent]; ok {
+			pkg.done[j] = true
+		}
+	}
+}
+
+// end emits the suite of a package. Tests that did not report a result are
+// marked as errors.
+func (p *jsonParser) end(name string) {
+	pkg := p.pending[name]
+	suite := &pkg.suite
+	for i := range suite.TestCases {
+		if tc := &suite.TestCases[i]; !pkg.done[i] {
+			tc.Status = Error
+			tc.Message = noResult
+		}
+	}
+	if pkg.reason != "" {
+		SetReason(suite, pkg.reason, p.buildOutput[name])
+	}
+	if pkg.killed != "" {
+		setKilled(suite, pkg.killed, pkg.dump)
+	}
+	if pkg.failed {
+		setPackageFailed(suite, failedWithoutTests, suite.Output.Bytes())
+	}
+	putBuffer(p.buildOutput[name])
+	putBuffer(pkg.dump)
+	delete(p.buildOutput, name)
+	delete(p.pending, name)
+	if debugging() {
+		Logger.Debug("suite ended", "line", p.lineno, "suite", name, "tests", len(suite.TestCases), "reason", pkg.reason)
+	}
+	p.emit(*suite)
+}
+
+// finish is called at the end of input to emit the packages that were still
+// running.
+func (p *jsonParser) finish() {
+	for _, name := range p.order {
+		if p.pending[name] != nil {
+			p.warn("", "input ended before the result of package "+name)
+			p.end(name)
+		}
+	}
+	p.order = nil
+}
+
+// isFramingLine reports whether line is one of the lines go test prints to
+// mark the start, pause or end of a test, which test2json also reports as
+// output.
+func isFramingLine(line string) bool {
+	line = strings.TrimLeft(line, " ")
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS:", "--- FAIL:", "--- SKIP:"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstField(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// jsonElapsed converts seconds to a Duration, rounding to the nanosecond
+// so that durations written in seconds read back the same.
+func jsonElapsed(seconds float64) time.Duration {
+	return time.Duration(math.Round(seconds * float64(time.Second)))
+}
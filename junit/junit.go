@@ -0,0 +1,177 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package junit holds the test results gojunit converts and the parsers of
+// the output of go test producing them.
+package junit
+
+import (
+	"fmt"
+	"time"
+)
+
+// OnFailure, if not nil, is called by the text and JSON parsers with each
+// test that failed, as soon as its output has been read, along with the
+// name of its package, if it is known by then. Calls may come from several
+// streams at the same time.
+var OnFailure func(pkg string, tc TestCase)
+
+// OnTestStart, if not nil, is called by the text and JSON parsers with each
+// test as it starts running, and OnTestEnd with each test as soon as its
+// result and output have been read, along with the name of its package, if
+// it is known by then: go test -json names it in every event, but its text
+// output only after the tests of the package. Calls may come from several
+// streams at the same time.
+var (
+	OnTestStart func(pkg string, tc TestCase)
+	OnTestEnd   func(pkg string, tc TestCase)
+)
+
+type TestSuite struct {
+	Name       string
+	TestCases  []TestCase
+	Duration   time.Duration
+	Timestamp  time.Time
+	Properties []Property
+
+	// Output is the output of the package that is not attributed to any of
+	// its tests, such as that printed by TestMain or between tests.
+	Output Log
+}
+
+// Property is a name/value pair attached to a TestSuite.
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Property returns the value of the named property, or "" if it is not set.
+func (s *TestSuite) Property(name string) string {
+	return getProperty(s.Properties, name)
+}
+
+// SetProperty sets the named property, replacing any existing value.
+func (s *TestSuite) SetProperty(name, value string) {
+	s.Properties = setProperty(s.Properties, name, value)
+}
+
+// Property returns the value of the named property, or "" if it is not set.
+func (t *TestCase) Property(name string) string {
+	return getProperty(t.Properties, name)
+}
+
+// SetProperty sets the named property, replacing any existing value.
+func (t *TestCase) SetProperty(name, value string) {
+	t.Properties = setProperty(t.Properties, name, value)
+}
+
+func getProperty(props []Property, name string) string {
+	for _, p := range props {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+func setProperty(props []Property, name, value string) []Property {
+	for i, p := range props {
+		if p.Name == name {
+			props[i].Value = value
+			return props
+		}
+	}
+	return append(props, Property{name, value})
+}
+
+type TestCase struct {
+	Name      string
+	Classname string
+	Duration  time.Duration
+	Status    Status
+	Message   string // short description of a failure, error or skip
+	Output    Log
+	Stderr    Log // standard error, if it was captured separately
+
+	Properties []Property
+}
+
+// Status is the result of a test case. It is written as its name, such as
+// "failure", by encoding/json, encoding/xml and other encoders using
+// encoding.TextMarshaler.
+type Status int
+
+// The values of Status are part of the stable API; new values are only ever
+// added at the end.
+const (
+	Success Status = iota // the test passed
+	Failure               // the test failed
+	Error                 // the test could not run or did not finish
+	Skipped               // the test was skipped
+)
+
+var statusNames = [...]string{
+	Success: "success",
+	Failure: "failure",
+	Error:   "error",
+	Skipped: "skipped",
+}
+
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return fmt.Sprintf("Status(%d)", int(s))
+	}
+	return statusNames[s]
+}
+
+// ParseStatus returns the Status with the given name, as returned by String.
+func ParseStatus(name string) (Status, error) {
+	for s, n := range statusNames {
+		if n == name {
+			return Status(s), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status %q", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(statusNames) {
+		return nil, fmt.Errorf("invalid status %d", int(s))
+	}
+	return []byte(statusNames[s]), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Status) UnmarshalText(text []byte) error {
+	status, err := ParseStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// ParseWarning describes a line of input that ParseOutput ignored or could
+// only partially interpret.
+type ParseWarning struct {
+	Line   int    // 1-based line number in the input, or 0 if unknown
+	Reason string // what went wrong
+	Text   string // the raw line
+	Input  string // name of the input, if there are several
+}
+
+func (w ParseWarning) String() string {
+	s := w.Reason
+	if w.Line > 0 {
+		s = fmt.Sprintf("line %d: %s", w.Line, s)
+	}
+	if w.Input != "" {
+		s = w.Input + ": " + s
+	}
+	if w.Text != "" {
+		s += fmt.Sprintf(": %q", w.Text)
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// finalizeLine is the line that, sent at the start of a connection to a
+// listener added with Collector.AddListener or of a session of a pipe added
+// with Collector.AddPipe, ends the collection of its results. The rest of
+// the connection or session is ignored.
+const finalizeLine = "gojunit finalize"
+
+// AddListener accepts connections on l and parses each of them like a
+// stream added with Add, in the given input format, until a connection starts
+// with finalizeLine or the context of the collector is done. The streams are
+// named after name and the number of the connection, as in "name#2". The
+// listener is closed when it is finalized, but the connections open at the
+// time are parsed to their end.
+func (c *Collector) AddListener(name string, l net.Listener, format string) error {
+	parse, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown input format %q", format)
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	stop := func() { once.Do(func() { close(done); l.Close() }) }
+	if c.Context != nil {
+		go func() {
+			select {
+			case <-c.Context.Done():
+				stop()
+			case <-done:
+			}
+		}()
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for n := 1; ; n++ {
+			conn, err := l.Accept()
+			if err != nil {
+				select {
+				case <-done:
+				default:
+					c.fail(fmt.Errorf("%s: %v", name, err))
+				}
+				return
+			}
+			c.AddStream(fmt.Sprintf("%s#%d", name, n), parse, func() (io.ReadCloser, error) {
+				r, finalize := finalizing(conn)
+				if finalize {
+					stop()
+				}
+				return r, nil
+			})
+		}
+	}()
+	return nil
+}
+
+// AddPipe parses the sessions of the writers of a named pipe, each like a
+// stream added with Add, in the given input format: when a writer closes the
+// pipe, it is opened again for the next one. The sessions are parsed until
+// one of them starts with finalizeLine or the context of the collector is
+// done, and are named after name and their number, as in "name#2".
+func (c *Collector) AddPipe(name, format string) error {
+	parse, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown input format %q", format)
+	}
+	done := make(chan struct{})
+	if c.Context != nil {
+		go func() {
+			select {
+			case <-c.Context.Done():
+				// Opening the pipe for writing lets the pending open for
+				// reading return.
+				if f, err := os.OpenFile(name, os.O_WRONLY, 0); err == nil {
+					f.Close()
+				}
+			case <-done:
+			}
+		}()
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(done)
+		for n := 1; c.Context == nil || c.Context.Err() == nil; n++ {
+			f, err := os.Open(name)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			r, finalize := finalizing(f)
+			stream, _ := c.newStream()
+			c.parseStream(stream, fmt.Sprintf("%s#%d", name, n), parse, r)
+			f.Close()
+			if finalize {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// finalizing reads the start of r and reports whether its first line is
+// finalizeLine, returning a reader of r, or of nothing if it is.
+func finalizing(r io.ReadCloser) (io.ReadCloser, bool) {
+	br := bufio.NewReader(r)
+	b, _ := br.Peek(len(finalizeLine) + 1)
+	if strings.TrimRight(string(b), "\r\n") == finalizeLine {
+		return struct {
+			io.Reader
+			io.Closer
+		}{strings.NewReader(""), r}, true
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, r}, false
+}
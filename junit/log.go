@@ -0,0 +1,107 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bytes"
+	"sync"
+)
+
+// A Log holds the output of a test case. Unlike a bytes.Buffer it is cheap
+// to copy, as test cases are when they are appended to a suite: copies of a
+// Log share its contents, and writing to either writes to both. The zero
+// value is an empty Log ready to use.
+type Log struct {
+	d *logData
+}
+
+type logData struct {
+	b []byte
+}
+
+func (l *Log) data() *logData {
+	if l.d == nil {
+		l.d = new(logData)
+	}
+	return l.d
+}
+
+// Write appends p to the log. It never returns an error.
+func (l *Log) Write(p []byte) (int, error) {
+	d := l.data()
+	d.b = append(d.b, p...)
+	return len(p), nil
+}
+
+// WriteString appends s to the log. It never returns an error.
+func (l *Log) WriteString(s string) (int, error) {
+	d := l.data()
+	d.b = append(d.b, s...)
+	return len(s), nil
+}
+
+// WriteByte appends c to the log. It never returns an error.
+func (l *Log) WriteByte(c byte) error {
+	d := l.data()
+	d.b = append(d.b, c)
+	return nil
+}
+
+// Len returns the number of bytes in the log.
+func (l Log) Len() int {
+	if l.d == nil {
+		return 0
+	}
+	return len(l.d.b)
+}
+
+// Bytes returns the contents of the log, which are valid until the next
+// write.
+func (l Log) Bytes() []byte {
+	if l.d == nil {
+		return nil
+	}
+	return l.d.b
+}
+
+// String returns a copy of the contents of the log as a string. Reading a
+// Log never writes to it, so that the suites of stored runs can be read by
+// several goroutines at once.
+func (l Log) String() string {
+	if l.d == nil {
+		return ""
+	}
+	return string(l.d.b)
+}
+
+// Clone returns a Log holding a copy of the contents of l, which is not
+// changed by writes to l or its copies.
+func (l Log) Clone() Log {
+	if l.d == nil {
+		return Log{}
+	}
+	return Log{&logData{b: append([]byte(nil), l.d.b...)}}
+}
+
+// maxPooled is the capacity above which buffers are not returned to
+// bufferPool, so that one large build log does not stay in memory.
+const maxPooled = 64 << 10
+
+// bufferPool holds the buffers collecting the output of builds and
+// goroutine dumps until it is copied into a test case.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns b to bufferPool. It does nothing if b is nil.
+func putBuffer(b *bytes.Buffer) {
+	if b == nil || b.Cap() > maxPooled {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
@@ -0,0 +1,21 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Logger receives the decisions of the parsers, at debug level. It discards
+// everything unless it is set, as gojunit sets it from its -debug flag.
+var Logger = slog.New(slog.DiscardHandler)
+
+// debugging reports whether Logger records debug messages, which the
+// parsers check first on the paths run for each line to avoid formatting
+// them.
+func debugging() bool {
+	return Logger.Enabled(context.Background(), slog.LevelDebug)
+}
@@ -0,0 +1,44 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bufio"
+	"io"
+)
+
+// A teeReader copies the lines read from r to w. It returns at most one line
+// from each Read and writes the line to w just before returning it, so that
+// the copy and anything written while the line is parsed, such as the
+// results of the suite it ends, appear on w in the order of the input
+// instead of a buffer at a time.
+type teeReader struct {
+	r    *bufio.Reader
+	w    io.Writer
+	line []byte // unread rest of the last line
+}
+
+func newTeeReader(r io.Reader, w io.Writer) *teeReader {
+	return &teeReader{r: bufio.NewReader(r), w: w}
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	if len(t.line) == 0 {
+		line, err := t.r.ReadSlice('\n')
+		if len(line) == 0 {
+			if err == bufio.ErrBufferFull {
+				err = nil
+			}
+			return 0, err
+		}
+		if _, werr := t.w.Write(line); werr != nil {
+			return 0, werr
+		}
+		t.line = line
+	}
+	n := copy(p, t.line)
+	t.line = t.line[n:]
+	return n, nil
+}
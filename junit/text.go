@@ -0,0 +1,607 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseOutput parses the output of the Go test runner and returns a slice of
+// TestSuites, along with warnings about lines that were ignored or guessed at.
+func ParseOutput(r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	return Collect(streamText, r)
+}
+
+// ParseBytes is like ParseOutput, but parses output that is already in
+// memory, without copying the lines of test output.
+func ParseBytes(b []byte) ([]TestSuite, []ParseWarning) {
+	var suites []TestSuite
+	p := newTextParser()
+	p.emit = func(s TestSuite) { suites = append(suites, s) }
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+		p.lineBytes(bytes.TrimRight(line, "\r"))
+	}
+	p.finish()
+	return suites, p.warnings
+}
+
+func streamText(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	p := newTextParser()
+	p.emit = emit
+	err := readLineBytes(r, p.lineBytes)
+	p.finish()
+	return p.warnings, err
+}
+
+// A Parser parses the output of go test, or of a test binary, a line at a
+// time, for callers that read the output themselves, such as gojunit run,
+// which runs test binaries directly and knows more about their packages
+// than their output tells.
+type Parser struct {
+	p *textParser
+}
+
+// NewParser returns a Parser calling emit with each suite as soon as it
+// ends.
+func NewParser(emit func(TestSuite)) *Parser {
+	p := newTextParser()
+	p.emit = emit
+	return &Parser{p}
+}
+
+// Line parses the next line of output, without its line ending.
+func (p *Parser) Line(line string) {
+	p.p.line(line)
+}
+
+// Suite returns the suite whose output is being parsed. Its name and
+// properties may be set before it ends.
+func (p *Parser) Suite() *TestSuite {
+	return p.p.suite
+}
+
+// Current returns the test receiving output, or nil if there is none.
+func (p *Parser) Current() *TestCase {
+	return p.p.current()
+}
+
+// Failed records that the package of the current suite failed, such as a
+// test binary exiting with a non-zero status, with a message and the output
+// telling why. The suite gets a test case with status Error named
+// PackageFailed when it ends, unless one of its tests failed.
+func (p *Parser) Failed(message string, output []byte) {
+	p.p.failed, p.p.failedOutput = message, output
+}
+
+// EndSuite ends the current suite, giving it a name and duration, as the
+// package result line of go test does. Tests that did not report a result
+// are marked as errors.
+func (p *Parser) EndSuite(name string, d time.Duration) {
+	p.p.endSuite(name, d)
+}
+
+// Reset discards the current suite, which has not ended.
+func (p *Parser) Reset() {
+	p.p.reset()
+}
+
+// Finish ends the output, reporting the tests still running in a final
+// suite, and returns the warnings about the output.
+func (p *Parser) Finish() []ParseWarning {
+	p.p.finish()
+	return p.p.warnings
+}
+
+// noResult is the message of tests that started but never reported a result,
+// usually because the test binary was killed.
+const noResult = "no result recorded"
+
+// textParser holds the state of ParseOutput between lines of input.
+type textParser struct {
+	emit     func(TestSuite) // called with each suite when it ends
+	warnings []ParseWarning
+	suite    *TestSuite
+	tests    map[string]int // index of each test in suite.TestCases by name
+	done     map[int]bool   // tests in suite.TestCases that reported a result
+	cur      int            // index of the test receiving output, or -1
+	failing  int            // index of a failed test whose output is still being read, or -1
+	ending   int            // index of a test whose output may follow its result, for OnTestEnd, or -1
+	lineno   int
+
+	// Compiler output is printed under a "# pkg" header, possibly long
+	// before the line reporting that the package failed to build.
+	building    string
+	buildOutput map[string]*bytes.Buffer
+
+	// gocheck is the name of the Go test running gocheck suites while their
+	// output is being read.
+	gocheck string
+
+	// passed is set by the PASS or FAIL line a test binary prints when it
+	// exits, which is all there is at the end of the output of a test binary
+	// run directly rather than by go test.
+	passed bool
+
+	// A test binary killed by go test prints a goroutine dump, which
+	// belongs to the package rather than the tests running at the time.
+	dump   *bytes.Buffer
+	killed string // the kill line
+
+	// failed is the message of a package that failed without any of its
+	// tests failing, such as a test binary whose TestMain exited with a
+	// non-zero status, and failedOutput the output explaining why.
+	failed       string
+	failedOutput []byte
+}
+
+func newTextParser() *textParser {
+	p := &textParser{buildOutput: make(map[string]*bytes.Buffer)}
+	p.emit = func(s TestSuite) {}
+	p.reset()
+	return p
+}
+
+func (p *textParser) reset() {
+	p.suite = new(TestSuite)
+	p.tests = make(map[string]int)
+	p.done = make(map[int]bool)
+	p.cur = -1
+	p.failing = -1
+	p.ending = -1
+	p.building = ""
+	p.gocheck = ""
+	p.passed = false
+	putBuffer(p.dump)
+	p.dump = nil
+	p.killed = ""
+	p.failed, p.failedOutput = "", nil
+}
+
+func (p *textParser) warn(line, reason string) {
+	p.warnings = append(p.warnings, ParseWarning{Line: p.lineno, Reason: reason, Text: line})
+}
+
+// current returns the test receiving output, or nil if there is none.
+func (p *textParser) current() *TestCase {
+	if p.cur < 0 {
+		return nil
+	}
+	return &p.suite.TestCases[p.cur]
+}
+
+// test returns the index of the named test in the current suite, adding it if
+// it has not been seen yet.
+func (p *textParser) test(name string) int {
+	i, ok := p.tests[name]
+	if !ok {
+		i = p.addTest(name)
+	}
+	return i
+}
+
+func (p *textParser) addTest(name string) int {
+	p.suite.TestCases = append(p.suite.TestCases, TestCase{Name: name})
+	i := len(p.suite.TestCases) - 1
+	p.tests[name] = i
+	return i
+}
+
+// lineBytes parses the next line of input like line. Indented lines written
+// by a running test, which make up most of the output, are copied into the
+// output of the test directly; only the other lines are made into strings.
+func (p *textParser) lineBytes(line []byte) {
+	if p.cur >= 0 && p.dump == nil && p.gocheck == "" && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		if trimmed := bytes.TrimLeft(line, " "); len(trimmed) == 0 || trimmed[0] != '-' {
+			p.lineno++
+			out := &p.current().Output
+			out.Write(line)
+			out.WriteByte('\n')
+			return
+		}
+	}
+	p.line(string(line))
+}
+
+// line parses the next line of input, without its trailing newline.
+func (p *textParser) line(line string) {
+	p.lineno++
+	trimmed := strings.TrimLeft(line, " ")
+	switch {
+	case line == "PASS" || line == "FAIL":
+		p.passed = true
+		return
+	case p.passed && strings.HasPrefix(line, "coverage: "):
+		// A test binary built with -cover prints the coverage of its
+		// package after PASS, which go test repeats on its ok line.
+		if pct := coverageOf(line); pct != "" {
+			p.suite.SetProperty("coverage", pct)
+		}
+		return
+	case strings.HasPrefix(line, "# ") && p.cur < 0:
+		if fields := strings.Fields(line); len(fields) > 1 {
+			p.building = fields[1]
+			putBuffer(p.buildOutput[p.building])
+			p.buildOutput[p.building] = getBuffer()
+		}
+		return
+	case gocheckRE.MatchString(line):
+		p.gocheckLine(line)
+	case p.gocheck != "" && (strings.HasPrefix(line, "OOPS: ") || strings.HasPrefix(line, "OK: ")):
+		p.endGocheck()
+	case p.gocheck != "" && isGocheckSeparator(line):
+	case strings.HasPrefix(line, "-test.shuffle "):
+		p.suite.SetProperty("shuffle", strings.TrimSpace(strings.TrimPrefix(line, "-test.shuffle ")))
+	case line == noTestsWarning:
+		p.suite.SetProperty("reason", NoTestsToRun)
+	case p.gocheck == "" && p.dump == nil && isBenchmarkHeader(line):
+		if name, value, _ := benchmarkHeader(line); name != "" {
+			p.suite.SetProperty(name, value)
+		}
+	case strings.HasPrefix(line, "=== RUN"):
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			p.warn(line, "test without a name")
+			fields = append(fields, "")
+		}
+		// A test that is run again, as with -count, gets a new test case.
+		p.reportFailure()
+		p.reportEnd()
+		p.cur = p.addTest(fields[2])
+		if OnTestStart != nil {
+			OnTestStart(p.suite.Name, *p.current())
+		}
+		if debugging() {
+			Logger.Debug("test started", "line", p.lineno, "test", fields[2])
+		}
+	case strings.HasPrefix(line, "=== PAUSE"):
+		p.reportFailure()
+		p.reportEnd()
+		p.cur = -1
+	case strings.HasPrefix(line, "=== CONT") || strings.HasPrefix(line, "=== NAME"):
+		p.reportFailure()
+		p.reportEnd()
+		if fields := strings.Fields(line); len(fields) > 2 {
+			p.cur = p.test(fields[2])
+		}
+	case strings.HasPrefix(trimmed, "--- FAIL:"):
+		p.result(line, Failure)
+	case strings.HasPrefix(trimmed, "--- PASS:"):
+		p.result(line, Success)
+	case strings.HasPrefix(trimmed, "--- SKIP:"):
+		p.result(line, Skipped)
+	case strings.HasPrefix(line, "FAIL"):
+		p.endSuiteLine(line)
+	case strings.HasPrefix(line, "ok"):
+		p.endSuiteLine(line)
+	case strings.HasPrefix(line, "?"):
+		p.endSuiteLine(line)
+	case isKillLine(line):
+		p.killed = line
+		if p.dump == nil {
+			p.dump = getBuffer()
+		}
+	case isDumpStart(line) && p.dump == nil:
+		p.dump = getBuffer()
+		fmt.Fprintln(p.dump, line)
+	case p.dump != nil:
+		fmt.Fprintln(p.dump, line)
+	case isBenchmarkName(line):
+		p.cur = p.test(line)
+	case benchmarkRE.MatchString(line):
+		p.benchmark(line)
+	case p.cur < 0 && p.building != "":
+		fmt.Fprintln(p.buildOutput[p.building], line)
+	case p.cur < 0:
+		p.suite.Output.WriteString(line)
+		p.suite.Output.WriteByte('\n')
+	default:
+		out := &p.current().Output
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+}
+
+// result records the result of a test. Output that follows a result line
+// belongs to that test, as go test prints the log of a failed test after its
+// result when not run with -v.
+func (p *textParser) result(line string, status Status) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		p.warn(line, "result without a test name")
+		return
+	}
+	// Without -v, the result of a test comes before those of its subtests,
+	// and the failure of a subtest is the one to report.
+	if p.failing < 0 || status != Failure || !strings.HasPrefix(fields[2], p.suite.TestCases[p.failing].Name+"/") {
+		p.reportFailure()
+	}
+	p.reportEnd()
+	p.cur = p.test(fields[2])
+	p.done[p.cur] = true
+	p.ending = p.cur
+	tc := p.current()
+	if len(fields) <= 3 {
+		p.warn(line, "missing test duration")
+	} else {
+		d, err := parseTestDuration(fields[3])
+		if err != nil {
+			p.warn(line, "invalid test duration")
+		}
+		tc.Duration = d
+	}
+	tc.Status = status
+	if status == Failure && OnFailure != nil {
+		// The output of the test may follow its result.
+		p.failing = p.cur
+	}
+	if debugging() {
+		Logger.Debug("test result", "line", p.lineno, "test", tc.Name, "status", status)
+	}
+}
+
+// reportFailure calls OnFailure with the failed test whose output was being
+// read, if any.
+func (p *textParser) reportFailure() {
+	if p.failing >= 0 && OnFailure != nil {
+		OnFailure(p.suite.Name, p.suite.TestCases[p.failing])
+	}
+	p.failing = -1
+}
+
+// reportEnd calls OnTestEnd with the test whose result was read last, if
+// any, once the output that may follow its result has been read.
+func (p *textParser) reportEnd() {
+	if p.ending >= 0 && OnTestEnd != nil {
+		OnTestEnd(p.suite.Name, p.suite.TestCases[p.ending])
+	}
+	p.ending = -1
+}
+
+// benchmark records the result of a benchmark, and that its parents, which
+// report none, ran.
+func (p *textParser) benchmark(line string) {
+	name, r, _ := ParseBenchmark(line)
+	p.cur = p.test(name)
+	p.done[p.cur] = true
+	setBenchmark(p.current(), r)
+	for _, parent := range benchmarkParents(name) {
+		if i, ok := p.tests[parent]; ok {
+			p.done[i] = true
+		}
+	}
+}
+
+// endSuiteLine ends the current suite at an "ok", "FAIL" or "?" package
+// line.
+func (p *textParser) endSuiteLine(line string) {
+	rest, reason := BracketReason(line)
+	fields := strings.Fields(rest)
+	var name string
+	var d time.Duration
+	if len(fields) > 1 {
+		name = fields[1]
+	}
+	if len(fields) > 2 {
+		var err error
+		switch fields[2] {
+		case "(cached)":
+			p.suite.SetProperty("cached", "true")
+		default:
+			if d, err = time.ParseDuration(fields[2]); err != nil {
+				p.warn(line, "invalid package duration")
+			}
+		}
+	}
+	if pct := coverageOf(rest); pct != "" {
+		p.suite.SetProperty("coverage", pct)
+	}
+	if len(fields) > 0 && fields[0] == "FAIL" && p.failed == "" {
+		// The output of the package outside its tests, such as a panic
+		// before the first test started, tells why.
+		p.failed, p.failedOutput = failedWithoutTests, p.suite.Output.Bytes()
+	}
+	if reason != "" {
+		var output *bytes.Buffer
+		if IsSuiteError(reason) {
+			output = p.buildOutput[name]
+		}
+		SetReason(p.suite, reason, output)
+	}
+	p.endSuite(name, d)
+	putBuffer(p.buildOutput[name])
+	delete(p.buildOutput, name)
+}
+
+// endSuite ends the current suite, giving it a name and duration. Tests that
+// did not report a result are marked as errors.
+func (p *textParser) endSuite(name string, d time.Duration) {
+	p.suite.Name = name
+	p.suite.Duration = d
+	// The output of gocheck may end without its summary.
+	p.endGocheckTest()
+	p.reportFailure()
+	p.reportEnd()
+	n := 0
+	for i := range p.suite.TestCases {
+		if tc := &p.suite.TestCases[i]; !p.done[i] && tc.Status == Success {
+			tc.Status = Error
+			tc.Message = noResult
+			n++
+		}
+	}
+	if n > 0 {
+		p.warn("", fmt.Sprintf("%d tests did not report a result", n))
+	}
+	if p.killed != "" {
+		setKilled(p.suite, p.killed, p.dump)
+	}
+	if p.failed != "" {
+		setPackageFailed(p.suite, p.failed, p.failedOutput)
+	}
+	if debugging() {
+		Logger.Debug("suite ended", "line", p.lineno, "suite", name, "tests", len(p.suite.TestCases), "reason", p.suite.Property("reason"))
+	}
+	p.emit(*p.suite)
+	p.reset()
+}
+
+// finish is called at the end of input. Tests that were still running, as
+// when the log of a killed test binary ends abruptly, are reported in a final
+// suite, as are the tests of a test binary run directly, which does not print
+// a package result. The suite has no name.
+func (p *textParser) finish() {
+	if len(p.suite.TestCases) > 0 {
+		if !p.passed {
+			p.warn("", "input ended before the package result")
+		}
+		p.endSuite(p.suite.Name, TestsDuration(p.suite))
+	}
+}
+
+// TestsDuration returns the total duration of the top-level tests in s.
+func TestsDuration(s *TestSuite) time.Duration {
+	var d time.Duration
+	for _, t := range s.TestCases {
+		if !strings.Contains(t.Name, "/") {
+			d += t.Duration
+		}
+	}
+	return d
+}
+
+// BracketReason splits a package result line such as
+// "FAIL pkg [build failed]" into the line without the bracketed reason, and
+// the reason.
+func BracketReason(line string) (rest, reason string) {
+	line = strings.TrimRight(line, " \t")
+	if !strings.HasSuffix(line, "]") {
+		return line, ""
+	}
+	i := strings.LastIndex(line, "[")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], line[i+1 : len(line)-1]
+}
+
+// IsSuiteError reports whether the bracketed reason of a package result
+// means that its tests could not be run at all.
+func IsSuiteError(reason string) bool {
+	return reason == "build failed" || reason == "setup failed"
+}
+
+// NoTestFiles is the bracketed reason of packages without tests.
+const NoTestFiles = "no test files"
+
+// NoTestsToRun is the reason of packages in which no test matched the -run
+// flag, which go test warns about with noTestsWarning.
+const (
+	NoTestsToRun   = "no tests to run"
+	noTestsWarning = "testing: warning: no tests to run"
+)
+
+// SetReason records the bracketed reason of a package result in the "reason"
+// property of suite. Build and setup failures are reported as a test case
+// with status Error named after the reason, holding the given output.
+func SetReason(suite *TestSuite, reason string, output *bytes.Buffer) {
+	suite.SetProperty("reason", reason)
+	if !IsSuiteError(reason) {
+		return
+	}
+	tc := TestCase{Name: reason, Status: Error, Message: reason}
+	if output != nil {
+		tc.Output.Write(output.Bytes())
+	}
+	suite.TestCases = append(suite.TestCases, tc)
+}
+
+// testKilled is the reason of packages whose test binary go test killed
+// because it ran too long.
+const testKilled = "test killed"
+
+// isKillLine reports whether line is the line go test prints when it kills a
+// test binary, such as "*** Test killed with quit: ran too long (11m0s).".
+func isKillLine(line string) bool {
+	return strings.HasPrefix(line, "*** Test killed")
+}
+
+// isDumpStart reports whether line starts the goroutine dump a test binary
+// prints when go test kills it.
+func isDumpStart(line string) bool {
+	return line == "SIGQUIT: quit"
+}
+
+// setKilled records that the test binary of suite was killed, as described
+// by the kill line, in the "reason" property of suite, and adds a test case
+// with status Error holding the goroutine dump.
+func setKilled(suite *TestSuite, line string, dump *bytes.Buffer) {
+	suite.SetProperty("reason", testKilled)
+	msg := strings.TrimSuffix(strings.TrimPrefix(line, "*** "), ".")
+	tc := TestCase{Name: testKilled, Status: Error, Message: msg}
+	if dump != nil {
+		tc.Output.Write(dump.Bytes())
+	}
+	suite.TestCases = append(suite.TestCases, tc)
+}
+
+// PackageFailed is the name of the test case added to packages that failed
+// although none of their tests did, and failedWithoutTests its message when
+// the package result says so.
+const (
+	PackageFailed      = "package failed"
+	failedWithoutTests = "the package failed, but none of its tests did"
+)
+
+// setPackageFailed adds a test case with status Error named PackageFailed,
+// with the given message and output, to suite unless one of its tests failed
+// or had an error, so that a failed package is never reported as passing.
+func setPackageFailed(suite *TestSuite, message string, output []byte) {
+	for _, t := range suite.TestCases {
+		if t.Status == Failure || t.Status == Error {
+			return
+		}
+	}
+	tc := TestCase{Name: PackageFailed, Status: Error, Message: message}
+	tc.Output.Write(output)
+	suite.TestCases = append(suite.TestCases, tc)
+}
+
+// parseTestDuration parses the duration of a test result line, which is
+// printed as "(1.23s)" or, by older versions of go test, "(1.23 seconds)".
+func parseTestDuration(field string) (time.Duration, error) {
+	field = strings.TrimPrefix(field, "(")
+	field = strings.TrimSuffix(field, ")")
+	if !strings.HasSuffix(field, "s") {
+		field += "s"
+	}
+	return time.ParseDuration(field)
+}
+
+// coverageOf returns the percentage of statements covered, without the
+// percent sign, in an ok or coverage line of go test -cover, as in
+// "ok  example.com/p  0.1s  coverage: 75.0% of statements", or "" if it has
+// none.
+func coverageOf(line string) string {
+	_, rest, ok := strings.Cut(line, "coverage: ")
+	if !ok {
+		return ""
+	}
+	pct, _, ok := strings.Cut(rest, "%")
+	if _, err := strconv.ParseFloat(pct, 64); !ok || err != nil {
+		return ""
+	}
+	return pct
+}
@@ -0,0 +1,199 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackageFailedWithoutFailingTest(t *testing.T) {
+	text := "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nPASS\nFAIL\tx/m\t0.002s\n"
+	panicked := "panic: init failed\n\ngoroutine 1 [running]:\nFAIL\tx/m\t0.002s\n"
+	failing := "=== RUN   TestBad\n--- FAIL: TestBad (0.00s)\nFAIL\nFAIL\tx/m\t0.002s\n"
+	json := `{"Action":"run","Package":"x/m","Test":"TestOK"}
+{"Action":"pass","Package":"x/m","Test":"TestOK"}
+{"Action":"output","Package":"x/m","Output":"teardown failed\n"}
+{"Action":"fail","Package":"x/m"}
+`
+	tests := []struct {
+		name       string
+		parse      func(string) ([]TestSuite, []ParseWarning, error)
+		input      string
+		wantCases  string
+		wantOutput string
+	}{
+		{"text", parseText, text, "TestOK:success,package failed:error", ""},
+		{"text panic", parseText, panicked, "package failed:error", "panic: init failed\n\ngoroutine 1 [running]:\n"},
+		{"text failing test", parseText, failing, "TestBad:failure", ""},
+		{"json", parseJSONString, json, "TestOK:success,package failed:error", "teardown failed\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := tt.parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suites) != 1 {
+				t.Fatalf("got %d suites, want 1", len(suites))
+			}
+			var cases []string
+			for _, tc := range suites[0].TestCases {
+				cases = append(cases, tc.Name+":"+tc.Status.String())
+				if tc.Name == PackageFailed {
+					if tc.Message != failedWithoutTests {
+						t.Errorf("message %q, want %q", tc.Message, failedWithoutTests)
+					}
+					if got := tc.Output.String(); got != tt.wantOutput {
+						t.Errorf("output %q, want %q", got, tt.wantOutput)
+					}
+				}
+			}
+			if got := strings.Join(cases, ","); got != tt.wantCases {
+				t.Errorf("test cases %s, want %s", got, tt.wantCases)
+			}
+		})
+	}
+}
+
+func TestCoverageLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantCover string
+	}{
+		{"go test", "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nPASS\ncoverage: 66.7% of statements\nok  \tx/m\t0.002s\tcoverage: 66.7% of statements\n", "66.7"},
+		{"test binary", "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nPASS\ncoverage: 50.0% of statements\n", "50.0"},
+		{"test output", "=== RUN   TestOK\ncoverage: 10.0% of statements\n--- PASS: TestOK (0.00s)\nPASS\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := parseText(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suites) != 1 || len(suites[0].TestCases) != 1 {
+				t.Fatalf("got %v, want one suite with one test", suites)
+			}
+			if got := suites[0].Property("coverage"); got != tt.wantCover {
+				t.Errorf("coverage %q, want %q", got, tt.wantCover)
+			}
+			if out := suites[0].TestCases[0].Output.String(); strings.Contains(out, "coverage") != (tt.wantCover == "") {
+				t.Errorf("test output %q", out)
+			}
+		})
+	}
+}
+
+func parseText(s string) ([]TestSuite, []ParseWarning, error) {
+	return ParseOutput(strings.NewReader(s))
+}
+
+func parseJSONString(s string) ([]TestSuite, []ParseWarning, error) {
+	return ParseJSON(strings.NewReader(s))
+}
+
+// casesOf returns the suites and test cases of suites as
+// "suite: test:status ..." lines.
+func casesOf(suites []TestSuite) string {
+	var lines []string
+	for _, s := range suites {
+		line := s.Name + ":"
+		for _, tc := range s.TestCases {
+			line += " " + tc.Name + ":" + tc.Status.String()
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) ([]TestSuite, []ParseWarning, error)
+		input string
+		want  string
+	}{
+		{
+			"text", parseText,
+			"=== RUN   TestA\n--- PASS: TestA (0.01s)\n=== RUN   TestB\n    b_test.go:3: bad\n--- FAIL: TestB (0.00s)\nFAIL\nFAIL\tx/m\t0.02s\n",
+			"x/m: TestA:success TestB:failure",
+		},
+		{
+			"text subtests", parseText,
+			"=== RUN   TestA\n=== RUN   TestA/one\n=== RUN   TestA/two\n    --- PASS: TestA/one (0.00s)\n    --- SKIP: TestA/two (0.00s)\n--- PASS: TestA (0.00s)\nPASS\nok  \tx/m\t0.01s\n",
+			"x/m: TestA:success TestA/one:success TestA/two:skipped",
+		},
+		{
+			"text packages", parseText,
+			"?   \tx/a\t[no test files]\n=== RUN   TestB\n--- PASS: TestB (0.00s)\nPASS\nok  \tx/b\t0.01s\n",
+			"x/a:\nx/b: TestB:success",
+		},
+		{
+			"json", parseJSONString,
+			`{"Action":"run","Package":"x/m","Test":"TestA"}
+{"Action":"pass","Package":"x/m","Test":"TestA","Elapsed":0.01}
+{"Action":"run","Package":"x/m","Test":"TestB"}
+{"Action":"output","Package":"x/m","Test":"TestB","Output":"    b_test.go:3: bad\n"}
+{"Action":"fail","Package":"x/m","Test":"TestB"}
+{"Action":"run","Package":"x/m","Test":"TestC"}
+{"Action":"skip","Package":"x/m","Test":"TestC"}
+{"Action":"fail","Package":"x/m","Elapsed":0.02}
+`,
+			"x/m: TestA:success TestB:failure TestC:skipped",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, warnings, err := tt.parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) > 0 {
+				t.Errorf("warnings %v", warnings)
+			}
+			if got := casesOf(suites); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnTestEvents(t *testing.T) {
+	text := "=== RUN   TestA\n--- PASS: TestA (0.00s)\n--- FAIL: TestB (0.00s)\n    b_test.go:3: bad\nFAIL\nFAIL\tx/m\t0.01s\n"
+	json := `{"Action":"run","Package":"x/m","Test":"TestA"}
+{"Action":"pass","Package":"x/m","Test":"TestA"}
+{"Action":"run","Package":"x/m","Test":"TestB"}
+{"Action":"output","Package":"x/m","Test":"TestB","Output":"    b_test.go:3: bad\n"}
+{"Action":"fail","Package":"x/m","Test":"TestB"}
+{"Action":"fail","Package":"x/m"}
+`
+	tests := []struct {
+		name  string
+		parse func(string) ([]TestSuite, []ParseWarning, error)
+		input string
+		want  string
+	}{
+		// The text output names the package after its tests, and the
+		// output of a failed test may follow its result, here until the
+		// end of the package.
+		{"text", parseText, text, "start :TestA, end :TestA:success:, end x/m:TestB:failure:    b_test.go:3: bad\n"},
+		{"json", parseJSONString, json, "start x/m:TestA, end x/m:TestA:success:, start x/m:TestB, end x/m:TestB:failure:    b_test.go:3: bad\n"},
+	}
+	defer func() { OnTestStart, OnTestEnd = nil, nil }()
+	for _, tt := range tests {
+		var events []string
+		OnTestStart = func(pkg string, tc TestCase) { events = append(events, "start "+pkg+":"+tc.Name) }
+		OnTestEnd = func(pkg string, tc TestCase) {
+			events = append(events, "end "+pkg+":"+tc.Name+":"+tc.Status.String()+":"+tc.Output.String())
+		}
+		if _, _, err := tt.parse(tt.input); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(events, ", "); got != tt.want {
+			t.Errorf("%s: events %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
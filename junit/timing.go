@@ -0,0 +1,32 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import "time"
+
+// The start and end of tests, when the input has them, are recorded in the
+// "timestamp" and "end_timestamp" properties of the tests, in TimeLayout.
+const TimeLayout = time.RFC3339Nano
+
+// setTestStart records the start of t at ts, if it is known.
+func setTestStart(t *TestCase, ts time.Time) {
+	if !ts.IsZero() {
+		t.SetProperty("timestamp", ts.Format(TimeLayout))
+	}
+}
+
+// setTestEnd records the end of t, which reported its result at ts. Without
+// the time of the result, as in the text output of go test, the end of a
+// test whose start is known is taken from its duration.
+func setTestEnd(t *TestCase, ts time.Time) {
+	if ts.IsZero() {
+		start, err := time.Parse(TimeLayout, t.Property("timestamp"))
+		if err != nil {
+			return
+		}
+		ts = start.Add(t.Duration)
+	}
+	t.SetProperty("end_timestamp", ts.Format(TimeLayout))
+}
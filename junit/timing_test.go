@@ -0,0 +1,55 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package junit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetTestEnd(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		start time.Time
+		ts    time.Time
+		want  string
+	}{
+		// A parallel test reports its result when its parent ends, after
+		// its own duration.
+		{"event", start, start.Add(3 * time.Second), "2024-05-01T12:00:03Z"},
+		{"event without start", time.Time{}, start.Add(3 * time.Second), "2024-05-01T12:00:03Z"},
+		{"no event time", start, time.Time{}, "2024-05-01T12:00:01.5Z"},
+		{"nothing known", time.Time{}, time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		tc := TestCase{Name: "TestA", Duration: 1500 * time.Millisecond}
+		setTestStart(&tc, tt.start)
+		setTestEnd(&tc, tt.ts)
+		if got := tc.Property("end_timestamp"); got != tt.want {
+			t.Errorf("%s: end_timestamp %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSONTestTimes(t *testing.T) {
+	json := `{"Time":"2024-05-01T12:00:00Z","Action":"run","Package":"x/m","Test":"TestP"}
+{"Time":"2024-05-01T12:00:00.5Z","Action":"pause","Package":"x/m","Test":"TestP"}
+{"Time":"2024-05-01T12:00:01Z","Action":"cont","Package":"x/m","Test":"TestP"}
+{"Time":"2024-05-01T12:00:04Z","Action":"pass","Package":"x/m","Test":"TestP","Elapsed":1}
+{"Time":"2024-05-01T12:00:04Z","Action":"pass","Package":"x/m","Elapsed":4}
+`
+	suites, _, err := parseJSONString(json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := &suites[0].TestCases[0]
+	if got, want := tc.Property("timestamp"), "2024-05-01T12:00:01Z"; got != want {
+		t.Errorf("timestamp %q, want %q", got, want)
+	}
+	if got, want := tc.Property("end_timestamp"), "2024-05-01T12:00:04Z"; got != want {
+		t.Errorf("end_timestamp %q, want %q", got, want)
+	}
+}
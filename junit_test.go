@@ -0,0 +1,135 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// quickSuites are suites as gojunit records them, generated by testing/quick
+// with names, messages and output holding the characters that need escaping.
+type quickSuites []TestSuite
+
+// quickText holds the pieces of the strings of quickSuites.
+var quickText = []string{
+	"a", "Z", "0", " ", ".", "/", "\"", "'", "<", ">", "&", "]]>", "é", "日本",
+	"😀", "\n", "\t", "\r", "\x1b[31m", "\x00", "\x7f", "--- ",
+}
+
+func quickString(r *rand.Rand, size int) string {
+	var b strings.Builder
+	for n := r.Intn(size + 1); n > 0; n-- {
+		b.WriteString(quickText[r.Intn(len(quickText))])
+	}
+	return b.String()
+}
+
+func quickProperties(r *rand.Rand, size int) []Property {
+	var props []Property
+	for n := r.Intn(3); n > 0; n-- {
+		props = append(props, Property{Name: "p" + quickString(r, size), Value: quickString(r, size)})
+	}
+	return props
+}
+
+func (quickSuites) Generate(r *rand.Rand, size int) reflect.Value {
+	var suites quickSuites
+	for n := r.Intn(4); n > 0; n-- {
+		s := TestSuite{
+			Name:     "s" + quickString(r, size),
+			Duration: time.Duration(r.Int63n(int64(time.Hour))),
+		}
+		if r.Intn(2) == 0 {
+			s.Timestamp = time.Unix(r.Int63n(1<<32), 0).UTC()
+		}
+		s.Properties = append(quickProperties(r, size), Property{Name: "generator", Value: "gojunit v" + Version})
+		s.Output.WriteString(quickString(r, size))
+		for n := r.Intn(4); n > 0; n-- {
+			t := TestCase{
+				Name:       "T" + quickString(r, size),
+				Status:     Status(r.Intn(4)),
+				Duration:   time.Duration(r.Int63n(int64(time.Minute))),
+				Properties: quickProperties(r, size),
+			}
+			if r.Intn(2) == 0 {
+				t.Classname = "c" + quickString(r, size)
+			}
+			if t.Status != Success {
+				t.Message = "m" + quickString(r, size)
+			}
+			t.Output.WriteString(quickString(r, size))
+			t.Stderr.WriteString(quickString(r, size))
+			s.TestCases = append(s.TestCases, t)
+		}
+		suites = append(suites, s)
+	}
+	return reflect.ValueOf(suites)
+}
+
+// suitesText returns the contents of suites, for comparing them.
+func suitesText(suites []TestSuite) string {
+	var b strings.Builder
+	for i := range suites {
+		s := &suites[i]
+		fmt.Fprintf(&b, "suite %q %v %v %q %q\n", s.Name, s.Duration, s.Timestamp.UTC(), s.Properties, s.Output.String())
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			fmt.Fprintf(&b, "\ttest %q %q %v %v %q %q %q %q\n", t.Name, t.Classname, t.Status, t.Duration, t.Message, t.Properties, t.Output.String(), t.Stderr.String())
+		}
+	}
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	formats := []struct {
+		name  string
+		write func([]TestSuite, *bytes.Buffer) error
+		read  func(*bytes.Buffer) ([]TestSuite, error)
+	}{
+		{
+			"xml",
+			func(s []TestSuite, b *bytes.Buffer) error { return WriteXML(s, b) },
+			func(b *bytes.Buffer) ([]TestSuite, error) {
+				suites, _, err := ParseXML(b)
+				return suites, err
+			},
+		},
+		{
+			"json",
+			func(s []TestSuite, b *bytes.Buffer) error { return WriteJSON(s, b) },
+			func(b *bytes.Buffer) ([]TestSuite, error) { return ReadJSONReport(b) },
+		},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			roundTrip := func(suites quickSuites) bool {
+				var b bytes.Buffer
+				if err := f.write(suites, &b); err != nil {
+					t.Fatal(err)
+				}
+				report := b.String()
+				got, err := f.read(&b)
+				if err != nil {
+					t.Fatalf("%v reading\n%s", err, report)
+				}
+				if want := suitesText(suites); suitesText(got) != want {
+					t.Errorf("read back\n%s\nwant\n%s\nfrom\n%s", suitesText(got), want, report)
+					return false
+				}
+				return true
+			}
+			if err := quick.Check(roundTrip, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
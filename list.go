@@ -0,0 +1,100 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// notRun is the message of the tests of inventories, which go test -list
+// lists without running them.
+const notRun = "listed by go test -list; not run"
+
+// listedRE matches the names go test -list prints, one per line.
+var listedRE = regexp.MustCompile(`^(Test|Benchmark|Example|Fuzz)\w*$`)
+
+// defaultList is the pattern gojunit list lists, that of the tests,
+// examples and fuzz targets go test runs without -bench.
+const defaultList = "^(Test|Example|Fuzz)"
+
+// isListOutput reports whether b starts with a name go test -list prints.
+func isListOutput(b []byte) bool {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	return listedRE.Match(bytes.TrimRight(b, "\r"))
+}
+
+func streamList(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	var warnings []ParseWarning
+	var suite TestSuite
+	var output bytes.Buffer // of a package that cannot be listed
+	lineno := 0
+	err := junit.ReadLines(r, func(line string) {
+		lineno++
+		switch {
+		case listedRE.MatchString(line):
+			suite.TestCases = append(suite.TestCases, TestCase{Name: line, Status: Skipped, Message: notRun})
+		case strings.HasPrefix(line, "ok") || strings.HasPrefix(line, "FAIL") || strings.HasPrefix(line, "?"):
+			rest, reason := junit.BracketReason(line)
+			if fields := strings.Fields(rest); len(fields) > 1 {
+				suite.Name = fields[1]
+			}
+			if reason != "" {
+				junit.SetReason(&suite, reason, &output)
+			}
+			emit(suite)
+			suite = TestSuite{}
+			output.Reset()
+		case strings.TrimSpace(line) != "":
+			fmt.Fprintln(&output, line)
+		}
+	})
+	if len(suite.TestCases) > 0 {
+		warnings = append(warnings, ParseWarning{Line: lineno, Reason: "input ended before the package result"})
+		emit(suite)
+	}
+	return warnings, err
+}
+
+// ListTests lists the tests of the packages matching patterns with go test
+// -list, passing it the given extra arguments, such as -tags, and returns
+// an inventory of them: one suite per package, whose tests are skipped with
+// the message "listed by go test -list; not run". A -list argument replaces
+// the default pattern, which lists the tests, examples and fuzz targets go
+// test runs.
+func ListTests(ctx context.Context, patterns, args []string) ([]TestSuite, []ParseWarning, error) {
+	list := []string{"test", "-list", defaultList}
+	for _, a := range args {
+		if a == "-list" || strings.HasPrefix(a, "-list=") {
+			list = list[:1]
+		}
+	}
+	cmd := exec.CommandContext(ctx, "go", append(append(list, args...), patterns...)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	suites, warnings, err := junit.Collect(streamList, stdout)
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		if _, ok := werr.(*exec.ExitError); !ok {
+			err = werr
+		}
+	}
+	return suites, warnings, err
+}
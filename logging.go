@@ -0,0 +1,118 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// logger receives the decisions of the parsers and the actions of gojunit,
+// at debug level, and the messages gojunit prints about a conversion. It
+// discards everything unless the command sets it up from -q, -v and -debug.
+var logger = slog.New(slog.DiscardHandler)
+
+// debugging reports whether logger records debug messages, which callers on
+// the paths run for each line check first to avoid formatting them.
+func debugging() bool {
+	return logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logLevel returns the level of the messages printed with the given flags.
+// Warnings, such as tests missing from the baseline, are printed by default;
+// -q leaves only errors, -v adds the warnings of the parsers and -debug
+// everything.
+func logLevel(quiet, verbose, debug bool) slog.Level {
+	switch {
+	case debug:
+		return slog.LevelDebug
+	case verbose:
+		return slog.LevelInfo
+	case quiet:
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+// A logHandler writes records as lines in the style of the log package
+// messages of gojunit, "gojunit: message key=value ...", with debug messages
+// marked as such.
+type logHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs string // formatted attributes added by WithAttrs
+	group string // prefix of the keys of attributes, ending in "."
+}
+
+func newLogHandler(w io.Writer, level slog.Leveler) *logHandler {
+	return &logHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+func (h *logHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString("gojunit: ")
+	if r.Level < slog.LevelInfo {
+		buf.WriteString("debug: ")
+	}
+	buf.WriteString(r.Message)
+	buf.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&buf, h.group, a)
+		return true
+	})
+	buf.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var buf bytes.Buffer
+	for _, a := range attrs {
+		writeAttr(&buf, h.group, a)
+	}
+	c := *h
+	c.attrs += buf.String()
+	return &c
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.group += name + "."
+	return &c
+}
+
+// writeAttr writes a as " key=value", quoting values that contain spaces.
+func writeAttr(buf *bytes.Buffer, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, g := range a.Value.Group() {
+			writeAttr(buf, group+a.Key+".", g)
+		}
+		return
+	}
+	v := a.Value.String()
+	if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+		v = fmt.Sprintf("%q", v)
+	}
+	fmt.Fprintf(buf, " %s%s=%s", group, a.Key, v)
+}
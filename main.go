@@ -6,177 +6,1399 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
+
+	"github.com/kisielk/gojunit/junit"
 )
 
-type TestSuite struct {
-	Name      string
-	TestCases []TestCase
-	Duration  time.Duration
-}
+// Version is the version of gojunit, reported by -version and recorded in
+// generated reports.
+const Version = "0.2"
 
-type TestCase struct {
-	Name     string
-	Duration time.Duration
-	Status   Status
-	Output   bytes.Buffer
+// suiteKey returns the name of s qualified by its label, which tells apart
+// the suites of the same package run in different matrix entries.
+func suiteKey(s *TestSuite) string {
+	l := s.Property("label")
+	if l == "" || strings.HasSuffix(s.Name, " ["+l+"]") {
+		return s.Name
+	}
+	return s.Name + " [" + l + "]"
 }
 
-type Status int
-
-const (
-	Success Status = iota
-	Failure
-	Error
-	Skipped
-)
-
-// ParseOutput parses the output of the Go test runner and returns a slice of 
-// TestSuites.
-func ParseOutput(r io.Reader) ([]TestSuite, error) {
-	buf := bufio.NewReader(r)
-	var suites []TestSuite
-	var suite = new(TestSuite)
-	var tc = new(TestCase)
-	var readErr error
-	var line string
+// classnameOf returns the classname of t, which defaults to the name of the
+// suite containing it.
+func classnameOf(s *TestSuite, t *TestCase) string {
+	if t.Classname != "" {
+		return t.Classname
+	}
+	return s.Name
+}
 
-	for ; readErr == nil; line, readErr = buf.ReadString('\n') {
-		line = strings.TrimRight(line, "\n")
-		switch {
-		case line == "PASS" || line == "FAIL":
-			continue
-		case strings.HasPrefix(line, "=== RUN"):
-			suite.TestCases = append(suite.TestCases, TestCase{})
-			tc = &suite.TestCases[len(suite.TestCases)-1]
-			fields := strings.Fields(line)
-			if len(fields) > 2 {
-				tc.Name = fields[2]
-			}
-		case strings.HasPrefix(line, "--- FAIL:"):
-			fields := strings.Fields(line)
-			if len(fields) > 3 {
-				// trim off leading (, ignore the error
-				tc.Duration, _ = time.ParseDuration(fields[3][1:] + "s")
-			}
-			tc.Status = Failure
-		case strings.HasPrefix(line, "--- PASS:"):
-			fields := strings.Fields(line)
-			if len(fields) > 3 {
-				// trim off leading (, ignore the error
-				tc.Duration, _ = time.ParseDuration(fields[3][1:] + "s")
-			}
-			tc.Status = Success
-		case strings.HasPrefix(line, "FAIL"):
-			fields := strings.Fields(line)
-			if len(fields) > 1 {
-				suite.Name = fields[1]
-			}
-			if len(fields) > 2 {
-				suite.Duration, _ = time.ParseDuration(fields[2])
-			}
-			suites = append(suites, *suite)
-			suite = new(TestSuite)
-		case strings.HasPrefix(line, "ok"):
-			fields := strings.Fields(line)
-			if len(fields) > 1 {
-				suite.Name = fields[1]
-			}
-			if len(fields) > 2 {
-				suite.Duration, _ = time.ParseDuration(fields[2])
-			}
-			suites = append(suites, *suite)
-			suite = new(TestSuite)
-		default:
-			fmt.Fprintln(&tc.Output, line)
-		}
+// messageOf returns the message of t, which defaults to the summary of the
+// first testify assertion that failed or else the first message it logged.
+func messageOf(t *TestCase) string {
+	if t.Message != "" {
+		return t.Message
 	}
-	if readErr != nil && readErr != io.EOF {
-		return nil, readErr
+	if t.Status == Skipped {
+		return skipReason(t.Output.String())
 	}
-	return suites, nil
+	if a := ParseAssertion(t.Output.String()); a != nil {
+		return a.Message()
+	}
+	if leaks := ParseGoroutineLeaks(t.Output.String()); leaks != nil {
+		return leakMessage(leaks)
+	}
+	_, _, msg := FailureLocation(t.Output.String())
+	return msg
 }
 
 // XML format based on https://svn.jenkins-ci.org/trunk/hudson/dtkit/dtkit-format/dtkit-junit-model/src/main/resources/com/thalesgroup/dtkit/junit/model/xsd/junit-4.xsd
 
+// Seconds is the value of a time attribute. It is always written as a
+// plain decimal number, such as 0.000001 rather than 1e-06, which some
+// consumers of JUnit reports fail to parse.
+type Seconds float64
+
+func (s Seconds) MarshalText() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(s), 'f', -1, 64), nil
+}
+
 // <testsuites> XML element
 type TestSuitesXML struct {
-	XMLName    xml.Name `xml:"testsuites"`
+	XMLName    xml.Name       `xml:"testsuites"`
+	Properties *PropertiesXML `xml:"properties,omitempty"`
 	TestSuites []TestSuiteXML
 }
 
 // <testsuite> XML element
 type TestSuiteXML struct {
-	XMLName   xml.Name `xml:"testsuite"`
-	Name      string   `xml:"name,attr"`
-	Errors    int      `xml:"errors,attr"`
-	Failures  int      `xml:"failures,attr"`
-	Skipped   int      `xml:"skipped,attr"`
-	Tests     int      `xml:"tests,attr"`
-	Time      float64  `xml:"time,attr"`
-	TestCases []TestCaseXML
+	XMLName    xml.Name       `xml:"testsuite"`
+	Name       string         `xml:"name,attr"`
+	Errors     int            `xml:"errors,attr"`
+	Failures   int            `xml:"failures,attr"`
+	Skipped    int            `xml:"skipped,attr"`
+	Tests      int            `xml:"tests,attr"`
+	Time       Seconds        `xml:"time,attr"`
+	Timestamp  string         `xml:"timestamp,attr,omitempty"`
+	Properties *PropertiesXML `xml:"properties,omitempty"`
+	TestCases  []TestCaseXML
+	TestSuites []TestSuiteXML
+	SystemOut  string `xml:"system-out,omitempty"`
+}
+
+// <properties> XML element
+type PropertiesXML struct {
+	Properties []PropertyXML `xml:"property"`
+}
+
+// <property> XML element
+type PropertyXML struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 // <testcase> XML element
 type TestCaseXML struct {
-	XMLName xml.Name    `xml:"testcase"`
-	Name    string      `xml:"name,attr"`
-	Time    float64     `xml:"time,attr"`
-	Failure *FailureXML `xml:"failure,omitempty"`
+	XMLName    xml.Name       `xml:"testcase"`
+	Name       string         `xml:"name,attr"`
+	Classname  string         `xml:"classname,attr"`
+	Time       Seconds        `xml:"time,attr"`
+	Properties *PropertiesXML `xml:"properties"`
+	Failure    *FailureXML    `xml:"failure,omitempty"`
+	Error      *FailureXML    `xml:"error,omitempty"`
+	Skipped    *SkippedXML    `xml:"skipped,omitempty"`
+	SystemOut  string         `xml:"system-out,omitempty"`
+	SystemErr  string         `xml:"system-err,omitempty"`
 }
 
-// <failure> XML element
+// <failure> and <error> XML elements
 type FailureXML struct {
-	XMLName xml.Name `xml:"failure"`
-	Message string   `xml:"message"`
+	Message  string `xml:"message,attr,omitempty"`
+	Type     string `xml:"type,attr,omitempty"`
+	Contents string `xml:",chardata"`
+}
+
+// <skipped> XML element
+type SkippedXML struct {
+	Message string `xml:"message,attr,omitempty"`
 }
 
 // WriteXML writes a slice of TestSuites to a writer in XML format.
 func WriteXML(suites []TestSuite, w io.Writer) error {
+	return encodeXML(w, suitesToXML(suites))
+}
+
+// suitesToXML converts a slice of TestSuites to their flat XML representation.
+func suitesToXML(suites []TestSuite) TestSuitesXML {
 	suitesXML := TestSuitesXML{}
+	run := sharedRunProperties(suites)
+	suitesXML.Properties = propertiesToXML(run)
 	for _, suite := range suites {
 		suiteXML := TestSuiteXML{
-			Name:  suite.Name,
-			Time:  suite.Duration.Seconds(),
+			Name:  xmlString(suite.Name),
+			Time:  Seconds(suite.Duration.Seconds()),
 			Tests: len(suite.TestCases),
 		}
+		if !suite.Timestamp.IsZero() {
+			suiteXML.Timestamp = suite.Timestamp.UTC().Format("2006-01-02T15:04:05")
+		}
+		suiteXML.Properties = propertiesToXML(withoutProperties(suite.Properties, run))
+		suiteXML.SystemOut = xmlString(suite.Output.String())
 		for _, t := range suite.TestCases {
 			testXML := TestCaseXML{
-				Name: t.Name,
-				Time: t.Duration.Seconds(),
+				Name:      xmlString(t.Name),
+				Classname: xmlString(classnameOf(&suite, &t)),
+				Time:      Seconds(t.Duration.Seconds()),
 			}
+			testXML.Properties = propertiesToXML(t.Properties)
+			testXML.SystemErr = xmlString(t.Stderr.String())
 			switch t.Status {
 			case Failure:
 				suiteXML.Failures += 1
-				f := FailureXML{Message: t.Output.String()}
-				testXML.Failure = &f
+				testXML.Failure = &FailureXML{Message: xmlString(messageOf(&t)), Contents: xmlString(failureBody(&t))}
+				switch {
+				case ParseAssertion(t.Output.String()) != nil:
+					testXML.Failure.Type = "Assertion"
+				case ParseGoroutineLeaks(t.Output.String()) != nil:
+					testXML.Failure.Type = "GoroutineLeak"
+				}
 			case Skipped:
 				suiteXML.Skipped += 1
+				testXML.Skipped = &SkippedXML{Message: xmlString(messageOf(&t))}
 			case Error:
 				suiteXML.Errors += 1
-			default:
-				// do nothing
+				testXML.Error = &FailureXML{Message: xmlString(messageOf(&t)), Contents: xmlString(failureBody(&t))}
+			}
+			if testXML.Failure == nil && testXML.Error == nil {
+				testXML.SystemOut = xmlString(t.Output.String())
 			}
 			suiteXML.TestCases = append(suiteXML.TestCases, testXML)
 		}
 		suitesXML.TestSuites = append(suitesXML.TestSuites, suiteXML)
 	}
+	return suitesXML
+}
+
+func propertiesToXML(props []Property) *PropertiesXML {
+	if len(props) == 0 {
+		return nil
+	}
+	p := new(PropertiesXML)
+	for _, prop := range props {
+		p.Properties = append(p.Properties, PropertyXML{xmlString(prop.Name), xmlString(prop.Value)})
+	}
+	return p
+}
+
+// withoutProperties returns the properties in props that are not in drop.
+func withoutProperties(props, drop []Property) []Property {
+	if len(drop) == 0 {
+		return props
+	}
+	var kept []Property
+outer:
+	for _, p := range props {
+		for _, d := range drop {
+			if p == d {
+				continue outer
+			}
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// xmlString returns s with the control characters XML cannot hold, such as
+// the escapes of colored output, replaced by their symbols in the Control
+// Pictures block, U+2400 to U+241F, which ParseXML turns back into control
+// characters in the reports of gojunit. encoding/xml would replace them with
+// U+FFFD.
+func xmlString(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return strings.Map(func(r rune) rune {
+				if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+					return 0x2400 + r
+				}
+				return r
+			}, s)
+		}
+	}
+	return s
+}
+
+// pruneSuccesses removes the test cases that neither failed nor had an
+// error from suites, which keep counting them.
+func pruneSuccesses(suites []TestSuiteXML) {
+	for i := range suites {
+		s := &suites[i]
+		kept := s.TestCases[:0]
+		for _, t := range s.TestCases {
+			if t.Failure != nil || t.Error != nil {
+				kept = append(kept, t)
+			}
+		}
+		s.TestCases = kept
+		pruneSuccesses(s.TestSuites)
+	}
+}
+
+func encodeXML(w io.Writer, suitesXML TestSuitesXML) error {
 	enc := xml.NewEncoder(w)
 	err := enc.Encode(suitesXML)
 	return err
 }
 
+var (
+	nameTemplate      = flag.String("name-template", "", "text/template for testcase names, e.g. {{.Package}}.{{.Name}}")
+	classnameTemplate = flag.String("classname-template", "", "text/template for testcase classnames, e.g. {{.Package}}")
+	groupBy           = flag.String("group-by", "package", "suites of the report: package, dir:N (directories N deep in the module) or owners:FILE (components of a CODEOWNERS style file)")
+	classnameStyle    = flag.String("classname-style", "go", "classname style: go (import paths) or java (org.repo.pkg)")
+	modules           = flag.Bool("modules", false, "detect the module of each suite and group suites by module")
+	moduleRoot        = flag.String("module-root", ".", "directory to search for go.work and go.mod files")
+	resolvePackages   = flag.Bool("resolve-packages", false, "replace relative package names such as . with import paths, resolved from -module-root")
+	resolveSources    = flag.Bool("resolve-sources", false, "show the source around failure locations in HTML reports, read from the modules under -module-root")
+	moduleOutput      = flag.String("module-output", "", "write one report per module into this directory")
+	includeNoTests    = flag.Bool("include-no-test-files", false, "include packages without test files in the report")
+	skipEmpty         = flag.Bool("skip-empty", false, "leave suites without test cases out of the report")
+	includeEmpty      = flag.Bool("include-empty", false, "include all suites without test cases, even packages without test files")
+	failuresOnly      = flag.Bool("failures-only", false, "write only the failed test cases, and those with errors, in JUnit XML reports, which still count all tests")
+	nested            = flag.Bool("nested", false, "nest testsuites following the package directory tree")
+	stylesheet        = flag.String("stylesheet", "", "URL of an XSLT stylesheet, such as the one gojunit stylesheet writes, with which browsers render JUnit XML reports")
+	verbose           = flag.Bool("verbose", false, "print warnings about input lines that were ignored or guessed at")
+	quiet             = flag.Bool("q", false, "print only errors")
+	debug             = flag.Bool("debug", false, "print what the parsers made of the input and what is written, in addition to -verbose")
+	version           = flag.Bool("version", false, "print the version and exit")
+	from              = flag.String("from", "text", "input format: text (go test -v), json (go test -json), junit, ginkgo (ginkgo --json-report), bazel (bazel test logs) or list (go test -list)")
+	format            = flag.String("format", "junit", "output format: junit, csv, github, html, json, md, proto, sql, sqlite, summary, teamcity or template")
+	templateFile      = flag.String("template", "", "text/template file used by -format=template")
+	summary           = flag.Bool("summary", false, "print a summary of the results to standard error")
+	badge             = flag.String("badge", "", "write an SVG badge of the numbers of tests that passed and failed, and of the coverage reported by go test -cover, to this file")
+	timing            = flag.Bool("timing", false, "add duration percentiles and histograms of the tests to summaries")
+	output            = flag.String("o", "", "write the report to this file instead of standard output")
+	listen            = flag.String("listen", ":8080", "address on which gojunit serve listens")
+	maxBody           = flag.Int64("max-body", 64<<20, "largest request body, in bytes, from which gojunit serve reads results; 0 for no limit")
+	label             = flag.String("label", "", "label the suites with a matrix entry, such as linux-amd64-integration")
+	labelNames        = flag.Bool("label-names", false, "append the label of each suite to its name")
+	maxSkipped        = flag.Int("max-skipped", -1, "fail if more than this many tests are skipped; -1 for no limit")
+	maxSkipRatio      = flag.Float64("max-skip-ratio", 1, "fail if more than this fraction of the tests, such as 0.05, are skipped")
+	gateFlag          = flag.String("gate", "", "condition the results must meet, such as failures==0 && skipped<5 && time<10m")
+	noCIEnv           = flag.Bool("no-ci-env", false, "do not record the build, branch, commit and job URL of the CI environment in the report")
+	impactBase        = flag.String("impact", "", "mark each failing test as caused by the changes since this git ref, when it fails in a changed file under -module-root, or as pre-existing")
+	mergeSuites       = flag.String("merge-suites", "", "resolve suites of the same package in several inputs: matrix (keep them apart, named after their label or input) or union (merge their tests)")
+	parallelPackages  = flag.Int("parallel-packages", 1, "number of packages gojunit run builds and tests at the same time")
+	orderByDuration   = flag.String("order-by-duration", "", "report of an earlier run; gojunit run starts the packages that took longest in it first")
+	changedFiles      = flag.String("changed-files", "", "file listing changed files, as git diff --name-only does; gojunit run only tests the packages they affect")
+	failFast          = flag.Bool("fail-fast", false, "stop starting packages in gojunit run once a test failed")
+	failFastReport    = flag.String("fail-fast-report", "", "as soon as a test fails, print its output to standard error and write a report of it alone to this file")
+	recordEnv         = flag.String("record-env", "", "comma separated patterns, such as GO*,CI_*, of the environment variables gojunit run records as env.NAME suite properties")
+	dryRun            = flag.Bool("dry-run", false, "read the results and print their summary, warnings and gate, but write, upload, publish and send nothing")
+	gitInfo           = flag.Bool("git", false, "record the commit, branch, dirty flag and changed files of the git checkout in the report")
+	failNoTests       = flag.Bool("fail-no-tests", false, "report packages in which no test matched -run as errors")
+	suiteName         = flag.String("suite-name", "", "name of suites without a package result, such as the output of a test binary run directly")
+	issuesFile        = flag.String("issues", "", "file of rules linking tests to issues")
+	issueURLFormat    = flag.String("issue-url", "", "URL of issues given by ID in -issues, with %s for the ID")
+	outputFilterFile  = flag.String("output-filter", "", "file of rules dropping lines from the output of tests, such as debug logs of passing tests")
+	tagRulesFile      = flag.String("tag-rules", "", "file of rules tagging tests, such as smoke or slow, by name")
+	onlyTags          = flag.String("only-tags", "", "comma separated tags; leave the tests with none of them out of the reports and the gate")
+	expectedFile      = flag.String("expected-failures", "", "file listing tests that are expected to fail")
+	statusRulesFile   = flag.String("status-rules", "", "file of rules reporting tests with a status and message, such as skips with known-broken, with another status")
+	quarantineFile    = flag.String("quarantine", "", "file listing flaky tests whose failures are reported as skipped, as written by gojunit suggest-quarantine")
+	flakeScoresFile   = flag.String("flake-scores", "", "JSON file of the flake scores of tests, as written by gojunit flake-scores, added to the tests as properties")
+	baseline          = flag.String("baseline", "", "report listing the tests that must appear in the results")
+	storeDir          = flag.String("store", "", "where gojunit serve keeps runs: a directory, sqlite:PATH, a postgres:// URL or bigquery://PROJECT/DATASET.TABLE (default in memory)")
+	tee               = flag.Bool("tee", false, "copy the input to standard output as it is read")
+	testIDs           = flag.Bool("test-ids", false, "record a stable ID of each test, derived from its package and name, in its id property")
+	maxReportBytes    = flag.Int64("max-report-bytes", 0, "split reports written to files into numbered files of at most this many bytes, along suite boundaries")
+	checksum          = flag.String("checksum", "", "write the sha256 or sha512 digest of each report file, and of the manifest, to a sidecar file such as report.xml.sha256")
+	signSpec          = flag.String("sign", "", "sign each report file, and the manifest, with minisign:KEY, an unencrypted minisign secret key, or cosign:KEY, with cosign sign-blob")
+	manifest          = flag.String("manifest", "", "write a JSON manifest of the inputs, results and reports of the conversion to this file")
+	smtpServer        = flag.String("smtp", envOr("GOJUNIT_SMTP", "localhost:25"), "host:port of the SMTP server gojunit notify sends email with ($GOJUNIT_SMTP)")
+	smtpUser          = flag.String("smtp-user", os.Getenv("GOJUNIT_SMTP_USER"), "user name on the SMTP server, whose password is read from $GOJUNIT_SMTP_PASSWORD ($GOJUNIT_SMTP_USER)")
+	emailFrom         = flag.String("email-from", os.Getenv("GOJUNIT_EMAIL_FROM"), "sender of the email of gojunit notify ($GOJUNIT_EMAIL_FROM)")
+	alertsFile        = flag.String("alerts", "", "file of rules raising PagerDuty or Opsgenie alerts when the suites matching them fail")
+	jiraURL           = flag.String("jira-url", "", "file an issue in Jira at this URL for every failed test, or comment on its open issue")
+	jiraProject       = flag.String("jira-project", "", "key of the Jira project in which -jira-url files issues")
+	jiraIssueType     = flag.String("jira-issue-type", "Bug", "type of the issues filed by -jira-url")
+	githubCheckName   = flag.String("github-check", "", "create a GitHub check run with this name on $GITHUB_SHA, annotating the failures")
+	gerritURL         = flag.String("gerrit-url", "", "post a review of the results on the patch set of $GERRIT_CHANGE_NUMBER on the Gerrit site at this URL")
+	bitbucketTitle    = flag.String("bitbucket-report", "", "create a Bitbucket Code Insights report with this title on $BITBUCKET_COMMIT, annotating the failures")
+	notifyPassing     = flag.Bool("notify-passing", false, "notify even when no test failed")
+	jobs              = flag.Int("j", runtime.NumCPU(), "number of inputs parsed at the same time")
+)
+
+// extension returns the file name extension for reports in the given format.
+func extension(format string) string {
+	if format == "junit" {
+		return ".xml"
+	}
+	return "." + format
+}
+
+func init() {
+	flag.StringVar(format, "to", *format, "alias for -format")
+	flag.BoolVar(verbose, "v", false, "alias for -verbose")
+	flag.StringVar(jiraProject, "project", "", "alias for -jira-project")
+}
+
+// writers maps the names accepted by -format to the functions implementing
+// them.
+var writers = map[string]func([]TestSuite, io.Writer) error{
+	"junit":    WriteXML,
+	"csv":      WriteCSV,
+	"github":   WriteGitHubAnnotations,
+	"html":     WriteHTML,
+	"json":     WriteJSON,
+	"md":       WriteMarkdown,
+	"proto":    WriteProto,
+	"sql":      WriteSQL,
+	"summary":  WriteSummary,
+	"teamcity": WriteTeamCity,
+}
+
+// schema identifies the flavor of JUnit XML written by WriteXML.
+const schema = "junit-4"
+
+// addMetadata records which program generated the report, and when, in each
+// suite.
+func addMetadata(suites []TestSuite, now time.Time) {
+	for i := range suites {
+		s := &suites[i]
+		if s.Timestamp.IsZero() {
+			s.Timestamp = now
+		}
+		s.SetProperty("generator", "gojunit v"+Version)
+		s.SetProperty("schema", schema)
+	}
+}
+
+// parseTemplate parses a name template flag, returning nil if it is empty.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("-%s-template: %v", name, err)
+	}
+	return t, nil
+}
+
+var nameTmpl, classnameTmpl, reportTmpl *template.Template
+
+var gate *Gate
+
+var grouping Grouping
+
+// sources reads the source snippets of -resolve-sources.
+var sources *sourceResolver
+
+// impact marks the failing tests of -impact.
+var impact *Impact
+
+// runOptions schedule the packages of gojunit run.
+var runOptions RunOptions
+
+var issueRules []IssueRule
+
+var expectedFailures []ExpectedFailure
+
+var quarantine []ExpectedFailure
+
+var flakeScores []FlakeScore
+
+var statusRules []StatusRule
+
+var tagRules []TagRule
+
+var outputRules []OutputRule
+
+var (
+	alertRules []AlertRule
+	alerters   []alerter
+)
+
+var jira *jiraClient
+
+var check *githubCheck
+
+var gerrit *gerritReview
+
+var bitbucket *bitbucketReport
+
+var reportSigner signer
+
+// runWall is the wall-clock time of the tests of gojunit run.
+var runWall time.Duration
+
+// checkFlags validates the flags controlling how results are processed.
+func checkFlags() {
+	if _, ok := junit.LookupFormat(*from); !ok {
+		fatalf(exitParse, "unknown input format %q", *from)
+	}
+	if *skipEmpty && (*includeEmpty || *includeNoTests) {
+		fatal(exitParse, "-skip-empty cannot be combined with -include-empty or -include-no-test-files")
+	}
+	if *mergeSuites != "" && *mergeSuites != "matrix" && *mergeSuites != "union" {
+		fatalf(exitParse, "unknown -merge-suites mode %q", *mergeSuites)
+	}
+	if _, ok := checksums[*checksum]; *checksum != "" && !ok {
+		fatalf(exitParse, "unknown -checksum algorithm %q", *checksum)
+	}
+	if *signSpec != "" {
+		var err error
+		if reportSigner, err = newSigner(*signSpec); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	runOptions = RunOptions{Parallel: *parallelPackages, FailFast: *failFast}
+	if *orderByDuration != "" {
+		earlier, err := readReport(*orderByDuration)
+		if err != nil {
+			fatal(exitParse, err)
+		}
+		runOptions.Durations = packageDurations(earlier)
+	}
+	if *failFastReport != "" {
+		report := &FailureReport{Path: *failFastReport, W: os.Stderr}
+		if *dryRun {
+			report.Path = ""
+		}
+		junit.OnFailure = report.Failed
+	}
+	for _, pattern := range splitTags(*recordEnv) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			fatalf(exitParse, "-record-env pattern %q: %v", pattern, err)
+		}
+	}
+	if *classnameStyle != "go" && *classnameStyle != "java" {
+		fatalf(exitParse, "unknown classname style %q", *classnameStyle)
+	}
+	var err error
+	if nameTmpl, err = parseTemplate("name", *nameTemplate); err != nil {
+		fatal(exitParse, err)
+	}
+	if *groupBy != "package" {
+		var err error
+		if grouping, err = ParseGrouping(*groupBy); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if classnameTmpl, err = parseTemplate("classname", *classnameTemplate); err != nil {
+		fatal(exitParse, err)
+	}
+	if *issuesFile != "" {
+		var err error
+		if issueRules, err = ReadIssueRules(*issuesFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *resolveSources {
+		mods, err := findModules(*moduleRoot)
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+		sources = newSourceResolver(mods)
+	}
+	if *impactBase != "" {
+		mods, err := findModules(*moduleRoot)
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+		if impact, err = NewImpact(*impactBase, mods); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if *outputFilterFile != "" {
+		var err error
+		if outputRules, err = ReadOutputRules(*outputFilterFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *tagRulesFile != "" {
+		var err error
+		if tagRules, err = ReadTagRules(*tagRulesFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *expectedFile != "" {
+		var err error
+		if expectedFailures, err = ReadExpectedFailures(*expectedFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *quarantineFile != "" {
+		var err error
+		if quarantine, err = ReadExpectedFailures(*quarantineFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *flakeScoresFile != "" {
+		var err error
+		if flakeScores, err = ReadFlakeScores(*flakeScoresFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *statusRulesFile != "" {
+		var err error
+		if statusRules, err = ReadStatusRules(*statusRulesFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *gateFlag != "" {
+		var err error
+		if gate, err = ParseGate(*gateFlag); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *templateFile != "" {
+		var err error
+		if reportTmpl, err = ParseReportTemplate(*templateFile); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *alertsFile != "" {
+		var err error
+		if alertRules, err = ReadAlertRules(*alertsFile); err != nil {
+			fatal(exitParse, err)
+		}
+		if alerters = ambientAlerters(); alerters == nil {
+			fatal(exitParse, "-alerts requires $PAGERDUTY_ROUTING_KEY or $OPSGENIE_API_KEY")
+		}
+	}
+	if *jiraURL != "" {
+		token := os.Getenv("JIRA_API_TOKEN")
+		if *jiraProject == "" || token == "" {
+			fatal(exitParse, "-jira-url requires -jira-project and $JIRA_API_TOKEN")
+		}
+		jira = &jiraClient{
+			URL:       *jiraURL,
+			Project:   *jiraProject,
+			IssueType: *jiraIssueType,
+			Auth:      jiraAuth(os.Getenv("JIRA_USER"), token),
+		}
+	}
+	if *githubCheckName != "" {
+		var err error
+		if check, err = ambientGitHubCheck(); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *gerritURL != "" {
+		var err error
+		if gerrit, err = ambientGerritReview(*gerritURL); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	if *bitbucketTitle != "" {
+		var err error
+		if bitbucket, err = ambientBitbucketReport(); err != nil {
+			fatal(exitParse, err)
+		}
+	}
+	for _, v := range uploadURLs {
+		u, err := parseUpload(v, *format)
+		if err != nil {
+			fatal(exitParse, err)
+		}
+		uploads = append(uploads, u)
+	}
+}
+
+// writer returns the function writing reports in the named format, or nil
+// for the sqlite format, which is not written to an io.Writer.
+func writer(format string) (func([]TestSuite, io.Writer) error, error) {
+	if format == "sqlite" {
+		return nil, nil
+	}
+	if format == "template" {
+		if reportTmpl == nil {
+			return nil, fmt.Errorf("-format=template requires -template")
+		}
+		return TemplateWriter(reportTmpl), nil
+	}
+	write, ok := writers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if format == "junit" && (*nested || *failuresOnly || *stylesheet != "") {
+		nest, failuresOnly, href := *nested, *failuresOnly, *stylesheet
+		write = func(suites []TestSuite, w io.Writer) error {
+			if href != "" {
+				if err := writeStylesheetRef(w, href); err != nil {
+					return err
+				}
+			}
+			suitesXML := suitesToXML(suites)
+			if failuresOnly {
+				pruneSuccesses(suitesXML.TestSuites)
+			}
+			if nest {
+				suitesXML.TestSuites = nestSuites(suitesXML.TestSuites)
+			}
+			return encodeXML(w, suitesXML)
+		}
+	}
+	return write, nil
+}
+
+// processModules returns the modules under -module-root, by which process
+// groups suites when -modules, -module-output or -group-by ask for it, or
+// nil. They are found once by the callers of process that call it for every
+// suite and test they stream.
+func processModules() ([]string, error) {
+	if !*modules && *moduleOutput == "" && grouping == nil {
+		return nil, nil
+	}
+	return FindModules(*moduleRoot)
+}
+
+// process applies the processing selected by flags to parsed suites before
+// they are written, returning warnings about the tests it renamed. The
+// suites are grouped by mods, the modules returned by processModules.
+func process(suites []TestSuite, mods []string) ([]TestSuite, []ParseWarning, error) {
+	if *suiteName != "" {
+		for i := range suites {
+			if suites[i].Name == "" {
+				suites[i].Name = *suiteName
+			}
+		}
+	}
+	if *resolvePackages {
+		ResolvePackages(suites, *moduleRoot)
+	}
+	if *mergeSuites != "" {
+		var err error
+		if suites, err = MergeSuites(suites, *mergeSuites); err != nil {
+			return nil, nil, err
+		}
+	}
+	if *failNoTests {
+		for i := range suites {
+			if s := &suites[i]; s.Property("reason") == junit.NoTestsToRun {
+				tc := TestCase{Name: junit.NoTestsToRun, Status: Error, Message: "no test matched the -run flag"}
+				s.TestCases = append(s.TestCases, tc)
+			}
+		}
+	}
+	if *label != "" {
+		for i := range suites {
+			if suites[i].Property("label") == "" {
+				suites[i].SetProperty("label", *label)
+			}
+		}
+	}
+	if *modules || *moduleOutput != "" || grouping != nil {
+		GroupByModule(suites, mods)
+	}
+	switch {
+	case *skipEmpty:
+		suites = dropSuites(suites, "no test cases", func(s *TestSuite) bool { return len(s.TestCases) == 0 })
+	case !*includeNoTests && !*includeEmpty:
+		suites = dropSuites(suites, junit.NoTestFiles, func(s *TestSuite) bool { return s.Property("reason") == junit.NoTestFiles })
+	}
+	if *testIDs {
+		AddTestIDs(suites)
+	}
+	if issueRules != nil {
+		LinkIssues(suites, issueRules, *issueURLFormat)
+	}
+	if expectedFailures != nil {
+		MarkExpectedFailures(suites, expectedFailures)
+	}
+	if quarantine != nil {
+		MarkQuarantined(suites, quarantine)
+	}
+	if flakeScores != nil {
+		AddFlakeScores(suites, flakeScores)
+	}
+	if statusRules != nil {
+		MapStatuses(suites, statusRules)
+	}
+	if impact != nil {
+		impact.Mark(suites)
+	}
+	if tagRules != nil {
+		TagTests(suites, tagRules)
+	}
+	if *onlyTags != "" {
+		suites = FilterTags(suites, splitTags(*onlyTags))
+	}
+	if outputRules != nil {
+		FilterOutput(suites, outputRules)
+	}
+	addMetadata(suites, time.Now())
+	AddRunProperties(suites, runProperties)
+	if err := RenameTests(suites, nameTmpl, classnameTmpl); err != nil {
+		return nil, nil, err
+	}
+	if grouping != nil {
+		suites = GroupSuites(suites, grouping)
+	}
+	if *classnameStyle == "java" {
+		MapClassnames(suites, JavaClassname)
+	}
+	warnings := DisambiguateNames(suites)
+	if *labelNames {
+		for i := range suites {
+			suites[i].Name = suiteKey(&suites[i])
+		}
+	}
+	return suites, warnings, nil
+}
+
+// logWarning logs a warning about the results, which is only shown with
+// -verbose, unless in a dry run.
+func logWarning(w ParseWarning) {
+	if *dryRun {
+		logger.Warn(w.String())
+	} else {
+		logger.Info(w.String())
+	}
+}
+
 func main() {
-	suites, err := ParseOutput(os.Stdin)
+	log.SetFlags(0)
+	log.SetPrefix("gojunit: ")
+	args := os.Args[1:]
+	c, named := lookupCommand("convert"), false
+	if len(args) > 0 {
+		if sub := lookupCommand(args[0]); sub != nil {
+			c, named, args = sub, true, args[1:]
+		}
+	}
+	if c.Main != nil {
+		c.Main(args)
+		return
+	}
+	cmd := c.Name
+	fs := c.flagSet(named)
+	fs.Parse(args)
+	if *version {
+		fmt.Println("gojunit", Version)
+		return
+	}
+	logger = slog.New(newLogHandler(os.Stderr, logLevel(*quiet, *verbose, *debug)))
+	junit.Logger = logger
+	checkFlags()
+	if cmd != "serve" {
+		runProperties = readRunProperties()
+	}
+	// An interrupted run still reports the results collected until then.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if cmd == "serve" {
+		store, err := OpenStore(*storeDir)
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+		if err := ServeContext(ctx, *listen, store); err != nil {
+			fatal(exitInfra, err)
+		}
+		return
+	}
+	reports, err := outputReports(cmd)
+	if err != nil {
+		fatal(exitParse, err)
+	}
+	if *dryRun {
+		// The flags of the reports are checked, but nothing is written,
+		// published or uploaded.
+		reports, publishURLs, uploads = nil, nil, nil
+	}
+
+	var publishers []Publisher
+	for _, u := range publishURLs {
+		p, err := NewPublisher(u)
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+		publishers = append(publishers, p)
+	}
+
+	mods, err := processModules()
 	if err != nil {
-		log.Fatal(err)
+		fatal(exitParse, err)
+	}
+
+	var suites []TestSuite
+	var warnings []ParseWarning
+	var streamed []io.WriteCloser
+	if cmd == "run" {
+		patterns, testArgs := splitArgs(fs.Args())
+		if *changedFiles != "" {
+			if patterns, err = affectedPatterns(ctx, *changedFiles, patterns); err != nil {
+				fatal(exitInfra, err)
+			}
+			logger.Info(fmt.Sprintf("%d packages affected by the changed files", len(patterns)))
+		}
+		start := time.Now()
+		if *changedFiles == "" || len(patterns) > 0 {
+			suites, warnings, err = RunTestsWith(ctx, patterns, testArgs, runOptions)
+		}
+		runWall = time.Since(start)
+		if err := RecordEnv(suites, splitTags(*recordEnv)); err != nil {
+			fatal(exitParse, err)
+		}
+	} else if cmd == "list" {
+		patterns, testArgs := splitArgs(fs.Args())
+		suites, warnings, err = ListTests(ctx, patterns, testArgs)
+	} else {
+		if inputs, err = expandInputs(inputs, os.Stdin); err != nil {
+			fatal(exitParse, err)
+		}
+		if streamed, err = openStreamed(reports); err != nil {
+			fatal(exitInfra, err)
+		}
+		defer closeAll(streamed)
+		if streaming(reports) {
+			junit.OnTestStart = func(pkg string, t TestCase) { streamTest(reports, mods, pkg, t, false) }
+			junit.OnTestEnd = func(pkg string, t TestCase) { streamTest(reports, mods, pkg, t, true) }
+		}
+		suites, warnings, err = collectInputs(ctx, inputs, *from, func(s TestSuite) {
+			writeStreamed(reports, publishers, mods, []TestSuite{s})
+		})
+	}
+	interrupted := err != nil && ctx.Err() != nil
+	if interrupted {
+		logger.Warn("interrupted; reporting the results collected so far")
+	} else if err != nil && (cmd == "run" || cmd == "list") {
+		fatal(exitInfra, err)
+	} else if err != nil {
+		fatal(exitParse, err)
+	}
+	var renamed []ParseWarning
+	if suites, renamed, err = process(suites, mods); err != nil {
+		fatal(exitParse, err)
+	}
+	warnings = append(warnings, renamed...)
+	for _, w := range warnings {
+		logWarning(w)
+	}
+	var missing []TestSuite
+	if *baseline != "" {
+		required, err := readReport(*baseline)
+		if err != nil {
+			fatal(exitParse, err)
+		}
+		missing = MissingTests(suites, required)
+		for i := range missing {
+			for _, t := range missing[i].TestCases {
+				logger.Warn(fmt.Sprintf("%s: %s: %s", suiteKey(&missing[i]), t.Name, notInRun))
+			}
+		}
+		suites = addMissing(suites, missing)
+		if cmd != "run" {
+			writeStreamed(reports, publishers, mods, missing)
+		}
+	}
+	var gateErr error
+	if gate != nil {
+		if gateErr = gate.Check(suites); gateErr != nil {
+			logger.Warn(gateErr.Error())
+		} else if *dryRun {
+			logger.Warn("gate met: " + gate.String())
+		}
+	}
+	if err := CheckSkips(suites, *maxSkipped, *maxSkipRatio); err != nil {
+		logger.Warn(err.Error())
+		gateErr = err
+	}
+	if *summary || *dryRun {
+		WriteSummary(suites, os.Stderr)
+	}
+	for i := range reports {
+		r := &reports[i]
+		if r.stream != nil && cmd != "run" {
+			continue
+		}
+		logger.Debug("writing report", "format", r.format, "path", r.path, "suites", len(suites))
+		switch {
+		case r.modules:
+			r.files, err = writeModuleReports(r.path, extension(r.format), suites, r.write)
+		case r.write == nil:
+			err = WriteSQLite(suites, r.path)
+		case *maxReportBytes > 0 && r.path != "":
+			r.files, err = writeChunkedReport(r.path, r.format, suites, r.write, *maxReportBytes)
+		default:
+			err = writeReport(r.path, suites, r.write)
+		}
+		if err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if *badge != "" && !*dryRun {
+		if err := writeReport(*badge, suites, WriteBadge); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	uploaded, err := uploadReports(uploads, suites)
+	if err != nil {
+		fatal(exitInfra, err)
+	}
+	if !*dryRun {
+		writeManifest(cmd, suites, warnings, reports, uploaded...)
+		if *checksum != "" || reportSigner != nil {
+			closeAll(streamed)
+			if err := sealFiles(reportFiles(reports), *checksum, reportSigner); err != nil {
+				fatal(exitInfra, err)
+			}
+		}
+		sendResults(cmd, suites)
 	}
-	WriteXML(suites, os.Stdout)
+	for _, p := range publishers {
+		if cmd == "run" {
+			publish(p, suites)
+		}
+		if err := p.Close(); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if code := exitCode(cmd == "run" && failed(suites) || len(missing) > 0, gateErr != nil, interrupted); code != exitOK {
+		closeAll(streamed)
+		os.Exit(code)
+	}
+}
+
+// sendResults sends the notifications, alerts, issues, checks and reviews
+// selected by the flags about suites.
+func sendResults(cmd string, suites []TestSuite) {
+	if cmd == "notify" {
+		notify(suites)
+	}
+	raiseAlerts(suites)
+	if jira != nil {
+		if err := jira.FileFailures(suites); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if check != nil {
+		if err := check.Publish(*githubCheckName, suites); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if gerrit != nil {
+		if err := gerrit.Post(suites); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+	if bitbucket != nil {
+		if err := bitbucket.Publish(*bitbucketTitle, suites); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+}
+
+// dropSuites removes the suites for which drop returns true, logging that
+// they were dropped for the given reason.
+func dropSuites(suites []TestSuite, reason string, drop func(*TestSuite) bool) []TestSuite {
+	kept := suites[:0]
+	for i := range suites {
+		if !drop(&suites[i]) {
+			kept = append(kept, suites[i])
+		} else {
+			logger.Debug("suite left out of the report", "suite", suiteKey(&suites[i]), "reason", reason)
+		}
+	}
+	return kept
+}
+
+// failed reports whether any test in suites failed or had an error.
+func failed(suites []TestSuite) bool {
+	for _, s := range suites {
+		for _, t := range s.TestCases {
+			if t.Status == Failure || t.Status == Error {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringList is a flag.Value that collects the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+var inputs, outputs, publishURLs, uploadURLs, emailTo stringList
+
+// uploads are the reports selected by -upload.
+var uploads []upload
+
+func init() {
+	flag.Var(&inputs, "i", "read results from this file instead of standard input, or from the files listed in @file or, with -, on standard input; may be repeated to merge several inputs")
+	flag.Var(&outputs, "output", "write a report in a format to a file, as in junit=report.xml; may be repeated")
+	flag.Var(&uploadURLs, "upload", "store the report in a bucket, as in s3://bucket/{date}/{job}/report.xml or md=gs://bucket/report.md; may be repeated")
+	flag.Var(&emailTo, "email", "email a digest of the failures to this address with gojunit notify; may be repeated")
+	flag.Var(&publishURLs, "publish", "publish every test case as a JSON message to a broker, as in nats://host/subject or kafka+http://proxy/topic; may be repeated")
+}
+
+// A report is a file to write the results to.
+type report struct {
+	format string
+	path   string // "" for standard output
+	write  func([]TestSuite, io.Writer) error
+	stream func(io.Writer) streamWriter // nil if the format is not streamed
+	files  []string                     // files written, when -max-report-bytes splits the report or -module-output writes one per module
+
+	modules  bool         // whether path is the directory of the reports of -module-output
+	streamer streamWriter // the writer of a streamed report, once opened
+}
+
+// outputReports returns the reports selected by -output, and by -format and
+// -o, or -module-output, unless -output is given without either. gojunit
+// notify only writes the reports selected with -o, -module-output and
+// -output.
+func outputReports(cmd string) ([]report, error) {
+	var reports []report
+	switch {
+	case *moduleOutput != "":
+		write, err := writer(*format)
+		if err != nil {
+			return nil, err
+		}
+		if write == nil {
+			return nil, fmt.Errorf("-module-output does not support -format=%s", *format)
+		}
+		reports = append(reports, report{format: *format, path: *moduleOutput, write: write, modules: true})
+	case len(outputs) == 0 && cmd != "notify" || *output != "":
+		write, err := writer(*format)
+		if err != nil {
+			return nil, err
+		}
+		if write == nil && *output == "" {
+			return nil, fmt.Errorf("-format=%s requires -o", *format)
+		}
+		reports = append(reports, report{format: *format, path: *output, write: write, stream: streamWriters[*format]})
+	}
+	for _, o := range outputs {
+		i := strings.Index(o, "=")
+		if i <= 0 || i == len(o)-1 {
+			return nil, fmt.Errorf("-output %s: want format=path", o)
+		}
+		write, err := writer(o[:i])
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report{format: o[:i], path: o[i+1:], write: write, stream: streamWriters[o[:i]]})
+	}
+	if *tee {
+		for _, r := range reports {
+			if r.path == "" && r.stream == nil {
+				return nil, fmt.Errorf("-tee requires -o unless the report is streamed, as with -format=teamcity or github")
+			}
+		}
+	}
+	return reports, nil
+}
+
+// expandInputs replaces the names of -i of the form @file with the inputs
+// listed in the file, and - with those listed on stdin. Lists hold a name per
+// line; blank lines and lines starting with # are skipped.
+func expandInputs(names []string, stdin io.Reader) ([]string, error) {
+	var expanded []string
+	for _, name := range names {
+		var r io.Reader
+		switch {
+		case name == "-":
+			r = stdin
+		case strings.HasPrefix(name, "@"):
+			f, err := os.Open(name[1:])
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		default:
+			expanded = append(expanded, name)
+			continue
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+				expanded = append(expanded, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading input list %s: %v", name, err)
+		}
+	}
+	return expanded, nil
+}
+
+// collectInputs parses the named inputs concurrently and merges their
+// results. With no names, it parses standard input.
+func collectInputs(ctx context.Context, names []string, format string, onSuite func(TestSuite)) ([]TestSuite, []ParseWarning, error) {
+	c := &Collector{Context: ctx, OnSuite: onSuite, Jobs: *jobs, LabelInputs: *mergeSuites == "matrix"}
+	if *tee {
+		c.Tee = stdout
+	}
+	if len(names) == 0 {
+		if err := c.Add("", os.Stdin, format); err != nil {
+			return nil, nil, err
+		}
+		return c.Wait()
+	}
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, "unix://"):
+			l, err := listenUnix(strings.TrimPrefix(name, "unix://"))
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := c.AddListener(name, l, format); err != nil {
+				return nil, nil, err
+			}
+			continue
+		case strings.HasPrefix(name, "pipe://"):
+			if err := c.AddPipe(strings.TrimPrefix(name, "pipe://"), format); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if format == "bazel" {
+			if info, err := os.Stat(name); err == nil && info.IsDir() {
+				if err := addBazelTestlogs(c, name); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+		}
+		if err := c.AddFile(name, format); err != nil {
+			return nil, nil, err
+		}
+	}
+	return c.Wait()
+}
+
+// listenUnix listens on the Unix socket at path, replacing the socket left
+// there by an earlier listener.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// splitArgs splits the arguments of gojunit run into package patterns and the
+// arguments following "--", which are passed to the test binaries.
+func splitArgs(args []string) (patterns, testArgs []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// notify sends the notifications of gojunit notify about suites, unless all
+// tests passed and -notify-passing is not set.
+func notify(suites []TestSuite) {
+	if len(emailTo) == 0 {
+		fatal(exitParse, "gojunit notify requires -email")
+	}
+	if !failed(suites) && !*notifyPassing {
+		logger.Debug("no test failed; not notifying")
+		return
+	}
+	cfg := emailConfig{
+		Server:   *smtpServer,
+		User:     *smtpUser,
+		Password: os.Getenv("GOJUNIT_SMTP_PASSWORD"),
+		From:     firstNonEmpty(*emailFrom, defaultEmailFrom()),
+		To:       emailTo,
+	}
+	logger.Debug("sending digest", "server", cfg.Server, "to", strings.Join(cfg.To, ","))
+	if err := SendDigest(cfg, suites); err != nil {
+		fatal(exitInfra, err)
+	}
+}
+
+// raiseAlerts raises the alerts of the failed suites matched by the rules of
+// -alerts.
+func raiseAlerts(suites []TestSuite) {
+	for _, a := range Alerts(suites, alertRules) {
+		logger.Info("raising alert", "suite", a.Suite, "severity", a.Severity)
+		for _, send := range alerters {
+			if err := send(&a); err != nil {
+				fatal(exitInfra, err)
+			}
+		}
+	}
+}
+
+// envOr returns the value of the named environment variable, or def if it is
+// not set.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// writeManifest writes the manifest selected by -manifest, if any, of a
+// conversion of the inputs, or of a run, to the given reports and uploaded
+// objects.
+func writeManifest(cmd string, suites []TestSuite, warnings []ParseWarning, reports []report, uploaded ...ManifestFile) {
+	if *manifest == "" {
+		return
+	}
+	names := inputs
+	if cmd == "run" {
+		names = nil
+	} else if len(names) == 0 {
+		names = []string{"-"}
+	}
+	m := NewManifest(names, *from, suites, warnings)
+	if cmd == "run" {
+		m.Run = NewManifestRun(runWall, suites)
+	}
+	for _, r := range reports {
+		switch {
+		case r.modules:
+			for _, f := range r.files {
+				m.AddOutput(f, r.format)
+			}
+		case len(r.files) > 1:
+			for _, f := range r.files {
+				m.AddOutput(f, r.format)
+			}
+			m.AddOutput(chunkManifestName(r.path), "manifest")
+		default:
+			m.AddOutput(r.path, r.format)
+		}
+	}
+	m.Outputs = append(m.Outputs, uploaded...)
+	if err := m.Write(*manifest); err != nil {
+		fatal(exitInfra, err)
+	}
+}
+
+// reportFiles returns the names of the files written for reports, and of
+// the manifest, if any.
+func reportFiles(reports []report) []string {
+	var names []string
+	for _, r := range reports {
+		switch {
+		case r.modules:
+			names = append(names, r.files...)
+		case len(r.files) > 1:
+			names = append(names, r.files...)
+			names = append(names, chunkManifestName(r.path))
+		case r.path != "":
+			names = append(names, r.path)
+		}
+	}
+	if *manifest != "" {
+		names = append(names, *manifest)
+	}
+	return names
+}
+
+// openStreamed opens the files of the streamed reports, returning nil for
+// those written to standard output and for the reports that are not
+// streamed, and makes their writers.
+func openStreamed(reports []report) ([]io.WriteCloser, error) {
+	files := make([]io.WriteCloser, len(reports))
+	for i := range reports {
+		r := &reports[i]
+		if r.stream == nil {
+			continue
+		}
+		var w io.Writer = stdout
+		if r.path != "" {
+			f, err := os.Create(r.path)
+			if err != nil {
+				closeAll(files)
+				return nil, err
+			}
+			files[i], w = f, f
+		}
+		r.streamer = r.stream(w)
+	}
+	return files, nil
+}
+
+// writeStreamed processes suites, with the modules mods, and writes them to
+// the streamed reports and publishers as soon as they are collected. Standard output is written to by
+// the copy of the input made by -tee as well, so writes to it are serialized
+// with the copy.
+func writeStreamed(reports []report, publishers []Publisher, mods []string, suites []TestSuite) {
+	if !streaming(reports) && len(publishers) == 0 {
+		return
+	}
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	suites, _, err := process(copySuites(suites), mods)
+	if err != nil {
+		fatal(exitParse, err)
+	}
+	for _, p := range publishers {
+		publish(p, suites)
+	}
+	for _, r := range reports {
+		if r.streamer == nil {
+			continue
+		}
+		for j := range suites {
+			if err := r.streamer.SuiteEnded(&suites[j]); err != nil {
+				fatal(exitInfra, err)
+			}
+		}
+	}
+}
+
+// publish publishes the test cases of suites with p.
+func publish(p Publisher, suites []TestSuite) {
+	for i := range suites {
+		if err := p.Publish(&suites[i]); err != nil {
+			fatal(exitInfra, err)
+		}
+	}
+}
+
+// stdout is standard output, shared by streamed reports and -tee.
+var stdout = &syncWriter{w: os.Stdout}
+
+func closeAll(files []io.WriteCloser) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// writeReport writes suites to the named file, or to standard output if name
+// is empty.
+func writeReport(name string, suites []TestSuite, write func([]TestSuite, io.Writer) error) error {
+	if name == "" {
+		return write(suites, os.Stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = write(suites, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
@@ -0,0 +1,736 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestMain runs gojunit itself instead of the tests when the test binary is
+// started by gojunitMain.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOJUNIT_TEST_MAIN") == "1" {
+		main()
+		os.Exit(exitOK)
+	}
+	os.Exit(m.Run())
+}
+
+// gojunitMain runs gojunit with args, reading input, and returns what it
+// wrote to standard output and its exit code.
+func gojunitMain(t *testing.T, input string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "GOJUNIT_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) {
+			t.Fatal(err)
+		}
+	}
+	t.Logf("gojunit %s:\n%s", strings.Join(args, " "), stderr.String())
+	return stdout.String(), cmd.ProcessState.ExitCode()
+}
+
+// casesOf returns the suites and test cases of suites as
+// "suite: test:status ..." lines, like its namesake in package junit.
+func casesOf(suites []TestSuite) string {
+	var lines []string
+	for _, s := range suites {
+		line := s.Name + ":"
+		for _, tc := range s.TestCases {
+			line += " " + tc.Name + ":" + tc.Status.String()
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// goldenLog is the go test -v output of a module with two packages, from
+// which the golden reports are written.
+const goldenLog = `=== RUN   TestSmokeLogin
+DEBUG connecting
+--- PASS: TestSmokeLogin (0.01s)
+=== RUN   TestQuery
+    query_test.go:12: got 2, want 1
+--- FAIL: TestQuery (0.02s)
+=== RUN   TestSlowScan
+    scan_test.go:5: needs a database
+--- SKIP: TestSlowScan (0.00s)
+FAIL
+FAIL	example.com/m/internal/storage	0.05s
+=== RUN   TestToken
+--- PASS: TestToken (0.01s)
+PASS
+ok  	example.com/m/auth	0.02s
+`
+
+var timestampPattern = regexp.MustCompile(`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d)?`)
+
+// normalizeReport returns report with what changes between runs replaced:
+// timestamps by TIMESTAMP and the version of gojunit by VERSION. The
+// elements of XML reports are put on lines of their own to keep failures
+// readable.
+func normalizeReport(report string) string {
+	report = timestampPattern.ReplaceAllString(report, "TIMESTAMP")
+	report = strings.ReplaceAll(report, "gojunit v"+Version, "gojunit VERSION")
+	return strings.ReplaceAll(report, "><", ">\n<")
+}
+
+// checkGolden runs gojunit with args on input and checks that it exits with
+// code and writes the want report, normalized by normalizeReport.
+func checkGolden(t *testing.T, input string, code int, want string, args ...string) {
+	t.Helper()
+	stdout, got := gojunitMain(t, input, args...)
+	if got != code {
+		t.Errorf("gojunit %s: exit code %d, want %d", strings.Join(args, " "), got, code)
+	}
+	if report := normalizeReport(stdout); report != want {
+		t.Errorf("gojunit %s: got\n%s\nwant\n%s", strings.Join(args, " "), report, want)
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantNil bool
+		wantErr string
+	}{
+		{text: "", wantNil: true},
+		{text: "{{.Test}} — {{.Subtest}}"},
+		{text: "{{.Package", wantErr: "-name-template: template: name:1: unclosed action"},
+		{text: "{{.Name | nosuchfunc}}", wantErr: `function "nosuchfunc" not defined`},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate("name", tt.text)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseTemplate(%q) error = %v, want %q", tt.text, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("parseTemplate(%q) error = %v", tt.text, err)
+		case (tmpl == nil) != tt.wantNil:
+			t.Errorf("parseTemplate(%q) = %v, want nil %v", tt.text, tmpl, tt.wantNil)
+		}
+	}
+}
+
+func TestModuleOutputExitCode(t *testing.T) {
+	log := "=== RUN   TestBad\n--- FAIL: TestBad (0.00s)\nFAIL\nFAIL\texample.com/p\t0.01s\n"
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, exitOK},
+		{[]string{"-gate", "failures==0"}, exitGate},
+		{[]string{"-gate", "failures==1"}, exitOK},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		out := filepath.Join(dir, "reports")
+		args := append([]string{"-module-root", dir, "-module-output", out}, tt.args...)
+		stdout, code := gojunitMain(t, log, args...)
+		if code != tt.want {
+			t.Errorf("gojunit %s: exit code %d, want %d", strings.Join(args, " "), code, tt.want)
+		}
+		if stdout != "" {
+			t.Errorf("gojunit %s: wrote %q to standard output, want nothing", strings.Join(args, " "), stdout)
+		}
+		b, err := os.ReadFile(filepath.Join(out, "nomodule.xml"))
+		if err != nil {
+			t.Error(err)
+		} else if !bytes.Contains(b, []byte(`name="TestBad"`)) {
+			t.Errorf("gojunit %s: report\n%s\nwant TestBad", strings.Join(args, " "), b)
+		}
+	}
+}
+
+func TestNestedReport(t *testing.T) {
+	const want = `<testsuites>
+<testsuite name="example.com/m" errors="0" failures="1" skipped="1" tests="4" time="0.07">
+<testsuite name="internal" errors="0" failures="1" skipped="1" tests="3" time="0.05">
+<testsuite name="storage" errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+<testcase name="TestSmokeLogin" classname="example.com/m/internal/storage" time="0.01">
+<system-out>DEBUG connecting&#xA;</system-out>
+</testcase>
+<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+<testcase name="TestSlowScan" classname="example.com/m/internal/storage" time="0">
+<skipped message="needs a database">
+</skipped>
+<system-out>    scan_test.go:5: needs a database&#xA;</system-out>
+</testcase>
+</testsuite>
+</testsuite>
+<testsuite name="auth" errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+<testcase name="TestToken" classname="example.com/m/auth" time="0.01">
+</testcase>
+</testsuite>
+</testsuite>
+</testsuites>`
+	checkGolden(t, goldenLog, exitOK, want, "-nested")
+}
+
+func TestCSVReport(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"module",
+			goldenLog,
+			"package,test,status,duration,file,line,message\n" +
+				"example.com/m/internal/storage,TestSmokeLogin,success,0.01,,,\n" +
+				"example.com/m/internal/storage,TestQuery,failure,0.02,query_test.go,12,\"got 2, want 1\"\n" +
+				"example.com/m/internal/storage,TestSlowScan,skipped,0,scan_test.go,5,needs a database\n" +
+				"example.com/m/auth,TestToken,success,0.01,,,\n",
+		},
+		{
+			"quotes",
+			"=== RUN   TestQuote\n    x_test.go:3: got \"a\"\n--- FAIL: TestQuote (0.00s)\nFAIL\nFAIL\tx/m\t0.01s\n",
+			"package,test,status,duration,file,line,message\n" +
+				"x/m,TestQuote,failure,0,x_test.go,3,\"got \"\"a\"\"\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkGolden(t, tt.input, exitOK, tt.want, "-format", "csv")
+		})
+	}
+}
+
+func TestSQLReport(t *testing.T) {
+	want := sqlSchema + `BEGIN;
+INSERT INTO runs (created, generator) VALUES ('TIMESTAMP', 'gojunit VERSION');
+INSERT INTO suites (run_id, name, duration, timestamp) VALUES ((SELECT max(id) FROM runs), 'example.com/m/internal/storage', 0.05, 'TIMESTAMP');
+INSERT INTO suite_properties (suite_id, name, value) VALUES ((SELECT max(id) FROM suites), 'generator', 'gojunit VERSION');
+INSERT INTO suite_properties (suite_id, name, value) VALUES ((SELECT max(id) FROM suites), 'schema', 'junit-4');
+INSERT INTO testcases (suite_id, name, classname, status, duration, output) VALUES ((SELECT max(id) FROM suites), 'TestSmokeLogin', 'example.com/m/internal/storage', 'success', 0.01, 'DEBUG connecting
+');
+INSERT INTO testcases (suite_id, name, classname, status, duration, output) VALUES ((SELECT max(id) FROM suites), 'TestQuery', 'example.com/m/internal/storage', 'failure', 0.02, '    query_test.go:12: got 2, want 1
+');
+INSERT INTO testcases (suite_id, name, classname, status, duration, output) VALUES ((SELECT max(id) FROM suites), 'TestSlowScan', 'example.com/m/internal/storage', 'skipped', 0, '    scan_test.go:5: needs a database
+');
+INSERT INTO suites (run_id, name, duration, timestamp) VALUES ((SELECT max(id) FROM runs), 'example.com/m/auth', 0.02, 'TIMESTAMP');
+INSERT INTO suite_properties (suite_id, name, value) VALUES ((SELECT max(id) FROM suites), 'generator', 'gojunit VERSION');
+INSERT INTO suite_properties (suite_id, name, value) VALUES ((SELECT max(id) FROM suites), 'schema', 'junit-4');
+INSERT INTO testcases (suite_id, name, classname, status, duration, output) VALUES ((SELECT max(id) FROM suites), 'TestToken', 'example.com/m/auth', 'success', 0.01, '');
+COMMIT;
+`
+	checkGolden(t, goldenLog, exitOK, want, "-format", "sql")
+}
+
+func TestSQLiteReport(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not found")
+	}
+	db := filepath.Join(t.TempDir(), "results.db")
+	// Each report adds a run to the database.
+	inputs := []string{
+		goldenLog,
+		"=== RUN   TestQuote\n    x_test.go:3: can't open\n--- FAIL: TestQuote (0.00s)\nFAIL\nFAIL\tx/m\t0.01s\n",
+	}
+	for _, input := range inputs {
+		if stdout, code := gojunitMain(t, input, "-format", "sqlite", "-o", db); code != exitOK || stdout != "" {
+			t.Fatalf("gojunit -format sqlite: exit code %d and output %q, want %d and nothing", code, stdout, exitOK)
+		}
+	}
+	out, err := exec.Command("sqlite3", "-batch", db,
+		"SELECT r.id, s.name, t.name, t.status, t.duration, t.output FROM runs r JOIN suites s ON s.run_id = r.id JOIN testcases t ON t.suite_id = s.id ORDER BY t.id").CombinedOutput()
+	if err != nil {
+		t.Fatalf("sqlite3: %v\n%s", err, out)
+	}
+	const want = `1|example.com/m/internal/storage|TestSmokeLogin|success|0.01|DEBUG connecting
+
+1|example.com/m/internal/storage|TestQuery|failure|0.02|    query_test.go:12: got 2, want 1
+
+1|example.com/m/internal/storage|TestSlowScan|skipped|0.0|    scan_test.go:5: needs a database
+
+1|example.com/m/auth|TestToken|success|0.01|
+2|x/m|TestQuote|failure|0.0|    x_test.go:3: can't open
+
+`
+	if string(out) != want {
+		t.Errorf("database holds\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestGroupedReport(t *testing.T) {
+	const props = `<properties>
+<property name="module" value="example.com/m">
+</property>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+`
+	const storage = `errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestSmokeLogin" classname="example.com/m/internal/storage" time="0.01">
+<system-out>DEBUG connecting&#xA;</system-out>
+</testcase>
+<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+<testcase name="TestSlowScan" classname="example.com/m/internal/storage" time="0">
+<skipped message="needs a database">
+</skipped>
+<system-out>    scan_test.go:5: needs a database&#xA;</system-out>
+</testcase>
+</testsuite>
+`
+	const auth = `errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestToken" classname="example.com/m/auth" time="0.01">
+</testcase>
+</testsuite>
+`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	owners := filepath.Join(dir, "OWNERS")
+	if err := os.WriteFile(owners, []byte("# storage\n/internal/**  @example/storage\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		groupBy string
+		want    string
+	}{
+		{
+			"dir:1",
+			"<testsuites>\n" +
+				`<testsuite name="auth" ` + auth +
+				`<testsuite name="internal" ` + storage +
+				"</testsuites>",
+		},
+		{
+			"owners:" + owners,
+			"<testsuites>\n" +
+				`<testsuite name="storage" ` + storage +
+				`<testsuite name="unowned" ` + auth +
+				"</testsuites>",
+		},
+	}
+	for _, tt := range tests {
+		checkGolden(t, goldenLog, exitOK, tt.want, "-module-root", dir, "-group-by", tt.groupBy)
+	}
+}
+
+func TestTaggedReport(t *testing.T) {
+	rules := filepath.Join(t.TempDir(), "tags")
+	if err := os.WriteFile(rules, []byte("/TestSmoke  smoke\nstorage/TestSlow  slow,regression\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	const props = `<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+`
+	const slowScan = `<testcase name="TestSlowScan" classname="example.com/m/internal/storage" time="0">
+<properties>
+<property name="tags" value="regression,slow">
+</property>
+</properties>
+<skipped message="needs a database">
+</skipped>
+<system-out>    scan_test.go:5: needs a database&#xA;</system-out>
+</testcase>
+`
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			nil,
+			`<testsuites>
+<testsuite name="example.com/m/internal/storage" errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestSmokeLogin" classname="example.com/m/internal/storage" time="0.01">
+<properties>
+<property name="tags" value="smoke">
+</property>
+</properties>
+<system-out>DEBUG connecting&#xA;</system-out>
+</testcase>
+<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+` + slowScan + `</testsuite>
+<testsuite name="example.com/m/auth" errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestToken" classname="example.com/m/auth" time="0.01">
+</testcase>
+</testsuite>
+</testsuites>`,
+		},
+		{
+			// The counts are those of the tests left, and suites without
+			// any are left out.
+			[]string{"-only-tags", "slow"},
+			`<testsuites>
+<testsuite name="example.com/m/internal/storage" errors="0" failures="0" skipped="1" tests="1" time="0.05" timestamp="TIMESTAMP">
+` + props + slowScan + `</testsuite>
+</testsuites>`,
+		},
+		{
+			[]string{"-only-tags", "smoke,nosuchtag", "-format", "csv"},
+			"package,test,status,duration,file,line,message\n" +
+				"example.com/m/internal/storage,TestSmokeLogin,success,0.01,,,\n",
+		},
+	}
+	for _, tt := range tests {
+		checkGolden(t, goldenLog, exitOK, tt.want, append([]string{"-tag-rules", rules}, tt.args...)...)
+	}
+}
+
+func TestChunkedReport(t *testing.T) {
+	const props = `<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+`
+	// The storage suite alone is larger than the limit, and written to a
+	// file of its own.
+	want := map[string]string{
+		"r-1.xml": `<testsuites>
+<testsuite name="example.com/m/internal/storage" errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestSmokeLogin" classname="example.com/m/internal/storage" time="0.01">
+<system-out>DEBUG connecting&#xA;</system-out>
+</testcase>
+<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+<testcase name="TestSlowScan" classname="example.com/m/internal/storage" time="0">
+<skipped message="needs a database">
+</skipped>
+<system-out>    scan_test.go:5: needs a database&#xA;</system-out>
+</testcase>
+</testsuite>
+</testsuites>`,
+		"r-2.xml": `<testsuites>
+<testsuite name="example.com/m/auth" errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestToken" classname="example.com/m/auth" time="0.01">
+</testcase>
+</testsuite>
+<testsuite name="example.com/m/cli" errors="0" failures="0" skipped="0" tests="1" time="0.01" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestFlags" classname="example.com/m/cli" time="0">
+</testcase>
+</testsuite>
+</testsuites>`,
+	}
+	input := goldenLog + "=== RUN   TestFlags\n--- PASS: TestFlags (0.00s)\nPASS\nok  \texample.com/m/cli\t0.01s\n"
+	dir := t.TempDir()
+	if stdout, code := gojunitMain(t, input, "-max-report-bytes", "800", "-o", filepath.Join(dir, "r.xml")); code != exitOK || stdout != "" {
+		t.Fatalf("gojunit -max-report-bytes: exit code %d and output %q, want %d and nothing", code, stdout, exitOK)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != "r-1.xml r-2.xml r-manifest.json" {
+		t.Fatalf("wrote %s, want r-1.xml r-2.xml r-manifest.json", got)
+	}
+	for name, want := range want {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := normalizeReport(string(b)); got != want {
+			t.Errorf("%s holds\n%s\nwant\n%s", name, got, want)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "r-manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Counts{Tests: 5, Failures: 1, Skipped: 1}); m.Counts != want || m.Suites != 3 {
+		t.Errorf("manifest counts %+v of %d suites, want %+v of 3", m.Counts, m.Suites, want)
+	}
+	if len(m.Outputs) != 2 {
+		t.Fatalf("manifest outputs %+v, want r-1.xml and r-2.xml", m.Outputs)
+	}
+	for i, out := range m.Outputs {
+		path := filepath.Join(dir, "r-"+strconv.Itoa(i+1)+".xml")
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(b)
+		want := ManifestFile{Path: path, Format: "junit", Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])}
+		if out != want {
+			t.Errorf("manifest output %+v, want %+v", out, want)
+		}
+	}
+
+	// A report within the limit is written as is.
+	dir = t.TempDir()
+	if _, code := gojunitMain(t, input, "-max-report-bytes", "10000", "-o", filepath.Join(dir, "r.xml")); code != exitOK {
+		t.Fatalf("gojunit -max-report-bytes: exit code %d, want %d", code, exitOK)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 || entries[0].Name() != "r.xml" {
+		t.Errorf("wrote %v (%v), want r.xml", entries, err)
+	}
+}
+
+func TestFilteredReport(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "filter")
+	if err := os.WriteFile(rules, []byte("drop ^DEBUG  success\nkeep ^\\s+\\S+_test.go  skipped\ntail 2  failure\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	const input = `=== RUN   TestA
+DEBUG a
+INFO a
+--- PASS: TestA (0.00s)
+=== RUN   TestB
+DEBUG b
+line 1
+line 2
+line 3
+    b_test.go:9: boom
+--- FAIL: TestB (0.00s)
+=== RUN   TestC
+DEBUG c
+    c_test.go:3: later
+--- SKIP: TestC (0.00s)
+FAIL
+FAIL	x/m	0.01s
+`
+	const want = `<testsuites>
+<testsuite name="x/m" errors="0" failures="1" skipped="1" tests="3" time="0.01" timestamp="TIMESTAMP">
+<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+<testcase name="TestA" classname="x/m" time="0">
+<system-out>INFO a&#xA;</system-out>
+</testcase>
+<testcase name="TestB" classname="x/m" time="0">
+<failure message="boom">... 3 lines omitted&#xA;line 3&#xA;    b_test.go:9: boom&#xA;</failure>
+</testcase>
+<testcase name="TestC" classname="x/m" time="0">
+<skipped message="later">
+</skipped>
+<system-out>    c_test.go:3: later&#xA;</system-out>
+</testcase>
+</testsuite>
+</testsuites>`
+	checkGolden(t, input, exitOK, want, "-output-filter", rules)
+
+	bad := filepath.Join(dir, "bad")
+	if err := os.WriteFile(bad, []byte("tail x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, input, exitParse, "", "-output-filter", bad)
+}
+
+func TestMergedSuitesReport(t *testing.T) {
+	const linux = "=== RUN   TestA\n--- PASS: TestA (0.01s)\n=== RUN   TestB\n--- PASS: TestB (0.01s)\nPASS\nok  \tx/m\t0.02s\n"
+	const darwin = "=== RUN   TestA\n    a_test.go:3: flaky\n--- FAIL: TestA (0.01s)\n=== RUN   TestC\n--- PASS: TestC (0.00s)\nFAIL\nFAIL\tx/m\t0.02s\n"
+	t.Chdir(t.TempDir())
+	for name, input := range map[string]string{"linux.log": linux, "darwin.log": darwin, "linux/test.log": linux, "darwin/test.log": darwin} {
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(input), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const props = `<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+`
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			[]string{"-format", "csv", "-i", "linux.log", "-i", "darwin.log"},
+			"package,test,status,duration,file,line,message\n" +
+				"x/m,TestA,success,0.01,,,\n" +
+				"x/m,TestB,success,0.01,,,\n" +
+				"x/m,TestA,failure,0.01,a_test.go,3,flaky\n" +
+				"x/m,TestC,success,0,,,\n",
+		},
+		{
+			[]string{"-merge-suites", "matrix", "-format", "csv", "-i", "linux.log", "-i", "darwin.log"},
+			"package,test,status,duration,file,line,message\n" +
+				"x/m [linux],TestA,success,0.01,,,\n" +
+				"x/m [linux],TestB,success,0.01,,,\n" +
+				"x/m [darwin],TestA,failure,0.01,a_test.go,3,flaky\n" +
+				"x/m [darwin],TestC,success,0,,,\n",
+		},
+		{
+			// The inputs of the entries have the same name in a directory
+			// per entry.
+			[]string{"-merge-suites", "matrix", "-i", "linux/test.log", "-i", "darwin/test.log"},
+			`<testsuites>
+<testsuite name="x/m [linux/test]" errors="0" failures="0" skipped="0" tests="2" time="0.02" timestamp="TIMESTAMP">
+<properties>
+<property name="label" value="linux/test">
+</property>
+` + props + `<testcase name="TestA" classname="x/m [linux/test]" time="0.01">
+</testcase>
+<testcase name="TestB" classname="x/m [linux/test]" time="0.01">
+</testcase>
+</testsuite>
+<testsuite name="x/m [darwin/test]" errors="0" failures="1" skipped="0" tests="2" time="0.02" timestamp="TIMESTAMP">
+<properties>
+<property name="label" value="darwin/test">
+</property>
+` + props + `<testcase name="TestA" classname="x/m [darwin/test]" time="0.01">
+<failure message="flaky">    a_test.go:3: flaky&#xA;</failure>
+</testcase>
+<testcase name="TestC" classname="x/m [darwin/test]" time="0">
+</testcase>
+</testsuite>
+</testsuites>`,
+		},
+		{
+			// TestA keeps its failure, and the suite the summed time of
+			// both.
+			[]string{"-merge-suites", "union", "-i", "linux/test.log", "-i", "darwin/test.log"},
+			`<testsuites>
+<testsuite name="x/m" errors="0" failures="1" skipped="0" tests="3" time="0.04" timestamp="TIMESTAMP">
+<properties>
+` + props + `<testcase name="TestA" classname="x/m" time="0.01">
+<failure message="flaky">    a_test.go:3: flaky&#xA;</failure>
+</testcase>
+<testcase name="TestB" classname="x/m" time="0.01">
+</testcase>
+<testcase name="TestC" classname="x/m" time="0">
+</testcase>
+</testsuite>
+</testsuites>`,
+		},
+	}
+	for _, tt := range tests {
+		checkGolden(t, "", exitOK, tt.want, tt.args...)
+	}
+}
+
+func TestFailuresOnlyReport(t *testing.T) {
+	const props = `<properties>
+<property name="generator" value="gojunit VERSION">
+</property>
+<property name="schema" value="junit-4">
+</property>
+</properties>
+`
+	tests := []struct {
+		name  string
+		input string
+		args  []string
+		want  string
+	}{
+		{
+			// The suites keep the counts of all their tests, and a suite
+			// whose tests all passed is kept without any.
+			"failure",
+			goldenLog,
+			nil,
+			`<testsuites>
+<testsuite name="example.com/m/internal/storage" errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+</testsuite>
+<testsuite name="example.com/m/auth" errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+` + props + `</testsuite>
+</testsuites>`,
+		},
+		{
+			"error",
+			"=== RUN   TestOK\n--- PASS: TestOK (0.00s)\n=== RUN   TestHang\n",
+			nil,
+			`<testsuites>
+<testsuite name="" errors="1" failures="0" skipped="0" tests="2" time="0" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestHang" classname="" time="0">
+<error message="no result recorded">
+</error>
+</testcase>
+</testsuite>
+</testsuites>`,
+		},
+		{
+			"nested",
+			goldenLog,
+			[]string{"-nested"},
+			`<testsuites>
+<testsuite name="example.com/m" errors="0" failures="1" skipped="1" tests="4" time="0.07">
+<testsuite name="internal" errors="0" failures="1" skipped="1" tests="3" time="0.05">
+<testsuite name="storage" errors="0" failures="1" skipped="1" tests="3" time="0.05" timestamp="TIMESTAMP">
+` + props + `<testcase name="TestQuery" classname="example.com/m/internal/storage" time="0.02">
+<failure message="got 2, want 1">    query_test.go:12: got 2, want 1&#xA;</failure>
+</testcase>
+</testsuite>
+</testsuite>
+<testsuite name="auth" errors="0" failures="0" skipped="0" tests="1" time="0.02" timestamp="TIMESTAMP">
+` + props + `</testsuite>
+</testsuite>
+</testsuites>`,
+		},
+		{
+			// Only JUnit XML reports leave tests out.
+			"csv",
+			goldenLog,
+			[]string{"-format", "csv"},
+			"package,test,status,duration,file,line,message\n" +
+				"example.com/m/internal/storage,TestSmokeLogin,success,0.01,,,\n" +
+				"example.com/m/internal/storage,TestQuery,failure,0.02,query_test.go,12,\"got 2, want 1\"\n" +
+				"example.com/m/internal/storage,TestSlowScan,skipped,0,scan_test.go,5,needs a database\n" +
+				"example.com/m/auth,TestToken,success,0.01,,,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkGolden(t, tt.input, exitOK, tt.want, append([]string{"-failures-only"}, tt.args...)...)
+		})
+	}
+}
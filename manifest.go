@@ -0,0 +1,146 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// A Manifest describes a conversion: what was read, what came of it and
+// what was written, with the hashes of the files, so that the pipelines
+// consuming the reports can check where they came from and that they are
+// intact.
+type Manifest struct {
+	Generator string            `json:"generator"`
+	Created   time.Time         `json:"created"`
+	Args      []string          `json:"args"`
+	Inputs    []ManifestFile    `json:"inputs"`
+	Counts    Counts            `json:"counts"`
+	Suites    int               `json:"suites"`
+	Run       *ManifestRun      `json:"run,omitempty"`
+	Warnings  []ManifestWarning `json:"warnings,omitempty"`
+	Outputs   []ManifestFile    `json:"outputs"`
+}
+
+// A ManifestFile is a file read or written by a conversion. Standard input
+// and output are named "-". The size and hash are only recorded for regular
+// files.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// A ManifestRun holds the times, in seconds, of a run of gojunit run: its
+// wall-clock time, and the summed build, wall-clock and CPU times of its
+// packages.
+type ManifestRun struct {
+	Wall      float64 `json:"wall_time"`
+	Build     float64 `json:"build_time"`
+	TestsWall float64 `json:"tests_wall_time"`
+	TestsCPU  float64 `json:"tests_cpu_time"`
+}
+
+// NewManifestRun returns the ManifestRun of a run of the given wall-clock
+// time to suites.
+func NewManifestRun(wall time.Duration, suites []TestSuite) *ManifestRun {
+	r := &ManifestRun{Wall: wall.Round(time.Millisecond).Seconds()}
+	for i := range suites {
+		s := &suites[i]
+		r.Build += floatProperty(s, "build_time")
+		r.TestsWall += floatProperty(s, "wall_time")
+		r.TestsCPU += floatProperty(s, "cpu_time")
+	}
+	r.Build, r.TestsWall, r.TestsCPU = roundMillis(r.Build), roundMillis(r.TestsWall), roundMillis(r.TestsCPU)
+	return r
+}
+
+// floatProperty returns the named property of s as a number, or 0.
+func floatProperty(s *TestSuite, name string) float64 {
+	f, _ := strconv.ParseFloat(s.Property(name), 64)
+	return f
+}
+
+func roundMillis(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
+
+// A ManifestWarning is a ParseWarning as recorded in a manifest.
+type ManifestWarning struct {
+	Input  string `json:"input,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+	Text   string `json:"text,omitempty"`
+}
+
+// NewManifest returns the manifest of the conversion of the named inputs,
+// in the given format, to suites.
+func NewManifest(inputs []string, format string, suites []TestSuite, warnings []ParseWarning) *Manifest {
+	m := &Manifest{
+		Generator: "gojunit v" + Version,
+		Created:   time.Now().UTC(),
+		Args:      os.Args[1:],
+		Suites:    len(suites),
+		Inputs:    []ManifestFile{},
+		Outputs:   []ManifestFile{},
+	}
+	for _, name := range inputs {
+		m.Inputs = append(m.Inputs, manifestFile(name, format))
+	}
+	for i := range suites {
+		m.Counts.Add(&suites[i])
+	}
+	for _, w := range warnings {
+		m.Warnings = append(m.Warnings, ManifestWarning{w.Input, w.Line, w.Reason, w.Text})
+	}
+	return m
+}
+
+// AddOutput records that a report in the given format was written to the
+// named file, or to standard output if name is empty.
+func (m *Manifest) AddOutput(name, format string) {
+	m.Outputs = append(m.Outputs, manifestFile(name, format))
+}
+
+// Write writes m to the named file as indented JSON.
+func (m *Manifest) Write(name string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(b, '\n'), 0666)
+}
+
+// manifestFile describes the named file, hashing it if it is a regular file.
+func manifestFile(name, format string) ManifestFile {
+	if name == "" || name == "-" {
+		return ManifestFile{Path: "-", Format: format}
+	}
+	f := ManifestFile{Path: name, Format: format}
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return f
+	}
+	r, err := os.Open(name)
+	if err != nil {
+		return f
+	}
+	defer r.Close()
+	h := sha256.New()
+	if f.Size, err = io.Copy(h, r); err != nil {
+		f.Size = 0
+		return f
+	}
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return f
+}
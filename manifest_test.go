@@ -0,0 +1,38 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewManifest(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(name, []byte("PASS\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	suites := []TestSuite{{Name: "p", TestCases: []TestCase{{Name: "TestOK"}, {Name: "TestBad", Status: Failure}}}}
+	m := NewManifest([]string{name, "-"}, "text", suites, nil)
+	if want := "gojunit v" + Version; m.Generator != want {
+		t.Errorf("generator %q, want %q", m.Generator, want)
+	}
+	if m.Suites != 1 || m.Counts.Tests != 2 || m.Counts.Failures != 1 {
+		t.Errorf("suites %d, counts %+v; want 1 suite, 2 tests, 1 failure", m.Suites, m.Counts)
+	}
+	want := []ManifestFile{
+		{Path: name, Format: "text", Size: 5, SHA256: "c26de83abdc9496cd1301470918ec39ecca1cf389ef0ae1c6504da1800d1c431"},
+		{Path: "-", Format: "text"},
+	}
+	if len(m.Inputs) != len(want) {
+		t.Fatalf("inputs %+v, want %+v", m.Inputs, want)
+	}
+	for i := range want {
+		if m.Inputs[i] != want[i] {
+			t.Errorf("input %d: %+v, want %+v", i, m.Inputs[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteMarkdown writes a slice of TestSuites to a writer as a Markdown
+// document, such as a pull request comment or a CI job summary: a table of
+// the suites followed by the details of each failed test, and the commands
+// running the failed tests again.
+func WriteMarkdown(suites []TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var total Counts
+	for i := range suites {
+		total.Add(&suites[i])
+	}
+	fmt.Fprintf(bw, "## Test results\n\n%s\n\n", total)
+	fmt.Fprintln(bw, "| Package | Tests | Failed | Errors | Skipped | Time |")
+	fmt.Fprintln(bw, "| --- | ---: | ---: | ---: | ---: | ---: |")
+	for i := range suites {
+		s := &suites[i]
+		var c Counts
+		c.Add(s)
+		mark := "✅"
+		if c.Failures+c.Errors > 0 {
+			mark = "❌"
+		}
+		fmt.Fprintf(bw, "| %s %s | %d | %d | %d | %d | %v |\n", mark, markdownEscape(suiteKey(s)),
+			c.Tests, c.Failures, c.Errors, c.Skipped, s.Duration.Round(time.Millisecond))
+	}
+	wroteHeader := false
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			if !wroteHeader {
+				fmt.Fprint(bw, "\n### Failures\n")
+				wroteHeader = true
+			}
+			// The summary is HTML rather than Markdown.
+			fmt.Fprintf(bw, "\n<details>\n<summary>%s %s: %s", statusLabel(t.Status),
+				html.EscapeString(suiteKey(s)+"/"+t.Name), html.EscapeString(messageOf(t)))
+			if issue := t.Property("issue"); issue != "" {
+				if url := t.Property("issue_url"); url != "" {
+					fmt.Fprintf(bw, " (<a href=\"%s\">%s</a>)", html.EscapeString(url), html.EscapeString(issue))
+				} else {
+					fmt.Fprintf(bw, " (%s)", html.EscapeString(issue))
+				}
+			}
+			fmt.Fprintf(bw, "</summary>\n\n```\n%s```\n</details>\n", strings.ReplaceAll(SymbolicateStacks(s, failureBody(t)), "```", "` ` `"))
+		}
+	}
+	if cmds := RerunCommands(suites); len(cmds) > 0 {
+		fmt.Fprint(bw, "\n### Reproduce\n\n```sh\n")
+		for _, c := range cmds {
+			fmt.Fprintln(bw, c)
+		}
+		fmt.Fprintln(bw, "```")
+	}
+	return bw.Flush()
+}
+
+// markdownEscape escapes the characters of text that Markdown, and the HTML
+// allowed in it, would interpret.
+func markdownEscape(text string) string {
+	return strings.NewReplacer(
+		"&", "&amp;", "<", "&lt;", ">", "&gt;", "|", "\\|",
+		"*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]",
+	).Replace(text)
+}
@@ -0,0 +1,96 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MergeSuites resolves the suites sharing a name, as when the same package
+// is read from the inputs of several matrix entries. With mode "matrix" they
+// are kept apart, named after their label, or numbered if they have none.
+// With mode "union" they are merged into one suite holding the union of
+// their tests, keeping a test that ran in several of them with its most
+// severe result, and the summed duration, earliest timestamp and shared
+// properties of the suites.
+func MergeSuites(suites []TestSuite, mode string) ([]TestSuite, error) {
+	switch mode {
+	case "matrix":
+		return matrixSuites(suites), nil
+	case "union":
+		return unionSuites(suites), nil
+	}
+	return nil, fmt.Errorf("unknown -merge-suites mode %q", mode)
+}
+
+func matrixSuites(suites []TestSuite) []TestSuite {
+	count := make(map[string]int)
+	for i := range suites {
+		count[suites[i].Name]++
+	}
+	seen := make(map[string]int)
+	for i := range suites {
+		s := &suites[i]
+		if count[s.Name] < 2 {
+			continue
+		}
+		seen[s.Name]++
+		if s.Property("label") == "" {
+			s.SetProperty("label", strconv.Itoa(seen[s.Name]))
+		}
+		s.Name = suiteKey(s)
+	}
+	return suites
+}
+
+func unionSuites(suites []TestSuite) []TestSuite {
+	index := make(map[string]int)
+	var merged []TestSuite
+	tests := make(map[[2]string]int) // by suite and test name
+	for i := range suites {
+		s := &suites[i]
+		j, ok := index[s.Name]
+		if !ok {
+			j = len(merged)
+			index[s.Name] = j
+			props := append([]Property(nil), s.Properties...)
+			merged = append(merged, TestSuite{Name: s.Name, Timestamp: s.Timestamp, Properties: props})
+		}
+		m := &merged[j]
+		m.Properties = sharedProperties(m.Properties, s)
+		m.Duration += s.Duration
+		m.Output.Write(s.Output.Bytes())
+		if !s.Timestamp.IsZero() && (m.Timestamp.IsZero() || s.Timestamp.Before(m.Timestamp)) {
+			m.Timestamp = s.Timestamp
+		}
+		for _, t := range s.TestCases {
+			key := [2]string{s.Name, t.Name}
+			k, ok := tests[key]
+			if !ok {
+				tests[key] = len(m.TestCases)
+				m.TestCases = append(m.TestCases, t)
+			} else if severity(t.Status) > severity(m.TestCases[k].Status) {
+				m.TestCases[k] = t
+			}
+		}
+	}
+	return merged
+}
+
+// severity orders the results of a test run several times: one that ran
+// beats one that was skipped, and one that failed or did not finish beats
+// one that passed.
+func severity(s Status) int {
+	switch s {
+	case Skipped:
+		return 0
+	case Success:
+		return 1
+	case Failure:
+		return 2
+	}
+	return 3
+}
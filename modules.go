@@ -0,0 +1,264 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FindModules returns the module paths of the Go modules under dir. If dir
+// or one of its parents contains a go.work file, the modules it uses are
+// returned. Otherwise dir is searched recursively for go.mod files, falling
+// back to the nearest go.mod in a parent directory.
+func FindModules(dir string) ([]string, error) {
+	mods, err := findModules(dir)
+	var paths []string
+	for _, m := range mods {
+		paths = append(paths, m.Path)
+	}
+	return paths, err
+}
+
+// A moduleDir is a module found by findModules.
+type moduleDir struct {
+	Path string // module path
+	Dir  string // absolute directory
+}
+
+// findModules is like FindModules, but also returns the directories of the
+// modules.
+func findModules(dir string) ([]moduleDir, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if work := findUp(dir, "go.work"); work != "" {
+		return workModules(work)
+	}
+	var mods []moduleDir
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == "go.mod" {
+			if m := modulePath(path); m != "" {
+				mods = append(mods, moduleDir{m, filepath.Dir(path)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(mods) == 0 {
+		if gomod := findUp(dir, "go.mod"); gomod != "" {
+			if m := modulePath(gomod); m != "" {
+				mods = append(mods, moduleDir{m, filepath.Dir(gomod)})
+			}
+		}
+	}
+	return mods, nil
+}
+
+// findUp returns the path of the named file in dir or its closest parent
+// that contains it, or "" if there is none.
+func findUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// workModules returns the modules used by a go.work file.
+func workModules(work string) ([]moduleDir, error) {
+	f, err := os.Open(work)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var mods []moduleDir
+	inUse := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := stripComment(s.Text())
+		var dir string
+		switch {
+		case inUse && line == ")":
+			inUse = false
+		case inUse:
+			dir = line
+		case line == "use (":
+			inUse = true
+		case strings.HasPrefix(line, "use "):
+			dir = strings.TrimSpace(strings.TrimPrefix(line, "use"))
+		}
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Join(filepath.Dir(work), strings.Trim(dir, `"`))
+		if m := modulePath(filepath.Join(dir, "go.mod")); m != "" {
+			mods = append(mods, moduleDir{m, dir})
+		}
+	}
+	return mods, s.Err()
+}
+
+// modulePath returns the module path declared in a go.mod file, or "" if it
+// cannot be read.
+func modulePath(gomod string) string {
+	f, err := os.Open(gomod)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := stripComment(s.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.Trim(strings.TrimSpace(line[len("module "):]), `"`)
+		}
+	}
+	return ""
+}
+
+func stripComment(line string) string {
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimSpace(line)
+}
+
+// moduleOf returns the longest module path in mods that contains pkg.
+func moduleOf(pkg string, mods []string) string {
+	var best string
+	for _, m := range mods {
+		if (pkg == m || strings.HasPrefix(pkg, m+"/")) && len(m) > len(best) {
+			best = m
+		}
+	}
+	return best
+}
+
+// ImportPath returns the import path of the package in dir, derived from
+// the go.mod file of the module containing it, or "" if dir is not in a
+// module.
+func ImportPath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	gomod := findUp(dir, "go.mod")
+	if gomod == "" {
+		return ""
+	}
+	mod := modulePath(gomod)
+	rel, err := filepath.Rel(filepath.Dir(gomod), dir)
+	if mod == "" || err != nil {
+		return ""
+	}
+	if rel == "." {
+		return mod
+	}
+	return mod + "/" + filepath.ToSlash(rel)
+}
+
+// isLocalPackage reports whether pkg is a directory rather than an import
+// path: a relative path such as "." or "./foo", or the "_/abs/dir" name go
+// test gives to directories outside a module.
+func isLocalPackage(pkg string) bool {
+	return pkg == "." || pkg == ".." || strings.HasPrefix(pkg, "./") ||
+		strings.HasPrefix(pkg, "../") || strings.HasPrefix(pkg, "_/") || filepath.IsAbs(pkg)
+}
+
+// ResolvePackages replaces the names of suites that are directories rather
+// than import paths with the import paths of the packages in them. Relative
+// directories are resolved against dir. Names that cannot be resolved are
+// left unchanged.
+func ResolvePackages(suites []TestSuite, dir string) {
+	for i := range suites {
+		name := suites[i].Name
+		if !isLocalPackage(name) {
+			continue
+		}
+		path := strings.TrimSuffix(strings.TrimPrefix(name, "_"), "/...")
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if pkg := ImportPath(path); pkg != "" {
+			suites[i].Name = pkg
+		}
+	}
+}
+
+// GroupByModule sets the "module" property of each suite to the module
+// containing it and sorts the suites so that suites of the same module are
+// adjacent. The relative order of suites within a module is preserved.
+func GroupByModule(suites []TestSuite, mods []string) {
+	for i := range suites {
+		if m := moduleOf(suites[i].Name, mods); m != "" {
+			suites[i].SetProperty("module", m)
+		}
+	}
+	sort.SliceStable(suites, func(i, j int) bool {
+		return suites[i].Property("module") < suites[j].Property("module")
+	})
+}
+
+// writeModuleReports writes one report per module into dir, naming each file
+// after its module with the extension ext, and returns the names of the
+// files. Suites that do not belong to a known module are written to
+// nomodule+ext.
+func writeModuleReports(dir, ext string, suites []TestSuite, write func([]TestSuite, io.Writer) error) ([]string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	var names []string
+	for len(suites) > 0 {
+		mod := suites[0].Property("module")
+		n := 1
+		for n < len(suites) && suites[n].Property("module") == mod {
+			n++
+		}
+		name := "nomodule"
+		if mod != "" {
+			name = strings.NewReplacer("/", "_", ".", "_").Replace(mod)
+		}
+		name = filepath.Join(dir, name+ext)
+		f, err := os.Create(name)
+		if err != nil {
+			return names, err
+		}
+		err = write(suites[:n], f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+		suites = suites[n:]
+	}
+	return names, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// NameData holds the fields available to name and classname templates.
+type NameData struct {
+	Package string // name of the suite, usually the package import path
+	Name    string // full test name as printed by go test, e.g. TestFoo/bar
+	Test    string // top-level test name, e.g. TestFoo
+	Subtest string // subtest path without the top-level test, e.g. bar
+}
+
+func newNameData(pkg, name string) NameData {
+	d := NameData{Package: pkg, Name: name, Test: name}
+	if i := strings.Index(name, "/"); i >= 0 {
+		d.Test, d.Subtest = name[:i], name[i+1:]
+	}
+	return d
+}
+
+// RenameTests renders the name and classname of every test case using the
+// given templates. A nil template leaves the corresponding field unchanged.
+func RenameTests(suites []TestSuite, name, classname *template.Template) error {
+	var buf bytes.Buffer
+	render := func(t *template.Template, d NameData) (string, error) {
+		buf.Reset()
+		if err := t.Execute(&buf, d); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			tc := &suites[i].TestCases[j]
+			d := newNameData(suites[i].Name, tc.Name)
+			var err error
+			if classname != nil {
+				if tc.Classname, err = render(classname, d); err != nil {
+					return err
+				}
+			}
+			if name != nil {
+				if tc.Name, err = render(name, d); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// JavaClassname maps a Go import path to a Java-style dotted name by dropping
+// a leading host name and joining the remaining path elements with dots, so
+// that github.com/org/repo/pkg becomes org.repo.pkg. Dots and dashes within
+// path elements are replaced with underscores to keep the elements distinct.
+func JavaClassname(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	if len(elems) > 1 && strings.Contains(elems[0], ".") {
+		elems = elems[1:]
+	}
+	r := strings.NewReplacer(".", "_", "-", "_")
+	for i, e := range elems {
+		elems[i] = r.Replace(e)
+	}
+	return strings.Join(elems, ".")
+}
+
+// MapClassnames replaces the classname of every test case with the result of
+// applying f to it.
+func MapClassnames(suites []TestSuite, f func(string) string) {
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			tc := &suites[i].TestCases[j]
+			tc.Classname = f(classnameOf(&suites[i], tc))
+		}
+	}
+}
+
+// DisambiguateNames renames the test cases of each suite that have the
+// classname and name of an earlier one, which JUnit consumers take for the
+// same test and drop, by appending #01, #02 and so on to their names, as go
+// test does to subtests of the same name, and returns a warning about each.
+// Names are compared as written in XML, with invalid UTF-8 replaced. The runs
+// of a test repeated with -count are numbered too.
+func DisambiguateNames(suites []TestSuite) []ParseWarning {
+	var warnings []ParseWarning
+	for i := range suites {
+		s := &suites[i]
+		key := func(tc *TestCase, name string) string {
+			return classnameOf(s, tc) + "\x00" + strings.ToValidUTF8(name, "\uFFFD")
+		}
+		taken := make(map[string]int, len(s.TestCases))
+		for j := range s.TestCases {
+			taken[key(&s.TestCases[j], s.TestCases[j].Name)]++
+		}
+		seen := make(map[string]bool, len(s.TestCases))
+		for j := range s.TestCases {
+			tc := &s.TestCases[j]
+			k := key(tc, tc.Name)
+			if !seen[k] {
+				seen[k] = true
+				continue
+			}
+			name := tc.Name
+			for n := 1; ; n++ {
+				name = fmt.Sprintf("%s#%02d", tc.Name, n)
+				if k := key(tc, name); taken[k] == 0 {
+					taken[k]++
+					seen[k] = true
+					break
+				}
+			}
+			warnings = append(warnings, ParseWarning{
+				Input:  suiteKey(s),
+				Reason: fmt.Sprintf("duplicate test name %q renamed %q", tc.Name, name),
+			})
+			tc.Name = name
+		}
+	}
+	return warnings
+}
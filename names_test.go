@@ -0,0 +1,67 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDisambiguateNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests []TestCase
+		want  string // the names after, separated by spaces
+		warns int
+	}{
+		{"unique", []TestCase{{Name: "TestA"}, {Name: "TestB"}}, "TestA TestB", 0},
+		{"count", []TestCase{{Name: "TestA"}, {Name: "TestA"}, {Name: "TestA"}}, "TestA TestA#01 TestA#02", 2},
+		// A name taken by another test is skipped.
+		{"taken", []TestCase{{Name: "TestA"}, {Name: "TestA"}, {Name: "TestA#01"}}, "TestA TestA#02 TestA#01", 1},
+		{"classnames", []TestCase{{Name: "TestA", Classname: "x"}, {Name: "TestA", Classname: "y"}}, "TestA TestA", 0},
+		// The classname defaults to the name of the suite.
+		{"default classname", []TestCase{{Name: "TestA"}, {Name: "TestA", Classname: "x/m"}}, "TestA TestA#01", 1},
+		{"subtests", []TestCase{{Name: "TestA/x"}, {Name: "TestA/x"}, {Name: "TestA/x#01"}}, "TestA/x TestA/x#02 TestA/x#01", 1},
+		// Names differing only in invalid UTF-8 are written alike.
+		{"invalid utf-8", []TestCase{{Name: "TestA\xff"}, {Name: "TestA\xfe"}}, "TestA\xff TestA\xfe#01", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites := []TestSuite{
+				{Name: "x/m", TestCases: tt.tests},
+				// The tests of another suite are not compared.
+				{Name: "x/n", TestCases: []TestCase{{Name: "TestA"}}},
+			}
+			warnings := DisambiguateNames(suites)
+			var got []string
+			for _, tc := range suites[0].TestCases {
+				got = append(got, tc.Name)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("names %q, want %q", strings.Join(got, " "), tt.want)
+			}
+			if suites[1].TestCases[0].Name != "TestA" {
+				t.Errorf("test of another suite renamed %q", suites[1].TestCases[0].Name)
+			}
+			if len(warnings) != tt.warns {
+				t.Errorf("%d warnings %v, want %d", len(warnings), warnings, tt.warns)
+			}
+		})
+	}
+}
+
+func TestDisambiguateNamesWarnings(t *testing.T) {
+	suites := []TestSuite{{
+		Name:       "x/m",
+		Properties: []Property{{Name: "label", Value: "linux"}},
+		TestCases:  []TestCase{{Name: "TestA"}, {Name: "TestA"}},
+	}}
+	warnings := DisambiguateNames(suites)
+	want := []ParseWarning{{Input: "x/m [linux]", Reason: `duplicate test name "TestA" renamed "TestA#01"`}}
+	if fmt.Sprint(warnings) != fmt.Sprint(want) {
+		t.Errorf("warnings %v, want %v", warnings, want)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// WriteNestedXML writes a slice of TestSuites to a writer in XML format,
+// nesting the suites to mirror the package directory tree. The outermost
+// suite is named after the longest directory prefix shared by all suites and
+// each nested suite after a single path element. Counts and times of a suite
+// include those of the suites nested within it.
+func WriteNestedXML(suites []TestSuite, w io.Writer) error {
+	suitesXML := suitesToXML(suites)
+	suitesXML.TestSuites = nestSuites(suitesXML.TestSuites)
+	return encodeXML(w, suitesXML)
+}
+
+func nestSuites(flat []TestSuiteXML) []TestSuiteXML {
+	if len(flat) == 0 {
+		return flat
+	}
+	names := make([]string, len(flat))
+	for i, s := range flat {
+		names[i] = s.Name
+	}
+	prefix := commonDir(names)
+	root := TestSuiteXML{Name: prefix}
+	for _, s := range flat {
+		rel := strings.Trim(strings.TrimPrefix(s.Name, prefix), "/")
+		var path []string
+		if rel != "" {
+			path = strings.Split(rel, "/")
+		}
+		insertSuite(&root, path, s)
+	}
+	sumSuite(&root)
+	if prefix == "" {
+		return root.TestSuites
+	}
+	return []TestSuiteXML{root}
+}
+
+// insertSuite places s at the given path below n, creating intermediate
+// suites as needed.
+func insertSuite(n *TestSuiteXML, path []string, s TestSuiteXML) {
+	if len(path) == 0 {
+		name, children := n.Name, n.TestSuites
+		*n = s
+		n.Name, n.TestSuites = name, children
+		return
+	}
+	for i := range n.TestSuites {
+		if n.TestSuites[i].Name == path[0] {
+			insertSuite(&n.TestSuites[i], path[1:], s)
+			return
+		}
+	}
+	n.TestSuites = append(n.TestSuites, TestSuiteXML{Name: path[0]})
+	insertSuite(&n.TestSuites[len(n.TestSuites)-1], path[1:], s)
+}
+
+// sumSuite adds the counts and times of nested suites to their parents.
+func sumSuite(n *TestSuiteXML) {
+	for i := range n.TestSuites {
+		c := &n.TestSuites[i]
+		sumSuite(c)
+		n.Errors += c.Errors
+		n.Failures += c.Failures
+		n.Skipped += c.Skipped
+		n.Tests += c.Tests
+		n.Time += c.Time
+	}
+}
+
+// commonDir returns the longest slash-separated prefix shared by all names
+// that is not itself one of the names, so that every name keeps at least its
+// last path element.
+func commonDir(names []string) string {
+	prefix := strings.Split(names[0], "/")
+	for _, name := range names {
+		elems := strings.Split(name, "/")
+		if len(elems)-1 < len(prefix) {
+			prefix = prefix[:len(elems)-1]
+		}
+		for i := range prefix {
+			if prefix[i] != elems[i] {
+				prefix = prefix[:i]
+				break
+			}
+		}
+	}
+	return strings.Join(prefix, "/")
+}
@@ -0,0 +1,181 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// digestSnippetLines is the number of lines of output shown for each failed
+// test in a failure digest.
+const digestSnippetLines = 20
+
+// WriteFailureDigest writes a plain text digest of the failures in suites
+// to w: the counts of the run, then every failed test with its message and
+// the last lines of its output.
+func WriteFailureDigest(suites []TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var total Counts
+	for i := range suites {
+		total.Add(&suites[i])
+	}
+	fmt.Fprintf(bw, "%s in %d packages.\n", total, len(suites))
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			fmt.Fprintf(bw, "\n%s %s: %s\n", strings.ToUpper(t.Status.String()), suiteKey(s), t.Name)
+			if msg := messageOf(t); msg != "" {
+				fmt.Fprintf(bw, "    %s\n", msg)
+			}
+			if issue := t.Property("issue"); issue != "" {
+				fmt.Fprintf(bw, "    Known issue: %s\n", firstNonEmpty(t.Property("issue_url"), issue))
+			}
+			for _, line := range lastLines(t.Output.String(), digestSnippetLines) {
+				fmt.Fprintf(bw, "    | %s\n", line)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// lastLines returns the last n lines of s, without trailing empty lines.
+func lastLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// An emailConfig holds the SMTP settings of gojunit notify.
+type emailConfig struct {
+	Server   string // host:port; port 465 uses implicit TLS
+	User     string
+	Password string
+	From     string
+	To       []string
+}
+
+// digestSubject returns the subject of the digest email of suites.
+func digestSubject(suites []TestSuite) string {
+	var c Counts
+	for i := range suites {
+		c.Add(&suites[i])
+	}
+	subject := "gojunit: "
+	if *label != "" {
+		subject += *label + ": "
+	}
+	if n := c.Failures + c.Errors; n > 0 {
+		return subject + fmt.Sprintf("%d of %d tests failed", n, c.Tests)
+	}
+	return subject + fmt.Sprintf("all %d tests passed", c.Tests)
+}
+
+// SendDigest emails the failure digest of suites.
+func SendDigest(cfg emailConfig, suites []TestSuite) error {
+	var body bytes.Buffer
+	if err := WriteFailureDigest(suites, &body); err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", digestSubject(suites)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+	qp.Close()
+	return sendMail(cfg, msg.Bytes())
+}
+
+// sendMail sends msg with the SMTP server of cfg. Connections to port 465
+// use implicit TLS; others are upgraded with STARTTLS when the server offers
+// it.
+func sendMail(cfg emailConfig, msg []byte) error {
+	host, port, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("smtp server %s: %v", cfg.Server, err)
+	}
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, host)
+	}
+	if port != "465" {
+		return smtp.SendMail(cfg.Server, auth, cfg.From, cfg.To, msg)
+	}
+	conn, err := tls.Dial("tcp", cfg.Server, &tls.Config{ServerName: host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// defaultEmailFrom returns the sender of digests when none is configured.
+func defaultEmailFrom() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return "gojunit@" + host
+}
@@ -0,0 +1,179 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// An smtpSession is what a client sent to a fakeSMTP server.
+type smtpSession struct {
+	auth string // the decoded AUTH PLAIN credentials
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP serves one SMTP session on a local port offering AUTH PLAIN and
+// no STARTTLS, returning its address and the session, sent once the client
+// quits.
+func fakeSMTP(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	done := make(chan smtpSession, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var s smtpSession
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case "AUTH":
+				b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+				s.auth = string(b)
+				reply("235 ok")
+			case "MAIL":
+				s.from = arg
+				reply("250 ok")
+			case "RCPT":
+				s.to = append(s.to, arg)
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(line, "."))
+				}
+				s.data = data.String()
+				reply("250 ok")
+			case "QUIT":
+				reply("221 bye")
+				done <- s
+				return
+			default:
+				reply("502 unknown command")
+			}
+		}
+	}()
+	return l.Addr().String(), done
+}
+
+// notifySuites are the suites of the tests of notifications.
+func notifySuites() []TestSuite {
+	failed := TestCase{Name: "TestB", Status: Failure, Message: "got 2, want 1"}
+	failed.Output.WriteString("b_test.go:9: got 2, want 1\n")
+	return []TestSuite{
+		{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}, failed, {Name: "TestC", Status: Skipped}}},
+		{Name: "x/n", TestCases: []TestCase{{
+			Name: "TestD", Status: Error,
+			Properties: []Property{{Name: "issue", Value: "BUG-1"}, {Name: "issue_url", Value: "https://bugs.example.com/BUG-1"}},
+		}}},
+	}
+}
+
+const notifyDigest = `4 tests, 1 failed, 1 errors, 1 skipped in 2 packages.
+
+FAILURE x/m: TestB
+    got 2, want 1
+    | b_test.go:9: got 2, want 1
+
+ERROR x/n: TestD
+    Known issue: https://bugs.example.com/BUG-1
+`
+
+func TestSendDigest(t *testing.T) {
+	defer func(v string) { *label = v }(*label)
+	*label = "linux"
+	addr, sessions := fakeSMTP(t)
+	cfg := emailConfig{
+		Server:   addr,
+		User:     "ci",
+		Password: "secret",
+		From:     "gojunit@ci.example.com",
+		To:       []string{"a@example.com", "b@example.com"},
+	}
+	if err := SendDigest(cfg, notifySuites()); err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+	if s.auth != "\x00ci\x00secret" {
+		t.Errorf("AUTH PLAIN %q, want ci and secret", s.auth)
+	}
+	if s.from != "FROM:<gojunit@ci.example.com>" {
+		t.Errorf("MAIL %s, want FROM:<gojunit@ci.example.com>", s.from)
+	}
+	if got := strings.Join(s.to, " "); got != "TO:<a@example.com> TO:<b@example.com>" {
+		t.Errorf("RCPT %s, want a@example.com and b@example.com", got)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(s.data))
+	if err != nil {
+		t.Fatalf("message %q: %v", s.data, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "gojunit: linux: 2 of 4 tests failed" {
+		t.Errorf("Subject %q, %v, want gojunit: linux: 2 of 4 tests failed", subject, err)
+	}
+	if got := msg.Header.Get("To"); got != "a@example.com, b@example.com" {
+		t.Errorf("To %q, want a@example.com, b@example.com", got)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if got := msg.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+		t.Fatalf("Content-Transfer-Encoding %q, want quoted-printable", got)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))); got != notifyDigest {
+		t.Errorf("body\n%s\nwant\n%s", got, notifyDigest)
+	}
+}
+
+func TestDigestSubject(t *testing.T) {
+	defer func(v string) { *label = v }(*label)
+	*label = ""
+	if got, want := digestSubject(notifySuites()[:1]), "gojunit: 1 of 3 tests failed"; got != want {
+		t.Errorf("digestSubject = %q, want %q", got, want)
+	}
+	if got, want := digestSubject([]TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}}), "gojunit: all 1 tests passed"; got != want {
+		t.Errorf("digestSubject = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// An OutputRule filters the lines of the output of tests.
+type OutputRule struct {
+	Action   string         // drop, keep, head or tail
+	Pattern  *regexp.Regexp // lines dropped or kept
+	N        int            // lines kept by head and tail
+	Statuses []Status       // of the tests filtered, or all of them if empty
+}
+
+// ReadOutputRules reads an output filter file. Each line holds an action,
+// its argument and an optional comma separated list of the statuses of the
+// tests it applies to, as in
+//
+//	drop ^DEBUG
+//	keep level=(warn|error)  success
+//	tail 200                 success,skipped
+//
+// drop removes the lines matching a regular expression and keep removes the
+// other ones; head and tail keep the first or last lines of the output. The
+// rules are applied in order. Blank lines and lines starting with # are
+// ignored.
+func ReadOutputRules(path string) ([]OutputRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []OutputRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: want an action, its argument and optional statuses", path, n)
+		}
+		r := OutputRule{Action: fields[0]}
+		switch r.Action {
+		case "drop", "keep":
+			if r.Pattern, err = regexp.Compile(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+		case "head", "tail":
+			if r.N, err = strconv.Atoi(fields[1]); err != nil || r.N < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid line count %q", path, n, fields[1])
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown action %q", path, n, r.Action)
+		}
+		if len(fields) == 3 {
+			for _, name := range strings.Split(fields[2], ",") {
+				st, err := junit.ParseStatus(name)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+				}
+				r.Statuses = append(r.Statuses, st)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, s.Err()
+}
+
+// applies reports whether r filters the output of tests with status st.
+func (r *OutputRule) applies(st Status) bool {
+	if len(r.Statuses) == 0 {
+		return true
+	}
+	for _, s := range r.Statuses {
+		if s == st {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the lines left by r, with a line counting those cut by
+// head and tail.
+func (r *OutputRule) filter(lines []string) []string {
+	switch r.Action {
+	case "head":
+		if len(lines) > r.N {
+			return append(lines[:r.N:r.N], omitted(len(lines)-r.N))
+		}
+	case "tail":
+		if len(lines) > r.N {
+			return append([]string{omitted(len(lines) - r.N)}, lines[len(lines)-r.N:]...)
+		}
+	default:
+		var kept []string
+		for _, l := range lines {
+			if r.Pattern.MatchString(l) == (r.Action == "keep") {
+				kept = append(kept, l)
+			}
+		}
+		return kept
+	}
+	return lines
+}
+
+func omitted(n int) string {
+	return fmt.Sprintf("... %d lines omitted", n)
+}
+
+// FilterOutput applies the rules applying to each test to its output and
+// standard error.
+func FilterOutput(suites []TestSuite, rules []OutputRule) {
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			t := &suites[i].TestCases[j]
+			t.Output = filterLog(t.Output, t.Status, rules)
+			t.Stderr = filterLog(t.Stderr, t.Status, rules)
+		}
+	}
+}
+
+func filterLog(l Log, st Status, rules []OutputRule) Log {
+	if l.Len() == 0 {
+		return l
+	}
+	lines := strings.Split(strings.TrimSuffix(l.String(), "\n"), "\n")
+	changed := false
+	for i := range rules {
+		if r := &rules[i]; r.applies(st) {
+			lines = r.filter(lines)
+			changed = true
+		}
+	}
+	if !changed {
+		return l
+	}
+	var out Log
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+	return out
+}
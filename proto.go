@@ -0,0 +1,44 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+
+	"github.com/kisielk/gojunit/gojunitpb"
+)
+
+// WriteProto writes a slice of TestSuites to a writer as a binary
+// gojunit.Report message, as defined in gojunitpb/gojunit.proto.
+func WriteProto(suites []TestSuite, w io.Writer) error {
+	_, err := w.Write(toProto(suites).Marshal())
+	return err
+}
+
+func toProto(suites []TestSuite) *gojunitpb.Report {
+	r := &gojunitpb.Report{Generator: "gojunit v" + Version}
+	for i := range suites {
+		suite := &suites[i]
+		ps := &gojunitpb.TestSuite{Name: suite.Name, DurationSeconds: suite.Duration.Seconds()}
+		if !suite.Timestamp.IsZero() {
+			ps.TimestampUnixNano = suite.Timestamp.UnixNano()
+		}
+		for _, p := range suite.Properties {
+			ps.Properties = append(ps.Properties, &gojunitpb.Property{Name: p.Name, Value: p.Value})
+		}
+		for j := range suite.TestCases {
+			t := &suite.TestCases[j]
+			ps.TestCases = append(ps.TestCases, &gojunitpb.TestCase{
+				Name:            t.Name,
+				Classname:       classnameOf(suite, t),
+				Status:          gojunitpb.Status(t.Status),
+				DurationSeconds: t.Duration.Seconds(),
+				Output:          t.Output.String(),
+			})
+		}
+		r.Suites = append(r.Suites, ps)
+	}
+	return r
+}
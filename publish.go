@@ -0,0 +1,259 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Publisher sends the test cases of suites to a message broker as they
+// are collected.
+type Publisher interface {
+	// Publish sends a message for every test case of suite.
+	Publish(suite *TestSuite) error
+	// Close waits for the messages sent to be accepted by the broker.
+	Close() error
+}
+
+// A TestMessage is the message published for a test case: the fields of the
+// test case in the JSON report, and the suite it belongs to.
+type TestMessage struct {
+	Suite           string     `json:"suite"`
+	SuiteProperties []Property `json:"suite_properties,omitempty"`
+	jsonTest
+}
+
+// testMessages returns the messages of the test cases of suite.
+func testMessages(suite *TestSuite) []TestMessage {
+	js := toJSONSuites([]TestSuite{*suite})[0]
+	msgs := make([]TestMessage, len(js.TestCases))
+	for i, t := range js.TestCases {
+		msgs[i] = TestMessage{Suite: js.Name, SuiteProperties: js.Properties, jsonTest: t}
+	}
+	return msgs
+}
+
+// NewPublisher returns a publisher of the messages of test cases to the
+// broker at rawurl:
+//
+//	nats://[user:password@]host[:port]/subject   a NATS subject; tls:// for TLS
+//	kafka+http[s]://host[:port]/topic            a Kafka topic, through the
+//	                                             Confluent REST proxy
+func NewPublisher(rawurl string) (Publisher, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimPrefix(u.Path, "/")
+	if name == "" {
+		return nil, fmt.Errorf("%s: no subject or topic", rawurl)
+	}
+	switch u.Scheme {
+	case "nats", "tls":
+		return dialNATS(u, name)
+	case "kafka+http", "kafka+https":
+		return &kafkaPublisher{u: u, topic: name}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown broker %q", rawurl, u.Scheme)
+}
+
+// natsPublisher publishes messages with the NATS client protocol.
+type natsPublisher struct {
+	subject string
+	conn    net.Conn
+	mu      sync.Mutex // guards w
+	w       *bufio.Writer
+	pong    chan struct{}
+
+	errMu  sync.Mutex    // guards err
+	err    error         // the first -ERR of the server, or error reading from it
+	failed chan struct{} // closed when err is set
+}
+
+func dialNATS(u *url.URL, subject string) (*natsPublisher, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	info, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: %v", host, err)
+	}
+	if !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: unexpected greeting %q", host, strings.TrimSpace(info))
+	}
+	var server struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(info[len("INFO "):]), &server)
+	if u.Scheme == "tls" || server.TLSRequired {
+		tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats %s: %v", host, err)
+		}
+		conn, r = tc, bufio.NewReader(tc)
+	}
+	p := &natsPublisher{
+		subject: subject,
+		conn:    conn,
+		w:       bufio.NewWriter(conn),
+		pong:    make(chan struct{}, 1),
+		failed:  make(chan struct{}),
+	}
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "gojunit", "lang": "go", "version": Version}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	b, _ := json.Marshal(opts)
+	if err := p.send(func() { fmt.Fprintf(p.w, "CONNECT %s\r\n", b) }); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: %v", host, err)
+	}
+	go p.read(r)
+	return p, nil
+}
+
+// send calls write to write to the connection, and flushes it.
+func (p *natsPublisher) send(write func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	write()
+	return p.w.Flush()
+}
+
+// read answers the pings of the server and records its errors.
+func (p *natsPublisher) read(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			p.fail(err)
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			p.send(func() { p.w.WriteString("PONG\r\n") })
+		case line == "PONG":
+			select {
+			case p.pong <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			p.fail(errors.New("nats: " + strings.Trim(strings.TrimSpace(line[len("-ERR"):]), "'")))
+		}
+	}
+}
+
+// fail records err, unless an earlier error was recorded.
+func (p *natsPublisher) fail(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+		close(p.failed)
+	}
+}
+
+// error returns the error recorded by fail, if any.
+func (p *natsPublisher) error() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+func (p *natsPublisher) Publish(suite *TestSuite) error {
+	if err := p.error(); err != nil {
+		return err
+	}
+	var payloads [][]byte
+	for _, m := range testMessages(suite) {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		payloads = append(payloads, b)
+	}
+	return p.send(func() {
+		for _, b := range payloads {
+			fmt.Fprintf(p.w, "PUB %s %d\r\n", p.subject, len(b))
+			p.w.Write(b)
+			p.w.WriteString("\r\n")
+		}
+	})
+}
+
+// Close pings the server, whose pong means that it processed the messages
+// published before the ping.
+func (p *natsPublisher) Close() error {
+	defer p.conn.Close()
+	if err := p.send(func() { p.w.WriteString("PING\r\n") }); err != nil {
+		return err
+	}
+	select {
+	case <-p.pong:
+		return nil
+	case <-p.failed:
+		return p.error()
+	case <-time.After(30 * time.Second):
+		return errors.New("nats: no answer to ping")
+	}
+}
+
+// kafkaPublisher produces messages with the REST API of the Confluent REST
+// proxy, keyed by the ID of the test so that the runs of a test stay in
+// order in one partition.
+type kafkaPublisher struct {
+	u     *url.URL
+	topic string
+}
+
+func (p *kafkaPublisher) Publish(suite *TestSuite) error {
+	type record struct {
+		Key   string      `json:"key"`
+		Value TestMessage `json:"value"`
+	}
+	var body struct {
+		Records []record `json:"records"`
+	}
+	for i, m := range testMessages(suite) {
+		body.Records = append(body.Records, record{caseID(suite, &suite.TestCases[i]), m})
+	}
+	if len(body.Records) == 0 {
+		return nil
+	}
+	u := *p.u
+	u.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+	u.User = nil
+	u.Path = "/topics/" + url.PathEscape(p.topic)
+	header := http.Header{"Content-Type": {"application/vnd.kafka.json.v2+json"}, "Accept": {"application/vnd.kafka.v2+json"}}
+	if p.u.User != nil {
+		pass, _ := p.u.User.Password()
+		header.Set("Authorization", basicAuth(p.u.User.Username(), pass))
+	}
+	return doJSON("POST", u.String(), header, body, nil)
+}
+
+func (p *kafkaPublisher) Close() error { return nil }
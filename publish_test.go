@@ -0,0 +1,106 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNATSPublisherErrors(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {}\r\n"))
+		r := bufio.NewReader(conn)
+		r.ReadString('\n') // CONNECT
+		// Two errors, of which the first is kept, while nothing is
+		// published.
+		conn.Write([]byte("-ERR 'Authorization Violation'\r\n-ERR 'Stale Connection'\r\n"))
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}()
+	p, err := NewPublisher("nats://" + l.Addr().String() + "/tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := &TestSuite{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}
+	done := make(chan error)
+	go func() {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if err := p.Publish(suite); err != nil {
+				done <- err
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		done <- nil
+	}()
+	const want = "nats: Authorization Violation"
+	if err := <-done; err == nil || err.Error() != want {
+		t.Fatalf("Publish error %v, want %s", err, want)
+	}
+	// Publish keeps returning the error rather than blocking.
+	for i := 0; i < 3; i++ {
+		if err := p.Publish(suite); err == nil || err.Error() != want {
+			t.Fatalf("Publish error %v, want %s", err, want)
+		}
+	}
+	if err := p.Close(); err == nil || err.Error() != want {
+		t.Errorf("Close error %v, want %s", err, want)
+	}
+}
+
+func TestKafkaPublisherKeys(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Records []struct{ Key string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, rec := range body.Records {
+			keys = append(keys, rec.Key)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	p, err := NewPublisher("kafka+" + srv.URL + "/tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := &TestSuite{
+		Name:       "x/m [linux]",
+		Properties: []Property{{Name: "label", Value: "linux"}},
+		TestCases: []TestCase{
+			{Name: "TestA"},
+			{Name: "TestB", Properties: []Property{{Name: "id", Value: "custom"}}},
+		},
+	}
+	if err := p.Publish(suite); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{TestID("x/m", "TestA"), "custom"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("keys %q, want %q", keys, want)
+	}
+}
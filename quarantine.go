@@ -0,0 +1,189 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// quarantined is the message of quarantined tests that failed.
+const quarantined = "quarantined"
+
+// MarkQuarantined applies a quarantine list, read like a list of expected
+// failures, to suites. Tests on the list that failed or had an error are
+// marked as skipped, so that they do not fail the run, and get the
+// "quarantined" property. Unlike expected failures, quarantined tests, being
+// flaky, may also pass.
+func MarkQuarantined(suites []TestSuite, list []ExpectedFailure) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			for _, e := range list {
+				if !e.lists(s.Name, t.Name) {
+					continue
+				}
+				msg := quarantined
+				if e.Reason != "" {
+					msg += ": " + e.Reason
+				}
+				if m := messageOf(t); m != "" {
+					msg += " (" + m + ")"
+				}
+				t.Status, t.Message = Skipped, msg
+				t.SetProperty("quarantined", "true")
+				break
+			}
+		}
+	}
+}
+
+// FlakeStats are the results of a test over the runs of a store.
+type FlakeStats struct {
+	Suite, Test string
+	Runs        int // runs in which the test ran, rather than being skipped
+	Failures    int // runs in which it failed or had an error
+	LastFailure time.Time
+	LastRun     string // ID of the run of the last failure
+}
+
+// Rate returns the fraction of the runs of the test in which it failed.
+func (f FlakeStats) Rate() float64 {
+	if f.Runs == 0 {
+		return 0
+	}
+	return float64(f.Failures) / float64(f.Runs)
+}
+
+// Flaky reports whether the test both failed and passed. Tests that never
+// passed are broken rather than flaky.
+func (f FlakeStats) Flaky() bool {
+	return f.Failures > 0 && f.Failures < f.Runs
+}
+
+// flakeKey returns the key of the results of test in suite, which sets them
+// apart from those of every other suite and test.
+func flakeKey(suite, test string) string {
+	return suite + "\x00" + test
+}
+
+// CollectFlakeStats returns the results of each test over runs, listed most
+// recently created first, as a Store lists them, in the order of their
+// suites and tests.
+func CollectFlakeStats(runs []*Run) []FlakeStats {
+	var stats []FlakeStats
+	index := make(map[string]int)
+	for _, run := range runs {
+		// A test run several times in a run, as with -count, counts once, as
+		// failed if it failed any time. The tests of daily runs written by
+		// CompactRuns count as the runs they were compacted from.
+		type count struct{ runs, failures int }
+		counts := make(map[int]count)
+		for i := range run.Suites {
+			s := &run.Suites[i]
+			for j := range s.TestCases {
+				t := &s.TestCases[j]
+				n, failures, ok := compactedCounts(t)
+				if !ok {
+					if t.Status == Skipped {
+						continue
+					}
+					n, failures = 1, 0
+					if t.Status == Failure || t.Status == Error {
+						failures = 1
+					}
+				}
+				if n == 0 {
+					continue
+				}
+				key := flakeKey(s.Name, t.Name)
+				k, ok := index[key]
+				if !ok {
+					k = len(stats)
+					index[key] = k
+					stats = append(stats, FlakeStats{Suite: s.Name, Test: t.Name})
+				}
+				c := counts[k]
+				counts[k] = count{max(c.runs, n), max(c.failures, failures)}
+			}
+		}
+		for k, c := range counts {
+			f := &stats[k]
+			f.Runs += c.runs
+			f.Failures += c.failures
+			if c.failures > 0 && f.LastRun == "" {
+				f.LastFailure, f.LastRun = run.Created, run.ID
+			}
+		}
+	}
+	return stats
+}
+
+// SuggestQuarantine returns the flaky tests of stats that failed in at least
+// the given fraction of their runs, most flaky first.
+func SuggestQuarantine(stats []FlakeStats, rate float64) []FlakeStats {
+	var list []FlakeStats
+	for _, f := range stats {
+		if f.Flaky() && f.Rate() >= rate {
+			list = append(list, f)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Rate() > list[j].Rate() })
+	return list
+}
+
+// WriteQuarantine writes list as a quarantine list, which -quarantine reads,
+// with the flake rate and last failure of each test as its reason.
+func WriteQuarantine(list []FlakeStats, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range list {
+		fmt.Fprintf(bw, "^%s$ flaky: failed %d of %d runs (%.1f%%), last on %s in run %s\n",
+			regexp.QuoteMeta(f.Suite+"/"+f.Test), f.Failures, f.Runs, 100*f.Rate(),
+			f.LastFailure.UTC().Format(time.DateOnly), f.LastRun)
+	}
+	return bw.Flush()
+}
+
+// suggestQuarantineMain runs gojunit suggest-quarantine, which lists the
+// flaky tests of the runs kept by gojunit serve.
+func suggestQuarantineMain(args []string) {
+	fs := flag.NewFlagSet("suggest-quarantine", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit suggest-quarantine [flags]")
+		fs.PrintDefaults()
+	}
+	dir := fs.String("store", "", "store in which gojunit serve keeps runs, as for its -store flag")
+	rate := fs.Float64("flake-rate", 0.05, "list the tests that failed, but not always, in at least this fraction of their runs")
+	last := fs.Int("runs", 0, "consider only this many of the latest runs; 0 for all")
+	fs.Parse(args)
+	if *dir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	store, err := OpenStore(*dir)
+	if err == nil {
+		var runs []*Run
+		if runs, err = store.List(); err == nil {
+			if *last > 0 && len(runs) > *last {
+				runs = runs[:*last]
+			}
+			err = WriteQuarantine(SuggestQuarantine(CollectFlakeStats(runs), *rate), os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit suggest-quarantine:", err)
+		os.Exit(exitInfra)
+	}
+}
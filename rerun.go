@@ -0,0 +1,89 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A RerunCommand is a go test command running the failed tests of a package
+// again.
+type RerunCommand struct {
+	Package string
+	Tests   []string // top-level tests, in the order in which they failed
+}
+
+// String returns the command, quoted for a POSIX shell, as in
+// go test -run '^(TestA|TestB)$' example.com/pkg.
+func (c RerunCommand) String() string {
+	names := make([]string, len(c.Tests))
+	for i, name := range c.Tests {
+		names[i] = regexp.QuoteMeta(name)
+	}
+	pattern := "^" + names[0] + "$"
+	if len(names) > 1 {
+		pattern = "^(" + strings.Join(names, "|") + ")$"
+	}
+	return "go test -run " + shellQuote(pattern) + " " + shellQuote(c.Package)
+}
+
+// RerunCommands returns the commands running the tests that failed or had
+// errors in suites again, one per package, in the order of the packages.
+// A failed subtest is run again along with the rest of its top-level test.
+// Tests that are not Go test functions, such as the build failure of a
+// package or a Ginkgo spec, are left out, as are benchmarks, which go test
+// -run does not run.
+func RerunCommands(suites []TestSuite) []RerunCommand {
+	var cmds []RerunCommand
+	index := make(map[string]int) // of the command of each package
+	seen := make(map[string]bool) // by package and test
+	for i := range suites {
+		s := &suites[i]
+		pkg := suitePackage(s)
+		if pkg == "" || strings.ContainsAny(pkg, " \t") {
+			continue
+		}
+		for _, t := range s.TestCases {
+			if t.Status != Failure && t.Status != Error {
+				continue
+			}
+			name, _, _ := strings.Cut(t.Name, "/")
+			// The runs of a test repeated with -count are numbered.
+			name, _, _ = strings.Cut(name, "#")
+			if !isRerunnable(name) || seen[pkg+"\x00"+name] {
+				continue
+			}
+			seen[pkg+"\x00"+name] = true
+			j, ok := index[pkg]
+			if !ok {
+				j = len(cmds)
+				index[pkg] = j
+				cmds = append(cmds, RerunCommand{Package: pkg})
+			}
+			cmds[j].Tests = append(cmds[j].Tests, name)
+		}
+	}
+	return cmds
+}
+
+// isRerunnable reports whether name is that of a test, example or fuzz test
+// function, which go test -run selects.
+func isRerunnable(name string) bool {
+	for _, prefix := range []string{"Test", "Example", "Fuzz"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok && !strings.ContainsAny(rest, " \t.") {
+			return true
+		}
+	}
+	return false
+}
+
+// shellQuote quotes s for a POSIX shell, unless it needs no quotes.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
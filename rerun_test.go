@@ -0,0 +1,38 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRerunCommands(t *testing.T) {
+	suites := []TestSuite{
+		{
+			Name:       "x/m [linux]",
+			Properties: []Property{{Name: "label", Value: "linux"}},
+			TestCases: []TestCase{
+				{Name: "TestA/sub", Status: Failure},
+				{Name: "TestB", Status: Success},
+				{Name: "build failed", Status: Error},
+			},
+		},
+		{
+			Name:       "x/m [darwin]",
+			Properties: []Property{{Name: "label", Value: "darwin"}},
+			TestCases:  []TestCase{{Name: "TestA", Status: Failure}, {Name: "TestC#01", Status: Error}},
+		},
+		{Name: "x/n", TestCases: []TestCase{{Name: "TestD", Status: Failure}}},
+	}
+	var got []string
+	for _, c := range RerunCommands(suites) {
+		got = append(got, c.String())
+	}
+	want := []string{"go test -run '^(TestA|TestC)$' x/m", "go test -run '^TestD$' x/n"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// The test results gojunit converts, and the parsers of the output of go
+// test producing them, are those of package junit, which other programs can
+// import.
+type (
+	TestSuite       = junit.TestSuite
+	TestCase        = junit.TestCase
+	Property        = junit.Property
+	Status          = junit.Status
+	Log             = junit.Log
+	ParseWarning    = junit.ParseWarning
+	TestEvent       = junit.TestEvent
+	BenchmarkResult = junit.BenchmarkResult
+	Collector       = junit.Collector
+)
+
+const (
+	Success = junit.Success
+	Failure = junit.Failure
+	Error   = junit.Error
+	Skipped = junit.Skipped
+)
+
+// The formats gojunit reads besides the output of go test are added to those
+// of junit.Collector.
+func init() {
+	junit.RegisterFormat("junit", streamXML)
+	junit.RegisterFormat("ginkgo", streamGinkgo)
+	junit.RegisterFormat("bazel", streamBazel)
+	junit.RegisterFormat("list", streamList)
+}
+
+func streamXML(r io.Reader, emit func(TestSuite)) ([]ParseWarning, error) {
+	suites, warnings, err := ParseXML(r)
+	for _, s := range suites {
+		emit(s)
+	}
+	return warnings, err
+}
@@ -0,0 +1,365 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// testPackage is a package listed by go list.
+type testPackage struct {
+	ImportPath string
+	Dir        string
+	HasTests   bool
+}
+
+func listTestPackages(ctx context.Context, patterns []string) ([]testPackage, error) {
+	args := append([]string{"list", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{len .TestGoFiles}}\t{{len .XTestGoFiles}}"}, patterns...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v", err)
+	}
+	var pkgs []testPackage
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) != 4 {
+			continue
+		}
+		pkgs = append(pkgs, testPackage{ImportPath: f[0], Dir: f[1], HasTests: f[2] != "0" || f[3] != "0"})
+	}
+	return pkgs, nil
+}
+
+// RunTests builds the tests of the packages matching patterns and runs them
+// with -test.v and the given extra arguments, returning one suite per package.
+// Packages are reported as go test reports them: a package whose tests fail
+// to build has a single "build failed" test case with status Error, and one
+// without tests has the "no test files" reason. Unlike go test, RunTests keeps
+// the standard output and standard error of the test binaries apart: each
+// line written to standard error is attributed to the test running at the
+// time it is read, and the other lines to the output of the suite of the
+// package. The time spent building the tests of a package, and the
+// wall-clock and CPU time of its test binary, measured by RunTests rather
+// than reported by the tests, are recorded in the "build_time", "wall_time"
+// and "cpu_time" properties of its suite, in seconds.
+//
+// The coverage flags of go test among args, -cover, -covermode and
+// -coverpkg, are given to go test when it builds the test binaries rather
+// than to the binaries, and the coverage of each package is recorded in the
+// "coverage" property of its suite, as go test -cover reports it.
+func RunTests(patterns, args []string) ([]TestSuite, []ParseWarning, error) {
+	return RunTestsContext(context.Background(), patterns, args)
+}
+
+// RunTestsContext is like RunTests, but stops when ctx is done, killing the
+// test binary that is running. The suites of the packages run until then are
+// returned together with the error of ctx; the tests that were killed are
+// marked as errors.
+func RunTestsContext(ctx context.Context, patterns, args []string) ([]TestSuite, []ParseWarning, error) {
+	return RunTestsWith(ctx, patterns, args, RunOptions{})
+}
+
+// RunOptions control how RunTestsWith schedules the packages it runs.
+type RunOptions struct {
+	// Parallel is the number of packages built and run at the same time.
+	// Packages are run one at a time if it is less than 2.
+	Parallel int
+
+	// Durations, if not nil, holds the durations of packages in an earlier
+	// run by import path. The packages are then started longest first, and
+	// those without a duration before all others.
+	Durations map[string]time.Duration
+
+	// FailFast stops starting packages once a test failed or had an error.
+	// The packages not started are reported with the notRunFailFast reason.
+	FailFast bool
+}
+
+// notRunFailFast is the reason of the packages RunTestsWith did not start
+// because a test failed and RunOptions.FailFast was set.
+const notRunFailFast = "not run after an earlier failure"
+
+// RunTestsWith is like RunTestsContext, but schedules the packages as opts
+// say. The suites are returned in the order of the packages, regardless of
+// when they ran, and the warnings name the package of their line as their
+// input.
+func RunTestsWith(ctx context.Context, patterns, args []string, opts RunOptions) ([]TestSuite, []ParseWarning, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	pkgs, err := listTestPackages(ctx, patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmp, err := os.MkdirTemp("", "gojunit")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	buildArgs, args := coverFlags(args)
+
+	suites := make([][]TestSuite, len(pkgs))
+	warnings := make([][]ParseWarning, len(pkgs))
+	var (
+		mu       sync.Mutex
+		runErr   error
+		stopping atomic.Bool
+		wg       sync.WaitGroup
+	)
+	queue := make(chan int)
+	for n := 0; n < max(1, opts.Parallel); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				pkg := pkgs[i]
+				if stopping.Load() {
+					s := TestSuite{Name: pkg.ImportPath}
+					junit.SetReason(&s, notRunFailFast, nil)
+					suites[i] = []TestSuite{s}
+					continue
+				}
+				bin := filepath.Join(tmp, strconv.Itoa(i)+".test")
+				s, w, err := runPackage(ctx, pkg, bin, buildArgs, args)
+				suites[i], warnings[i] = s, w
+				if err != nil {
+					mu.Lock()
+					if runErr == nil {
+						runErr = err
+					}
+					mu.Unlock()
+					stopping.Store(true)
+				}
+				if opts.FailFast && failed(s) {
+					stopping.Store(true)
+				}
+			}
+		}()
+	}
+	for _, i := range schedulePackages(pkgs, opts.Durations) {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	if runErr != nil {
+		return nil, nil, runErr
+	}
+	var all []TestSuite
+	var allWarnings []ParseWarning
+	for i := range pkgs {
+		all = append(all, suites[i]...)
+		for _, w := range warnings[i] {
+			w.Input = pkgs[i].ImportPath
+			allWarnings = append(allWarnings, w)
+		}
+	}
+	return all, allWarnings, ctx.Err()
+}
+
+// schedulePackages returns the indexes of pkgs in the order in which they
+// are started: longest first by durations, if not nil, and otherwise in
+// their own order.
+func schedulePackages(pkgs []testPackage, durations map[string]time.Duration) []int {
+	order := make([]int, len(pkgs))
+	for i := range order {
+		order[i] = i
+	}
+	if durations == nil {
+		return order
+	}
+	duration := func(i int) time.Duration {
+		if d, ok := durations[pkgs[i].ImportPath]; ok {
+			return d
+		}
+		return math.MaxInt64
+	}
+	sort.SliceStable(order, func(i, j int) bool { return duration(order[i]) > duration(order[j]) })
+	return order
+}
+
+// coverFlags splits args into the coverage flags of go test, which are its
+// build flags, and the flags of the test binary.
+func coverFlags(args []string) (build, rest []string) {
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		switch {
+		case !strings.HasPrefix(args[i], "-"):
+			rest = append(rest, args[i])
+		case name == "cover":
+			build = append(build, args[i])
+		case name == "covermode" || name == "coverpkg":
+			build = append(build, args[i])
+			if !hasValue && i+1 < len(args) {
+				i++
+				build = append(build, args[i])
+			}
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return build, rest
+}
+
+// runPackage builds the tests of pkg into bin, with the go test build flags
+// buildArgs, and runs them with args, returning the suite of the package, if
+// it was not interrupted by ctx before its tests ran, and the warnings about
+// its output.
+func runPackage(ctx context.Context, pkg testPackage, bin string, buildArgs, args []string) ([]TestSuite, []ParseWarning, error) {
+	var suites []TestSuite
+	p := junit.NewParser(func(s TestSuite) { suites = append(suites, s) })
+	if !pkg.HasTests {
+		junit.SetReason(p.Suite(), junit.NoTestFiles, nil)
+		p.EndSuite(pkg.ImportPath, 0)
+		return suites, p.Finish(), nil
+	}
+	build := exec.CommandContext(ctx, "go", append(append([]string{"test", "-c"}, buildArgs...), "-o", bin, pkg.ImportPath)...)
+	start := time.Now()
+	out, err := build.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, nil, nil
+	}
+	p.Suite().SetProperty("build_time", seconds(time.Since(start)))
+	if err != nil {
+		junit.SetReason(p.Suite(), "build failed", bytes.NewBuffer(out))
+		p.EndSuite(pkg.ImportPath, 0)
+		return suites, p.Finish(), nil
+	}
+	p.Suite().Name = pkg.ImportPath
+	if err := runTestBinary(ctx, p, pkg, bin, args); err != nil {
+		return nil, nil, err
+	}
+	return suites, p.Finish(), nil
+}
+
+// runPattern returns the -run pattern matching the named test alone, which
+// for a subtest matches each element of its name.
+func runPattern(name string) string {
+	elems := strings.Split(name, "/")
+	for i, e := range elems {
+		elems[i] = "^" + regexp.QuoteMeta(e) + "$"
+	}
+	return strings.Join(elems, "/")
+}
+
+// packageDurations returns the durations of the suites of an earlier report
+// by name, for RunOptions.Durations.
+func packageDurations(suites []TestSuite) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, s := range suites {
+		durations[s.Name] += s.Duration
+	}
+	return durations
+}
+
+// RecordEnv records the environment variables whose names match any of
+// patterns, shell patterns such as GO* or CI_*, as the env.NAME properties
+// of suites, in the order of their names.
+func RecordEnv(suites []TestSuite, patterns []string) error {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range patterns {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return fmt.Errorf("-record-env pattern %q: %v", pattern, err)
+			}
+			if ok {
+				env = append(env, kv)
+				break
+			}
+		}
+	}
+	sort.Strings(env)
+	for i := range suites {
+		for _, kv := range env {
+			name, value, _ := strings.Cut(kv, "=")
+			suites[i].SetProperty("env."+name, value)
+		}
+	}
+	return nil
+}
+
+// runTestBinary runs a compiled test binary in the directory of its package,
+// feeding its output to p and ending a suite for the package when it exits.
+func runTestBinary(ctx context.Context, p *junit.Parser, pkg testPackage, bin string, args []string) error {
+	cmd := exec.CommandContext(ctx, bin, append([]string{"-test.v"}, args...)...)
+	cmd.Dir = pkg.Dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errOutput bytes.Buffer // all of standard error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		junit.ReadLines(stderr, func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+			fmt.Fprintln(&errOutput, line)
+			if tc := p.Current(); tc != nil {
+				fmt.Fprintln(&tc.Stderr, line)
+			} else {
+				fmt.Fprintln(&p.Suite().Output, line)
+			}
+		})
+	}()
+	junit.ReadLines(stdout, func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		p.Line(line)
+	})
+	wg.Wait()
+	if err := cmd.Wait(); err != nil {
+		exit, ok := err.(*exec.ExitError)
+		if !ok {
+			return err
+		}
+		// A test binary exiting with a non-zero status failed even if
+		// none of its tests did, as when TestMain calls os.Exit(1).
+		p.Failed("test binary failed: "+exit.Error(), errOutput.Bytes())
+	}
+	wall := time.Since(start)
+	p.Suite().SetProperty("wall_time", seconds(wall))
+	p.Suite().SetProperty("cpu_time", seconds(cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime()))
+	p.EndSuite(pkg.ImportPath, wall)
+	return nil
+}
+
+// seconds formats d as a number of seconds, to the millisecond.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Round(time.Millisecond).Seconds(), 'f', -1, 64)
+}
@@ -0,0 +1,119 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// fakeTestBinary writes a shell script standing in for a test binary, which
+// prints stdout and stderr and exits with the given status.
+func fakeTestBinary(t *testing.T, stdout, stderr string, status int) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "pkg.test")
+	script := "#!/bin/sh\nprintf '%s' '" + stdout + "'\nprintf '%s' '" + stderr + "' >&2\nexit " + strconv.Itoa(status) + "\n"
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestRunTestBinaryExitStatus(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	pass := "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nPASS\n"
+	fail := "=== RUN   TestBad\n--- FAIL: TestBad (0.00s)\nFAIL\n"
+	tests := []struct {
+		name         string
+		stdout       string
+		stderr       string
+		status       int
+		wantCases    []string
+		wantMessage  string
+		wantErrorOut string
+	}{
+		{"passed", pass, "", 0, []string{"TestOK"}, "", ""},
+		{"TestMain exit", pass, "teardown failed\n", 1, []string{"TestOK", junit.PackageFailed}, "test binary failed: exit status 1", "teardown failed\n"},
+		{"bad flag", "", "flag provided but not defined: -x\n", 2, []string{junit.PackageFailed}, "test binary failed: exit status 2", "flag provided but not defined: -x\n"},
+		{"test failed", fail, "", 1, []string{"TestBad"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var suites []TestSuite
+			p := junit.NewParser(func(s TestSuite) { suites = append(suites, s) })
+			bin := fakeTestBinary(t, tt.stdout, tt.stderr, tt.status)
+			if err := runTestBinary(context.Background(), p, testPackage{ImportPath: "example.com/p", Dir: t.TempDir()}, bin, nil); err != nil {
+				t.Fatal(err)
+			}
+			if len(suites) != 1 {
+				t.Fatalf("got %d suites, want 1", len(suites))
+			}
+			var names []string
+			for _, tc := range suites[0].TestCases {
+				names = append(names, tc.Name)
+				if tc.Name != junit.PackageFailed {
+					continue
+				}
+				if tc.Status != Error || tc.Message != tt.wantMessage {
+					t.Errorf("%s: status %v, message %q; want error, %q", tc.Name, tc.Status, tc.Message, tt.wantMessage)
+				}
+				if got := tc.Output.String(); got != tt.wantErrorOut {
+					t.Errorf("%s: output %q, want %q", tc.Name, got, tt.wantErrorOut)
+				}
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantCases, ",") {
+				t.Errorf("test cases %v, want %v", names, tt.wantCases)
+			}
+		})
+	}
+}
+
+func TestCoverFlags(t *testing.T) {
+	tests := []struct {
+		args      string
+		wantBuild string
+		wantRest  string
+	}{
+		{"-cover", "-cover", ""},
+		{"-test.run TestFoo -cover -covermode=atomic", "-cover -covermode=atomic", "-test.run TestFoo"},
+		{"-coverpkg ./... -test.count 2", "-coverpkg ./...", "-test.count 2"},
+		{"-test.coverprofile c.out", "", "-test.coverprofile c.out"},
+	}
+	for _, tt := range tests {
+		build, rest := coverFlags(strings.Fields(tt.args))
+		if got := strings.Join(build, " "); got != tt.wantBuild {
+			t.Errorf("coverFlags(%q) build = %q, want %q", tt.args, got, tt.wantBuild)
+		}
+		if got := strings.Join(rest, " "); got != tt.wantRest {
+			t.Errorf("coverFlags(%q) rest = %q, want %q", tt.args, got, tt.wantRest)
+		}
+	}
+}
+
+func TestRunTestBinaryCoverage(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	var suites []TestSuite
+	p := junit.NewParser(func(s TestSuite) { suites = append(suites, s) })
+	bin := fakeTestBinary(t, "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nPASS\ncoverage: 66.7% of statements\n", "", 0)
+	if err := runTestBinary(context.Background(), p, testPackage{ImportPath: "example.com/p", Dir: t.TempDir()}, bin, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(suites) != 1 {
+		t.Fatalf("got %d suites, want 1", len(suites))
+	}
+	if got := suites[0].Property("coverage"); got != "66.7" {
+		t.Errorf("coverage %q, want 66.7", got)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsCredentials are the credentials requests to AWS are signed with.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string `json:"Token"`
+}
+
+// awsRegion returns the region of the AWS environment, by default
+// us-east-1.
+func awsRegion() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(name); r != "" {
+			return r
+		}
+	}
+	return "us-east-1"
+}
+
+// ambientAWSCredentials returns the credentials of the environment gojunit
+// runs in, looked up like the AWS CLI does: in the environment, from a web
+// identity token as in GitHub Actions and EKS, in the shared credentials
+// file, from the ECS container agent and from the EC2 instance metadata.
+func ambientAWSCredentials() (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{id, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if role, file := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); role != "" && file != "" {
+		return assumeRoleWithWebIdentity(role, file)
+	}
+	if c, ok := sharedAWSCredentials(); ok {
+		return c, nil
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return containerAWSCredentials("http://169.254.170.2" + uri)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return containerAWSCredentials(uri)
+	}
+	return instanceAWSCredentials()
+}
+
+func assumeRoleWithWebIdentity(role, tokenFile string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	q := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {"gojunit"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	resp, err := httpClient.Get("https://sts." + awsRegion() + ".amazonaws.com/?" + q.Encode())
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return awsCredentials{}, fmt.Errorf("sts: AssumeRoleWithWebIdentity: %s: %s", resp.Status, msg)
+	}
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string
+			SessionToken    string
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return awsCredentials{}, err
+	}
+	c := result.Credentials
+	return awsCredentials{c.AccessKeyID, c.SecretAccessKey, c.SessionToken}, nil
+}
+
+// sharedAWSCredentials reads the credentials of the profile selected by
+// AWS_PROFILE, by default "default", from the shared credentials file.
+func sharedAWSCredentials() (awsCredentials, bool) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return awsCredentials{}, false
+	}
+	defer f.Close()
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	var c awsCredentials
+	var section string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch v = strings.TrimSpace(v); strings.TrimSpace(k) {
+		case "aws_access_key_id":
+			c.AccessKeyID = v
+		case "aws_secret_access_key":
+			c.SecretAccessKey = v
+		case "aws_session_token":
+			c.SessionToken = v
+		}
+	}
+	return c, c.AccessKeyID != ""
+}
+
+func containerAWSCredentials(uri string) (awsCredentials, error) {
+	var header http.Header
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		header = http.Header{"Authorization": {token}}
+	}
+	var c awsCredentials
+	err := doJSON("GET", uri, header, nil, &c)
+	return c, err
+}
+
+// instanceAWSCredentials returns the credentials of the role of the EC2
+// instance, read from the instance metadata service with IMDSv2.
+func instanceAWSCredentials() (awsCredentials, error) {
+	const imds = "http://169.254.169.254/latest"
+	client := &http.Client{Timeout: 2 * time.Second}
+	get := func(method, path string, header http.Header) (string, error) {
+		req, err := http.NewRequest(method, imds+path, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header = header
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+		}
+		return string(b), err
+	}
+	token, err := get("PUT", "/api/token", http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"300"}})
+	if err != nil {
+		return awsCredentials{}, errors.New("no AWS credentials found in the environment")
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {token}}
+	roles, err := get("GET", "/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	var c awsCredentials
+	err = doJSON("GET", imds+"/meta-data/iam/security-credentials/"+role, header, nil, &c)
+	return c, err
+}
+
+// uploadS3 stores body as the object key of bucket. The endpoint can be
+// changed, as for S3 compatible stores, with AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL.
+func uploadS3(bucket, key, contentType string, body []byte) error {
+	creds, err := ambientAWSCredentials()
+	if err != nil {
+		return err
+	}
+	region := awsRegion()
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	var u string
+	switch {
+	case endpoint != "":
+		u = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + s3Escape(key)
+	case strings.Contains(bucket, "."):
+		// The certificate of S3 does not cover bucket names with dots.
+		u = "https://s3." + region + ".amazonaws.com/" + bucket + "/" + s3Escape(key)
+	default:
+		u = "https://" + bucket + ".s3." + region + ".amazonaws.com/" + s3Escape(key)
+	}
+	req, err := http.NewRequest("PUT", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signAWS(req, body, creds, region, "s3", time.Now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3://%s/%s: %s: %s", bucket, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// s3Escape escapes an object key for the path of a request as Signature
+// Version 4 requires: every byte but the unreserved characters of RFC 3986
+// and the slashes are percent-encoded.
+func s3Escape(key string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// signAWS signs req, with the given body, with Signature Version 4.
+func signAWS(req *http.Request, body []byte, c awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payload[:])
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") || k == "content-type" {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, req.URL.Query().Encode(), canonicalHeaders.String(), signed, payloadHash}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+c.SecretAccessKey), date)
+	key = mac(key, region)
+	key = mac(key, service)
+	key = mac(key, "aws4_request")
+	sig := hex.EncodeToString(mac(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.AccessKeyID, scope, signed, sig))
+}
@@ -0,0 +1,38 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestS3Escape(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"reports/junit.xml", "reports/junit.xml"},
+		{"a-b_c.d~e/F0", "a-b_c.d~e/F0"},
+		{"run 1/a+b.xml", "run%201/a%2Bb.xml"},
+		{"x/!$&'()*,;=:@", "x/%21%24%26%27%28%29%2A%2C%3B%3D%3A%40"},
+		{"é/%?#", "%C3%A9/%25%3F%23"},
+	}
+	for _, tt := range tests {
+		got := s3Escape(tt.key)
+		if got != tt.want {
+			t.Errorf("s3Escape(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+		// The path signed is that of the request, which must keep the
+		// escaping.
+		req, err := http.NewRequest("PUT", "https://b.s3.us-east-1.amazonaws.com/"+got, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path := req.URL.EscapedPath(); path != "/"+tt.want {
+			t.Errorf("request path of %q = %q, want %q", tt.key, path, "/"+tt.want)
+		}
+	}
+}
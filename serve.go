@@ -0,0 +1,314 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// Serve runs an HTTP server on addr that stores runs in store. Its endpoints
+// are:
+//
+//	POST /runs         create a run from the results in the request body
+//	POST /runs/{id}    add the results in the request body to a run
+//	GET  /runs         list the runs as JSON
+//	GET  /runs/{id}    render a run; ?format= selects the report format
+//
+// and a web UI for browsing the runs and the history of each test is served
+// at /.
+//
+// The format of posted results is selected with ?from=, or detected from the
+// body when it is not given.
+func Serve(addr string, store Store) error {
+	return ServeContext(context.Background(), addr, store)
+}
+
+// ServeContext is like Serve, but shuts the server down when ctx is done,
+// waiting for requests in progress to complete, and returns nil.
+func ServeContext(ctx context.Context, addr string, store Store) error {
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     newServer(store),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+	log.Printf("listening on %s", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
+}
+
+type server struct {
+	*http.ServeMux
+	store Store
+	mu    sync.Mutex // serializes updates of runs
+}
+
+func newServer(store Store) *server {
+	s := &server{ServeMux: http.NewServeMux(), store: store}
+	s.HandleFunc("/runs", s.runs)
+	s.HandleFunc("/runs/", s.run)
+	s.HandleFunc("/", s.index)
+	s.HandleFunc("/view/", s.view)
+	s.HandleFunc("/history", s.history)
+	return s
+}
+
+func (s *server) runs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		s.createRun(w, r)
+	case "GET", "HEAD":
+		s.listRuns(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) run(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/runs/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		s.appendRun(w, r, id)
+	case "GET", "HEAD":
+		s.getRun(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// contentTypes maps report formats to the Content-Type they are served with.
+var contentTypes = map[string]string{
+	"junit":    "application/xml",
+	"csv":      "text/csv; charset=utf-8",
+	"github":   "text/plain; charset=utf-8",
+	"html":     "text/html; charset=utf-8",
+	"json":     "application/json",
+	"md":       "text/markdown; charset=utf-8",
+	"proto":    "application/x-protobuf",
+	"sql":      "text/plain; charset=utf-8",
+	"summary":  "text/plain; charset=utf-8",
+	"teamcity": "text/plain; charset=utf-8",
+}
+
+// readResults parses the results in the body of r, which is cut off after
+// -max-body bytes.
+func readResults(w http.ResponseWriter, r *http.Request) ([]TestSuite, []ParseWarning, error) {
+	if *maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, *maxBody)
+	}
+	body := bufio.NewReader(junit.NewTextReader(r.Body))
+	format := r.URL.Query().Get("from")
+	if format == "" {
+		format = sniffFormat(body)
+	}
+	parse, ok := junit.LookupFormat(format)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown input format %q", format)
+	}
+	return junit.Collect(parse, junit.NewContextReader(r.Context(), body))
+}
+
+// sniffFormat guesses the input format of r from its first non-blank byte.
+func sniffFormat(r *bufio.Reader) string {
+	b, _ := r.Peek(512)
+	b = bytes.TrimLeft(b, " \t\r\n\ufeff")
+	switch {
+	case len(b) > 0 && b[0] == '{':
+		return "json"
+	case len(b) > 0 && b[0] == '<':
+		return "junit"
+	case isListOutput(b):
+		return "list"
+	}
+	return "text"
+}
+
+func (s *server) createRun(w http.ResponseWriter, r *http.Request) {
+	suites, warnings, err := readResults(w, r)
+	if err != nil {
+		resultsError(w, err)
+		return
+	}
+	run := &Run{ID: NewRunID(), Created: time.Now(), Suites: suites}
+	if err := s.store.Save(run); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeRunResponse(w, http.StatusCreated, run, warnings)
+}
+
+func (s *server) appendRun(w http.ResponseWriter, r *http.Request, id string) {
+	suites, warnings, err := readResults(w, r)
+	if err != nil {
+		resultsError(w, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, err := s.store.Load(id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	updated := *run
+	updated.Suites = append(append([]TestSuite(nil), run.Suites...), suites...)
+	if err := s.store.Save(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeRunResponse(w, http.StatusOK, &updated, warnings)
+}
+
+// runInfo describes a run in JSON responses.
+type runInfo struct {
+	ID       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	Suites   int       `json:"suites"`
+	Counts   Counts    `json:"counts"`
+	Commit   string    `json:"commit,omitempty"`
+	Branch   string    `json:"branch,omitempty"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+func newRunInfo(run *Run) runInfo {
+	info := runInfo{ID: run.ID, Created: run.Created, Suites: len(run.Suites)}
+	for i := range run.Suites {
+		info.Counts.Add(&run.Suites[i])
+	}
+	info.Commit, info.Branch = runCommit(run.Suites)
+	return info
+}
+
+func writeRunResponse(w http.ResponseWriter, code int, run *Run, warnings []ParseWarning) {
+	info := newRunInfo(run)
+	for _, warning := range warnings {
+		info.Warnings = append(info.Warnings, warning.String())
+	}
+	writeJSONResponse(w, code, info)
+}
+
+func writeJSONResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func (s *server) listRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store.List()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	infos := []runInfo{}
+	for _, run := range runs {
+		infos = append(infos, newRunInfo(run))
+	}
+	writeJSONResponse(w, http.StatusOK, infos)
+}
+
+func (s *server) getRun(w http.ResponseWriter, r *http.Request, id string) {
+	run, err := s.store.Load(id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "junit"
+	}
+	write, err := writer(format)
+	if err != nil || write == nil {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	suites, err := processRun(run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	if err := write(suites, &buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	io.Copy(w, &buf)
+}
+
+// resultsError replies to a request whose results could not be read, with
+// status 413 if its body was larger than -max-body.
+func resultsError(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if err == ErrNotFound {
+		code = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// processRun processes a copy of the suites of run, as they are written in
+// the responses of the server. The modules are found for every request, as
+// they may change while the server runs.
+func processRun(run *Run) ([]TestSuite, error) {
+	mods, err := processModules()
+	if err != nil {
+		return nil, err
+	}
+	suites, _, err := process(copySuites(run.Suites), mods)
+	return suites, err
+}
+
+// copySuites returns a copy of suites that can be modified without changing
+// the test cases of the original.
+func copySuites(suites []TestSuite) []TestSuite {
+	c := make([]TestSuite, len(suites))
+	for i, s := range suites {
+		c[i] = s
+		c[i].TestCases = append([]TestCase(nil), s.TestCases...)
+		c[i].Properties = append([]Property(nil), s.Properties...)
+		c[i].Output = s.Output.Clone()
+		for j := range c[i].TestCases {
+			t := &c[i].TestCases[j]
+			t.Properties = append([]Property(nil), t.Properties...)
+			t.Output, t.Stderr = t.Output.Clone(), t.Stderr.Clone()
+		}
+	}
+	return c
+}
@@ -0,0 +1,103 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServeMaxBody(t *testing.T) {
+	defer func(n int64) { *maxBody = n }(*maxBody)
+	*maxBody = 256
+	small := "=== RUN   TestOK\n--- PASS: TestOK (0.00s)\nok  \tx/m\t0.002s\n"
+	large := strings.Repeat("=== RUN   TestOK\n--- PASS: TestOK (0.00s)\n", 20) + "ok  \tx/m\t0.002s\n"
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"create", "/runs", small, http.StatusCreated},
+		{"create too large", "/runs", large, http.StatusRequestEntityTooLarge},
+		{"append too large", "/runs/x", large, http.StatusRequestEntityTooLarge},
+		{"unknown format", "/runs?from=nosuch", small, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newServer(NewMemStore()).ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("POST %s: status %d, want %d: %s", tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestServeConcurrentReads reads a stored run from several goroutines at
+// once, grouping its suites by module, which go test -race checks do not
+// race.
+func TestServeConcurrentReads(t *testing.T) {
+	defer func(m bool, root string) { *modules, *moduleRoot = m, root }(*modules, *moduleRoot)
+	*modules, *moduleRoot = true, t.TempDir()
+	if err := os.WriteFile(filepath.Join(*moduleRoot, "go.mod"), []byte("module x\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemStore()
+	run := &Run{ID: "r1", Suites: []TestSuite{{
+		Name:      "x/m",
+		Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		TestCases: []TestCase{{Name: "TestBad", Status: Failure}},
+	}}}
+	run.Suites[0].Output.WriteString("FAIL\n")
+	run.Suites[0].TestCases[0].Output.WriteString("bad_test.go:10: got 1, want 2\n")
+	if err := store.Save(run); err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(store)
+	bodies := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest("GET", "/runs/r1?format=json", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET /runs/r1: status %d: %s", rec.Code, rec.Body)
+			}
+			bodies[i] = rec.Body.String()
+		}()
+	}
+	wg.Wait()
+	for i, b := range bodies {
+		if !strings.Contains(b, "got 1, want 2") || !strings.Contains(b, `"value": "x"`) || b != bodies[0] {
+			t.Errorf("response %d:\n%s\nwant the output of TestBad and module x, as in\n%s", i, b, bodies[0])
+		}
+	}
+}
+
+func TestCopySuites(t *testing.T) {
+	suites := []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestA"}}}}
+	suites[0].Output.WriteString("suite\n")
+	suites[0].TestCases[0].Output.WriteString("out\n")
+	suites[0].TestCases[0].Stderr.WriteString("err\n")
+	c := copySuites(suites)
+	c[0].Output.WriteString("more")
+	c[0].TestCases[0].Output.WriteString("more")
+	c[0].TestCases[0].Stderr.WriteString("more")
+	c[0].TestCases[0].SetProperty("p", "v")
+	s, tc := &suites[0], &suites[0].TestCases[0]
+	if s.Output.String() != "suite\n" || tc.Output.String() != "out\n" || tc.Stderr.String() != "err\n" || len(tc.Properties) != 0 {
+		t.Errorf("original changed by writing to its copy: output %q, test output %q, stderr %q, properties %v",
+			s.Output.String(), tc.Output.String(), tc.Stderr.String(), tc.Properties)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// snippetContext is the number of lines shown before and after the line of
+// a failure in source snippets.
+const snippetContext = 3
+
+// A Snippet is an excerpt of a source file around the line of a failure.
+type Snippet struct {
+	File  string // as reported by the test
+	Lines []SnippetLine
+}
+
+// A SnippetLine is a line of a Snippet.
+type SnippetLine struct {
+	N       int
+	Text    string
+	Failure bool // the line of the failure
+}
+
+// A sourceResolver finds the source files of the failures of tests in the
+// modules of a source tree and reads snippets of them.
+type sourceResolver struct {
+	mods  []moduleDir
+	files map[string][]string // lines of the files read so far
+}
+
+func newSourceResolver(mods []moduleDir) *sourceResolver {
+	return &sourceResolver{mods: mods, files: make(map[string][]string)}
+}
+
+// Snippet returns the snippet of the location of the failure of t, a test
+// of s, or nil if the failure has no location or its file is not in the
+// source tree.
+func (r *sourceResolver) Snippet(s *TestSuite, t *TestCase) *Snippet {
+	file, line, _ := FailureLocation(t.Output.String())
+	if file == "" {
+		return nil
+	}
+	lines := r.lines(r.path(suitePackage(s), file))
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	sn := &Snippet{File: file}
+	for n := max(1, line-snippetContext); n <= min(len(lines), line+snippetContext); n++ {
+		sn.Lines = append(sn.Lines, SnippetLine{n, lines[n-1], n == line})
+	}
+	return sn
+}
+
+// path returns the path of file, as reported by a test of pkg, in the source
+// tree, or "" if pkg is not in one of its modules.
+func (r *sourceResolver) path(pkg, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	var best moduleDir
+	for _, m := range r.mods {
+		if (pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/")) && len(m.Path) > len(best.Path) {
+			best = m
+		}
+	}
+	if best.Path == "" {
+		return ""
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(pkg, best.Path), "/")
+	return filepath.Join(best.Dir, filepath.FromSlash(rel), filepath.Base(file))
+}
+
+// lines returns the lines of the named file, or nil if it cannot be read.
+func (r *sourceResolver) lines(name string) []string {
+	if name == "" {
+		return nil
+	}
+	lines, ok := r.files[name]
+	if !ok {
+		if data, err := os.ReadFile(name); err == nil {
+			lines = strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+		}
+		r.files[name] = lines
+	}
+	return lines
+}
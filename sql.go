@@ -0,0 +1,107 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlSchema creates the tables and indices written to by WriteSQL. Every
+// invocation adds a new row to runs, so a database accumulates the history of
+// many runs.
+const sqlSchema = `CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	created TEXT NOT NULL,
+	generator TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS suites (
+	id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs(id),
+	name TEXT NOT NULL,
+	duration REAL NOT NULL,
+	timestamp TEXT
+);
+CREATE TABLE IF NOT EXISTS suite_properties (
+	suite_id INTEGER NOT NULL REFERENCES suites(id),
+	name TEXT NOT NULL,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS testcases (
+	id INTEGER PRIMARY KEY,
+	suite_id INTEGER NOT NULL REFERENCES suites(id),
+	name TEXT NOT NULL,
+	classname TEXT NOT NULL,
+	status TEXT NOT NULL,
+	duration REAL NOT NULL,
+	output TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS suites_run_id ON suites(run_id);
+CREATE INDEX IF NOT EXISTS suites_name ON suites(name);
+CREATE INDEX IF NOT EXISTS suite_properties_suite_id ON suite_properties(suite_id);
+CREATE INDEX IF NOT EXISTS testcases_suite_id ON testcases(suite_id);
+CREATE INDEX IF NOT EXISTS testcases_name ON testcases(name);
+CREATE INDEX IF NOT EXISTS testcases_status ON testcases(status);
+`
+
+// WriteSQL writes a slice of TestSuites to a writer as a SQL script that
+// creates the results schema if necessary and inserts the suites as a new run.
+func WriteSQL(suites []TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(sqlSchema)
+	bw.WriteString("BEGIN;\n")
+	fmt.Fprintf(bw, "INSERT INTO runs (created, generator) VALUES (%s, %s);\n",
+		sqlQuote(time.Now().UTC().Format(time.RFC3339)), sqlQuote("gojunit v"+Version))
+	for _, suite := range suites {
+		var ts string
+		if !suite.Timestamp.IsZero() {
+			ts = suite.Timestamp.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(bw, "INSERT INTO suites (run_id, name, duration, timestamp) VALUES ((SELECT max(id) FROM runs), %s, %s, %s);\n",
+			sqlQuote(suite.Name), sqlFloat(suite.Duration.Seconds()), sqlQuote(ts))
+		for _, p := range suite.Properties {
+			fmt.Fprintf(bw, "INSERT INTO suite_properties (suite_id, name, value) VALUES ((SELECT max(id) FROM suites), %s, %s);\n",
+				sqlQuote(p.Name), sqlQuote(p.Value))
+		}
+		for _, t := range suite.TestCases {
+			fmt.Fprintf(bw, "INSERT INTO testcases (suite_id, name, classname, status, duration, output) VALUES ((SELECT max(id) FROM suites), %s, %s, %s, %s, %s);\n",
+				sqlQuote(t.Name), sqlQuote(classnameOf(&suite, &t)), sqlQuote(t.Status.String()), sqlFloat(t.Duration.Seconds()), sqlQuote(t.Output.String()))
+		}
+	}
+	bw.WriteString("COMMIT;\n")
+	return bw.Flush()
+}
+
+// WriteSQLite adds a slice of TestSuites as a new run to the SQLite database
+// at path, creating it if necessary. It requires the sqlite3 command.
+func WriteSQLite(suites []TestSuite, path string) error {
+	var script bytes.Buffer
+	if err := WriteSQL(suites, &script); err != nil {
+		return err
+	}
+	cmd := exec.Command("sqlite3", "-bail", path)
+	cmd.Stdin = &script
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %v", err)
+	}
+	return nil
+}
+
+func sqlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func sqlFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,173 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runsTable creates the table in which SQL stores keep runs, each as the
+// JSON document of a runFile. It is not the schema of the reports of
+// -format=sqlite and -format=sql, whose runs, suites and testcases tables
+// hold the results of each run in rows and lack what a store keeps of runs,
+// such as their IDs and metadata: a database can hold both, but a store
+// does not read the runs of those reports, nor they the runs of a store.
+const runsTable = `CREATE TABLE IF NOT EXISTS gojunit_runs (
+	id TEXT PRIMARY KEY,
+	created TEXT NOT NULL,
+	data TEXT NOT NULL
+);
+`
+
+// An sqlStore keeps runs in a database with the command line client of the
+// database, which runs SQL read from its standard input and prints each
+// selected value on a line of its own. The JSON documents of runs never hold
+// newlines.
+type sqlStore struct {
+	client  string           // name of the command, for errors
+	command func() *exec.Cmd // runs the client
+	setup   string           // SQL run before the statements of the store
+	once    sync.Once        // creates the table
+	err     error            // of creating the table
+}
+
+// NewSQLiteStore returns a Store that keeps runs in the SQLite database at
+// path, creating it if necessary. It requires the sqlite3 command.
+func NewSQLiteStore(path string) Store {
+	return &sqlStore{
+		client:  "sqlite3",
+		command: func() *exec.Cmd { return exec.Command("sqlite3", "-bail", "-batch", "-list", "-noheader", path) },
+	}
+}
+
+// NewPostgresStore returns a Store that keeps runs in the PostgreSQL
+// database at the URL dsn. It requires the psql command, which also reads
+// the password from ~/.pgpass or $PGPASSWORD. A password in dsn is given to
+// psql in $PGPASSWORD rather than on its command line, which other users
+// can see.
+func NewPostgresStore(dsn string) Store {
+	dsn, password := splitPassword(dsn)
+	return &sqlStore{
+		client: "psql",
+		command: func() *exec.Cmd {
+			cmd := exec.Command("psql", "-X", "-q", "-A", "-t", "-v", "ON_ERROR_STOP=1", "-d", dsn)
+			if password != "" {
+				cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
+			}
+			return cmd
+		},
+		setup: "SET client_min_messages = warning;\n",
+	}
+}
+
+// splitPassword returns the URL dsn without the password of its user or its
+// password parameter, and the password. A dsn that is not a URL is returned
+// as it is.
+func splitPassword(dsn string) (string, string) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn, ""
+	}
+	var password string
+	if p, ok := u.User.Password(); ok {
+		password = p
+		u.User = url.User(u.User.Username())
+	}
+	if q := u.Query(); q.Has("password") {
+		if password == "" {
+			password = q.Get("password")
+		}
+		q.Del("password")
+		u.RawQuery = q.Encode()
+	}
+	if password == "" {
+		return dsn, ""
+	}
+	return u.String(), password
+}
+
+// exec runs script, returning the values it selected.
+func (s *sqlStore) exec(script string) ([]string, error) {
+	s.once.Do(func() { _, s.err = s.run(runsTable) })
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.run(script)
+}
+
+func (s *sqlStore) run(script string) ([]string, error) {
+	cmd := s.command()
+	cmd.Stdin = strings.NewReader(s.setup + script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", s.client, err, strings.TrimSpace(stderr.String()))
+	}
+	var rows []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			rows = append(rows, line)
+		}
+	}
+	return rows, nil
+}
+
+func (s *sqlStore) Save(r *Run) error {
+	b, err := marshalRun(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(fmt.Sprintf("INSERT INTO gojunit_runs (id, created, data) VALUES (%s, %s, %s)\n"+
+		"ON CONFLICT (id) DO UPDATE SET created = excluded.created, data = excluded.data;\n",
+		sqlQuote(r.ID), sqlQuote(r.Created.UTC().Format(time.RFC3339Nano)), sqlQuote(string(b))))
+	return err
+}
+
+func (s *sqlStore) Load(id string) (*Run, error) {
+	rows, err := s.exec(fmt.Sprintf("SELECT data FROM gojunit_runs WHERE id = %s;\n", sqlQuote(id)))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return unmarshalRun([]byte(rows[0]))
+}
+
+func (s *sqlStore) List() ([]*Run, error) {
+	rows, err := s.exec("SELECT data FROM gojunit_runs;\n")
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalRuns(rows)
+}
+
+func (s *sqlStore) Delete(id string) error {
+	_, err := s.exec(fmt.Sprintf("DELETE FROM gojunit_runs WHERE id = %s;\n", sqlQuote(id)))
+	return err
+}
+
+// unmarshalRuns decodes the runs encoded by marshalRun in rows, most
+// recently created first.
+func unmarshalRuns(rows []string) ([]*Run, error) {
+	runs := make([]*Run, 0, len(rows))
+	for _, row := range rows {
+		r, err := unmarshalRun([]byte(row))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// stackFileRE matches the file lines of the frames of a goroutine stack
+// trace, as in "\t/home/ci/src/pkg/x_test.go:12 +0x1d".
+var stackFileRE = regexp.MustCompile(`^\t(\S+\.(?:go|s)):(\d+)(?: \+0x[0-9a-f]+)?$`)
+
+// inTestedPackage marks the frames of stack traces in the package under
+// test.
+const inTestedPackage = "» "
+
+// SymbolicateStacks returns the output of a test of s with its goroutine
+// stack traces, such as those of panics, made easier to read: file names are
+// relative to the module for the packages of the module of s, when it is
+// known, to the module cache for dependencies and to GOROOT/src for the
+// standard library, program counter offsets are dropped, and the frames in
+// the package under test are marked with ». Output without stack traces is
+// returned unchanged.
+func SymbolicateStacks(s *TestSuite, output string) string {
+	if !strings.Contains(output, "\ngoroutine ") {
+		return output
+	}
+	lines := strings.Split(output, "\n")
+	for i := 1; i < len(lines); i++ {
+		m := stackFileRE.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		pkg := framePackage(lines[i-1])
+		file, mark := frameFile(s, pkg, m[1])
+		lines[i] = "\t" + mark + file + ":" + m[2]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// framePackage returns the import path of the package of the function named
+// on a function line of a stack trace, as in "example.com/m/pkg.(*T).F(...)".
+func framePackage(fn string) string {
+	fn = strings.TrimPrefix(strings.TrimSpace(fn), "created by ")
+	if strings.HasPrefix(fn, "panic(") {
+		return "runtime"
+	}
+	slash := strings.LastIndexByte(fn, '/')
+	dot := strings.IndexByte(fn[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return fn[:slash+1+dot]
+}
+
+// frameFile returns the name to show for file, of a frame of a function of
+// pkg in a stack trace of a test of s, and its mark.
+func frameFile(s *TestSuite, pkg, file string) (string, string) {
+	base := path.Base(file)
+	tested := suitePackage(s)
+	mod := s.Property("module")
+	switch {
+	case pkg != "" && strings.TrimSuffix(pkg, "_test") == tested:
+		return path.Join(packageDir(s), base), inTestedPackage
+	case mod != "" && (pkg == mod || strings.HasPrefix(pkg, mod+"/")):
+		return path.Join(strings.TrimPrefix(strings.TrimPrefix(pkg, mod), "/"), base), ""
+	}
+	if i := strings.Index(file, "/pkg/mod/"); i >= 0 {
+		return file[i+len("/pkg/mod/"):], ""
+	}
+	if pkg != "" && !strings.Contains(strings.SplitN(pkg, "/", 2)[0], ".") {
+		// The standard library, at GOROOT/src/pkg.
+		if i := strings.LastIndex(file, "/src/"+pkg+"/"); i >= 0 {
+			return file[i+len("/src/"):], ""
+		}
+	}
+	return file, ""
+}
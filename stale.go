@@ -0,0 +1,130 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// A StaleTest is a test that has not run for a while: it has been skipped, or
+// quarantined, or left out of the runs since a time.
+type StaleTest struct {
+	Suite, Test string
+	Kind        string // "skipped", "quarantined", "expected failure" or "not run"
+	Since       time.Time
+	Reason      string // message of the last skip
+}
+
+// FindStaleTests returns the tests of runs, listed most recently created
+// first, as a Store lists them, that have been skipped in every run since
+// before now minus age, and those missing from the runs since then, longest
+// stale first. Tests are only reported missing if there are runs since then.
+func FindStaleTests(runs []*Run, now time.Time, age time.Duration) []StaleTest {
+	cutoff := now.Add(-age)
+	type state struct {
+		stale StaleTest
+		seen  time.Time // created time of the last run of the test
+		ran   bool      // the test ran, rather than being skipped, since
+	}
+	var order []string
+	tests := make(map[string]*state)
+	for _, run := range runs {
+		for i := range run.Suites {
+			s := &run.Suites[i]
+			for j := range s.TestCases {
+				t := &s.TestCases[j]
+				key := s.Name + "\x00" + t.Name
+				st := tests[key]
+				if st == nil {
+					st = &state{stale: StaleTest{Suite: s.Name, Test: t.Name}, seen: run.Created}
+					tests[key] = st
+					order = append(order, key)
+					st.stale.Kind, st.stale.Reason = skipKind(t), messageOf(t)
+				}
+				if st.ran {
+					continue
+				}
+				if t.Status == Skipped {
+					st.stale.Since = run.Created
+				} else {
+					st.ran = true
+				}
+			}
+		}
+	}
+	var stale []StaleTest
+	for _, key := range order {
+		st := tests[key]
+		switch {
+		case len(runs) > 0 && st.seen.Before(cutoff) && runs[0].Created.After(cutoff):
+			st.stale.Kind, st.stale.Since, st.stale.Reason = "not run", st.seen, ""
+		case st.stale.Kind != "" && !st.stale.Since.IsZero() && st.stale.Since.Before(cutoff):
+		default:
+			continue
+		}
+		stale = append(stale, st.stale)
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Since.Before(stale[j].Since) })
+	return stale
+}
+
+// skipKind returns the kind of staleness of t, if it was skipped.
+func skipKind(t *TestCase) string {
+	switch {
+	case t.Status != Skipped:
+		return ""
+	case t.Property("quarantined") != "":
+		return "quarantined"
+	case t.Property("expected_failure") != "":
+		return "expected failure"
+	}
+	return "skipped"
+}
+
+// WriteStaleTests writes a table of stale tests, with their age at now.
+func WriteStaleTests(stale []StaleTest, now time.Time, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Test\tStale\tSince\tDays\tReason")
+	for _, s := range stale {
+		days := int(now.Sub(s.Since).Hours() / 24)
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%d\t%s\n", s.Suite, s.Test, s.Kind, s.Since.UTC().Format(time.DateOnly), days, s.Reason)
+	}
+	return tw.Flush()
+}
+
+// staleMain runs gojunit stale, which reports the tests of the runs kept by
+// gojunit serve that have not run for a while.
+func staleMain(args []string) {
+	fs := flag.NewFlagSet("stale", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit stale [flags]")
+		fs.PrintDefaults()
+	}
+	dir := fs.String("store", "", "store in which gojunit serve keeps runs, as for its -store flag")
+	days := fs.Int("days", 30, "report the tests skipped, quarantined or not run for more than this many days")
+	fs.Parse(args)
+	if *dir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	store, err := OpenStore(*dir)
+	if err == nil {
+		var runs []*Run
+		if runs, err = store.List(); err == nil {
+			now := time.Now()
+			err = WriteStaleTests(FindStaleTests(runs, now, time.Duration(*days)*24*time.Hour), now, os.Stdout)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit stale:", err)
+		os.Exit(exitInfra)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindStaleTests(t *testing.T) {
+	now := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return now.AddDate(0, 0, -n) }
+	skipped := func(name, msg string) TestCase { return TestCase{Name: name, Status: Skipped, Message: msg} }
+	quarantined := TestCase{Name: "TestQ", Status: Skipped}
+	quarantined.SetProperty("quarantined", "true")
+	// Runs most recent first. x/m/TestA sub is skipped in every run, but
+	// x/m TestA/sub, which joined with a slash has the same name, ran.
+	runs := []*Run{
+		{ID: "r3", Created: day(1), Suites: []TestSuite{
+			{Name: "x/m", TestCases: []TestCase{{Name: "TestA/sub"}, skipped("TestB", "flaky"), quarantined}},
+			{Name: "x/m/TestA", TestCases: []TestCase{skipped("sub", "slow")}},
+		}},
+		{ID: "r2", Created: day(20), Suites: []TestSuite{
+			{Name: "x/m", TestCases: []TestCase{skipped("TestA/sub", ""), skipped("TestB", "flaky"), quarantined, {Name: "TestGone"}}},
+			{Name: "x/m/TestA", TestCases: []TestCase{skipped("sub", "slow")}},
+		}},
+		{ID: "r1", Created: day(40), Suites: []TestSuite{
+			{Name: "x/m", TestCases: []TestCase{{Name: "TestB"}, quarantined}},
+			{Name: "x/m/TestA", TestCases: []TestCase{skipped("sub", "slow")}},
+		}},
+	}
+	got := FindStaleTests(runs, now, 14*24*time.Hour)
+	want := []StaleTest{
+		{Suite: "x/m", Test: "TestQ", Kind: "quarantined", Since: day(40)},
+		{Suite: "x/m/TestA", Test: "sub", Kind: "skipped", Since: day(40), Reason: "slow"},
+		{Suite: "x/m", Test: "TestB", Kind: "skipped", Since: day(20), Reason: "flaky"},
+		{Suite: "x/m", Test: "TestGone", Kind: "not run", Since: day(20)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("FindStaleTests = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stale[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
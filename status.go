@@ -0,0 +1,90 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// A StatusRule reports the tests with a status whose message matches a
+// pattern with another status.
+type StatusRule struct {
+	From    Status
+	Pattern *regexp.Regexp // matched against the message, unanchored
+	To      Status
+}
+
+// ReadStatusRules reads a status rules file. Each line holds a status, a
+// regular expression matched against the messages of tests with that status,
+// and the status to report them with instead, as in
+//
+//	skipped  known-broken     failure
+//	error    ^build failed$   failure
+//
+// Blank lines and lines starting with # are ignored.
+func ReadStatusRules(path string) ([]StatusRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []StatusRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want a status, a pattern and a status", path, n)
+		}
+		from, err := junit.ParseStatus(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		re, err := regexp.Compile(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		to, err := junit.ParseStatus(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		rules = append(rules, StatusRule{from, re, to})
+	}
+	return rules, s.Err()
+}
+
+// MapStatuses applies the first rule matching each test of suites to it,
+// recording the status it had in its "original_status" property.
+func MapStatuses(suites []TestSuite, rules []StatusRule) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			for _, r := range rules {
+				if t.Status != r.From || !r.Pattern.MatchString(messageOf(t)) {
+					continue
+				}
+				if r.To != t.Status {
+					// The message is kept, as it tells what happened.
+					if t.Message == "" {
+						t.Message = messageOf(t)
+					}
+					t.SetProperty("original_status", t.Status.String())
+					t.Status = r.To
+				}
+				break
+			}
+		}
+	}
+}
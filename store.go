@@ -0,0 +1,232 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Run is a set of results stored under an ID, such as those of one CI job.
+type Run struct {
+	ID      string
+	Created time.Time
+	Suites  []TestSuite
+}
+
+// ErrNotFound is returned by a Store for runs it does not hold.
+var ErrNotFound = errors.New("run not found")
+
+// A Store holds runs.
+type Store interface {
+	// Save stores r, replacing any run with the same ID.
+	Save(r *Run) error
+	// Load returns the run with the given ID.
+	Load(id string) (*Run, error)
+	// List returns all runs, most recently created first.
+	List() ([]*Run, error)
+	// Delete removes the run with the given ID, if any.
+	Delete(id string) error
+}
+
+// NewRunID returns a new random run ID.
+func NewRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type memStore struct {
+	mu   sync.Mutex
+	runs map[string]*Run
+}
+
+// NewMemStore returns a Store that keeps runs in memory.
+func NewMemStore() Store {
+	return &memStore{runs: make(map[string]*Run)}
+}
+
+func (s *memStore) Save(r *Run) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[r.ID] = r
+	return nil
+}
+
+func (s *memStore) Load(id string) (*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *memStore) List() ([]*Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]*Run, 0, len(s.runs))
+	for _, r := range s.runs {
+		runs = append(runs, r)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *memStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, id)
+	return nil
+}
+
+type dirStore struct {
+	dir string
+}
+
+// runFile is the document a dirStore keeps for each run.
+type runFile struct {
+	ID      string      `json:"id"`
+	Created time.Time   `json:"created"`
+	Suites  []jsonSuite `json:"suites"`
+}
+
+// NewDirStore returns a Store that keeps each run as a JSON file in dir,
+// creating the directory if needed.
+func NewDirStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir}, nil
+}
+
+func (s *dirStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// marshalRun encodes r as the JSON document of a runFile.
+func marshalRun(r *Run) ([]byte, error) {
+	return json.Marshal(runFile{r.ID, r.Created, toJSONSuites(r.Suites)})
+}
+
+// unmarshalRun decodes a run encoded by marshalRun.
+func unmarshalRun(b []byte) (*Run, error) {
+	var f runFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	return &Run{ID: f.ID, Created: f.Created, Suites: fromJSONSuites(f.Suites)}, nil
+}
+
+func (s *dirStore) Save(r *Run) error {
+	b, err := marshalRun(r)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so that readers never see a partial run.
+	tmp, err := os.CreateTemp(s.dir, ".run-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(r.ID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *dirStore) Load(id string) (*Run, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, ErrNotFound
+	}
+	return s.load(s.path(id))
+}
+
+func (s *dirStore) load(path string) (*Run, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	r, err := unmarshalRun(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+func (s *dirStore) List() ([]*Run, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, path := range paths {
+		r, err := s.load(path)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *dirStore) Delete(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil
+	}
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// OpenStore returns the Store named by dsn: runs kept in memory if it is
+// empty, in an SQLite database with sqlite:PATH, in a PostgreSQL database
+// with a postgres:// or postgresql:// URL, in a BigQuery table with
+// bigquery://PROJECT/DATASET.TABLE, and otherwise as JSON files in the
+// directory dsn.
+func OpenStore(dsn string) (Store, error) {
+	switch {
+	case dsn == "":
+		return NewMemStore(), nil
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return NewSQLiteStore(strings.TrimPrefix(dsn, "sqlite:")), nil
+	case strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://"):
+		return NewPostgresStore(dsn), nil
+	case strings.HasPrefix(dsn, "bigquery://"):
+		return NewBigQueryStore(dsn)
+	}
+	return NewDirStore(dsn)
+}
+
+// sortRuns sorts runs with the most recently created first.
+func sortRuns(runs []*Run) {
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].Created.Equal(runs[j].Created) {
+			return runs[i].Created.After(runs[j].Created)
+		}
+		return runs[i].ID < runs[j].ID
+	})
+}
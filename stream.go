@@ -0,0 +1,98 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// A streamWriter writes a report, such as TeamCity service messages, as the
+// input is read. The messages of a test are written as it starts and
+// finishes when its package is known by then, as it is in the output of go
+// test -json, and those of the other tests, such as all of those of the
+// text output of go test, which names the package after its tests, when
+// their suite ends.
+type streamWriter interface {
+	TestStarted(s *TestSuite, t *TestCase) error
+	TestFinished(s *TestSuite, t *TestCase) error
+	// SuiteEnded writes the messages of the tests of s that TestFinished
+	// did not write.
+	SuiteEnded(s *TestSuite) error
+}
+
+// streamWriters maps the formats that are streamed, when reading inputs, to
+// the functions making their writers.
+var streamWriters = map[string]func(io.Writer) streamWriter{
+	"github":   func(w io.Writer) streamWriter { return newGitHubStream(w, *tee) },
+	"teamcity": newTeamCityStream,
+}
+
+// streamedTests counts the tests a streamWriter wrote messages about, by
+// suite and name.
+type streamedTests map[string]int
+
+func (st streamedTests) add(s *TestSuite, t *TestCase) {
+	st[suiteKey(s)+"\x00"+t.Name]++
+}
+
+// take reports whether t was added, forgetting it if it was.
+func (st streamedTests) take(s *TestSuite, t *TestCase) bool {
+	k := suiteKey(s) + "\x00" + t.Name
+	if st[k] == 0 {
+		return false
+	}
+	if st[k]--; st[k] == 0 {
+		delete(st, k)
+	}
+	return true
+}
+
+// streamMu serializes the writes of the streamed reports, which the parsers
+// of several inputs make at the same time, and the processing before them.
+var streamMu sync.Mutex
+
+// streaming reports whether any of reports is streamed.
+func streaming(reports []report) bool {
+	for _, r := range reports {
+		if r.stream != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// streamTest processes the test t of package pkg, which started or, if
+// finished is set, finished, and writes it to the streamed reports, as
+// writeStreamed does with suites and mods. Tests whose package is not known yet are
+// left for writeStreamed.
+func streamTest(reports []report, mods []string, pkg string, t TestCase, finished bool) {
+	if pkg == "" {
+		return
+	}
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	suites, _, err := process([]TestSuite{{Name: pkg, TestCases: []TestCase{t}}}, mods)
+	if err != nil {
+		fatal(exitParse, err)
+	}
+	for _, r := range reports {
+		if r.streamer == nil {
+			continue
+		}
+		for i := range suites {
+			s := &suites[i]
+			for j := range s.TestCases {
+				write := r.streamer.TestStarted
+				if finished {
+					write = r.streamer.TestFinished
+				}
+				if err := write(s, &s.TestCases[j]); err != nil {
+					fatal(exitInfra, err)
+				}
+			}
+		}
+	}
+}
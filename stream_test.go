@@ -0,0 +1,97 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStreamWriters(t *testing.T) {
+	suite := TestSuite{Name: "x/m", TestCases: []TestCase{
+		{Name: "TestOK"},
+		{Name: "TestBad", Status: Failure, Message: "bad"},
+		{Name: "package failed", Status: Error, Message: "exit status 1"},
+	}}
+	tests := []struct {
+		name   string
+		writer func(*bytes.Buffer) streamWriter
+		want   string
+	}{
+		{
+			"teamcity",
+			func(b *bytes.Buffer) streamWriter { return newTeamCityStream(b) },
+			`##teamcity[testSuiteStarted name='x/m']
+##teamcity[testStarted name='TestOK' captureStandardOutput='false']
+##teamcity[testFinished name='TestOK' duration='0']
+##teamcity[testStarted name='TestBad' captureStandardOutput='false']
+##teamcity[testFailed name='TestBad' message='bad' details='']
+##teamcity[testFinished name='TestBad' duration='0']
+##teamcity[testStarted name='package failed' captureStandardOutput='false']
+##teamcity[testFailed name='package failed' message='exit status 1' details='']
+##teamcity[testFinished name='package failed' duration='0']
+##teamcity[testSuiteFinished name='x/m']
+`,
+		},
+		{
+			"github",
+			func(b *bytes.Buffer) streamWriter { return newGitHubStream(b, true) },
+			`::group::x/m.TestOK
+::endgroup::
+::group::x/m.TestBad
+::endgroup::
+::error title=x/m.TestBad::bad
+::error title=x/m.package failed::exit status 1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			w := tt.writer(&b)
+			// The package failed after its tests, which were streamed as
+			// they ran.
+			for i := 0; i < 2; i++ {
+				if err := w.TestStarted(&suite, &suite.TestCases[i]); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.TestFinished(&suite, &suite.TestCases[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.SuiteEnded(&suite); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamWritersWithoutTestEvents(t *testing.T) {
+	suites := []TestSuite{{Name: "x/m", TestCases: []TestCase{{Name: "TestOK"}, {Name: "TestBad", Status: Failure, Message: "bad"}}}}
+	formats := []struct {
+		name   string
+		writer func(*bytes.Buffer) streamWriter
+		write  func([]TestSuite, *bytes.Buffer) error
+	}{
+		{"teamcity", func(b *bytes.Buffer) streamWriter { return newTeamCityStream(b) }, func(s []TestSuite, b *bytes.Buffer) error { return WriteTeamCity(s, b) }},
+		{"github", func(b *bytes.Buffer) streamWriter { return newGitHubStream(b, true) }, func(s []TestSuite, b *bytes.Buffer) error { return WriteGitHubAnnotations(s, b) }},
+	}
+	for _, f := range formats {
+		var streamed, written bytes.Buffer
+		if err := f.writer(&streamed).SuiteEnded(&suites[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.write(suites, &written); err != nil {
+			t.Fatal(err)
+		}
+		if streamed.String() != written.String() || !strings.Contains(written.String(), "TestBad") {
+			t.Errorf("%s: streamed\n%s\nwant\n%s", f.name, streamed.String(), written.String())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+)
+
+// writeStylesheetRef writes the XML declaration and an xml-stylesheet
+// processing instruction referring to the XSLT stylesheet at href, with
+// which browsers render the XML that follows.
+func writeStylesheetRef(w io.Writer, href string) error {
+	var quoted bytes.Buffer
+	xml.EscapeText(&quoted, []byte(href))
+	_, err := fmt.Fprintf(w, "%s<?xml-stylesheet type=\"text/xsl\" href=\"%s\"?>\n", xml.Header, quoted.Bytes())
+	return err
+}
+
+// stylesheetMain runs gojunit stylesheet, which writes the default XSLT
+// stylesheet for -stylesheet.
+func stylesheetMain(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: gojunit stylesheet > junit.xsl")
+		os.Exit(exitParse)
+	}
+	io.WriteString(os.Stdout, junitXSLT)
+}
+
+// junitXSLT renders JUnit XML reports, as gojunit writes them, as an HTML
+// page like that of -format html: a table of the suites followed by the
+// failed tests of each.
+const junitXSLT = `<?xml version="1.0" encoding="UTF-8"?>
+<xsl:stylesheet version="1.0" xmlns:xsl="http://www.w3.org/1999/XSL/Transform">
+<xsl:output method="html" encoding="UTF-8"/>
+
+<xsl:template match="/">
+<html>
+<head>
+<meta charset="utf-8"/>
+<title>Test report</title>
+<style>` + htmlStyle + `</style>
+</head>
+<body>
+<h1>Test report</h1>
+<xsl:variable name="suites" select="//testsuite[testcase]"/>
+<p>
+<xsl:value-of select="sum($suites/@tests)"/> tests,
+<xsl:value-of select="sum($suites/@failures)"/> failed,
+<xsl:value-of select="sum($suites/@errors)"/> errors,
+<xsl:value-of select="sum($suites/@skipped)"/> skipped
+</p>
+<table>
+<tr><th>Package</th><th class="num">Tests</th><th class="num">Failed</th><th class="num">Errors</th><th class="num">Skipped</th><th class="num">Time</th></tr>
+<xsl:for-each select="$suites">
+<tr>
+<td>
+<xsl:attribute name="class">
+<xsl:choose><xsl:when test="@failures &gt; 0 or @errors &gt; 0">failure</xsl:when><xsl:otherwise>success</xsl:otherwise></xsl:choose>
+</xsl:attribute>
+<xsl:value-of select="@name"/>
+</td>
+<td class="num"><xsl:value-of select="@tests"/></td>
+<td class="num"><xsl:value-of select="@failures"/></td>
+<td class="num"><xsl:value-of select="@errors"/></td>
+<td class="num"><xsl:value-of select="@skipped"/></td>
+<td class="num"><xsl:value-of select="@time"/>s</td>
+</tr>
+</xsl:for-each>
+</table>
+<xsl:for-each select="$suites">
+<details>
+<xsl:if test="@failures &gt; 0 or @errors &gt; 0"><xsl:attribute name="open">open</xsl:attribute></xsl:if>
+<summary><xsl:value-of select="@name"/></summary>
+<table>
+<tr><th>Test</th><th>Status</th><th class="num">Time</th></tr>
+<xsl:for-each select="testcase">
+<xsl:variable name="status">
+<xsl:choose>
+<xsl:when test="failure">failure</xsl:when>
+<xsl:when test="error">error</xsl:when>
+<xsl:when test="skipped">skipped</xsl:when>
+<xsl:otherwise>success</xsl:otherwise>
+</xsl:choose>
+</xsl:variable>
+<tr>
+<td><xsl:value-of select="@name"/><xsl:for-each select="failure|error|skipped"><xsl:if test="@message"><br/><small><xsl:value-of select="@message"/></small></xsl:if></xsl:for-each></td>
+<td class="{$status}"><xsl:value-of select="$status"/></td>
+<td class="num"><xsl:value-of select="@time"/>s</td>
+</tr>
+<xsl:if test="failure|error">
+<tr><td colspan="3"><pre><xsl:value-of select="failure|error"/></pre><xsl:if test="system-err"><pre><xsl:value-of select="system-err"/></pre></xsl:if></td></tr>
+</xsl:if>
+</xsl:for-each>
+</table>
+<xsl:if test="system-out"><details><summary>Output outside of tests</summary><pre><xsl:value-of select="system-out"/></pre></details></xsl:if>
+</details>
+</xsl:for-each>
+</body>
+</html>
+</xsl:template>
+</xsl:stylesheet>
+`
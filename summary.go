@@ -0,0 +1,190 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// Counts holds the number of test cases with each status.
+type Counts struct {
+	Tests    int `json:"tests"`
+	Failures int `json:"failures"`
+	Errors   int `json:"errors"`
+	Skipped  int `json:"skipped"`
+}
+
+// Add adds the test cases of suite to c.
+func (c *Counts) Add(suite *TestSuite) {
+	for _, t := range suite.TestCases {
+		c.Tests++
+		switch t.Status {
+		case Failure:
+			c.Failures++
+		case Error:
+			c.Errors++
+		case Skipped:
+			c.Skipped++
+		}
+	}
+}
+
+func (c Counts) String() string {
+	return fmt.Sprintf("%d tests, %d failed, %d errors, %d skipped", c.Tests, c.Failures, c.Errors, c.Skipped)
+}
+
+// WriteSummary writes a short human-readable summary of a slice of
+// TestSuites to a writer, listing the tests that failed in each suite.
+func WriteSummary(suites []TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var total Counts
+	var elapsed time.Duration
+	for i := range suites {
+		suite := &suites[i]
+		var c Counts
+		c.Add(suite)
+		total.Add(suite)
+		elapsed += suite.Duration
+
+		result := "ok  "
+		if c.Failures+c.Errors > 0 {
+			result = "FAIL"
+		}
+		if reason := suite.Property("reason"); reason != "" {
+			if reason == junit.NoTestFiles {
+				result = "?   "
+			}
+			fmt.Fprintf(bw, "%s %s [%s]\n", result, suiteKey(suite), reason)
+		} else {
+			fmt.Fprintf(bw, "%s %s (%s, %v", result, suiteKey(suite), c, suite.Duration)
+			if cpu := suite.Property("cpu_time"); cpu != "" {
+				fmt.Fprintf(bw, ", cpu %ss, build %ss", cpu, suite.Property("build_time"))
+			}
+			fmt.Fprintln(bw, ")")
+			if t := TimingOf(suite); *timing && t.Tests > 0 {
+				fmt.Fprintf(bw, "     time: %s\n     histogram: %s\n", t, t.histogramString())
+			}
+		}
+		if c.Failures+c.Errors == 0 {
+			continue
+		}
+		if seed := suite.Property("shuffle"); seed != "" {
+			fmt.Fprintf(bw, "     tests ran in shuffled order; reproduce with go test -shuffle=%s\n", seed)
+		}
+		for _, t := range suite.TestCases {
+			if t.Status == Failure || t.Status == Error {
+				fmt.Fprintf(bw, "     --- %s: %s", statusLabel(t.Status), t.Name)
+				if im := t.Property("impact"); im != "" {
+					fmt.Fprintf(bw, " [%s]", im)
+				}
+				if msg := messageOf(&t); msg != "" && msg != t.Name {
+					fmt.Fprintf(bw, ": %s", msg)
+				}
+				fmt.Fprintln(bw)
+			}
+		}
+	}
+	fmt.Fprintf(bw, "%s in %d packages (%v)\n", total, len(suites), elapsed)
+	if changed, preexisting := impactCounts(suites); changed+preexisting > 0 {
+		fmt.Fprintf(bw, "%d failing in changed files, %d pre-existing\n", changed, preexisting)
+	}
+	if cmds := RerunCommands(suites); len(cmds) > 0 {
+		fmt.Fprintln(bw, "reproduce the failures with:")
+		for _, c := range cmds {
+			fmt.Fprintf(bw, "    %s\n", c)
+		}
+	}
+	if total.Skipped > 0 {
+		var parts []string
+		for _, r := range SkipReasons(suites) {
+			parts = append(parts, fmt.Sprintf("%s (%d)", r.Reason, r.Count))
+		}
+		fmt.Fprintf(bw, "%d skipped: %s\n", total.Skipped, strings.Join(parts, ", "))
+	}
+	if *timing {
+		all := make([]*TestSuite, len(suites))
+		for i := range suites {
+			all[i] = &suites[i]
+		}
+		if t := TimingOf(all...); t.Tests > 0 {
+			fmt.Fprintf(bw, "time: %s\nhistogram: %s\n", t, t.histogramString())
+		}
+	}
+	return bw.Flush()
+}
+
+// impactCounts returns the number of failing tests of suites marked by
+// -impact as failing in changed files and as pre-existing.
+func impactCounts(suites []TestSuite) (changed, preexisting int) {
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			switch suites[i].TestCases[j].Property("impact") {
+			case impactChanged:
+				changed++
+			case impactPreexisting:
+				preexisting++
+			}
+		}
+	}
+	return changed, preexisting
+}
+
+// noSkipReason stands for the reason of tests skipped without one, as with
+// t.SkipNow.
+const noSkipReason = "no reason given"
+
+// A SkipReason is the reason of skipped tests and how many were skipped for
+// it.
+type SkipReason struct {
+	Reason string
+	Count  int
+}
+
+// SkipReasons returns the reasons of the skipped tests of suites, the most
+// common first.
+func SkipReasons(suites []TestSuite) []SkipReason {
+	index := make(map[string]int)
+	var reasons []SkipReason
+	for i := range suites {
+		for j := range suites[i].TestCases {
+			t := &suites[i].TestCases[j]
+			if t.Status != Skipped {
+				continue
+			}
+			reason := strings.TrimSpace(messageOf(t))
+			if reason == "" {
+				reason = noSkipReason
+			}
+			k, ok := index[reason]
+			if !ok {
+				k = len(reasons)
+				index[reason] = k
+				reasons = append(reasons, SkipReason{Reason: reason})
+			}
+			reasons[k].Count++
+		}
+	}
+	sort.SliceStable(reasons, func(i, j int) bool { return reasons[i].Count > reasons[j].Count })
+	return reasons
+}
+
+func statusLabel(s Status) string {
+	switch s {
+	case Failure:
+		return "FAIL"
+	case Error:
+		return "ERROR"
+	case Skipped:
+		return "SKIP"
+	}
+	return "PASS"
+}
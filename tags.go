@@ -0,0 +1,122 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A TagRule tags the tests matching a pattern.
+type TagRule struct {
+	Pattern *regexp.Regexp // matched against "suite/test", unanchored
+	Tags    []string
+}
+
+// ReadTagRules reads a tag rules file. Each line holds a regular expression,
+// matched against test names like those of ReadIssueRules, and a comma
+// separated list of tags, as in
+//
+//	/TestSmoke          smoke
+//	/integration/       regression,slow
+//
+// Blank lines and lines starting with # are ignored.
+func ReadTagRules(path string) ([]TagRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []TagRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a pattern and tags", path, n)
+		}
+		re, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		rules = append(rules, TagRule{re, splitTags(fields[1])})
+	}
+	return rules, s.Err()
+}
+
+// splitTags splits a comma separated list of tags, dropping empty ones.
+func splitTags(list string) []string {
+	var tags []string
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// testTags returns the tags in the "tags" property of t.
+func testTags(t *TestCase) []string {
+	return splitTags(t.Property("tags"))
+}
+
+// TagTests adds the tags of every rule matching a test to its "tags"
+// property, a sorted comma separated list, which keeps the tags it had.
+func TagTests(suites []TestSuite, rules []TagRule) {
+	for i := range suites {
+		s := &suites[i]
+		for j := range s.TestCases {
+			t := &s.TestCases[j]
+			tags := testTags(t)
+			for _, r := range rules {
+				if r.Pattern.MatchString(s.Name + "/" + t.Name) {
+					tags = append(tags, r.Tags...)
+				}
+			}
+			if len(tags) == 0 {
+				continue
+			}
+			sort.Strings(tags)
+			n := 0
+			for k, tag := range tags {
+				if k == 0 || tag != tags[n-1] {
+					tags[n] = tag
+					n++
+				}
+			}
+			t.SetProperty("tags", strings.Join(tags[:n], ","))
+		}
+	}
+}
+
+// FilterTags removes the tests that have none of the given tags from
+// suites, and the suites left without tests.
+func FilterTags(suites []TestSuite, only []string) []TestSuite {
+	want := make(map[string]bool)
+	for _, tag := range only {
+		want[tag] = true
+	}
+	for i := range suites {
+		s := &suites[i]
+		kept := s.TestCases[:0]
+		for _, t := range s.TestCases {
+			for _, tag := range testTags(&t) {
+				if want[tag] {
+					kept = append(kept, t)
+					break
+				}
+			}
+		}
+		s.TestCases = kept
+	}
+	return dropSuites(suites, "no tests with the tags of -only-tags", func(s *TestSuite) bool { return len(s.TestCases) == 0 })
+}
@@ -0,0 +1,138 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// teamcityEscaper escapes the values of TeamCity service messages.
+var teamcityEscaper = strings.NewReplacer(
+	"|", "||",
+	"'", "|'",
+	"\n", "|n",
+	"\r", "|r",
+	"[", "|[",
+	"]", "|]",
+	"\u0085", "|x",
+	"\u2028", "|l",
+	"\u2029", "|p",
+)
+
+// WriteTeamCity writes suites to w as TeamCity service messages, which
+// TeamCity turns into test results when they appear in a build log.
+func WriteTeamCity(suites []TestSuite, w io.Writer) error {
+	for i := range suites {
+		if err := writeTeamCitySuite(&suites[i], w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTeamCitySuite writes the service messages of a single suite and
+// flushes them, so that a suite streamed to the build log shows up at once.
+func writeTeamCitySuite(s *TestSuite, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	name := suiteKey(s)
+	teamcityMessage(bw, "testSuiteStarted", "name", name)
+	for i := range s.TestCases {
+		teamcityMessage(bw, "testStarted", "name", s.TestCases[i].Name, "captureStandardOutput", "false")
+		writeTeamCityResult(bw, &s.TestCases[i])
+	}
+	teamcityMessage(bw, "testSuiteFinished", "name", name)
+	return bw.Flush()
+}
+
+// writeTeamCityResult writes the service messages of a test that ran, from
+// its output to its testFinished message.
+func writeTeamCityResult(w io.Writer, t *TestCase) {
+	if t.Output.Len() > 0 {
+		teamcityMessage(w, "testStdOut", "name", t.Name, "out", t.Output.String())
+	}
+	if t.Stderr.Len() > 0 {
+		teamcityMessage(w, "testStdErr", "name", t.Name, "out", t.Stderr.String())
+	}
+	switch t.Status {
+	case Failure, Error:
+		teamcityMessage(w, "testFailed", "name", t.Name, "message", messageOf(t), "details", t.Output.String())
+	case Skipped:
+		teamcityMessage(w, "testIgnored", "name", t.Name, "message", messageOf(t))
+	}
+	teamcityMessage(w, "testFinished", "name", t.Name, "duration", fmt.Sprint(t.Duration.Milliseconds()))
+}
+
+// teamcityMessage writes a service message with attributes given as pairs of
+// names and values.
+func teamcityMessage(w io.Writer, name string, attrs ...string) {
+	fmt.Fprintf(w, "##teamcity[%s", name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		fmt.Fprintf(w, " %s='%s'", attrs[i], teamcityEscaper.Replace(attrs[i+1]))
+	}
+	fmt.Fprintln(w, "]")
+}
+
+// teamcityStream streams service messages as the input is read: the
+// testStarted message of a test as soon as it starts and the rest as soon
+// as it finishes, so that TeamCity shows the test running and attributes to
+// it the lines -tee copies to the build log in between.
+type teamcityStream struct {
+	w        io.Writer
+	open     map[string]bool // suites whose testSuiteStarted was written
+	started  streamedTests
+	finished streamedTests
+}
+
+func newTeamCityStream(w io.Writer) streamWriter {
+	return &teamcityStream{w: w, open: make(map[string]bool), started: make(streamedTests), finished: make(streamedTests)}
+}
+
+func (ts *teamcityStream) startSuite(w io.Writer, s *TestSuite) {
+	if name := suiteKey(s); !ts.open[name] {
+		ts.open[name] = true
+		teamcityMessage(w, "testSuiteStarted", "name", name)
+	}
+}
+
+func (ts *teamcityStream) TestStarted(s *TestSuite, t *TestCase) error {
+	bw := bufio.NewWriter(ts.w)
+	ts.startSuite(bw, s)
+	teamcityMessage(bw, "testStarted", "name", t.Name, "captureStandardOutput", "false")
+	ts.started.add(s, t)
+	return bw.Flush()
+}
+
+func (ts *teamcityStream) TestFinished(s *TestSuite, t *TestCase) error {
+	bw := bufio.NewWriter(ts.w)
+	ts.startSuite(bw, s)
+	if !ts.started.take(s, t) {
+		teamcityMessage(bw, "testStarted", "name", t.Name, "captureStandardOutput", "false")
+	}
+	writeTeamCityResult(bw, t)
+	ts.finished.add(s, t)
+	return bw.Flush()
+}
+
+func (ts *teamcityStream) SuiteEnded(s *TestSuite) error {
+	bw := bufio.NewWriter(ts.w)
+	ts.startSuite(bw, s)
+	for i := range s.TestCases {
+		t := &s.TestCases[i]
+		if ts.finished.take(s, t) {
+			continue
+		}
+		if !ts.started.take(s, t) {
+			teamcityMessage(bw, "testStarted", "name", t.Name, "captureStandardOutput", "false")
+		}
+		writeTeamCityResult(bw, t)
+	}
+	name := suiteKey(s)
+	teamcityMessage(bw, "testSuiteFinished", "name", name)
+	delete(ts.open, name)
+	return bw.Flush()
+}
@@ -0,0 +1,56 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"os"
+	"text/template"
+	"time"
+)
+
+// ReportData is the value report templates are executed with.
+type ReportData struct {
+	Generator string
+	Counts    Counts
+	Suites    []TestSuite
+}
+
+// ReportFuncs are the functions available to report templates in addition
+// to the predefined ones of text/template:
+//
+//	seconds  the seconds in a time.Duration, as a float64
+//	message  the message of a test case, as in the failure message of JUnit
+//	counts   the Counts of a suite
+var ReportFuncs = template.FuncMap{
+	"seconds": func(d time.Duration) float64 { return d.Seconds() },
+	"message": func(t TestCase) string { return messageOf(&t) },
+	"counts": func(s TestSuite) Counts {
+		var c Counts
+		c.Add(&s)
+		return c
+	},
+}
+
+// ParseReportTemplate parses a report template from the named file.
+func ParseReportTemplate(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path).Funcs(ReportFuncs).Parse(string(text))
+}
+
+// TemplateWriter returns a function writing reports with tmpl, which is
+// executed with a ReportData.
+func TemplateWriter(tmpl *template.Template) func([]TestSuite, io.Writer) error {
+	return func(suites []TestSuite, w io.Writer) error {
+		data := ReportData{Generator: "gojunit v" + Version, Suites: suites}
+		for i := range suites {
+			data.Counts.Add(&suites[i])
+		}
+		return tmpl.Execute(w, data)
+	}
+}
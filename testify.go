@@ -0,0 +1,134 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+)
+
+// An Assertion is a failed assertion of the testify assert or require
+// packages, parsed from the block they log:
+//
+//	foo_test.go:12:
+//		Error Trace:	/src/foo_test.go:12
+//		Error:      	Not equal:
+//		            	expected: 1
+//		            	actual  : 2
+//		Test:       	TestFoo
+//		Messages:   	counting foos
+type Assertion struct {
+	Trace    string `json:"trace,omitempty"`
+	Error    string `json:"error"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Diff     string `json:"diff,omitempty"`
+	Messages string `json:"messages,omitempty"`
+}
+
+// Message returns a one line summary of a.
+func (a *Assertion) Message() string {
+	msg := strings.TrimSuffix(strings.TrimSpace(firstLine(a.Error)), ":")
+	if a.Expected != "" || a.Actual != "" {
+		msg += ": expected " + a.Expected + ", actual " + a.Actual
+	}
+	if a.Messages != "" {
+		msg += " (" + firstLine(a.Messages) + ")"
+	}
+	return msg
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// ParseAssertion returns the first testify assertion logged in output, or
+// nil if there is none.
+func ParseAssertion(output string) *Assertion {
+	lines := strings.Split(output, "\n")
+	for i, l := range lines {
+		if label, _, ok := assertionField(l); ok && label == "Error Trace" {
+			return parseAssertionBlock(lines[i:])
+		}
+	}
+	return nil
+}
+
+// assertionField splits a line of an assertion block into its label, if it
+// has one, and its content. Labelled lines are indented by a tab and have
+// the label and the content separated by a colon, padding and a tab;
+// continuation lines have blank padding in place of the label.
+func assertionField(line string) (label, content string, ok bool) {
+	i := strings.IndexByte(line, '\t')
+	if i < 0 || strings.TrimLeft(line[:i], " ") != "" {
+		return "", "", false
+	}
+	rest := line[i+1:]
+	j := strings.IndexByte(rest, '\t')
+	if j < 0 {
+		return "", "", false
+	}
+	label = strings.TrimSpace(rest[:j])
+	if label != "" && !strings.HasSuffix(label, ":") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(label, ":"), rest[j+1:], true
+}
+
+func parseAssertionBlock(lines []string) *Assertion {
+	fields := make(map[string]*[]string)
+	var cur *[]string
+	for _, l := range lines {
+		label, content, ok := assertionField(l)
+		if !ok {
+			if strings.TrimSpace(l) == "" && cur != nil {
+				*cur = append(*cur, "")
+				continue
+			}
+			break
+		}
+		if label != "" {
+			if _, seen := fields[label]; seen {
+				break
+			}
+			cur = new([]string)
+			fields[label] = cur
+		}
+		*cur = append(*cur, content)
+	}
+	get := func(label string) string {
+		if f := fields[label]; f != nil {
+			return strings.TrimSpace(strings.Join(*f, "\n"))
+		}
+		return ""
+	}
+	a := &Assertion{
+		Trace:    get("Error Trace"),
+		Error:    get("Error"),
+		Messages: get("Messages"),
+	}
+	// The diff of Equal and friends is part of the Error field.
+	var errLines []string
+	for _, l := range strings.Split(a.Error, "\n") {
+		t := strings.TrimSpace(l)
+		switch {
+		case a.Diff != "":
+			a.Diff += "\n" + l
+		case strings.HasPrefix(t, "expected:"):
+			a.Expected = strings.TrimSpace(strings.TrimPrefix(t, "expected:"))
+		case strings.HasPrefix(t, "actual") && strings.HasPrefix(strings.TrimLeft(t[len("actual"):], " "), ":"):
+			a.Actual = strings.TrimSpace(t[strings.Index(t, ":")+1:])
+		case t == "Diff:":
+			a.Diff = "\n"
+		default:
+			errLines = append(errLines, l)
+		}
+	}
+	a.Diff = strings.TrimSpace(a.Diff)
+	a.Error = strings.TrimSpace(strings.Join(errLines, "\n"))
+	return a
+}
@@ -0,0 +1,154 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string // of go test -v
+		want        *Assertion
+		wantMessage string
+	}{
+		{
+			"equal",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:12: \n" +
+				"        \tError Trace:\t/src/foo_test.go:12\n" +
+				"        \tError:      \tNot equal: \n" +
+				"        \t            \texpected: 1\n" +
+				"        \t            \tactual  : 2\n" +
+				"        \tTest:       \tTestFoo\n" +
+				"        \tMessages:   \tcounting foos\n" +
+				"--- FAIL: TestFoo (0.00s)\n",
+			&Assertion{Trace: "/src/foo_test.go:12", Error: "Not equal:", Expected: "1", Actual: "2", Messages: "counting foos"},
+			"Not equal: expected 1, actual 2 (counting foos)",
+		},
+		{
+			"diff",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:20: \n" +
+				"        \tError Trace:\t/src/foo_test.go:20\n" +
+				"        \tError:      \tNot equal: \n" +
+				"        \t            \texpected: []string{\"a\"}\n" +
+				"        \t            \tactual  : []string{\"b\"}\n" +
+				"        \t            \t\n" +
+				"        \t            \tDiff:\n" +
+				"        \t            \t--- Expected\n" +
+				"        \t            \t+++ Actual\n" +
+				"        \t            \t@@ -1,3 +1,3 @@\n" +
+				"        \t            \t (string) (len=1) {\n" +
+				"        \t            \t- (string) \"a\"\n" +
+				"        \t            \t+ (string) \"b\"\n" +
+				"        \t            \t }\n" +
+				"        \tTest:       \tTestFoo\n" +
+				"--- FAIL: TestFoo (0.00s)\n",
+			&Assertion{
+				Trace:    "/src/foo_test.go:20",
+				Error:    "Not equal:",
+				Expected: `[]string{"a"}`,
+				Actual:   `[]string{"b"}`,
+				Diff:     "--- Expected\n+++ Actual\n@@ -1,3 +1,3 @@\n (string) (len=1) {\n- (string) \"a\"\n+ (string) \"b\"\n }",
+			},
+			`Not equal: expected []string{"a"}, actual []string{"b"}`,
+		},
+		{
+			"require",
+			"=== RUN   TestOpen\n" +
+				"    open_test.go:8: \n" +
+				"        \tError Trace:\t/src/open_test.go:8\n" +
+				"        \tError:      \tReceived unexpected error:\n" +
+				"        \t            \topen x: no such file or directory\n" +
+				"        \tTest:       \tTestOpen\n" +
+				"--- FAIL: TestOpen (0.00s)\n",
+			&Assertion{Trace: "/src/open_test.go:8", Error: "Received unexpected error:\nopen x: no such file or directory"},
+			"Received unexpected error",
+		},
+		{
+			// The output of a test cut short, as by a timeout, ends in the
+			// middle of the block, and the test has the message of the
+			// missing result.
+			"truncated",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:12: \n" +
+				"        \tError Trace:\t/src/foo_test.go:12\n" +
+				"        \tError:      \tNot equal: \n" +
+				"        \t            \texpected: 1\n",
+			&Assertion{Trace: "/src/foo_test.go:12", Error: "Not equal:", Expected: "1"},
+			"no result recorded",
+		},
+		{
+			"trace only",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:12: \n" +
+				"        \tError Trace:\t/src/foo_test.go:12\n" +
+				"--- FAIL: TestFoo (0.00s)\n",
+			&Assertion{Trace: "/src/foo_test.go:12"},
+			"",
+		},
+		{
+			// A repeated label starts another assertion, which is left out.
+			"two assertions",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:12: \n" +
+				"        \tError Trace:\t/src/foo_test.go:12\n" +
+				"        \tError:      \tShould be true\n" +
+				"    foo_test.go:13: \n" +
+				"        \tError Trace:\t/src/foo_test.go:13\n" +
+				"        \tError:      \tShould be false\n" +
+				"--- FAIL: TestFoo (0.00s)\n",
+			&Assertion{Trace: "/src/foo_test.go:12", Error: "Should be true"},
+			"Should be true",
+		},
+		{
+			// Without the tab separating the label from the content, the
+			// lines are not those of an assertion.
+			"malformed",
+			"=== RUN   TestFoo\n" +
+				"    foo_test.go:12: \n" +
+				"        Error Trace: /src/foo_test.go:12\n" +
+				"        Error: Not equal\n" +
+				"--- FAIL: TestFoo (0.00s)\n",
+			nil,
+			"",
+		},
+		{
+			"t.Error",
+			"=== RUN   TestFoo\n    foo_test.go:12: got 2, want 1\n--- FAIL: TestFoo (0.00s)\n",
+			nil,
+			"got 2, want 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suites, _, err := junit.ParseOutput(strings.NewReader(tt.output + "FAIL\nFAIL\tx/m\t0.01s\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suites) != 1 || len(suites[0].TestCases) != 1 {
+				t.Fatalf("got %v, want one suite with one test", suites)
+			}
+			tc := &suites[0].TestCases[0]
+			got := ParseAssertion(tc.Output.String())
+			switch {
+			case got == nil && tt.want != nil:
+				t.Errorf("no assertion in %q, want %+v", tc.Output.String(), *tt.want)
+			case got != nil && tt.want == nil:
+				t.Errorf("assertion %+v, want none", *got)
+			case got != nil && *got != *tt.want:
+				t.Errorf("assertion\n%+v\nwant\n%+v", *got, *tt.want)
+			}
+			if msg := messageOf(tc); msg != tt.wantMessage {
+				t.Errorf("message %q, want %q", msg, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kisielk/gojunit/junit"
+)
+
+// timingBuckets are the upper bounds of the buckets of duration histograms,
+// but for the last bucket, which holds the longer durations.
+var timingBuckets = []time.Duration{
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// Timing holds statistics of the durations of the top-level tests of one or
+// more suites. Subtests are left out: their time is part of that of their
+// parents.
+type Timing struct {
+	Tests         int
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+	Sum           time.Duration // summed time of the tests
+	Wall          time.Duration // summed time of the suites
+	Histogram     []int         // number of tests in each of timingBuckets and above
+	Concurrency   int           // most tests running at once, if their times are known
+}
+
+// testTimes returns the start and end of t, either of which is zero if it
+// is not known.
+func testTimes(t *TestCase) (start, end time.Time) {
+	start, _ = time.Parse(junit.TimeLayout, t.Property("timestamp"))
+	end, _ = time.Parse(junit.TimeLayout, t.Property("end_timestamp"))
+	return start, end
+}
+
+// TimingOf returns the Timing of suites.
+func TimingOf(suites ...*TestSuite) Timing {
+	t := Timing{Histogram: make([]int, len(timingBuckets)+1)}
+	var d []time.Duration
+	var edges []edge
+	for _, s := range suites {
+		t.Wall += s.Duration
+		for i := range s.TestCases {
+			tc := &s.TestCases[i]
+			if strings.Contains(tc.Name, "/") || junit.IsSuiteError(tc.Name) {
+				continue
+			}
+			d = append(d, tc.Duration)
+			if start, end := testTimes(tc); !start.IsZero() && !end.IsZero() {
+				edges = append(edges, edge{start, 1}, edge{end, -1})
+			}
+			t.Sum += tc.Duration
+			t.Histogram[sort.Search(len(timingBuckets), func(i int) bool { return tc.Duration < timingBuckets[i] })]++
+		}
+	}
+	if t.Tests = len(d); t.Tests == 0 {
+		return t
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	t.P50, t.P90, t.P99 = percentile(d, 50), percentile(d, 90), percentile(d, 99)
+	t.Max = d[len(d)-1]
+	t.Concurrency = concurrency(edges)
+	return t
+}
+
+// An edge is the start, 1, or end, -1, of a test.
+type edge struct {
+	at time.Time
+	n  int
+}
+
+// concurrency returns the most tests running at once by the edges of
+// their runs. A test ending when another starts does not overlap it.
+func concurrency(edges []edge) int {
+	sort.Slice(edges, func(i, j int) bool {
+		if !edges[i].at.Equal(edges[j].at) {
+			return edges[i].at.Before(edges[j].at)
+		}
+		return edges[i].n < edges[j].n
+	})
+	most, n := 0, 0
+	for _, e := range edges {
+		if n += e.n; n > most {
+			most = n
+		}
+	}
+	return most
+}
+
+// percentile returns the pth percentile of the sorted durations d, by the
+// nearest rank method.
+func percentile(d []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p/100*float64(len(d)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return d[i]
+}
+
+// Parallelism returns the summed time of the tests over that of the suites:
+// below 1, the suites spend time outside of their tests, or run them one at a
+// time; above 1, tests run in parallel.
+func (t Timing) Parallelism() float64 {
+	if t.Wall == 0 {
+		return 0
+	}
+	return float64(t.Sum) / float64(t.Wall)
+}
+
+// BucketLabels returns the labels of the buckets of t.Histogram.
+func (Timing) BucketLabels() []string {
+	labels := make([]string, 0, len(timingBuckets)+1)
+	for _, b := range timingBuckets {
+		labels = append(labels, "<"+shortDuration(b))
+	}
+	return append(labels, ">="+shortDuration(timingBuckets[len(timingBuckets)-1]))
+}
+
+func (t Timing) String() string {
+	s := fmt.Sprintf("p50 %v, p90 %v, p99 %v, max %v; tests %v in %v (%.1fx parallel)",
+		round(t.P50), round(t.P90), round(t.P99), round(t.Max), round(t.Sum), round(t.Wall), t.Parallelism())
+	if t.Concurrency > 0 {
+		s += fmt.Sprintf(", at most %d at once", t.Concurrency)
+	}
+	return s
+}
+
+// histogramString returns t.Histogram as text, as in "<1ms 12, <10ms 3".
+func (t Timing) histogramString() string {
+	var parts []string
+	for i, l := range t.BucketLabels() {
+		parts = append(parts, fmt.Sprintf("%s %d", l, t.Histogram[i]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
+
+// shortDuration returns d as in time.Duration.String, without the zero
+// minutes and seconds of whole hours and minutes.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	return s
+}
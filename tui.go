@@ -0,0 +1,534 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// tuiMain runs gojunit tui, which browses the suites of reports in the
+// terminal.
+func tuiMain(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: gojunit tui [flags] report...")
+		fs.PrintDefaults()
+		fmt.Fprint(fs.Output(), tuiKeysHelp)
+	}
+	failures := fs.Bool("failures", false, "list only the failed tests at first")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(exitParse)
+	}
+	var suites []TestSuite
+	for _, name := range fs.Args() {
+		s, err := readReport(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "gojunit tui:", err)
+			os.Exit(exitParse)
+		}
+		suites = append(suites, s...)
+	}
+	t := newTUI(suites)
+	t.failuresOnly = *failures
+	if err := t.run(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "gojunit tui:", err)
+		os.Exit(exitInfra)
+	}
+}
+
+const tuiKeysHelp = `
+Keys:
+  up, down, k, j   move, or scroll the output
+  pgup, pgdown     move, or scroll the output, by a page
+  enter            list the tests of a suite, or show the output of a test
+  /                filter the tests by name, or search the output
+  n                go to the next match of the search in the output
+  f                list only the failed tests, or all of them
+  r                run the selected test, or the tests of the selected suite, again
+  q, esc           go back from the output, or quit
+`
+
+// A tuiRow is a line of the list of a tui: a suite, or one of its tests.
+type tuiRow struct {
+	suite int
+	test  int // -1 for the suite
+}
+
+// A tui is the state of gojunit tui, kept apart from the terminal.
+type tui struct {
+	suites       []TestSuite
+	expanded     map[int]bool // suites whose tests are listed
+	failuresOnly bool
+	filter       string // lists only the tests whose names contain it
+
+	rows []tuiRow
+	sel  int // selected row
+	top  int // first row shown
+
+	// The output of a test, while it is shown.
+	viewing bool
+	view    tuiRow
+	lines   []string
+	scroll  int
+	search  string
+
+	// prompt is "/" while the filter or search is typed into input.
+	prompt string
+	input  string
+
+	message       string // shown at the bottom until the next key
+	width, height int
+}
+
+func newTUI(suites []TestSuite) *tui {
+	t := &tui{suites: suites, expanded: make(map[int]bool), width: 80, height: 24}
+	// Suites with failures are opened, as they are the ones to look into.
+	for i := range suites {
+		if suiteFailures(&suites[i]) > 0 {
+			t.expanded[i] = true
+		}
+	}
+	t.layout()
+	return t
+}
+
+// suiteFailures returns the number of tests of s that failed or had errors.
+func suiteFailures(s *TestSuite) int {
+	n := 0
+	for _, tc := range s.TestCases {
+		if tc.Status == Failure || tc.Status == Error {
+			n++
+		}
+	}
+	return n
+}
+
+// layout lists the rows shown by the filters, keeping the selected row if it
+// is still listed.
+func (t *tui) layout() {
+	sel := tuiRow{0, -1}
+	if t.sel < len(t.rows) {
+		sel = t.rows[t.sel]
+	}
+	t.rows = t.rows[:0]
+	t.sel = 0
+	for i := range t.suites {
+		s := &t.suites[i]
+		var tests []tuiRow
+		for j, tc := range s.TestCases {
+			if t.failuresOnly && tc.Status != Failure && tc.Status != Error {
+				continue
+			}
+			if t.filter != "" && !strings.Contains(strings.ToLower(tc.Name), strings.ToLower(t.filter)) {
+				continue
+			}
+			tests = append(tests, tuiRow{i, j})
+		}
+		if len(tests) == 0 && (t.failuresOnly || t.filter != "") {
+			continue
+		}
+		t.rows = append(t.rows, tuiRow{i, -1})
+		if t.expanded[i] || t.filter != "" {
+			t.rows = append(t.rows, tests...)
+		}
+	}
+	for i, r := range t.rows {
+		if r == sel {
+			t.sel = i
+		}
+	}
+}
+
+// key handles a key, as named by readKey, and reports whether to quit.
+func (t *tui) key(k string) bool {
+	t.message = ""
+	if t.prompt != "" {
+		t.promptKey(k)
+		return false
+	}
+	if k == "ctrl-c" {
+		return true
+	}
+	if t.viewing {
+		return t.viewKey(k)
+	}
+	page := t.height - 3
+	switch k {
+	case "q", "esc":
+		return true
+	case "up", "k":
+		t.move(-1)
+	case "down", "j":
+		t.move(1)
+	case "pgup":
+		t.move(-page)
+	case "pgdown", " ":
+		t.move(page)
+	case "enter":
+		if len(t.rows) == 0 {
+			break
+		}
+		r := t.rows[t.sel]
+		if r.test < 0 {
+			t.expanded[r.suite] = !t.expanded[r.suite]
+			t.layout()
+		} else {
+			t.open(r)
+		}
+	case "f":
+		t.failuresOnly = !t.failuresOnly
+		t.layout()
+	case "/":
+		t.prompt, t.input = "/", t.filter
+	case "r":
+		if len(t.rows) > 0 {
+			t.rerun(t.rows[t.sel])
+		}
+	}
+	return false
+}
+
+// viewKey handles a key while the output of a test is shown.
+func (t *tui) viewKey(k string) bool {
+	page := t.height - 3
+	switch k {
+	case "q", "esc", "backspace":
+		t.viewing = false
+	case "up", "k":
+		t.scrollBy(-1)
+	case "down", "j":
+		t.scrollBy(1)
+	case "pgup":
+		t.scrollBy(-page)
+	case "pgdown", " ":
+		t.scrollBy(page)
+	case "/":
+		t.prompt, t.input = "/", t.search
+	case "n":
+		t.next(t.scroll + 1)
+	case "r":
+		t.rerun(t.view)
+	}
+	return false
+}
+
+// promptKey handles a key while the filter or search is typed.
+func (t *tui) promptKey(k string) {
+	switch k {
+	case "esc", "ctrl-c":
+		t.prompt = ""
+	case "enter":
+		t.prompt = ""
+		if t.viewing {
+			t.search = t.input
+			t.next(t.scroll)
+		} else {
+			t.filter = t.input
+			t.layout()
+		}
+	case "backspace":
+		if t.input != "" {
+			t.input = t.input[:len(t.input)-1]
+		}
+	default:
+		if len(k) == 1 {
+			t.input += k
+		}
+	}
+}
+
+func (t *tui) move(n int) {
+	t.sel = clamp(t.sel+n, 0, len(t.rows)-1)
+}
+
+func (t *tui) scrollBy(n int) {
+	t.scroll = clamp(t.scroll+n, 0, len(t.lines)-1)
+}
+
+func clamp(n, lo, hi int) int {
+	if n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+	return n
+}
+
+// open shows the output of the test of r.
+func (t *tui) open(r tuiRow) {
+	tc := &t.suites[r.suite].TestCases[r.test]
+	t.viewing, t.view, t.scroll = true, r, 0
+	t.lines = t.lines[:0]
+	if tc.Message != "" {
+		t.lines = append(t.lines, tc.Message, "")
+	}
+	out := strings.TrimRight(tc.Output.String(), "\n")
+	if err := strings.TrimRight(tc.Stderr.String(), "\n"); err != "" {
+		out += "\n" + err
+	}
+	t.lines = append(t.lines, strings.Split(out, "\n")...)
+	if t.search != "" {
+		t.next(0)
+	}
+}
+
+// next scrolls the output to the first line from the i-th on that matches the
+// search.
+func (t *tui) next(i int) {
+	if t.search == "" {
+		return
+	}
+	for ; i < len(t.lines); i++ {
+		if strings.Contains(t.lines[i], t.search) {
+			t.scroll = i
+			return
+		}
+	}
+	t.message = fmt.Sprintf("%q not found", t.search)
+}
+
+// rerunArgs returns the package and go test flags running the test of s
+// with index test again, or all of its tests if test is negative. The
+// package is the name of s without the label of its matrix entry.
+func rerunArgs(s *TestSuite, test int) (patterns, args []string) {
+	if test >= 0 {
+		args = []string{"-test.run", runPattern(s.TestCases[test].Name)}
+	}
+	return []string{suitePackage(s)}, args
+}
+
+// rerun runs the test of r again, or the tests of its suite, and replaces
+// its results with those of the new run.
+func (t *tui) rerun(r tuiRow) {
+	s := &t.suites[r.suite]
+	patterns, args := rerunArgs(s, r.test)
+	suites, _, err := RunTestsContext(context.Background(), patterns, args)
+	if err == nil && len(suites) == 0 {
+		err = errors.New("no results")
+	}
+	if err != nil {
+		t.message = fmt.Sprintf("run %s: %v", s.Name, err)
+		return
+	}
+	if r.test < 0 {
+		// The suite run again keeps the name and label it was shown with.
+		name, label := s.Name, s.Property("label")
+		*s = suites[0]
+		s.Name = name
+		if label != "" {
+			s.SetProperty("label", label)
+		}
+		t.message = fmt.Sprintf("ran %s again: %d failed", s.Name, suiteFailures(s))
+		t.layout()
+		return
+	}
+	name := s.TestCases[r.test].Name
+	for _, tc := range suites[0].TestCases {
+		if tc.Name == name {
+			s.TestCases[r.test] = tc
+			t.message = fmt.Sprintf("ran %s again: %s", name, tuiStatus(tc.Status))
+			if t.viewing {
+				t.open(r)
+			}
+			return
+		}
+	}
+	t.message = fmt.Sprintf("ran %s again: it did not run", name)
+}
+
+func tuiStatus(s Status) string {
+	switch s {
+	case Success:
+		return "PASS"
+	case Failure:
+		return "FAIL"
+	case Error:
+		return "ERROR"
+	}
+	return "SKIP"
+}
+
+// render writes a screen of t to w.
+func (t *tui) render(w io.Writer) {
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1b[2J")
+	body := t.height - 2
+	if t.viewing {
+		s := &t.suites[t.view.suite]
+		tc := &s.TestCases[t.view.test]
+		t.line(&b, fmt.Sprintf("%s %s.%s (%v)", tuiStatus(tc.Status), s.Name, tc.Name, tc.Duration), true)
+		for i := t.scroll; i < len(t.lines) && i < t.scroll+body; i++ {
+			t.line(&b, t.lines[i], t.search != "" && strings.Contains(t.lines[i], t.search))
+		}
+		for i := len(t.lines) - t.scroll; i < body; i++ {
+			b.WriteString("\r\n")
+		}
+	} else {
+		tests, failed := 0, 0
+		for i := range t.suites {
+			tests += len(t.suites[i].TestCases)
+			failed += suiteFailures(&t.suites[i])
+		}
+		head := fmt.Sprintf("%d suites, %d tests, %d failed", len(t.suites), tests, failed)
+		if t.failuresOnly {
+			head += " (failures only)"
+		}
+		if t.filter != "" {
+			head += fmt.Sprintf(" (matching %q)", t.filter)
+		}
+		t.line(&b, head, true)
+		if t.sel < t.top {
+			t.top = t.sel
+		}
+		if t.sel >= t.top+body {
+			t.top = t.sel - body + 1
+		}
+		for i := t.top; i < len(t.rows) && i < t.top+body; i++ {
+			t.line(&b, t.rowText(t.rows[i]), i == t.sel)
+		}
+		for i := len(t.rows) - t.top; i < body; i++ {
+			b.WriteString("\r\n")
+		}
+	}
+	switch {
+	case t.prompt != "":
+		b.WriteString(t.prompt + t.input)
+	case t.message != "":
+		b.WriteString(fitWidth(t.message, t.width))
+	default:
+		b.WriteString(fitWidth("q quit  enter open  / search  f failures  r run again", t.width))
+	}
+	w.Write(b.Bytes())
+}
+
+// line writes a line of the screen, in reverse video if highlighted.
+func (t *tui) line(b *bytes.Buffer, s string, highlight bool) {
+	s = fitWidth(strings.ReplaceAll(s, "\t", "    "), t.width)
+	if highlight {
+		s = "\x1b[7m" + s + "\x1b[0m"
+	}
+	b.WriteString(s + "\r\n")
+}
+
+// fitWidth returns s cut to at most width runes.
+func fitWidth(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+func (t *tui) rowText(r tuiRow) string {
+	s := &t.suites[r.suite]
+	if r.test < 0 {
+		mark := "+"
+		if t.expanded[r.suite] || t.filter != "" {
+			mark = "-"
+		}
+		return fmt.Sprintf("%s %s  %d tests, %d failed  %v", mark, s.Name, len(s.TestCases), suiteFailures(s), s.Duration)
+	}
+	tc := &s.TestCases[r.test]
+	return fmt.Sprintf("    %-5s %s  %v", tuiStatus(tc.Status), tc.Name, tc.Duration)
+}
+
+// run shows t in the terminal in and out until it quits. The terminal is
+// put into raw mode with stty, and restored at the end.
+func (t *tui) run(in *os.File, out io.Writer) error {
+	if fi, err := in.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("standard input is not a terminal")
+	}
+	saved, err := stty(in, "-g")
+	if err != nil {
+		return fmt.Errorf("stty: %v", err)
+	}
+	if _, err := stty(in, "raw", "-echo"); err != nil {
+		return fmt.Errorf("stty: %v", err)
+	}
+	defer stty(in, saved)
+	io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+	defer io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+	keys := bufio.NewReader(in)
+	for {
+		if size, err := stty(in, "size"); err == nil {
+			if f := strings.Fields(size); len(f) == 2 {
+				t.height, _ = strconv.Atoi(f[0])
+				t.width, _ = strconv.Atoi(f[1])
+			}
+		}
+		t.render(out)
+		k, err := readKey(keys)
+		if err != nil {
+			return err
+		}
+		if k == "r" && t.prompt == "" && (t.viewing || len(t.rows) > 0) {
+			io.WriteString(out, "\r\x1b[2Krunning...")
+		}
+		if t.key(k) {
+			return nil
+		}
+	}
+}
+
+func stty(in *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = in
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// readKey reads a key press from a terminal in raw mode, returning it as
+// typed, or named, as in "up", "enter" or "ctrl-c".
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\x1b':
+		// The rest of an escape sequence is read along with its start.
+		if r.Buffered() == 0 {
+			return "esc", nil
+		}
+		seq := []byte{c}
+		for r.Buffered() > 0 {
+			c, _ := r.ReadByte()
+			seq = append(seq, c)
+			if len(seq) > 2 && (c >= 'A' && c <= 'Z' || c == '~') {
+				break
+			}
+		}
+		switch string(seq) {
+		case "\x1b[A":
+			return "up", nil
+		case "\x1b[B":
+			return "down", nil
+		case "\x1b[5~":
+			return "pgup", nil
+		case "\x1b[6~":
+			return "pgdown", nil
+		}
+		return "esc", nil
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, '\b':
+		return "backspace", nil
+	case 3:
+		return "ctrl-c", nil
+	}
+	return string(c), nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRerunArgs(t *testing.T) {
+	labeled := TestSuite{Name: "x/m [linux]", Properties: []Property{{Name: "label", Value: "linux"}}, TestCases: []TestCase{{Name: "TestA/sub.1"}}}
+	plain := TestSuite{Name: "x/m", TestCases: []TestCase{{Name: "TestB"}}}
+	tests := []struct {
+		s            *TestSuite
+		test         int
+		wantPatterns string
+		wantArgs     string
+	}{
+		{&labeled, -1, "x/m", ""},
+		{&labeled, 0, "x/m", `-test.run ^TestA$/^sub\.1$`},
+		{&plain, -1, "x/m", ""},
+		{&plain, 0, "x/m", "-test.run ^TestB$"},
+	}
+	for _, tt := range tests {
+		patterns, args := rerunArgs(tt.s, tt.test)
+		if got := strings.Join(patterns, " "); got != tt.wantPatterns {
+			t.Errorf("rerunArgs(%s, %d) patterns = %q, want %q", tt.s.Name, tt.test, got, tt.wantPatterns)
+		}
+		if got := strings.Join(args, " "); got != tt.wantArgs {
+			t.Errorf("rerunArgs(%s, %d) args = %q, want %q", tt.s.Name, tt.test, got, tt.wantArgs)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The pages of the gojunit serve web UI share the style and the suites
+// template of WriteHTML.
+var uiTemplate = template.Must(template.Must(htmlTemplate.Clone()).Funcs(template.FuncMap{
+	"add":   func(a, b int) int { return a + b },
+	"short": shortCommit,
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>` + htmlStyle + `</style>
+</head>
+<body>
+<p><a href="/">Runs</a></p>
+<h1>{{.}}</h1>
+{{end}}
+
+{{define "index"}}{{template "header" "Runs"}}
+<table>
+<tr><th>Run</th><th>Created</th><th>Commit</th><th>Suites</th><th>Results</th></tr>
+{{range .}}
+<tr>
+<td><a href="/view/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Created.Format "2006-01-02 15:04:05"}}</td>
+<td>{{short .Commit}}{{with .Branch}} <small>{{.}}</small>{{end}}</td>
+<td class="num">{{.Suites}}</td>
+<td class="{{if gt (add .Counts.Failures .Counts.Errors) 0}}failure{{else}}success{{end}}">{{.Counts}}</td>
+</tr>
+{{else}}
+<tr><td colspan="5">No runs have been posted.</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+{{end}}
+
+{{define "run"}}{{template "header" .Title}}
+<p>{{.Counts}} &mdash; <a href="/runs/{{.ID}}?format=junit">JUnit XML</a>
+<a href="/runs/{{.ID}}?format=json">JSON</a>
+<a href="/runs/{{.ID}}?format=csv">CSV</a></p>
+{{template "suites" .}}
+</body>
+</html>
+{{end}}
+
+{{define "history"}}{{template "header" .Title}}
+<table>
+<tr><th>Run</th><th>Created</th><th>Commit</th><th>Status</th><th class="num">Time</th></tr>
+{{range .Entries}}
+<tr>
+<td><a href="/view/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Created.Format "2006-01-02 15:04:05"}}</td>
+<td>{{short .Commit}}{{if .Broke}} <strong>first failure</strong>{{end}}</td>
+<td class="{{.Status}}">{{.Status}}{{with .Message}}<br><small>{{.}}</small>{{end}}</td>
+<td class="num">{{seconds .Duration}}</td>
+</tr>
+{{else}}
+<tr><td colspan="5">The test does not appear in any run.</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+{{end}}
+`))
+
+// uiRun holds the values of the run page.
+type uiRun struct {
+	htmlData
+	ID string
+}
+
+// uiHistory holds the values of the history page of a test.
+type uiHistory struct {
+	Title   string
+	Entries []uiHistoryEntry
+}
+
+type uiHistoryEntry struct {
+	ID       string
+	Created  time.Time
+	Commit   string
+	Broke    bool // whether the test passed in the previous run
+	Status   Status
+	Duration time.Duration
+	Message  string
+}
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	runs, err := s.store.List()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	var infos []runInfo
+	for _, run := range runs {
+		infos = append(infos, newRunInfo(run))
+	}
+	s.render(w, "index", infos)
+}
+
+func (s *server) view(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/view/")
+	run, err := s.store.Load(id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	suites, err := processRun(run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := uiRun{newHTMLData("Run "+run.ID, suites), run.ID}
+	data.History = true
+	s.render(w, "run", data)
+}
+
+func (s *server) history(w http.ResponseWriter, r *http.Request) {
+	suite, test := r.URL.Query().Get("suite"), r.URL.Query().Get("test")
+	runs, err := s.store.List()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	data := uiHistory{Title: suite + " " + test}
+	for _, run := range runs {
+		suites, err := processRun(run)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range suites {
+			if suiteKey(&suites[i]) != suite {
+				continue
+			}
+			for j := range suites[i].TestCases {
+				t := &suites[i].TestCases[j]
+				if t.Name != test {
+					continue
+				}
+				e := uiHistoryEntry{ID: run.ID, Created: run.Created, Status: t.Status, Duration: t.Duration}
+				e.Commit, _ = runCommit(suites)
+				if t.Status != Success {
+					e.Message = messageOf(t)
+				}
+				data.Entries = append(data.Entries, e)
+			}
+		}
+	}
+	// The runs are listed most recent first.
+	for i := 0; i+1 < len(data.Entries); i++ {
+		e := &data.Entries[i]
+		e.Broke = (e.Status == Failure || e.Status == Error) && data.Entries[i+1].Status == Success
+	}
+	s.render(w, "history", data)
+}
+
+func (s *server) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := uiTemplate.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// An upload is a report to store in a bucket, selected by -upload.
+type upload struct {
+	format string
+	scheme string // "s3" or "gs"
+	bucket string
+	key    string // with placeholders
+}
+
+// uploadKeyRE matches the placeholders in the keys of uploads.
+var uploadKeyRE = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// uploadPlaceholders are the placeholders of the keys of uploads, which are
+// replaced by uploadKey.
+var uploadPlaceholders = map[string]bool{"date": true, "time": true, "job": true, "label": true, "format": true}
+
+// parseUpload parses the value of -upload, a bucket URL optionally preceded
+// by the format of the report and "=", as in junit=s3://bucket/report.xml.
+// The placeholders are replaced in the key once it is unescaped, so that
+// their values are used as they are.
+func parseUpload(v, defaultFormat string) (upload, error) {
+	up, raw := upload{format: defaultFormat}, v
+	if i, j := strings.Index(v, "="), strings.Index(v, "://"); i > 0 && (j < 0 || i < j) {
+		up.format, raw = v[:i], v[i+1:]
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return up, fmt.Errorf("-upload %s: %v", v, err)
+	}
+	if u.Scheme != "s3" && u.Scheme != "gs" {
+		return up, fmt.Errorf("-upload %s: want s3://bucket/key or gs://bucket/key", v)
+	}
+	if u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return up, fmt.Errorf("-upload %s: escape ? and # in the key as %%3F and %%23", v)
+	}
+	up.scheme, up.bucket, up.key = u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/")
+	if up.bucket == "" || strings.Trim(up.key, "/") == "" {
+		return up, fmt.Errorf("-upload %s: no bucket or key", v)
+	}
+	for _, m := range uploadKeyRE.FindAllStringSubmatch(up.key, -1) {
+		if !uploadPlaceholders[m[1]] {
+			return up, fmt.Errorf("-upload %s: unknown placeholder %s", v, m[0])
+		}
+	}
+	return up, nil
+}
+
+// uploadKey replaces the placeholders in key: {date} and {time} by the UTC
+// date and time of now, as in 2006-01-02 and 150405, {job} by the ID of the
+// CI job, {label} by the -label of the results and {format} by the format
+// of the report. Keys starting with the date make lifecycle rules expiring
+// old reports simple to write.
+func uploadKey(key string, now time.Time, format string) string {
+	now = now.UTC()
+	return strings.NewReplacer(
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{job}", ciJobID(),
+		"{label}", *label,
+		"{format}", format,
+	).Replace(key)
+}
+
+// ciJobID returns the ID of the CI job gojunit runs in, read from the
+// variables set by common CI systems, or "local" outside of CI.
+func ciJobID() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			id += "-" + attempt
+		}
+		return id
+	}
+	for _, name := range []string{"CI_JOB_ID", "BUILDKITE_JOB_ID", "CIRCLE_WORKFLOW_JOB_ID", "TRAVIS_JOB_ID", "BUILD_ID", "BUILD_NUMBER"} {
+		if id := os.Getenv(name); id != "" {
+			return id
+		}
+	}
+	return "local"
+}
+
+// uploadReports writes suites as the reports of uploads and stores them in
+// their buckets, using the credentials of the environment. It returns the
+// uploaded objects as recorded in a manifest.
+func uploadReports(uploads []upload, suites []TestSuite) ([]ManifestFile, error) {
+	var files []ManifestFile
+	now := time.Now()
+	for _, up := range uploads {
+		write, err := writer(up.format)
+		if err != nil {
+			return files, err
+		}
+		if write == nil {
+			return files, fmt.Errorf("-upload: cannot upload a report in format %s", up.format)
+		}
+		var buf bytes.Buffer
+		if err := write(suites, &buf); err != nil {
+			return files, err
+		}
+		key := uploadKey(up.key, now, up.format)
+		contentType := contentTypes[up.format]
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		logger.Debug("uploading report", "format", up.format, "url", up.scheme+"://"+up.bucket+"/"+key)
+		if up.scheme == "s3" {
+			err = uploadS3(up.bucket, key, contentType, buf.Bytes())
+		} else {
+			err = uploadGCS(up.bucket, key, contentType, buf.Bytes())
+		}
+		if err != nil {
+			return files, err
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		files = append(files, ManifestFile{
+			Path:   up.scheme + "://" + up.bucket + "/" + key,
+			Format: up.format,
+			Size:   int64(buf.Len()),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	return files, nil
+}
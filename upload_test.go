@@ -0,0 +1,89 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseUpload(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    upload
+		wantErr string
+	}{
+		{v: "s3://b/{date}/r.xml", want: upload{"junit", "s3", "b", "{date}/r.xml"}},
+		{v: "md=gs://b/{label}/r.md", want: upload{"md", "gs", "b", "{label}/r.md"}},
+		{v: "s3://b/a%20b%3F%23/{label}.xml", want: upload{"junit", "s3", "b", "a b?#/{label}.xml"}},
+		{v: "s3://b/r.xml?x=1", wantErr: "escape ? and #"},
+		{v: "s3://b/r.xml#x", wantErr: "escape ? and #"},
+		{v: "s3://b/r%zz.xml", wantErr: "invalid URL escape"},
+		{v: "http://b/r.xml", wantErr: "want s3://bucket/key"},
+		{v: "s3://b/", wantErr: "no bucket or key"},
+		{v: "s3://b/{branch}.xml", wantErr: "unknown placeholder {branch}"},
+	}
+	for _, tt := range tests {
+		got, err := parseUpload(tt.v, "junit")
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseUpload(%q) error = %v, want %q", tt.v, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("parseUpload(%q) error = %v", tt.v, err)
+		case got != tt.want:
+			t.Errorf("parseUpload(%q) = %+v, want %+v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestUploadReportsLabel(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.EscapedPath())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "id")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer func(l string) { *label = l }(*label)
+
+	tests := []struct {
+		label    string
+		wantPath string
+		wantURL  string
+	}{
+		{"cov-50%", "/b/cov-50%25/r.xml", "s3://b/cov-50%/r.xml"},
+		{"a?b", "/b/a%3Fb/r.xml", "s3://b/a?b/r.xml"},
+		{"a#b", "/b/a%23b/r.xml", "s3://b/a#b/r.xml"},
+		{"%41", "/b/%2541/r.xml", "s3://b/%41/r.xml"},
+	}
+	up, err := parseUpload("s3://b/{label}/r.xml", "junit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		*label = tt.label
+		paths = nil
+		files, err := uploadReports([]upload{up}, []TestSuite{{Name: "p", TestCases: []TestCase{{Name: "TestA"}}}})
+		if err != nil {
+			t.Errorf("label %q: %v", tt.label, err)
+			continue
+		}
+		if len(paths) != 1 || paths[0] != tt.wantPath {
+			t.Errorf("label %q: requested %q, want %q", tt.label, paths, tt.wantPath)
+		}
+		if len(files) != 1 || files[0].Path != tt.wantURL {
+			t.Errorf("label %q: uploaded %+v, want %s", tt.label, files, tt.wantURL)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2012 Kamil Kisiel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The xmlIn types decode JUnit XML written by gojunit and by other tools,
+// which differ in whether messages are attributes or element text.
+
+type xmlInSuite struct {
+	Name       string          `xml:"name,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []PropertyXML   `xml:"properties>property"`
+	TestCases  []xmlInTestCase `xml:"testcase"`
+	TestSuites []xmlInSuite    `xml:"testsuite"`
+	SystemOut  string          `xml:"system-out"`
+}
+
+type xmlInTestCase struct {
+	Name       string        `xml:"name,attr"`
+	Classname  string        `xml:"classname,attr"`
+	Time       string        `xml:"time,attr"`
+	Properties []PropertyXML `xml:"properties>property"`
+	Failure    *xmlInMessage `xml:"failure"`
+	Error      *xmlInMessage `xml:"error"`
+	Skipped    *xmlInMessage `xml:"skipped"`
+	SystemOut  string        `xml:"system-out"`
+	SystemErr  string        `xml:"system-err"`
+}
+
+type xmlInMessage struct {
+	MessageAttr string `xml:"message,attr"`
+	MessageElem string `xml:"message"`
+	Text        string `xml:",chardata"`
+}
+
+// String returns the message and text of the element, without repeating the
+// message if the text already includes it.
+func (m *xmlInMessage) String() string {
+	if m.MessageElem != "" {
+		return m.MessageElem
+	}
+	if m.MessageAttr == "" || strings.Contains(m.Text, m.MessageAttr) {
+		return m.Text
+	}
+	if strings.TrimSpace(m.Text) == "" {
+		return m.MessageAttr
+	}
+	return m.MessageAttr + "\n" + m.Text
+}
+
+// ParseXML parses a JUnit XML report with either a <testsuites> or a
+// <testsuite> root element and returns a slice of TestSuites. Nested suites
+// are flattened, joining their names with slashes when a nested name does not
+// already include that of its parent.
+func ParseXML(r io.Reader) ([]TestSuite, []ParseWarning, error) {
+	dec := xml.NewDecoder(r)
+	var suites []TestSuite
+	var warnings []ParseWarning
+	var props []PropertyXML
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "testsuites":
+			// descend into the children
+		case "properties":
+			var p struct {
+				Properties []PropertyXML `xml:"property"`
+			}
+			if err := dec.DecodeElement(&p, &start); err != nil {
+				return nil, nil, err
+			}
+			props = append(props, p.Properties...)
+		case "testsuite":
+			var s xmlInSuite
+			if err := dec.DecodeElement(&s, &start); err != nil {
+				return nil, nil, err
+			}
+			suites = flattenXMLSuite(suites, &warnings, "", &s)
+		default:
+			return nil, nil, fmt.Errorf("unexpected element <%s> in JUnit XML", start.Name.Local)
+		}
+	}
+	// The properties of <testsuites>, such as those of the CI build, are
+	// those of every suite.
+	for i := range suites {
+		for _, p := range props {
+			suites[i].SetProperty(p.Name, p.Value)
+		}
+	}
+	return suites, warnings, nil
+}
+
+func flattenXMLSuite(suites []TestSuite, warnings *[]ParseWarning, parent string, s *xmlInSuite) []TestSuite {
+	// The reports written by gojunit are read back exactly, rather than with
+	// the guesses needed for those of other tools.
+	ours := false
+	for _, p := range s.Properties {
+		ours = ours || p.Name == "generator" && strings.HasPrefix(p.Value, "gojunit")
+	}
+	text := func(s string) string {
+		if ours {
+			return xmlControls(s)
+		}
+		return s
+	}
+	name := text(s.Name)
+	if parent != "" && !strings.HasPrefix(name, parent) {
+		name = parent + "/" + name
+	}
+	suite := TestSuite{Name: name}
+	suite.Duration = xmlSeconds(s.Time, warnings, "invalid time of suite "+name)
+	if s.Timestamp != "" {
+		ts, err := time.Parse("2006-01-02T15:04:05", s.Timestamp)
+		if err != nil {
+			ts, err = time.Parse(time.RFC3339, s.Timestamp)
+		}
+		if err != nil {
+			*warnings = append(*warnings, ParseWarning{Reason: "invalid timestamp of suite " + name, Text: s.Timestamp})
+		}
+		suite.Timestamp = ts
+	}
+	for _, p := range s.Properties {
+		suite.Properties = append(suite.Properties, Property{Name: text(p.Name), Value: text(p.Value)})
+	}
+	suite.Output.WriteString(text(s.SystemOut))
+	for _, t := range s.TestCases {
+		tc := TestCase{Name: text(t.Name), Classname: text(t.Classname)}
+		if tc.Classname == name {
+			tc.Classname = ""
+		}
+		tc.Duration = xmlSeconds(t.Time, warnings, "invalid time of test "+t.Name)
+		for _, p := range t.Properties {
+			tc.Properties = append(tc.Properties, Property{Name: text(p.Name), Value: text(p.Value)})
+		}
+		var msg *xmlInMessage
+		switch {
+		case t.Failure != nil:
+			tc.Status, msg = Failure, t.Failure
+		case t.Error != nil:
+			tc.Status, msg = Error, t.Error
+		case t.Skipped != nil:
+			tc.Status, msg = Skipped, t.Skipped
+		}
+		if ours {
+			if msg != nil {
+				tc.Message = text(msg.MessageAttr)
+			}
+			if msg != nil && tc.Status != Skipped {
+				tc.Output.WriteString(unwrapFailureBody(text(msg.Text)))
+			} else {
+				tc.Output.WriteString(text(t.SystemOut))
+			}
+			tc.Stderr.WriteString(text(t.SystemErr))
+			suite.TestCases = append(suite.TestCases, tc)
+			continue
+		}
+		if msg != nil {
+			if msg.MessageElem == "" && msg.MessageAttr != "" {
+				tc.Message = msg.MessageAttr
+			}
+			writeLine(&tc.Output, msg.String())
+		}
+		writeLine(&tc.Output, t.SystemOut)
+		writeLine(&tc.Output, t.SystemErr)
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	if len(s.TestCases) > 0 || len(s.TestSuites) == 0 {
+		suites = append(suites, suite)
+	}
+	for i := range s.TestSuites {
+		suites = flattenXMLSuite(suites, warnings, name, &s.TestSuites[i])
+	}
+	return suites
+}
+
+// writeLine writes s to buf, ending it with a newline if it is not empty.
+func writeLine(buf interface{ WriteString(string) (int, error) }, s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	buf.WriteString(s)
+	if !strings.HasSuffix(s, "\n") {
+		buf.WriteString("\n")
+	}
+}
+
+// xmlControls undoes xmlString.
+func xmlControls(s string) string {
+	if !strings.ContainsAny(s, controlPictures) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 0x2400 && r < 0x2420 && r != 0x2409 && r != 0x240a && r != 0x240d {
+			return r - 0x2400
+		}
+		return r
+	}, s)
+}
+
+// controlPictures holds the symbols xmlString replaces control characters
+// with.
+var controlPictures = func() string {
+	var b strings.Builder
+	for r := rune(0x2400); r < 0x2420; r++ {
+		if r != 0x2409 && r != 0x240a && r != 0x240d {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}()
+
+// parseDecimal parses a decimal number, accepting a comma as the decimal
+// separator, and a period or comma as the thousands separator in numbers
+// that use the other as the decimal separator, as written by tools that
+// follow the locale.
+func parseDecimal(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	f, err := strconv.ParseFloat(s, 64)
+	if err == nil {
+		return f, nil
+	}
+	dec := strings.LastIndexAny(s, ".,")
+	if dec < 0 {
+		return 0, err
+	}
+	thousands := ","
+	if s[dec] == ',' {
+		thousands = "."
+	}
+	normal := strings.ReplaceAll(s[:dec], thousands, "") + "." + s[dec+1:]
+	if f, err2 := strconv.ParseFloat(normal, 64); err2 == nil {
+		return f, nil
+	}
+	return 0, err
+}
+
+func xmlSeconds(s string, warnings *[]ParseWarning, reason string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	f, err := parseDecimal(s)
+	if err != nil {
+		*warnings = append(*warnings, ParseWarning{Reason: reason, Text: s})
+		return 0
+	}
+	return jsonElapsed(f)
+}